@@ -1,6 +1,7 @@
 package miner
 
 import (
+	"crypto/sha256"
 	"math/big"
 	"os"
 	"strconv"
@@ -61,19 +62,23 @@ const (
 	ErrAskNotFound = 40
 	// ErrInvalidSealProof signals that the passed in seal proof was invalid.
 	ErrInvalidSealProof = 41
+	// ErrPoStChallengeUnavailable signals that the challenge of the current
+	// proving period is not in the chain yet.
+	ErrPoStChallengeUnavailable = 42
 )
 
 // Errors map error codes to revert errors this actor may return.
 var Errors = map[uint8]error{
-	ErrPublicKeyTooBig:         errors.NewCodedRevertErrorf(ErrPublicKeyTooBig, "public key must be less than %d bytes", MaximumPublicKeySize),
-	ErrInvalidSector:           errors.NewCodedRevertErrorf(ErrInvalidSector, "sectorID out of range"),
-	ErrSectorCommitted:         errors.NewCodedRevertErrorf(ErrSectorCommitted, "sector already committed"),
-	ErrStoragemarketCallFailed: errors.NewCodedRevertErrorf(ErrStoragemarketCallFailed, "call to StorageMarket failed"),
-	ErrCallerUnauthorized:      errors.NewCodedRevertErrorf(ErrCallerUnauthorized, "not authorized to call the method"),
-	ErrInsufficientPledge:      errors.NewCodedRevertErrorf(ErrInsufficientPledge, "not enough pledged"),
-	ErrInvalidPoSt:             errors.NewCodedRevertErrorf(ErrInvalidPoSt, "PoSt proof did not validate"),
-	ErrAskNotFound:             errors.NewCodedRevertErrorf(ErrAskNotFound, "no ask was found"),
-	ErrInvalidSealProof:        errors.NewCodedRevertErrorf(ErrInvalidSealProof, "seal proof was invalid"),
+	ErrPublicKeyTooBig:          errors.NewCodedRevertErrorf(ErrPublicKeyTooBig, "public key must be less than %d bytes", MaximumPublicKeySize),
+	ErrInvalidSector:            errors.NewCodedRevertErrorf(ErrInvalidSector, "sectorID out of range"),
+	ErrSectorCommitted:          errors.NewCodedRevertErrorf(ErrSectorCommitted, "sector already committed"),
+	ErrStoragemarketCallFailed:  errors.NewCodedRevertErrorf(ErrStoragemarketCallFailed, "call to StorageMarket failed"),
+	ErrCallerUnauthorized:       errors.NewCodedRevertErrorf(ErrCallerUnauthorized, "not authorized to call the method"),
+	ErrInsufficientPledge:       errors.NewCodedRevertErrorf(ErrInsufficientPledge, "not enough pledged"),
+	ErrInvalidPoSt:              errors.NewCodedRevertErrorf(ErrInvalidPoSt, "PoSt proof did not validate"),
+	ErrAskNotFound:              errors.NewCodedRevertErrorf(ErrAskNotFound, "no ask was found"),
+	ErrInvalidSealProof:         errors.NewCodedRevertErrorf(ErrInvalidSealProof, "seal proof was invalid"),
+	ErrPoStChallengeUnavailable: errors.NewCodedRevertErrorf(ErrPoStChallengeUnavailable, "PoSt challenge is not in the chain yet"),
 }
 
 // Actor is the miner actor.
@@ -101,6 +106,12 @@ type Ask struct {
 type State struct {
 	Owner address.Address
 
+	// Worker may send the miner's operational messages, which commit sectors,
+	// submit PoSts, add asks and update the peer id, in place of the owner,
+	// so that the owner's key need not be kept on the mining machine. It is
+	// the owner until the owner changes it.
+	Worker address.Address
+
 	// PeerID references the libp2p identity that the miner is operating.
 	PeerID peer.ID
 
@@ -131,6 +142,10 @@ type State struct {
 	LastPoSt           *types.BlockHeight
 
 	Power *big.Int
+
+	// ProofsMode is which proofs the miner submits, that of the network it
+	// was created on.
+	ProofsMode proofs.Mode
 }
 
 // NewActor returns a new miner actor
@@ -142,6 +157,7 @@ func NewActor() *actor.Actor {
 func NewState(owner address.Address, key []byte, pledge *big.Int, pid peer.ID, collateral *types.AttoFIL) *State {
 	return &State{
 		Owner:             owner,
+		Worker:            owner,
 		PeerID:            pid,
 		PublicKey:         key,
 		PledgeSectors:     pledge,
@@ -197,6 +213,14 @@ var minerExports = exec.Exports{
 		Params: nil,
 		Return: []abi.Type{abi.Address},
 	},
+	"getWorker": &exec.FunctionSignature{
+		Params: nil,
+		Return: []abi.Type{abi.Address},
+	},
+	"changeWorker": &exec.FunctionSignature{
+		Params: []abi.Type{abi.Address},
+		Return: []abi.Type{},
+	},
 	"getLastUsedSectorID": &exec.FunctionSignature{
 		Params: nil,
 		Return: []abi.Type{abi.SectorID},
@@ -253,7 +277,7 @@ func (ma *Actor) AddAsk(ctx exec.VMContext, price *types.AttoFIL, expiry *big.In
 
 	var state State
 	out, err := actor.WithState(ctx, &state, func() (interface{}, error) {
-		if ctx.Message().From != state.Owner {
+		if !state.isOperator(ctx.Message().From) {
 			return nil, Errors[ErrCallerUnauthorized]
 		}
 
@@ -385,6 +409,53 @@ func (ma *Actor) GetOwner(ctx exec.VMContext) (address.Address, uint8, error) {
 	return a, 0, nil
 }
 
+// GetWorker returns the address that may send the miner's operational
+// messages.
+func (ma *Actor) GetWorker(ctx exec.VMContext) (address.Address, uint8, error) {
+	if err := ctx.Charge(100); err != nil {
+		return address.Address{}, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	var state State
+	out, err := actor.WithState(ctx, &state, func() (interface{}, error) {
+		return state.worker(), nil
+	})
+	if err != nil {
+		return address.Address{}, errors.CodeError(err), err
+	}
+
+	a, ok := out.(address.Address)
+	if !ok {
+		return address.Address{}, 1, errors.NewFaultErrorf("expected an Address return value from call, but got %T instead", out)
+	}
+
+	return a, 0, nil
+}
+
+// ChangeWorker sets the address that may send the miner's operational
+// messages. Only the owner may change it.
+func (ma *Actor) ChangeWorker(ctx exec.VMContext, worker address.Address) (uint8, error) {
+	if err := ctx.Charge(100); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	var state State
+	_, err := actor.WithState(ctx, &state, func() (interface{}, error) {
+		if ctx.Message().From != state.Owner {
+			return nil, Errors[ErrCallerUnauthorized]
+		}
+
+		state.Worker = worker
+
+		return nil, nil
+	})
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	return 0, nil
+}
+
 // GetLastUsedSectorID returns the last used sector id.
 func (ma *Actor) GetLastUsedSectorID(ctx exec.VMContext) (uint64, uint8, error) {
 	if err := ctx.Charge(100); err != nil {
@@ -466,7 +537,16 @@ func (ma *Actor) CommitSector(ctx exec.VMContext, sectorID uint64, commD, commR,
 		req.SectorID = sectorbuilder.SectorIDToBytes(sectorID)
 		req.StoreType = sectorStoreType
 
-		res, err := (&proofs.RustVerifier{}).VerifySeal(req)
+		var state State
+		chunk, err := ctx.ReadStorage()
+		if err != nil {
+			return errors.CodeError(err), err
+		}
+		if err := actor.UnmarshalStorage(chunk, &state); err != nil {
+			return errors.CodeError(err), err
+		}
+
+		res, err := proofs.ModeVerifier(state.ProofsMode).VerifySeal(req)
 		if err != nil {
 			return 1, errors.RevertErrorWrap(err, "failed to verify seal proof")
 		}
@@ -482,7 +562,7 @@ func (ma *Actor) CommitSector(ctx exec.VMContext, sectorID uint64, commD, commR,
 	var state State
 	_, err := actor.WithState(ctx, &state, func() (interface{}, error) {
 		// verify that the caller is authorized to perform update
-		if ctx.Message().From != state.Owner {
+		if !state.isOperator(ctx.Message().From) {
 			return nil, Errors[ErrCallerUnauthorized]
 		}
 
@@ -573,7 +653,7 @@ func (ma *Actor) UpdatePeerID(ctx exec.VMContext, pid peer.ID) (uint8, error) {
 	var storage State
 	_, err := actor.WithState(ctx, &storage, func() (interface{}, error) {
 		// verify that the caller is authorized to perform update
-		if ctx.Message().From != storage.Owner {
+		if !storage.isOperator(ctx.Message().From) {
 			return nil, Errors[ErrCallerUnauthorized]
 		}
 
@@ -646,10 +726,23 @@ func (ma *Actor) SubmitPoSt(ctx exec.VMContext, proof []byte) (uint8, error) {
 	var state State
 	_, err := actor.WithState(ctx, &state, func() (interface{}, error) {
 		// verify that the caller is authorized to perform update
-		if ctx.Message().From != state.Owner {
+		if !state.isOperator(ctx.Message().From) {
 			return nil, Errors[ErrCallerUnauthorized]
 		}
 
+		// Check if we submitted it in time
+		provingPeriodEnd := state.ProvingPeriodStart.Add(ProvingPeriodBlocks)
+		if ctx.BlockHeight().GreaterThan(provingPeriodEnd) {
+			// Not great.
+			// TODO: charge penalty
+			return nil, errors.NewRevertErrorf("submitted PoSt late, need to pay a fee")
+		}
+
+		challenge, err := ProvingPeriodChallenge(ctx, state.ProvingPeriodStart, ctx.BlockHeight())
+		if err != nil {
+			return nil, Errors[ErrPoStChallengeUnavailable]
+		}
+
 		// reach in to actor storage to grab comm-r for each committed sector
 		var commRs []proofs.CommR
 		for _, v := range state.SectorCommitments {
@@ -662,13 +755,13 @@ func (ma *Actor) SubmitPoSt(ctx exec.VMContext, proof []byte) (uint8, error) {
 
 		// TODO: use IsPoStValidWithProver when proofs are implemented
 		req := proofs.VerifyPoSTRequest{
-			ChallengeSeed: proofs.PoStChallengeSeed{},
+			ChallengeSeed: challenge,
 			CommRs:        commRs,
 			Faults:        []uint64{},
 			Proof:         postProof,
 		}
 
-		res, err := (&proofs.RustVerifier{}).VerifyPoST(req)
+		res, err := proofs.ModeVerifier(state.ProofsMode).VerifyPoST(req)
 		if err != nil {
 			return nil, errors.RevertErrorWrap(err, "failed to verify PoSt")
 		}
@@ -676,17 +769,8 @@ func (ma *Actor) SubmitPoSt(ctx exec.VMContext, proof []byte) (uint8, error) {
 			return nil, Errors[ErrInvalidPoSt]
 		}
 
-		// Check if we submitted it in time
-		provingPeriodEnd := state.ProvingPeriodStart.Add(ProvingPeriodBlocks)
-
-		if ctx.BlockHeight().LessEqual(provingPeriodEnd) {
-			state.ProvingPeriodStart = provingPeriodEnd
-			state.LastPoSt = ctx.BlockHeight()
-		} else {
-			// Not great.
-			// TODO: charge penalty
-			return nil, errors.NewRevertErrorf("submitted PoSt late, need to pay a fee")
-		}
+		state.ProvingPeriodStart = provingPeriodEnd
+		state.LastPoSt = ctx.BlockHeight()
 
 		return nil, nil
 	})
@@ -697,6 +781,39 @@ func (ma *Actor) SubmitPoSt(ctx exec.VMContext, proof []byte) (uint8, error) {
 	return 0, nil
 }
 
+// maxChallengeNullRounds bounds how many null rounds after the start of a
+// proving period are skipped looking for its challenge.
+const maxChallengeNullRounds = 100
+
+// Randomness samples the chain randomness at a block height, like
+// vm.Context.Rand.
+type Randomness interface {
+	Rand(sampleHeight *types.BlockHeight) ([]byte, error)
+}
+
+// ProvingPeriodChallenge returns the PoSt challenge seed of the proving period
+// starting at start, as seen by a block at height. It is derived from the
+// randomness of the first tipset at or after start, skipping null rounds, and
+// is an error until that randomness is in the chain, so the challenge of a
+// period can't be known before the period begins.
+func ProvingPeriodChallenge(r Randomness, start, height *types.BlockHeight) (proofs.PoStChallengeSeed, error) {
+	var seed proofs.PoStChallengeSeed
+	last := start.Add(types.NewBlockHeight(maxChallengeNullRounds))
+	for h := start; h.LessThan(height) && h.LessEqual(last); h = h.Add(types.NewBlockHeight(1)) {
+		rand, err := r.Rand(h)
+		if err != nil {
+			// Either h is a null round or its randomness is not in the
+			// chain yet. In the latter case it isn't for later heights
+			// either, so the loop ends without a challenge.
+			continue
+		}
+		sum := sha256.Sum256(rand)
+		copy(seed[:], sum[:])
+		return seed, nil
+	}
+	return seed, xerrors.Errorf("challenge of proving period starting at %s is not in the chain at %s", start, height)
+}
+
 // GetProvingPeriodStart returns the current ProvingPeriodStart value.
 func (ma *Actor) GetProvingPeriodStart(ctx exec.VMContext) (*types.BlockHeight, uint8, error) {
 	if err := ctx.Charge(100); err != nil {
@@ -715,3 +832,18 @@ func (ma *Actor) GetProvingPeriodStart(ctx exec.VMContext) (*types.BlockHeight,
 
 	return state.ProvingPeriodStart, 0, nil
 }
+
+// worker returns the address that may send the miner's operational messages.
+// Miners created before workers were introduced are worked by their owner.
+func (s *State) worker() address.Address {
+	if s.Worker == (address.Address{}) {
+		return s.Owner
+	}
+	return s.Worker
+}
+
+// isOperator returns whether from may send the miner's operational messages:
+// it is the miner's worker or its owner.
+func (s *State) isOperator(from address.Address) bool {
+	return from == s.worker() || from == s.Owner
+}
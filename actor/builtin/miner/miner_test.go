@@ -2,7 +2,9 @@ package miner_test
 
 import (
 	"context"
+	"crypto/sha256"
 	"math/big"
+	"strconv"
 	"testing"
 
 	peer "gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
@@ -14,6 +16,7 @@ import (
 	"github.com/filecoin-project/go-filecoin/consensus"
 	"github.com/filecoin-project/go-filecoin/core"
 	"github.com/filecoin-project/go-filecoin/proofs"
+	"github.com/filecoin-project/go-filecoin/proofs/sectorbuilder"
 	"github.com/filecoin-project/go-filecoin/state"
 	th "github.com/filecoin-project/go-filecoin/testhelpers"
 	"github.com/filecoin-project/go-filecoin/types"
@@ -206,6 +209,58 @@ func TestPeerIdGetterAndSetter(t *testing.T) {
 	})
 }
 
+func TestMinerChangeWorker(t *testing.T) {
+	require := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	st, vms := core.CreateStorages(ctx, t)
+
+	minerAddr := createTestMiner(assert.New(t), st, vms, address.TestAddress, []byte("my public key"), th.RequireRandomPeerID())
+
+	getWorker := func() address.Address {
+		result := callQueryMethodSuccess("getWorker", ctx, t, st, vms, address.TestAddress, minerAddr)
+		worker, err := address.NewFromBytes(result[0])
+		require.NoError(err)
+		return worker
+	}
+	changeWorker := func(from, worker address.Address) *consensus.ApplicationResult {
+		msg := types.NewMessage(
+			from,
+			minerAddr,
+			core.MustGetNonce(st, from),
+			types.NewAttoFILFromFIL(0),
+			"changeWorker",
+			actor.MustConvertParams(worker))
+
+		applyMsgResult, err := th.ApplyTestMessage(st, vms, msg, types.NewBlockHeight(0))
+		require.NoError(err)
+		return applyMsgResult
+	}
+
+	// The owner works the miner until it names a worker.
+	require.Equal(address.TestAddress, getWorker())
+
+	// Only the owner may change the worker.
+	res := changeWorker(address.TestAddress2, address.TestAddress2)
+	require.Equal(Errors[ErrCallerUnauthorized], res.ExecutionError)
+	require.Equal(address.TestAddress, getWorker())
+
+	res = changeWorker(address.TestAddress, address.TestAddress2)
+	require.NoError(res.ExecutionError)
+	require.Equal(uint8(0), res.Receipt.ExitCode)
+	require.Equal(address.TestAddress2, getWorker())
+
+	// The worker may send operational messages, but not change the worker.
+	updatePeerIdSuccess(ctx, t, st, vms, address.TestAddress2, minerAddr, th.RequireRandomPeerID())
+	res = changeWorker(address.TestAddress2, address.TestAddress2)
+	require.Equal(Errors[ErrCallerUnauthorized], res.ExecutionError)
+
+	// The owner may still send them.
+	updatePeerIdSuccess(ctx, t, st, vms, address.TestAddress, minerAddr, th.RequireRandomPeerID())
+}
+
 func TestMinerGetPledge(t *testing.T) {
 	t.Parallel()
 	require := require.New(t)
@@ -327,7 +382,7 @@ func TestMinerSubmitPoSt(t *testing.T) {
 
 	// submit post
 	proof := th.MakeRandomPoSTProofForTest()
-	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 8, "submitPoSt", proof[:])
+	res, err = th.CreateAndApplyTestMessageWithAncestors(t, st, vms, minerAddr, 0, 8, makeAncestors(require, 8), "submitPoSt", proof[:])
 	require.NoError(err)
 	require.NoError(res.ExecutionError)
 	require.Equal(uint8(0), res.Receipt.ExitCode)
@@ -344,3 +399,148 @@ func TestMinerSubmitPoSt(t *testing.T) {
 	require.NoError(err)
 	require.EqualError(res.ExecutionError, "submitted PoSt late, need to pay a fee")
 }
+
+func TestMinerCommitSectorVerifiesProofsOfNetwork(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	st, vms := core.CreateStorages(ctx, t, consensus.ProofsMode(proofs.InsecureMode))
+
+	// A miner created after genesis verifies seal proofs.
+	pdata := actor.MustConvertParams(big.NewInt(100), []byte("my public key"), th.RequireRandomPeerID())
+	nonce := core.MustGetNonce(st, address.TestAddress)
+	msg := types.NewMessage(address.TestAddress, address.StorageMarketAddress, nonce, types.NewAttoFILFromFIL(100), "createMiner", pdata)
+	result, err := th.ApplyTestMessage(st, vms, msg, types.NewBlockHeight(1))
+	require.NoError(err)
+	require.NoError(result.ExecutionError)
+	minerAddr, err := address.NewFromBytes(result.Receipt.Return[0])
+	require.NoError(err)
+
+	var commD proofs.CommD
+	copy(commD[:], th.MakeCommitment())
+	proverID := sectorbuilder.AddressToProverID(minerAddr)
+	sectorID := sectorbuilder.SectorIDToBytes(1)
+	commR := proofs.InsecureCommR(proverID, sectorID, commD)
+	commRStar := proofs.InsecureCommRStar(commR)
+
+	res, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 3, "commitSector", uint64(1), commD[:], commR[:], commRStar[:], th.MakeRandomBytes(int(proofs.SealBytesLen)))
+	require.NoError(err)
+	require.EqualError(res.ExecutionError, "seal proof was invalid")
+	require.Equal(uint8(ErrInvalidSealProof), res.Receipt.ExitCode)
+
+	proof := proofs.InsecureSealProof(proverID, sectorID, commD, commR, commRStar)
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 3, "commitSector", uint64(1), commD[:], commR[:], commRStar[:], proof[:])
+	require.NoError(err)
+	require.NoError(res.ExecutionError)
+	require.Equal(uint8(0), res.Receipt.ExitCode)
+}
+
+func TestMinerSubmitPoStChallenge(t *testing.T) {
+	ctx := context.Background()
+
+	setup := func(t *testing.T) (state.Tree, vm.StorageMap, address.Address, proofs.CommR) {
+		require := require.New(t)
+		st, vms := core.CreateStorages(ctx, t, consensus.ProofsMode(proofs.InsecureMode))
+		minerAddr := createTestMiner(assert.New(t), st, vms, address.TestAddress, []byte("my public key"), th.RequireRandomPeerID())
+
+		var commR proofs.CommR
+		copy(commR[:], th.MakeCommitment())
+		res, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 3, "commitSector", uint64(1), th.MakeCommitment(), commR[:], th.MakeCommitment(), th.MakeRandomBytes(int(proofs.SealBytesLen)))
+		require.NoError(err)
+		require.NoError(res.ExecutionError)
+		return st, vms, minerAddr, commR
+	}
+
+	t.Run("proves against the randomness of the proving period start", func(t *testing.T) {
+		require := require.New(t)
+		st, vms, minerAddr, commR := setup(t)
+		ancestors := makeAncestors(require, 8)
+
+		// The wrong randomness does not make a valid PoSt.
+		proof := proofs.InsecurePoStProof(challengeSeed("3"), []proofs.CommR{commR})
+		res, err := th.CreateAndApplyTestMessageWithAncestors(t, st, vms, minerAddr, 0, 8, ancestors, "submitPoSt", proof[:])
+		require.NoError(err)
+		require.EqualError(res.ExecutionError, "PoSt proof did not validate")
+		require.Equal(uint8(ErrInvalidPoSt), res.Receipt.ExitCode)
+
+		// The period started at height 3, whose randomness is the ticket
+		// lookback tipsets away from it.
+		seed, err := ProvingPeriodChallenge(newRandomness(ancestors), types.NewBlockHeight(3), types.NewBlockHeight(8))
+		require.NoError(err)
+		require.Equal(challengeSeed("6"), seed)
+
+		proof = proofs.InsecurePoStProof(seed, []proofs.CommR{commR})
+		res, err = th.CreateAndApplyTestMessageWithAncestors(t, st, vms, minerAddr, 0, 8, ancestors, "submitPoSt", proof[:])
+		require.NoError(err)
+		require.NoError(res.ExecutionError)
+		require.Equal(uint8(0), res.Receipt.ExitCode)
+	})
+
+	t.Run("rejects PoSts before the challenge is in the chain", func(t *testing.T) {
+		require := require.New(t)
+		st, vms, minerAddr, commR := setup(t)
+		ancestors := makeAncestors(require, 5)
+
+		_, err := ProvingPeriodChallenge(newRandomness(ancestors), types.NewBlockHeight(3), types.NewBlockHeight(5))
+		require.Error(err)
+
+		proof := proofs.InsecurePoStProof(challengeSeed("4"), []proofs.CommR{commR})
+		res, err := th.CreateAndApplyTestMessageWithAncestors(t, st, vms, minerAddr, 0, 5, ancestors, "submitPoSt", proof[:])
+		require.NoError(err)
+		require.EqualError(res.ExecutionError, "PoSt challenge is not in the chain yet")
+		require.Equal(uint8(ErrPoStChallengeUnavailable), res.Receipt.ExitCode)
+	})
+
+	t.Run("skips null rounds at the proving period start", func(t *testing.T) {
+		require := require.New(t)
+		st, vms, minerAddr, commR := setup(t)
+		ancestors := makeAncestors(require, 8, 3)
+
+		seed, err := ProvingPeriodChallenge(newRandomness(ancestors), types.NewBlockHeight(3), types.NewBlockHeight(8))
+		require.NoError(err)
+		require.Equal(challengeSeed("7"), seed)
+
+		proof := proofs.InsecurePoStProof(seed, []proofs.CommR{commR})
+		res, err := th.CreateAndApplyTestMessageWithAncestors(t, st, vms, minerAddr, 0, 8, ancestors, "submitPoSt", proof[:])
+		require.NoError(err)
+		require.NoError(res.ExecutionError)
+	})
+}
+
+// makeAncestors returns tipsets of the heights below height but nulls, newest
+// first like the ancestors given to the consensus processor. The ticket of
+// each is its height.
+func makeAncestors(require *require.Assertions, height uint64, nulls ...uint64) []types.TipSet {
+	isNull := make(map[uint64]bool)
+	for _, h := range nulls {
+		isNull[h] = true
+	}
+
+	var ancestors []types.TipSet
+	var parent *types.Block
+	for h := uint64(0); h < height; h++ {
+		if isNull[h] {
+			continue
+		}
+		blk := types.NewBlockForTest(parent, h)
+		blk.Height = types.Uint64(h)
+		blk.Ticket = []byte(strconv.FormatUint(h, 10))
+		ancestors = append([]types.TipSet{types.RequireNewTipSet(require, blk)}, ancestors...)
+		parent = blk
+	}
+	return ancestors
+}
+
+func newRandomness(ancestors []types.TipSet) Randomness {
+	return vm.NewVMContext(vm.NewContextParams{
+		Ancestors: ancestors,
+		LookBack:  consensus.LookBackParameter,
+	})
+}
+
+// challengeSeed returns the challenge seed derived from a ticket.
+func challengeSeed(ticket string) proofs.PoStChallengeSeed {
+	var seed proofs.PoStChallengeSeed
+	sum := sha256.Sum256([]byte(ticket))
+	copy(seed[:], sum[:])
+	return seed
+}
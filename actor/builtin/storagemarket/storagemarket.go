@@ -15,6 +15,7 @@ import (
 	"github.com/filecoin-project/go-filecoin/actor/builtin/miner"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/proofs"
 	"github.com/filecoin-project/go-filecoin/types"
 	"github.com/filecoin-project/go-filecoin/vm/errors"
 )
@@ -57,6 +58,10 @@ type State struct {
 	// TotalCommitedStorage is the number of sectors that are currently committed
 	// in the whole network.
 	TotalCommittedStorage *big.Int
+
+	// ProofsMode is which proofs the miners of the network submit. It is
+	// set in the genesis block and handed to every miner created.
+	ProofsMode proofs.Mode
 }
 
 // NewActor returns a new storage market actor.
@@ -64,11 +69,15 @@ func NewActor() (*actor.Actor, error) {
 	return actor.NewActor(types.StorageMarketActorCodeCid, types.NewZeroAttoFIL()), nil
 }
 
-// InitializeState stores the actor's initial data structure.
-func (sma *Actor) InitializeState(storage exec.Storage, _ interface{}) error {
+// InitializeState stores the actor's initial data structure. initializerData,
+// if not nil, is the proofs.Mode of the network.
+func (sma *Actor) InitializeState(storage exec.Storage, initializerData interface{}) error {
 	initStorage := &State{
 		TotalCommittedStorage: big.NewInt(0),
 	}
+	if mode, ok := initializerData.(proofs.Mode); ok {
+		initStorage.ProofsMode = mode
+	}
 	stateBytes, err := cbor.DumpObject(initStorage)
 	if err != nil {
 		return err
@@ -128,6 +137,7 @@ func (sma *Actor) CreateMiner(vmctx exec.VMContext, pledge *big.Int, publicKey [
 		}
 
 		minerInitializationParams := miner.NewState(vmctx.Message().From, publicKey, pledge, pid, vmctx.Message().Value)
+		minerInitializationParams.ProofsMode = state.ProofsMode
 
 		actorCodeCid := types.MinerActorCodeCid
 		if vmctx.BlockHeight().Equal(types.NewBlockHeight(0)) {
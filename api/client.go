@@ -10,6 +10,7 @@ import (
 
 	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/proofs"
 	"github.com/filecoin-project/go-filecoin/protocol/storage"
 	"github.com/filecoin-project/go-filecoin/types"
 )
@@ -28,8 +29,12 @@ type Ask struct {
 type Client interface {
 	Cat(ctx context.Context, c cid.Cid) (uio.DagReader, error)
 	ImportData(ctx context.Context, data io.Reader) (ipld.Node, error)
-	ProposeStorageDeal(ctx context.Context, data cid.Cid, miner address.Address, ask uint64, duration uint64, allowDuplicates bool) (*storage.DealResponse, error)
+	ProposeStorageDeal(ctx context.Context, data cid.Cid, miner address.Address, ask uint64, duration uint64, allowDuplicates bool, transfer storage.TransferMode) (*storage.DealResponse, error)
+	ImportDealData(ctx context.Context, proposal cid.Cid, data io.Reader) error
 	QueryStorageDeal(ctx context.Context, prop cid.Cid) (*storage.DealResponse, error)
+	DealHistory(ctx context.Context, prop cid.Cid) ([]*storage.DealResponse, error)
+	ListDeals(ctx context.Context, filter storage.DealFilter) ([]*storage.DealSummary, error)
+	PieceCommitment(ctx context.Context, data cid.Cid) (*proofs.PieceCommitment, error)
 	ListAsks(ctx context.Context) (<-chan Ask, error)
 	Payments(ctx context.Context, dealCid cid.Cid) ([]*paymentbroker.PaymentVoucher, error)
 }
@@ -21,6 +21,7 @@ import (
 	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
 	"github.com/filecoin-project/go-filecoin/address"
 	mapi "github.com/filecoin-project/go-filecoin/api"
+	"github.com/filecoin-project/go-filecoin/proofs"
 	"github.com/filecoin-project/go-filecoin/protocol/storage"
 	"github.com/filecoin-project/go-filecoin/types"
 )
@@ -50,6 +51,26 @@ func (api *nodeClient) Cat(ctx context.Context, c cid.Cid) (uio.DagReader, error
 	return uio.NewDagReader(ctx, data, ds)
 }
 
+// PieceCommitment computes the commitment of the data with the given cid,
+// as stored in a sector. Only nodes running with insecure proofs compute
+// them, as they do not match the sectors rust-fil-proofs seals.
+func (api *nodeClient) PieceCommitment(ctx context.Context, data cid.Cid) (*proofs.PieceCommitment, error) {
+	if !api.api.node.InsecureProofs() {
+		return nil, proofs.ErrPieceInclusionProofsUnsupported
+	}
+
+	r, err := api.Cat(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+
+	commP, err := proofs.GeneratePieceCommitment(r, r.Size())
+	if err != nil {
+		return nil, err
+	}
+	return &proofs.PieceCommitment{CommP: commP, Size: r.Size()}, nil
+}
+
 func (api *nodeClient) ImportData(ctx context.Context, data io.Reader) (ipld.Node, error) {
 	ds := dag.NewDAGService(api.api.node.BlockService())
 	bufds := ipld.NewBufferedDAG(ctx, ds)
@@ -63,14 +84,38 @@ func (api *nodeClient) ImportData(ctx context.Context, data io.Reader) (ipld.Nod
 	return nd, bufds.Commit()
 }
 
-func (api *nodeClient) ProposeStorageDeal(ctx context.Context, data cid.Cid, miner address.Address, askid uint64, duration uint64, allowDuplicates bool) (*storage.DealResponse, error) {
-	return api.api.node.StorageMinerClient.ProposeDeal(ctx, miner, data, askid, duration, allowDuplicates)
+func (api *nodeClient) ProposeStorageDeal(ctx context.Context, data cid.Cid, miner address.Address, askid uint64, duration uint64, allowDuplicates bool, transfer storage.TransferMode) (*storage.DealResponse, error) {
+	return api.api.node.StorageMinerClient.ProposeDeal(ctx, miner, data, askid, duration, allowDuplicates, transfer)
+}
+
+// ImportDealData imports the data of an offline deal made with one of this
+// node's miners from a CAR file.
+func (api *nodeClient) ImportDealData(ctx context.Context, proposal cid.Cid, data io.Reader) error {
+	sm := api.api.node.StorageMinerForDeal(proposal)
+	if sm == nil {
+		sm = api.api.node.StorageMiner
+	}
+	if sm == nil {
+		return ErrNotMining
+	}
+	return sm.ImportDealData(ctx, proposal, data)
 }
 
 func (api *nodeClient) QueryStorageDeal(ctx context.Context, prop cid.Cid) (*storage.DealResponse, error) {
 	return api.api.node.StorageMinerClient.QueryDeal(ctx, prop)
 }
 
+// DealHistory returns the signed responses received from the miner of the
+// storage deal with the given proposal cid.
+func (api *nodeClient) DealHistory(ctx context.Context, prop cid.Cid) ([]*storage.DealResponse, error) {
+	return api.api.node.StorageMinerClient.DealHistory(prop)
+}
+
+// ListDeals lists the storage deals this node made as a client.
+func (api *nodeClient) ListDeals(ctx context.Context, filter storage.DealFilter) ([]*storage.DealSummary, error) {
+	return api.api.node.StorageMinerClient.ListDeals(filter)
+}
+
 func (api *nodeClient) ListAsks(ctx context.Context) (<-chan mapi.Ask, error) {
 	nd := api.api.node
 
@@ -13,4 +13,7 @@ var (
 	ErrCannotPingSelf = errors.New("cannot ping self")
 	// ErrNodeOffline indicates that the node must not be offline for the operation performed.
 	ErrNodeOffline = errors.New("node must be online")
+	// ErrNotMining indicates that the operation needs the node's storage miner,
+	// which only exists while the node is mining.
+	ErrNotMining = errors.New("node must be mining")
 )
@@ -9,7 +9,10 @@ import (
 	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
 
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/node"
 	"github.com/filecoin-project/go-filecoin/porcelain"
+	"github.com/filecoin-project/go-filecoin/proofs/sectorbuilder"
+	"github.com/filecoin-project/go-filecoin/protocol/storage"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
@@ -82,6 +85,27 @@ func (nm *nodeMiner) GetOwner(ctx context.Context, minerAddr address.Address) (a
 	return address.NewFromBytes(bytes[0])
 }
 
+// GetWorker returns the address that may send the operational messages of
+// the miner.
+func (nm *nodeMiner) GetWorker(ctx context.Context, minerAddr address.Address) (address.Address, error) {
+	return nm.porcelainAPI.MinerGetWorkerAddress(ctx, minerAddr)
+}
+
+// ChangeWorker sends a message, which must come from the miner's owner,
+// making worker the miner's worker.
+func (nm *nodeMiner) ChangeWorker(ctx context.Context, fromAddr, minerAddr address.Address, gasPrice types.AttoFIL, gasLimit types.GasUnits, worker address.Address) (cid.Cid, error) {
+	return nm.porcelainAPI.MessageSendWithDefaultAddress(
+		ctx,
+		fromAddr,
+		minerAddr,
+		nil,
+		gasPrice,
+		gasLimit,
+		"changeWorker",
+		worker,
+	)
+}
+
 func (nm *nodeMiner) GetPower(ctx context.Context, minerAddr address.Address) (*big.Int, error) {
 	bytes, _, err := nm.porcelainAPI.MessageQuery(
 		ctx,
@@ -129,3 +153,108 @@ func (nm *nodeMiner) GetTotalPower(ctx context.Context) (*big.Int, error) {
 
 	return power, nil
 }
+
+// ListDeals lists the storage deals made with this node's miners, or with
+// the one filter.Miner names.
+func (nm *nodeMiner) ListDeals(ctx context.Context, filter storage.DealFilter) ([]*storage.DealSummary, error) {
+	miners := nm.api.node.StorageMiners()
+	if filter.Miner != (address.Address{}) {
+		sm, err := nm.storageMiner(filter.Miner)
+		if err != nil {
+			return nil, err
+		}
+		miners = []*storage.Miner{sm}
+	}
+	if len(miners) == 0 {
+		return nil, ErrNotMining
+	}
+
+	var deals []*storage.DealSummary
+	for _, sm := range miners {
+		minerDeals, err := sm.ListDeals(filter)
+		if err != nil {
+			return nil, err
+		}
+		deals = append(deals, minerDeals...)
+	}
+	return deals, nil
+}
+
+// ProvePiece proves that a piece this node's miner stores lies inside its
+// sealed sector.
+func (nm *nodeMiner) ProvePiece(ctx context.Context, minerAddr address.Address, piece cid.Cid) (*sectorbuilder.PieceInclusionProof, error) {
+	sm, err := nm.storageMiner(minerAddr)
+	if err != nil {
+		return nil, err
+	}
+	return sm.ProvePiece(ctx, piece)
+}
+
+// ListSectors describes the sectors of this node's miner.
+func (nm *nodeMiner) ListSectors(ctx context.Context, minerAddr address.Address) ([]*storage.SectorStatus, error) {
+	sm, err := nm.storageMiner(minerAddr)
+	if err != nil {
+		return nil, err
+	}
+	return sm.ListSectors(ctx)
+}
+
+// SectorStatus describes the sector of this node's miner with the given id.
+func (nm *nodeMiner) SectorStatus(ctx context.Context, minerAddr address.Address, sectorID uint64) (*storage.SectorStatus, error) {
+	sm, err := nm.storageMiner(minerAddr)
+	if err != nil {
+		return nil, err
+	}
+	return sm.SectorStatus(ctx, sectorID)
+}
+
+// SealNow seals the sector of this node's miner with the given id, or all of
+// its staged sectors if sectorID is nil.
+func (nm *nodeMiner) SealNow(ctx context.Context, minerAddr address.Address, sectorID *uint64) error {
+	scheduler, err := nm.api.node.SealSchedulerFor(minerAddr)
+	if errors.Cause(err) == node.ErrUnknownMiner {
+		return err
+	}
+	if scheduler == nil {
+		return ErrNotMining
+	}
+	return scheduler.SealNow(ctx, sectorID)
+}
+
+// ProvingInfo describes the current proving period of this node's miner and
+// the progress of its PoSt.
+func (nm *nodeMiner) ProvingInfo(ctx context.Context, minerAddr address.Address) (*storage.ProvingInfo, error) {
+	sm, err := nm.storageMiner(minerAddr)
+	if err != nil {
+		return nil, err
+	}
+	return sm.ProvingInfo(), nil
+}
+
+// storageMiner returns the storage miner of this node's miner with the given
+// address, or of its default miner if minerAddr is empty.
+func (nm *nodeMiner) storageMiner(minerAddr address.Address) (*storage.Miner, error) {
+	sm, err := nm.api.node.StorageMinerFor(minerAddr)
+	if errors.Cause(err) == node.ErrUnknownMiner {
+		return nil, err
+	}
+	if sm == nil {
+		return nil, ErrNotMining
+	}
+	return sm, nil
+}
+
+// StorageLs describes how much of each of the node's storage paths is used.
+func (nm *nodeMiner) StorageLs(ctx context.Context) ([]*sectorbuilder.StoragePathUsage, error) {
+	return nm.api.node.SectorStorage.Usage()
+}
+
+// StorageAttach adds a path new sectors may be stored in.
+func (nm *nodeMiner) StorageAttach(ctx context.Context, path sectorbuilder.StoragePath) error {
+	return nm.api.node.AttachStorage(path)
+}
+
+// StorageDetach removes an empty storage path.
+func (nm *nodeMiner) StorageDetach(ctx context.Context, path string) error {
+	return nm.api.node.DetachStorage(path)
+}
@@ -3,12 +3,25 @@ package impl
 import (
 	"context"
 	"io"
+	"sort"
+	"sync"
+	"time"
 
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
 
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/api"
+	"github.com/filecoin-project/go-filecoin/protocol/retrieval"
+	"github.com/filecoin-project/go-filecoin/protocol/storage"
 )
 
+// maxDHTProviders is the most providers of a piece looked up in the DHT.
+const maxDHTProviders = 20
+
+// findProvidersTimeout bounds the DHT lookup and the queries of FindProviders.
+const findProvidersTimeout = 30 * time.Second
+
 type nodeRetrievalClient struct {
 	api *nodeAPI
 }
@@ -25,3 +38,98 @@ func (nrc *nodeRetrievalClient) RetrievePiece(ctx context.Context, pieceCID cid.
 
 	return nrc.api.node.RetrievalClient.RetrievePiece(ctx, minerPeerID, pieceCID)
 }
+
+// FindProviders finds the peers that may serve the piece with the given cid,
+// from this node's storage deals and the DHT, and queries each of them. Providers that have the piece come first, fastest first.
+func (nrc *nodeRetrievalClient) FindProviders(ctx context.Context, pieceCID cid.Cid) ([]*api.PieceProvider, error) {
+	ctx, cancel := context.WithTimeout(ctx, findProvidersTimeout)
+	defer cancel()
+
+	providers := map[peer.ID]*api.PieceProvider{}
+	addProvider := func(pid peer.ID, minerAddr address.Address, source string) {
+		p, ok := providers[pid]
+		if !ok {
+			p = &api.PieceProvider{PeerID: pid}
+			providers[pid] = p
+		}
+		if p.Miner.Empty() {
+			p.Miner = minerAddr
+		}
+		for _, s := range p.Sources {
+			if s == source {
+				return
+			}
+		}
+		p.Sources = append(p.Sources, source)
+	}
+
+	if err := nrc.findDealProviders(ctx, pieceCID, addProvider); err != nil {
+		return nil, err
+	}
+
+	self := nrc.api.node.Host().ID()
+	for info := range nrc.api.node.Router.FindProvidersAsync(ctx, pieceCID, maxDHTProviders) {
+		if info.ID != self {
+			addProvider(info.ID, address.Address{}, api.ProviderSourceDHT)
+		}
+	}
+
+	var wg sync.WaitGroup
+	out := make([]*api.PieceProvider, 0, len(providers))
+	for _, p := range providers {
+		out = append(out, p)
+		wg.Add(1)
+		go func(p *api.PieceProvider) {
+			defer wg.Done()
+			nrc.queryProvider(ctx, p, pieceCID)
+		}(p)
+	}
+	wg.Wait()
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Available != out[j].Available {
+			return out[i].Available
+		}
+		return out[i].Latency < out[j].Latency
+	})
+	return out, nil
+}
+
+// findDealProviders adds the miners of this node's storage deals for the
+// piece.
+func (nrc *nodeRetrievalClient) findDealProviders(ctx context.Context, pieceCID cid.Cid, addProvider func(peer.ID, address.Address, string)) error {
+	deals, err := nrc.api.node.StorageMinerClient.ListDeals(storage.DealFilter{PieceRef: pieceCID})
+	if err != nil {
+		return err
+	}
+
+	for _, d := range deals {
+		if d.State == storage.Unknown || d.State == storage.Rejected || d.State == storage.Failed {
+			continue
+		}
+
+		pid, err := nrc.api.node.PorcelainAPI.MinerGetPeerID(ctx, d.Miner)
+		if err != nil {
+			nrc.api.logger.Warningf("failed to get peer id of miner %s: %s", d.Miner, err)
+			continue
+		}
+		addProvider(pid, d.Miner, api.ProviderSourceDeal)
+	}
+	return nil
+}
+
+// queryProvider asks p whether it can serve the piece and records its answer
+// in p.
+func (nrc *nodeRetrievalClient) queryProvider(ctx context.Context, p *api.PieceProvider, pieceCID cid.Cid) {
+	start := time.Now()
+	resp, err := nrc.api.node.RetrievalClient.QueryPiece(ctx, p.PeerID, pieceCID)
+	p.Latency = time.Since(start)
+	if err != nil {
+		p.Error = err.Error()
+		return
+	}
+
+	p.Available = resp.Status == retrieval.Available
+	p.Size = resp.Size
+	p.PricePerByte = resp.PricePerByte
+}
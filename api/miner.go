@@ -8,6 +8,8 @@ import (
 	"gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
 
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/proofs/sectorbuilder"
+	"github.com/filecoin-project/go-filecoin/protocol/storage"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
@@ -17,7 +19,18 @@ type Miner interface {
 	UpdatePeerID(ctx context.Context, fromAddr, minerAddr address.Address, gasPrice types.AttoFIL, gasLimit types.GasUnits, newPid peer.ID) (cid.Cid, error)
 	AddAsk(ctx context.Context, fromAddr, minerAddr address.Address, gasPrice types.AttoFIL, gasLimit types.GasUnits, price *types.AttoFIL, expiry *big.Int) (cid.Cid, error)
 	GetOwner(ctx context.Context, minerAddr address.Address) (address.Address, error)
+	GetWorker(ctx context.Context, minerAddr address.Address) (address.Address, error)
+	ChangeWorker(ctx context.Context, fromAddr, minerAddr address.Address, gasPrice types.AttoFIL, gasLimit types.GasUnits, worker address.Address) (cid.Cid, error)
 	GetPledge(ctx context.Context, minerAddr address.Address) (*big.Int, error)
 	GetPower(ctx context.Context, minerAddr address.Address) (*big.Int, error)
 	GetTotalPower(ctx context.Context) (*big.Int, error)
+	ListDeals(ctx context.Context, filter storage.DealFilter) ([]*storage.DealSummary, error)
+	ProvePiece(ctx context.Context, minerAddr address.Address, piece cid.Cid) (*sectorbuilder.PieceInclusionProof, error)
+	ListSectors(ctx context.Context, minerAddr address.Address) ([]*storage.SectorStatus, error)
+	SectorStatus(ctx context.Context, minerAddr address.Address, sectorID uint64) (*storage.SectorStatus, error)
+	SealNow(ctx context.Context, minerAddr address.Address, sectorID *uint64) error
+	ProvingInfo(ctx context.Context, minerAddr address.Address) (*storage.ProvingInfo, error)
+	StorageLs(ctx context.Context) ([]*sectorbuilder.StoragePathUsage, error)
+	StorageAttach(ctx context.Context, path sectorbuilder.StoragePath) error
+	StorageDetach(ctx context.Context, path string) error
 }
@@ -3,13 +3,44 @@ package api
 import (
 	"context"
 	"io"
+	"time"
 
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
 
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/types"
 )
 
+// Places a piece provider may be found.
+const (
+	// ProviderSourceDeal is a storage deal this node made for the piece.
+	ProviderSourceDeal = "deal"
+	// ProviderSourceDHT is a provider record for the piece in the DHT.
+	ProviderSourceDHT = "dht"
+)
+
+// PieceProvider is a peer that may serve a piece, with its answer to a
+// retrieval query for it.
+type PieceProvider struct {
+	PeerID peer.ID
+	// Miner is the miner actor of the peer, if known.
+	Miner address.Address
+	// Sources are the places the provider was found.
+	Sources []string
+
+	Available    bool
+	Size         uint64
+	PricePerByte *types.AttoFIL
+	// Latency is how long the peer took to answer the query.
+	Latency time.Duration
+
+	// Error is why the peer could not be queried, if it could not.
+	Error string
+}
+
 // RetrievalClient is the interface that defines methods to manage retrieval client operations.
 type RetrievalClient interface {
 	RetrievePiece(ctx context.Context, pieceCID cid.Cid, minerAddr address.Address) (io.ReadCloser, error)
+	FindProviders(ctx context.Context, pieceCID cid.Cid) ([]*PieceProvider, error)
 }
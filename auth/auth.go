@@ -0,0 +1,248 @@
+// Package auth implements token based authentication for the node's API.
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+)
+
+// Permission is the level of access an API token grants. Each permission
+// includes all permissions below it: admin > sign > write > read.
+type Permission string
+
+const (
+	// PermRead allows inspecting the node and chain.
+	PermRead = Permission("read")
+	// PermWrite allows changing local node state, e.g. importing data or
+	// connecting to peers.
+	PermWrite = Permission("write")
+	// PermSign allows using the node's wallet to sign messages, e.g. sending
+	// messages and making deals.
+	PermSign = Permission("sign")
+	// PermAdmin allows everything, including exporting keys, changing the
+	// config and creating new tokens.
+	PermAdmin = Permission("admin")
+)
+
+var permissionLevels = map[Permission]int{
+	PermRead:  1,
+	PermWrite: 2,
+	PermSign:  3,
+	PermAdmin: 4,
+}
+
+var (
+	// ErrMissingToken is returned when a request carries no token.
+	ErrMissingToken = errors.New("missing API token")
+	// ErrInvalidToken is returned when a token is malformed or was not
+	// issued by this node.
+	ErrInvalidToken = errors.New("invalid API token")
+	// ErrExpiredToken is returned when a token is past its expiry.
+	ErrExpiredToken = errors.New("expired API token")
+	// ErrRevokedToken is returned when a token has been revoked.
+	ErrRevokedToken = errors.New("revoked API token")
+)
+
+// secretKey is the datastore key the token signing secret is stored under.
+var secretKey = datastore.NewKey("/auth/secret")
+
+// revokedPrefix is the datastore key the ids of revoked tokens are stored
+// under.
+var revokedPrefix = datastore.NewKey("/auth/revoked")
+
+// secretLen is the length in bytes of the token signing secret.
+const secretLen = 32
+
+// tokenIDLen is the length in bytes of the random id of a token.
+const tokenIDLen = 16
+
+// ParsePermission parses the given string into a permission.
+func ParsePermission(s string) (Permission, error) {
+	p := Permission(s)
+	if _, ok := permissionLevels[p]; !ok {
+		return "", fmt.Errorf("unknown permission %q, must be one of read, write, sign or admin", s)
+	}
+	return p, nil
+}
+
+// Includes returns true iff a token with permission p may do anything that
+// requires permission q.
+func (p Permission) Includes(q Permission) bool {
+	pl, ok := permissionLevels[p]
+	if !ok {
+		return false
+	}
+	return pl >= permissionLevels[q]
+}
+
+// tokenPayload is the signed content of a token.
+type tokenPayload struct {
+	ID     string     `json:"id"`
+	Perm   Permission `json:"perm"`
+	Issued int64      `json:"issued"`
+	// Expires is the unix time after which the token is no longer valid,
+	// zero if it never expires.
+	Expires int64 `json:"expires,omitempty"`
+}
+
+// Authenticator issues and verifies API tokens. Tokens are a payload and an
+// HMAC over it, keyed with a secret known only to the node. The ids of
+// revoked tokens are kept in a datastore.
+type Authenticator struct {
+	secret []byte
+	ds     datastore.Datastore
+}
+
+// NewAuthenticator returns an Authenticator which signs tokens with the given
+// secret and records revoked tokens in ds.
+func NewAuthenticator(secret []byte, ds datastore.Datastore) *Authenticator {
+	return &Authenticator{secret: secret, ds: ds}
+}
+
+// LoadOrCreateSecret returns the token signing secret stored in ds, generating
+// and storing a new one if there is none.
+func LoadOrCreateSecret(ds datastore.Datastore) ([]byte, error) {
+	secret, err := ds.Get(secretKey)
+	if err == nil {
+		return secret, nil
+	}
+	if err != datastore.ErrNotFound {
+		return nil, errors.Wrap(err, "failed to read API token secret")
+	}
+
+	secret = make([]byte, secretLen)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, errors.Wrap(err, "failed to generate API token secret")
+	}
+	if err := ds.Put(secretKey, secret); err != nil {
+		return nil, errors.Wrap(err, "failed to store API token secret")
+	}
+	return secret, nil
+}
+
+// CreateToken returns a new token granting the given permission. The token
+// expires after ttl, or never if ttl is zero.
+func (a *Authenticator) CreateToken(perm Permission, ttl time.Duration) (string, error) {
+	if _, ok := permissionLevels[perm]; !ok {
+		return "", fmt.Errorf("unknown permission %q", perm)
+	}
+	if ttl < 0 {
+		return "", fmt.Errorf("token lifetime must not be negative")
+	}
+
+	id := make([]byte, tokenIDLen)
+	if _, err := rand.Read(id); err != nil {
+		return "", errors.Wrap(err, "failed to generate token id")
+	}
+
+	now := time.Now()
+	p := tokenPayload{
+		ID:     base64.RawURLEncoding.EncodeToString(id),
+		Perm:   perm,
+		Issued: now.Unix(),
+	}
+	if ttl > 0 {
+		p.Expires = now.Add(ttl).Unix()
+	}
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(a.sign(payload)), nil
+}
+
+// Verify checks the token was issued by this authenticator, has not expired
+// and has not been revoked, and returns the permission it grants.
+func (a *Authenticator) Verify(token string) (Permission, error) {
+	p, err := a.parse(token)
+	if err != nil {
+		return "", err
+	}
+	if p.Expires != 0 && time.Now().Unix() >= p.Expires {
+		return "", ErrExpiredToken
+	}
+
+	revoked, err := a.ds.Has(revokedPrefix.ChildString(p.ID))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to check token revocation")
+	}
+	if revoked {
+		return "", ErrRevokedToken
+	}
+	return p.Perm, nil
+}
+
+// Revoke makes the token, which must have been issued by this authenticator,
+// invalid from now on.
+func (a *Authenticator) Revoke(token string) error {
+	p, err := a.parse(token)
+	if err != nil {
+		return err
+	}
+	if err := a.ds.Put(revokedPrefix.ChildString(p.ID), []byte{}); err != nil {
+		return errors.Wrap(err, "failed to record token revocation")
+	}
+	return nil
+}
+
+// parse checks the token's signature and returns its payload.
+func (a *Authenticator) parse(token string) (*tokenPayload, error) {
+	if token == "" {
+		return nil, ErrMissingToken
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, ErrInvalidToken
+	}
+
+	enc := base64.RawURLEncoding
+	payload, err := enc.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	mac, err := enc.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if !hmac.Equal(mac, a.sign(payload)) {
+		return nil, ErrInvalidToken
+	}
+
+	var p tokenPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if _, ok := permissionLevels[p.Perm]; !ok || p.ID == "" {
+		return nil, ErrInvalidToken
+	}
+	return &p, nil
+}
+
+func (a *Authenticator) sign(payload []byte) []byte {
+	h := hmac.New(sha256.New, a.secret)
+	h.Write(payload) // nolint: errcheck
+	return h.Sum(nil)
+}
+
+// TokenFromRequest extracts the API token from the bearer Authorization
+// header of an HTTP request. Tokens are never taken from the url, where they
+// would end up in access logs.
+func TokenFromRequest(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		return strings.TrimPrefix(h, "Bearer ")
+	}
+	return ""
+}
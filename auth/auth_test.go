@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+)
+
+func TestPermissionIncludes(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(PermAdmin.Includes(PermRead))
+	assert.True(PermAdmin.Includes(PermAdmin))
+	assert.True(PermSign.Includes(PermWrite))
+	assert.True(PermRead.Includes(PermRead))
+	assert.False(PermRead.Includes(PermWrite))
+	assert.False(PermWrite.Includes(PermSign))
+	assert.False(PermSign.Includes(PermAdmin))
+	assert.False(Permission("bogus").Includes(PermRead))
+}
+
+func TestParsePermission(t *testing.T) {
+	assert := assert.New(t)
+
+	p, err := ParsePermission("sign")
+	assert.NoError(err)
+	assert.Equal(PermSign, p)
+
+	_, err = ParsePermission("root")
+	assert.Error(err)
+}
+
+func TestTokens(t *testing.T) {
+	t.Run("tokens verify with the permission they were created with", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		a := NewAuthenticator([]byte("secret"), datastore.NewMapDatastore())
+		for _, perm := range []Permission{PermRead, PermWrite, PermSign, PermAdmin} {
+			tok, err := a.CreateToken(perm, 0)
+			require.NoError(err)
+
+			got, err := a.Verify(tok)
+			assert.NoError(err)
+			assert.Equal(perm, got)
+		}
+	})
+
+	t.Run("tokens from another secret are rejected", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		tok, err := NewAuthenticator([]byte("other"), datastore.NewMapDatastore()).CreateToken(PermAdmin, 0)
+		require.NoError(err)
+
+		_, err = NewAuthenticator([]byte("secret"), datastore.NewMapDatastore()).Verify(tok)
+		assert.Equal(ErrInvalidToken, err)
+	})
+
+	t.Run("expired tokens are rejected", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		a := NewAuthenticator([]byte("secret"), datastore.NewMapDatastore())
+		tok, err := a.CreateToken(PermRead, time.Hour)
+		require.NoError(err)
+		_, err = a.Verify(tok)
+		assert.NoError(err)
+
+		tok, err = a.CreateToken(PermRead, time.Nanosecond)
+		require.NoError(err)
+		_, err = a.Verify(tok)
+		assert.Equal(ErrExpiredToken, err)
+
+		_, err = a.CreateToken(PermRead, -time.Hour)
+		assert.Error(err)
+	})
+
+	t.Run("revoked tokens are rejected", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		ds := datastore.NewMapDatastore()
+		a := NewAuthenticator([]byte("secret"), ds)
+		revoked, err := a.CreateToken(PermAdmin, 0)
+		require.NoError(err)
+		kept, err := a.CreateToken(PermAdmin, 0)
+		require.NoError(err)
+
+		require.NoError(a.Revoke(revoked))
+		_, err = a.Verify(revoked)
+		assert.Equal(ErrRevokedToken, err)
+		_, err = a.Verify(kept)
+		assert.NoError(err)
+
+		// Revocations outlive the authenticator.
+		_, err = NewAuthenticator([]byte("secret"), ds).Verify(revoked)
+		assert.Equal(ErrRevokedToken, err)
+
+		assert.Equal(ErrInvalidToken, a.Revoke("not.valid"))
+	})
+
+	t.Run("malformed and missing tokens are rejected", func(t *testing.T) {
+		assert := assert.New(t)
+
+		a := NewAuthenticator([]byte("secret"), datastore.NewMapDatastore())
+		_, err := a.Verify("")
+		assert.Equal(ErrMissingToken, err)
+		_, err = a.Verify("not-a-token")
+		assert.Equal(ErrInvalidToken, err)
+		_, err = a.Verify("a.b.c")
+		assert.Equal(ErrInvalidToken, err)
+	})
+
+	t.Run("unknown permissions cannot be issued", func(t *testing.T) {
+		_, err := NewAuthenticator([]byte("secret"), datastore.NewMapDatastore()).CreateToken(Permission("root"), 0)
+		assert.Error(t, err)
+	})
+}
+
+func TestLoadOrCreateSecret(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ds := datastore.NewMapDatastore()
+	s1, err := LoadOrCreateSecret(ds)
+	require.NoError(err)
+	assert.Len(s1, secretLen)
+
+	s2, err := LoadOrCreateSecret(ds)
+	require.NoError(err)
+	assert.Equal(s1, s2)
+}
+
+func TestTokenFromRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	// Tokens in the url are ignored.
+	req := httptest.NewRequest("POST", "/api/id?token=fromquery", nil)
+	assert.Equal("", TokenFromRequest(req))
+
+	req.Header.Set("Authorization", "Bearer fromheader")
+	assert.Equal("fromheader", TokenFromRequest(req))
+}
@@ -17,13 +17,22 @@ var ErrMessageTooLarge = fmt.Errorf("attempted to read a message larger than the
 
 // MsgReader is a cbor message reader
 type MsgReader struct {
-	br *bufio.Reader
+	br      *bufio.Reader
+	maxSize uint64
 }
 
 // NewMsgReader returns a new MsgReader
 func NewMsgReader(r io.Reader) *MsgReader {
+	return NewMsgReaderSize(r, MaxMessageSize)
+}
+
+// NewMsgReaderSize returns a new MsgReader that accepts messages of up to
+// maxSize bytes, for protocols exchanging messages larger than
+// MaxMessageSize.
+func NewMsgReaderSize(r io.Reader, maxSize uint64) *MsgReader {
 	return &MsgReader{
-		br: bufio.NewReader(r),
+		br:      bufio.NewReader(r),
+		maxSize: maxSize,
 	}
 }
 
@@ -34,7 +43,7 @@ func (mr *MsgReader) ReadMsg(i interface{}) error {
 		return err
 	}
 
-	if l > MaxMessageSize {
+	if l > mr.maxSize {
 		return ErrMessageTooLarge
 	}
 
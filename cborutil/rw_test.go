@@ -42,3 +42,17 @@ func TestMessageSending(t *testing.T) {
 		assert.Equal(it, msg)
 	}
 }
+
+func TestMessageSizeLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	big := fooTestMessage{A: string(make([]byte, MaxMessageSize))}
+
+	buf := new(bytes.Buffer)
+	assert.NoError(NewMsgWriter(buf).WriteMsg(big))
+	assert.Equal(ErrMessageTooLarge, NewMsgReader(bytes.NewReader(buf.Bytes())).ReadMsg(&fooTestMessage{}))
+
+	var msg fooTestMessage
+	assert.NoError(NewMsgReaderSize(buf, 2*MaxMessageSize).ReadMsg(&msg))
+	assert.Equal(big, msg)
+}
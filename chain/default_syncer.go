@@ -61,6 +61,11 @@ type DefaultSyncer struct {
 	badTipSets *badTipSetCache
 	consensus  consensus.Protocol
 	chainStore Store
+
+	// statusMu protects status. It is separate from mu so that the status
+	// can be read while a sync is in progress.
+	statusMu sync.Mutex
+	status   SyncStatus
 }
 
 var _ Syncer = (*DefaultSyncer)(nil)
@@ -158,8 +163,15 @@ func (syncer *DefaultSyncer) collectChain(ctx context.Context, blkCids []cid.Cid
 			return chain, ts, nil
 		}
 
+		if len(chain) == 0 {
+			syncer.observeTarget(ts)
+		}
+
 		// Update values to traverse next tipset
 		chain = append([]types.TipSet{ts}, chain...)
+		syncer.updateStatus(func(s *SyncStatus) {
+			s.FetchedTipSets++
+		})
 		parentCidSet, err := ts.Parents()
 		if err != nil {
 			return nil, nil, err
@@ -230,6 +242,9 @@ func (syncer *DefaultSyncer) syncOne(ctx context.Context, parent, next types.Tip
 		return err
 	}
 	logSyncer.Debugf("Successfully updated store with %s", next.String())
+	syncer.updateStatus(func(s *SyncStatus) {
+		s.ValidatedTipSets++
+	})
 
 	// TipSet is validated and added to store, now check if it is the heaviest.
 	// If it is the heaviest update the chainStore.
@@ -317,7 +332,7 @@ func (syncer *DefaultSyncer) widen(ctx context.Context, ts types.TipSet) (types.
 // represent a valid extension. It limits the length of new chains it will
 // attempt to validate and caches invalid blocks it has encountered to
 // help prevent DOS.
-func (syncer *DefaultSyncer) HandleNewBlocks(ctx context.Context, blkCids []cid.Cid) error {
+func (syncer *DefaultSyncer) HandleNewBlocks(ctx context.Context, blkCids []cid.Cid) (err error) {
 	// ********** WARNING **********
 	//
 	// This concurrency model is flawed.  The mutex is held during a possibly
@@ -334,6 +349,25 @@ func (syncer *DefaultSyncer) HandleNewBlocks(ctx context.Context, blkCids []cid.
 		return nil
 	}
 
+	syncer.updateStatus(func(s *SyncStatus) {
+		s.Stage = SyncFetching
+		s.FetchedTipSets = 0
+		s.ValidatedTipSets = 0
+		s.SyncStarted = time.Now()
+	})
+	defer func() {
+		syncer.updateStatus(func(s *SyncStatus) {
+			s.Stage = SyncIdle
+			// Keep the target and the error of a failed sync, so the status
+			// shows the node is behind and why until a sync succeeds.
+			if err != nil {
+				s.LastError = err.Error()
+				return
+			}
+			s.LastError = ""
+		})
+	}()
+
 	// Walk the chain given by the input blocks back to a known tipset in
 	// the store. This is the only code that may go to the network to
 	// resolve cids to blocks.
@@ -342,6 +376,10 @@ func (syncer *DefaultSyncer) HandleNewBlocks(ctx context.Context, blkCids []cid.
 		return err
 	}
 
+	syncer.updateStatus(func(s *SyncStatus) {
+		s.Stage = SyncValidating
+	})
+
 	// Try adding the tipsets of the chain to the store, checking for new
 	// heaviest tipsets.
 	for i, ts := range chain {
@@ -367,3 +405,35 @@ func (syncer *DefaultSyncer) HandleNewBlocks(ctx context.Context, blkCids []cid.
 	}
 	return nil
 }
+
+// Status returns a snapshot of the syncer's progress.
+func (syncer *DefaultSyncer) Status() SyncStatus {
+	syncer.statusMu.Lock()
+	status := syncer.status
+	syncer.statusMu.Unlock()
+
+	status.CurrentHeight, _ = syncer.chainStore.Head().Height()
+	return status
+}
+
+// updateStatus applies f to the syncer's status under the status lock.
+func (syncer *DefaultSyncer) updateStatus(f func(*SyncStatus)) {
+	syncer.statusMu.Lock()
+	defer syncer.statusMu.Unlock()
+	f(&syncer.status)
+}
+
+// observeTarget records ts as the sync target if it is higher than the
+// current target.
+func (syncer *DefaultSyncer) observeTarget(ts types.TipSet) {
+	h, err := ts.Height()
+	if err != nil {
+		return
+	}
+	syncer.updateStatus(func(s *SyncStatus) {
+		if s.TargetHead.Len() == 0 || h > s.TargetHeight {
+			s.TargetHead = ts.ToSortedCidSet()
+			s.TargetHeight = h
+		}
+	})
+}
@@ -511,6 +511,48 @@ func TestBlocksNotATipSet(t *testing.T) {
 	assertNoAdd(assert, chainStore, badCids)
 }
 
+// Syncer reports its progress through its status.
+func TestSyncStatus(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	syncer, _, cst, _ := initSyncTestDefault(require)
+	ctx := context.Background()
+
+	status := syncer.Status()
+	assert.Equal(chain.SyncIdle, status.Stage)
+	assert.Equal(0, status.TargetHead.Len())
+	assert.False(status.Syncing())
+
+	h4, err := link4.Height()
+	require.NoError(err)
+
+	// A sync failing to fetch the ancestors of its target keeps reporting
+	// the target, and the error.
+	cids4 := requirePutBlocks(require, cst, link4.ToSlice()...)
+	require.Error(syncer.HandleNewBlocks(ctx, cids4))
+
+	status = syncer.Status()
+	assert.Equal(chain.SyncIdle, status.Stage)
+	assert.Equal(h4, status.TargetHeight)
+	assert.NotEmpty(status.LastError)
+	assert.True(status.Syncing())
+
+	_ = requirePutBlocks(require, cst, link1.ToSlice()...)
+	_ = requirePutBlocks(require, cst, link2.ToSlice()...)
+	_ = requirePutBlocks(require, cst, link3.ToSlice()...)
+	require.NoError(syncer.HandleNewBlocks(ctx, cids4))
+
+	status = syncer.Status()
+	assert.Equal(chain.SyncIdle, status.Stage)
+	assert.True(link4.ToSortedCidSet().Equals(status.TargetHead))
+	assert.Equal(h4, status.TargetHeight)
+	assert.Equal(h4, status.CurrentHeight)
+	assert.Equal(uint64(4), status.FetchedTipSets)
+	assert.Equal(uint64(4), status.ValidatedTipSets)
+	assert.Empty(status.LastError)
+	assert.False(status.Syncing())
+}
+
 /* particularly tricky edge cases relating to subtle Expected Consensus requirements */
 
 // Syncer is capable of recovering from a fork reorg after Load.
@@ -0,0 +1,63 @@
+package chain
+
+import (
+	"time"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// SyncStage describes what the syncer is currently doing.
+type SyncStage int
+
+const (
+	// SyncIdle means the syncer is not working on a chain.
+	SyncIdle = SyncStage(iota)
+	// SyncFetching means the syncer is collecting the blocks of a new chain.
+	SyncFetching
+	// SyncValidating means the syncer is running state transitions over the
+	// tipsets of a newly collected chain.
+	SyncValidating
+)
+
+func (s SyncStage) String() string {
+	switch s {
+	case SyncIdle:
+		return "idle"
+	case SyncFetching:
+		return "fetching"
+	case SyncValidating:
+		return "validating"
+	default:
+		return "unknown"
+	}
+}
+
+// SyncStatus is a snapshot of the syncer's progress.
+type SyncStatus struct {
+	// Stage is what the syncer is currently doing.
+	Stage SyncStage
+	// TargetHead is the head of the highest chain the syncer has been asked
+	// to sync, empty if it has never been asked to sync.
+	TargetHead types.SortedCidSet
+	// TargetHeight is the height of TargetHead.
+	TargetHeight uint64
+	// CurrentHeight is the height of the chain store's head.
+	CurrentHeight uint64
+	// FetchedTipSets is the number of new tipsets collected by the most
+	// recent sync.
+	FetchedTipSets uint64
+	// ValidatedTipSets is the number of those tipsets the most recent sync
+	// has validated and added to the store.
+	ValidatedTipSets uint64
+	// SyncStarted is when the most recent sync began.
+	SyncStarted time.Time
+	// LastError is the error the most recent sync failed with. It is kept
+	// until a sync succeeds.
+	LastError string
+}
+
+// Syncing returns true iff the syncer is working on a chain, or knows of a
+// chain higher than its head it has not yet caught up to.
+func (s SyncStatus) Syncing() bool {
+	return s.Stage != SyncIdle || s.TargetHeight > s.CurrentHeight
+}
@@ -19,4 +19,7 @@ import (
 // after too many blocks.
 type Syncer interface {
 	HandleNewBlocks(ctx context.Context, blkCids []cid.Cid) error
+
+	// Status returns a snapshot of the syncer's progress.
+	Status() SyncStatus
 }
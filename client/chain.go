@@ -0,0 +1,56 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// ChainHead runs `chain head`, returning the cids of the head tipset.
+func (c *Client) ChainHead(ctx context.Context) ([]cid.Cid, error) {
+	var out []cid.Cid
+	err := c.call(ctx, newRequest("chain", "head"), &out)
+	return out, err
+}
+
+// ChainLs runs `chain ls`, returning the blocks of each tipset from the
+// head back to genesis.
+func (c *Client) ChainLs(ctx context.Context) ([][]types.Block, error) {
+	var out [][]types.Block
+	err := c.stream(ctx, newRequest("chain", "ls"), func(dec *json.Decoder) error {
+		var blks []types.Block
+		if err := dec.Decode(&blks); err != nil {
+			return err
+		}
+		out = append(out, blks)
+		return nil
+	})
+	return out, err
+}
+
+// ChainStatus is the output of `chain status`.
+type ChainStatus struct {
+	// Syncing is true while the node is catching up to the best chain it
+	// knows of.
+	Syncing bool
+	// Stage is one of "idle", "fetching" or "validating".
+	Stage            string
+	TargetHead       types.SortedCidSet
+	TargetHeight     uint64
+	CurrentHeight    uint64
+	FetchedTipSets   uint64
+	ValidatedTipSets uint64
+	LastError        string
+}
+
+// ChainStatus runs `chain status`.
+func (c *Client) ChainStatus(ctx context.Context) (*ChainStatus, error) {
+	var out ChainStatus
+	if err := c.call(ctx, newRequest("chain", "status"), &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
@@ -0,0 +1,250 @@
+// Package client is a typed Go client for the daemon's command API. Each
+// method wraps a go-filecoin command, e.g. Client.MessageSend runs
+// `go-filecoin message send`, taking and returning Go values rather than
+// command line strings and JSON.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	ma "gx/ipfs/QmNTCey11oxhb1AxDnQBRHtdhap6Ctud872NjAYPYYXPuc/go-multiaddr"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	"gx/ipfs/QmZcLBXKaFe8ND5YHPkJRAwmhJGrVsi1JqDZNyJ4nRK5Mj/go-multiaddr-net"
+	"gx/ipfs/QmdcULN1WCzgoQmcCaUAmEhwcxHYsDrbZ2LvRJKCL8dMrK/go-homedir"
+
+	"github.com/filecoin-project/go-filecoin/repo"
+)
+
+// apiPrefix is the path under which the daemon serves commands.
+const apiPrefix = "/api"
+
+// streamErrorTrailer is the trailer the daemon sets when a command fails
+// after it has started writing its output.
+const streamErrorTrailer = "X-Stream-Error"
+
+// Error is an error returned by a command run by the daemon.
+type Error struct {
+	Message string
+	Code    int
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Client runs commands against a daemon's API.
+type Client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// New returns a client for the daemon whose API listens on the multiaddr
+// apiAddr, as found in a repo's api file. token is sent with every request
+// and may be empty if the daemon does not require authentication.
+func New(apiAddr, token string) (*Client, error) {
+	maddr, err := ma.NewMultiaddr(apiAddr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid API address %s", apiAddr)
+	}
+	_, host, err := manet.DialArgs(maddr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to dial API address %s", apiAddr)
+	}
+
+	return &Client{
+		baseURL: "http://" + host + apiPrefix,
+		token:   token,
+		http:    &http.Client{},
+	}, nil
+}
+
+// NewFromRepo returns a client for the daemon running on the repo at
+// repoDir, using the API address and token the daemon wrote there.
+func NewFromRepo(repoDir string) (*Client, error) {
+	dir, err := homedir.Expand(repoDir)
+	if err != nil {
+		return nil, err
+	}
+
+	apiAddr, err := repo.APIAddrFromFile(filepath.Join(dir, repo.APIFile))
+	if err != nil {
+		return nil, errors.Wrap(err, "can't read API address from repo (is the daemon running?)")
+	}
+	token, err := repo.APITokenFromFile(filepath.Join(dir, repo.APITokenFile))
+	if err != nil {
+		return nil, errors.Wrap(err, "can't read API token from repo")
+	}
+
+	return New(apiAddr, token)
+}
+
+// request is a single command invocation.
+type request struct {
+	path    []string
+	args    []string
+	options url.Values
+	// file, if not nil, is sent as the command's file argument.
+	file io.Reader
+}
+
+func newRequest(path ...string) *request {
+	return &request{path: path, options: url.Values{}}
+}
+
+// arg appends positional arguments.
+func (r *request) arg(args ...string) *request {
+	r.args = append(r.args, args...)
+	return r
+}
+
+// opt sets an option, unless value is empty.
+func (r *request) opt(name, value string) *request {
+	if value != "" {
+		r.options.Set(name, value)
+	}
+	return r
+}
+
+// boolOpt sets a boolean option if it is true.
+func (r *request) boolOpt(name string, value bool) *request {
+	if value {
+		r.options.Set(name, "true")
+	}
+	return r
+}
+
+// send runs the request and returns the response, which the caller must
+// close. Errors reported by the daemon before any output are returned as
+// *Error.
+func (c *Client) send(ctx context.Context, r *request) (*http.Response, error) {
+	q := url.Values{}
+	for k, vs := range r.options {
+		q[k] = vs
+	}
+	for _, a := range r.args {
+		q.Add("arg", a)
+	}
+	q.Set("encoding", "json")
+	q.Set("stream-channels", "true")
+
+	u := c.baseURL + "/" + strings.Join(r.path, "/") + "?" + q.Encode()
+
+	var body io.Reader
+	contentType := ""
+	if r.file != nil {
+		var err error
+		body, contentType, err = multipartFile(r.file)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close() // nolint: errcheck
+		return nil, readError(res)
+	}
+	return res, nil
+}
+
+// call runs the request and decodes its single output value into out, which
+// may be nil if the output is not needed.
+func (c *Client) call(ctx context.Context, r *request, out interface{}) error {
+	return c.stream(ctx, r, func(dec *json.Decoder) error {
+		if out == nil {
+			var ignored json.RawMessage
+			return dec.Decode(&ignored)
+		}
+		return dec.Decode(out)
+	})
+}
+
+// stream runs the request and calls next for each output value until the
+// output is exhausted. next must decode exactly one value from dec.
+func (c *Client) stream(ctx context.Context, r *request, next func(dec *json.Decoder) error) error {
+	res, err := c.send(ctx, r)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close() // nolint: errcheck
+
+	dec := json.NewDecoder(res.Body)
+	for dec.More() {
+		if err := next(dec); err != nil {
+			return err
+		}
+	}
+
+	// Drain the body so the trailers are available.
+	io.Copy(ioutil.Discard, res.Body) // nolint: errcheck
+	if msg := res.Trailer.Get(streamErrorTrailer); msg != "" {
+		return &Error{Message: msg}
+	}
+	return nil
+}
+
+func readError(res *http.Response) error {
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	var e Error
+	if json.Unmarshal(data, &e) == nil && e.Message != "" {
+		return &e
+	}
+	msg := strings.TrimSpace(string(data))
+	if msg == "" {
+		msg = res.Status
+	}
+	return &Error{Message: fmt.Sprintf("%s (HTTP %d)", msg, res.StatusCode)}
+}
+
+// multipartFile encodes data as the single file of a multipart form, as the
+// daemon expects file arguments.
+func multipartFile(data io.Reader) (io.Reader, string, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="file"; filename="file"`)
+	header.Set("Content-Type", "application/octet-stream")
+	part, err := w.CreatePart(header)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := io.Copy(part, data); err != nil {
+		return nil, "", err
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return &buf, "multipart/form-data; boundary=" + w.Boundary(), nil
+}
@@ -0,0 +1,218 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/auth"
+	"github.com/filecoin-project/go-filecoin/client"
+	"github.com/filecoin-project/go-filecoin/commands"
+	"github.com/filecoin-project/go-filecoin/node"
+	"github.com/filecoin-project/go-filecoin/proofs"
+	"github.com/filecoin-project/go-filecoin/protocol/storage"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// testNode is a started node holding the genesis miner, served over HTTP.
+type testNode struct {
+	seed      *node.ChainSeed
+	minerAddr address.Address
+	stop      func()
+}
+
+// newTestClient starts a node holding the genesis miner and returns a client
+// for its API, authenticated with a token granting perm. The caller must
+// call stop when done.
+func newTestClient(t *testing.T, perm auth.Permission) (*client.Client, *testNode) {
+	ctx := context.Background()
+
+	seed := node.MakeChainSeed(t, node.TestGenCfg)
+	nd := node.MakeNodeWithChainSeed(t, seed, []node.ConfigOpt{})
+	seed.GiveKey(t, nd, 0)
+	minerAddr, _ := seed.GiveMiner(t, nd, 0)
+	require.NoError(t, nd.Start(ctx))
+
+	authenticator := auth.NewAuthenticator([]byte("test secret"), datastore.NewMapDatastore())
+	token, err := authenticator.CreateToken(perm, 0)
+	require.NoError(t, err)
+
+	handler, err := commands.NewAPIHandler(nd, nd.Repo.Config(), authenticator)
+	require.NoError(t, err)
+	ts := httptest.NewServer(handler)
+
+	tn := &testNode{
+		seed:      seed,
+		minerAddr: minerAddr,
+		stop: func() {
+			ts.Close()
+			nd.Stop(ctx)
+		},
+	}
+
+	c, err := client.New("/ip4/127.0.0.1/tcp/"+ts.URL[strings.LastIndex(ts.URL, ":")+1:], token)
+	require.NoError(t, err)
+	return c, tn
+}
+
+func TestClientWallet(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	c, tn := newTestClient(t, auth.PermAdmin)
+	defer tn.stop()
+	owner := tn.seed.Addr(t, 0)
+
+	addrs, err := c.WalletAddrs(ctx)
+	require.NoError(t, err)
+	assert.Contains(addrs, owner)
+
+	balance, err := c.WalletBalance(ctx, owner)
+	require.NoError(t, err)
+	assert.Equal(types.NewAttoFILFromFIL(10000), balance)
+
+	addr, err := c.WalletNewAddr(ctx)
+	require.NoError(t, err)
+	keys, err := c.WalletExport(ctx, addr)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+
+	// Import the exported key into a second node's wallet.
+	other, otherNode := newTestClient(t, auth.PermAdmin)
+	defer otherNode.stop()
+	imported, err := other.WalletImport(ctx, keys...)
+	require.NoError(t, err)
+	assert.Equal([]address.Address{addr}, imported)
+}
+
+func TestClientChain(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	c, tn := newTestClient(t, auth.PermRead)
+	defer tn.stop()
+
+	head, err := c.ChainHead(ctx)
+	require.NoError(t, err)
+	require.Len(t, head, 1)
+
+	tipsets, err := c.ChainLs(ctx)
+	require.NoError(t, err)
+	require.Len(t, tipsets, 1)
+	assert.Equal(head[0], tipsets[0][0].Cid())
+
+	status, err := c.ChainStatus(ctx)
+	require.NoError(t, err)
+	assert.False(status.Syncing)
+}
+
+func TestClientMessages(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	c, tn := newTestClient(t, auth.PermAdmin)
+	defer tn.stop()
+	seed := tn.seed
+
+	res, err := c.MessageSend(ctx, client.MessageSendRequest{
+		GasOptions: client.GasOptions{GasPrice: types.NewAttoFILFromFIL(1), GasLimit: types.NewGasUnits(300)},
+		From:       seed.Addr(t, 0),
+		To:         seed.Addr(t, 1),
+		Value:      10,
+	})
+	require.NoError(t, err)
+	assert.False(res.Preview)
+
+	pending, err := c.MpoolLs(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(seed.Addr(t, 1), pending[0].To)
+
+	require.NoError(t, c.MpoolRemove(ctx, res.Cid))
+	pending, err = c.MpoolLs(ctx, 0)
+	require.NoError(t, err)
+	assert.Empty(pending)
+}
+
+func TestClientMiner(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	c, tn := newTestClient(t, auth.PermRead)
+	defer tn.stop()
+
+	owner, err := c.MinerOwner(ctx, tn.minerAddr)
+	require.NoError(t, err)
+	assert.Equal(tn.seed.Addr(t, 0), owner)
+
+	power, err := c.MinerPower(ctx, tn.minerAddr)
+	require.NoError(t, err)
+	assert.True(power.Power <= power.Total)
+
+	candidates, err := c.ClientFindMiners(ctx)
+	require.NoError(t, err)
+	for _, candidate := range candidates {
+		assert.NotNil(candidate.Price)
+	}
+}
+
+func TestClientData(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	c, tn := newTestClient(t, auth.PermAdmin)
+	defer tn.stop()
+
+	data := []byte("some data to store")
+	dataCid, err := c.ClientImport(ctx, bytes.NewReader(data))
+	require.NoError(t, err)
+
+	r, err := c.ClientCat(ctx, dataCid)
+	require.NoError(t, err)
+	defer r.Close() // nolint: errcheck
+	out, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(data, out)
+
+	commitment, err := c.ClientPieceCommitment(ctx, dataCid)
+	require.NoError(t, err)
+	assert.Equal(uint64(len(data)), commitment.Size)
+	expected, err := proofs.GeneratePieceCommitment(bytes.NewReader(data), uint64(len(data)))
+	require.NoError(t, err)
+	assert.Equal(expected, commitment.CommP)
+
+	deals, err := c.ClientListDeals(ctx, storage.DealFilter{State: storage.Accepted})
+	require.NoError(t, err)
+	assert.Empty(deals)
+}
+
+func TestClientErrors(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	c, tn := newTestClient(t, auth.PermRead)
+	defer tn.stop()
+
+	// Creating addresses requires write permission.
+	_, err := c.WalletNewAddr(ctx)
+	require.Error(t, err)
+	_, ok := err.(*client.Error)
+	assert.True(ok)
+
+	_, err = c.MinerOwner(ctx, address.Address{})
+	assert.Error(err)
+}
@@ -0,0 +1,96 @@
+package client
+
+import (
+	"context"
+	"strconv"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// GasOptions are the gas parameters of commands that send messages.
+type GasOptions struct {
+	// GasPrice is the price to pay per unit of gas, required.
+	GasPrice *types.AttoFIL
+	// GasLimit is the most gas the message may consume.
+	GasLimit types.GasUnits
+	// Preview estimates the gas the message would use instead of sending
+	// it.
+	Preview bool
+}
+
+func (r *request) gas(g GasOptions) *request {
+	price := types.ZeroAttoFIL
+	if g.GasPrice != nil {
+		price = g.GasPrice
+	}
+	return r.
+		opt("price", price.String()).
+		opt("limit", strconv.FormatUint(uint64(g.GasLimit), 10)).
+		boolOpt("preview", g.Preview)
+}
+
+// fromOpt sets the from option unless from is empty.
+func (r *request) fromOpt(from address.Address) *request {
+	if from == (address.Address{}) {
+		return r
+	}
+	return r.opt("from", from.String())
+}
+
+// MessageResponse is the output of commands that send a single message.
+type MessageResponse struct {
+	// Cid is the cid of the message sent, undefined for previews.
+	Cid cid.Cid
+	// GasUsed is the estimated gas use of a previewed message.
+	GasUsed types.GasUnits
+	Preview bool
+}
+
+// MessageSendRequest are the parameters of MessageSend.
+type MessageSendRequest struct {
+	GasOptions
+
+	// From is the address to send from, the node's default address if empty.
+	From address.Address
+	To   address.Address
+	// Value is the whole number of FIL to send.
+	Value uint64
+	// Method is the actor method to invoke, empty for a plain transfer.
+	Method string
+}
+
+// MessageSend runs `message send`.
+func (c *Client) MessageSend(ctx context.Context, req MessageSendRequest) (*MessageResponse, error) {
+	r := newRequest("message", "send").
+		arg(req.To.String()).
+		fromOpt(req.From).
+		opt("method", req.Method).
+		gas(req.GasOptions)
+	if req.Value > 0 {
+		r.opt("value", strconv.FormatUint(req.Value, 10))
+	}
+	return c.messageCall(ctx, r)
+}
+
+// MessageWaitResponse is the output of MessageWait.
+type MessageWaitResponse struct {
+	Message *types.SignedMessage
+	Receipt *types.MessageReceipt
+	// Signature is the signature of the method called, needed to decode the
+	// receipt's return value. It is nil for plain transfers.
+	Signature *exec.FunctionSignature
+}
+
+// MessageWait runs `message wait`, waiting until the message with the given
+// cid is mined.
+func (c *Client) MessageWait(ctx context.Context, msgCid cid.Cid) (*MessageWaitResponse, error) {
+	var out MessageWaitResponse
+	if err := c.call(ctx, newRequest("message", "wait").arg(msgCid.String()), &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
@@ -0,0 +1,276 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/proofs/sectorbuilder"
+	"github.com/filecoin-project/go-filecoin/protocol/storage"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// MinerCreateRequest are the parameters of MinerCreate.
+type MinerCreateRequest struct {
+	GasOptions
+
+	From address.Address
+	// PeerID is the libp2p identity the miner will operate, the node's own
+	// if empty.
+	PeerID peer.ID
+	// Pledge is the number of sectors pledged.
+	Pledge     uint64
+	Collateral *types.AttoFIL
+}
+
+// MinerCreateResponse is the output of MinerCreate.
+type MinerCreateResponse struct {
+	// Address is the new miner's address, empty for previews.
+	Address address.Address
+	GasUsed types.GasUnits
+	Preview bool
+}
+
+// MinerCreate runs `miner create`, waiting for the miner to be created.
+func (c *Client) MinerCreate(ctx context.Context, req MinerCreateRequest) (*MinerCreateResponse, error) {
+	r := newRequest("miner", "create").
+		arg(strconv.FormatUint(req.Pledge, 10), req.Collateral.String()).
+		fromOpt(req.From).
+		gas(req.GasOptions)
+	if req.PeerID != "" {
+		r.opt("peerid", req.PeerID.Pretty())
+	}
+
+	var out MinerCreateResponse
+	if err := c.call(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// MinerSetPriceRequest are the parameters of MinerSetPrice.
+type MinerSetPriceRequest struct {
+	GasOptions
+
+	From address.Address
+	// Miner is the miner whose price is set, the node's miner if empty.
+	Miner address.Address
+	Price *types.AttoFIL
+	// Expiry is the number of blocks the ask is valid for.
+	Expiry uint64
+}
+
+// MinerSetPriceResponse is the output of MinerSetPrice.
+type MinerSetPriceResponse struct {
+	GasUsed               types.GasUnits
+	MinerSetPriceResponse struct {
+		AddAskCid cid.Cid
+		BlockCid  cid.Cid
+		MinerAddr address.Address
+		Price     *types.AttoFIL
+	}
+	Preview bool
+}
+
+// MinerSetPrice runs `miner set-price`, setting the node's storage price and
+// waiting for an ask at that price to be mined.
+func (c *Client) MinerSetPrice(ctx context.Context, req MinerSetPriceRequest) (*MinerSetPriceResponse, error) {
+	r := newRequest("miner", "set-price").
+		arg(req.Price.String(), strconv.FormatUint(req.Expiry, 10)).
+		fromOpt(req.From).
+		gas(req.GasOptions)
+	if req.Miner != (address.Address{}) {
+		r.opt("miner", req.Miner.String())
+	}
+
+	var out MinerSetPriceResponse
+	if err := c.call(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// MinerAddAskRequest are the parameters of MinerAddAsk.
+type MinerAddAskRequest struct {
+	GasOptions
+
+	From   address.Address
+	Miner  address.Address
+	Price  *types.AttoFIL
+	Expiry uint64
+}
+
+// MinerAddAsk runs `miner add-ask`. Prefer MinerSetPrice.
+func (c *Client) MinerAddAsk(ctx context.Context, req MinerAddAskRequest) (*MessageResponse, error) {
+	r := newRequest("miner", "add-ask").
+		arg(req.Miner.String(), req.Price.String(), strconv.FormatUint(req.Expiry, 10)).
+		fromOpt(req.From).
+		gas(req.GasOptions)
+	return c.messageCall(ctx, r)
+}
+
+// MinerUpdatePeerID runs `miner update-peerid`.
+func (c *Client) MinerUpdatePeerID(ctx context.Context, from, miner address.Address, pid peer.ID, gas GasOptions) (*MessageResponse, error) {
+	r := newRequest("miner", "update-peerid").
+		arg(miner.String(), pid.Pretty()).
+		fromOpt(from).
+		gas(gas)
+	return c.messageCall(ctx, r)
+}
+
+// MinerOwner runs `miner owner`, returning the address owning miner.
+func (c *Client) MinerOwner(ctx context.Context, miner address.Address) (address.Address, error) {
+	var out address.Address
+	err := c.call(ctx, newRequest("miner", "owner").arg(miner.String()), &out)
+	return out, err
+}
+
+// MinerWorker runs `miner worker`, returning the address that may send the
+// operational messages of miner.
+func (c *Client) MinerWorker(ctx context.Context, miner address.Address) (address.Address, error) {
+	var out address.Address
+	err := c.call(ctx, newRequest("miner", "worker").arg(miner.String()), &out)
+	return out, err
+}
+
+// MinerChangeWorker runs `miner change-worker`, making worker the worker of
+// miner. from must be the miner's owner.
+func (c *Client) MinerChangeWorker(ctx context.Context, from, miner, worker address.Address, gas GasOptions) (*MessageResponse, error) {
+	r := newRequest("miner", "change-worker").
+		arg(miner.String(), worker.String()).
+		fromOpt(from).
+		gas(gas)
+	return c.messageCall(ctx, r)
+}
+
+// MinerPledge runs `miner pledge`, returning the number of sectors miner
+// has pledged.
+func (c *Client) MinerPledge(ctx context.Context, miner address.Address) (uint64, error) {
+	var out string
+	if err := c.call(ctx, newRequest("miner", "pledge").arg(miner.String()), &out); err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(out, 10, 64)
+}
+
+// MinerListDeals runs `miner list-deals`, returning the deals made with this
+// node's miners that match filter.
+func (c *Client) MinerListDeals(ctx context.Context, filter storage.DealFilter) ([]*storage.DealSummary, error) {
+	var out []*storage.DealSummary
+	err := c.call(ctx, dealFilterRequest(newRequest("miner", "list-deals"), filter), &out)
+	return out, err
+}
+
+// MinerProvePiece runs `miner prove-piece`, proving that piece lies inside
+// the sealed sector the node's miner with address minerAddr stored it in.
+// An empty minerAddr selects the node's default miner, here and in the other
+// commands acting on one of the node's miners.
+func (c *Client) MinerProvePiece(ctx context.Context, minerAddr address.Address, piece cid.Cid) (*sectorbuilder.PieceInclusionProof, error) {
+	var out sectorbuilder.PieceInclusionProof
+	if err := c.call(ctx, newRequest("miner", "prove-piece").arg(piece.String()).minerOpt(minerAddr), &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// MinerPowerResponse is the output of MinerPower.
+type MinerPowerResponse struct {
+	// Power is the miner's power.
+	Power uint64
+	// Total is the power of the whole storage market.
+	Total uint64
+}
+
+// MinerPower runs `miner power`.
+func (c *Client) MinerPower(ctx context.Context, miner address.Address) (*MinerPowerResponse, error) {
+	var out string
+	if err := c.call(ctx, newRequest("miner", "power").arg(miner.String()), &out); err != nil {
+		return nil, err
+	}
+
+	var res MinerPowerResponse
+	if _, err := fmt.Sscanf(out, "%d / %d", &res.Power, &res.Total); err != nil {
+		return nil, fmt.Errorf("unexpected power %q: %s", out, err)
+	}
+	return &res, nil
+}
+
+// MinerSectorsLs runs `miner sectors ls`, describing the sectors of the
+// node's miner with address minerAddr.
+func (c *Client) MinerSectorsLs(ctx context.Context, minerAddr address.Address) ([]*storage.SectorStatus, error) {
+	var out []*storage.SectorStatus
+	if err := c.call(ctx, newRequest("miner", "sectors", "ls").minerOpt(minerAddr), &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// MinerSectorStatus runs `miner sectors status`, describing the sector with
+// the given id of the node's miner with address minerAddr.
+func (c *Client) MinerSectorStatus(ctx context.Context, minerAddr address.Address, sectorID uint64) (*storage.SectorStatus, error) {
+	var out storage.SectorStatus
+	r := newRequest("miner", "sectors", "status").arg(strconv.FormatUint(sectorID, 10)).minerOpt(minerAddr)
+	if err := c.call(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// MinerSealNow runs `miner seal-now`, sealing the sector with the given id,
+// or every staged sector if sectorID is nil, of the node's miner with address
+// minerAddr.
+func (c *Client) MinerSealNow(ctx context.Context, minerAddr address.Address, sectorID *uint64) error {
+	r := newRequest("miner", "seal-now").minerOpt(minerAddr)
+	if sectorID != nil {
+		r = r.arg(strconv.FormatUint(*sectorID, 10))
+	}
+	return c.call(ctx, r, nil)
+}
+
+// MinerProvingInfo runs `miner proving info`, describing the current proving
+// period of the node's miner with address minerAddr.
+func (c *Client) MinerProvingInfo(ctx context.Context, minerAddr address.Address) (*storage.ProvingInfo, error) {
+	var out storage.ProvingInfo
+	if err := c.call(ctx, newRequest("miner", "proving", "info").minerOpt(minerAddr), &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// MinerStorageLs runs `miner storage ls`, describing the storage paths of
+// this node's miner.
+func (c *Client) MinerStorageLs(ctx context.Context) ([]*sectorbuilder.StoragePathUsage, error) {
+	var out []*sectorbuilder.StoragePathUsage
+	if err := c.call(ctx, newRequest("miner", "storage", "ls"), &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// MinerStorageAttach runs `miner storage attach`, adding a storage path.
+func (c *Client) MinerStorageAttach(ctx context.Context, p sectorbuilder.StoragePath) error {
+	r := newRequest("miner", "storage", "attach").arg(p.Path).
+		opt("role", string(p.Role)).
+		opt("weight", strconv.FormatUint(uint64(p.Weight), 10)).
+		opt("max-bytes", strconv.FormatUint(p.MaxBytes, 10))
+	return c.call(ctx, r, nil)
+}
+
+// MinerStorageDetach runs `miner storage detach`, removing an empty storage
+// path.
+func (c *Client) MinerStorageDetach(ctx context.Context, path string) error {
+	return c.call(ctx, newRequest("miner", "storage", "detach").arg(path), nil)
+}
+
+// minerOpt selects the node's miner a miner command acts on, unless minerAddr
+// is empty.
+func (r *request) minerOpt(minerAddr address.Address) *request {
+	if minerAddr == (address.Address{}) {
+		return r
+	}
+	return r.opt("miner", minerAddr.String())
+}
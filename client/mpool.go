@@ -0,0 +1,28 @@
+package client
+
+import (
+	"context"
+	"strconv"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// MpoolLs runs `mpool ls`, returning the messages in the node's pool. If
+// waitForCount is positive it blocks until the pool holds that many.
+func (c *Client) MpoolLs(ctx context.Context, waitForCount uint) ([]*types.SignedMessage, error) {
+	r := newRequest("mpool", "ls")
+	if waitForCount > 0 {
+		r.opt("wait-for-count", strconv.FormatUint(uint64(waitForCount), 10))
+	}
+
+	var out []*types.SignedMessage
+	err := c.call(ctx, r, &out)
+	return out, err
+}
+
+// MpoolRemove runs `mpool rm`, removing a message from the node's pool.
+func (c *Client) MpoolRemove(ctx context.Context, msgCid cid.Cid) error {
+	return c.call(ctx, newRequest("mpool", "rm").arg(msgCid.String()), nil)
+}
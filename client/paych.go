@@ -0,0 +1,114 @@
+package client
+
+import (
+	"context"
+
+	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// PaychCreateRequest are the parameters of PaychCreate.
+type PaychCreateRequest struct {
+	GasOptions
+
+	From   address.Address
+	Target address.Address
+	Amount *types.AttoFIL
+	// Eol is the block height at which the channel expires.
+	Eol *types.BlockHeight
+}
+
+// PaychCreate runs `paych create`. The returned message creates the
+// channel; its receipt holds the channel id.
+func (c *Client) PaychCreate(ctx context.Context, req PaychCreateRequest) (*MessageResponse, error) {
+	r := newRequest("paych", "create").
+		arg(req.Target.String(), req.Amount.String(), req.Eol.String()).
+		fromOpt(req.From).
+		gas(req.GasOptions)
+	return c.messageCall(ctx, r)
+}
+
+// PaychLs runs `paych ls`, returning the channels paid by payer, keyed by
+// channel id. If payer is empty the channels of from are returned.
+func (c *Client) PaychLs(ctx context.Context, from, payer address.Address) (map[string]*paymentbroker.PaymentChannel, error) {
+	r := newRequest("paych", "ls").fromOpt(from)
+	if payer != (address.Address{}) {
+		r.opt("payer", payer.String())
+	}
+
+	var out map[string]*paymentbroker.PaymentChannel
+	err := c.call(ctx, r, &out)
+	return out, err
+}
+
+// PaychVoucherRequest are the parameters of PaychVoucher.
+type PaychVoucherRequest struct {
+	From    address.Address
+	Channel *types.ChannelID
+	Amount  *types.AttoFIL
+	// ValidAt is the smallest block height at which the voucher may be
+	// redeemed, if not nil.
+	ValidAt *types.BlockHeight
+}
+
+// PaychVoucher runs `paych voucher`, returning a base58 encoded signed
+// voucher.
+func (c *Client) PaychVoucher(ctx context.Context, req PaychVoucherRequest) (string, error) {
+	r := newRequest("paych", "voucher").
+		arg(req.Channel.String(), req.Amount.String()).
+		fromOpt(req.From)
+	if req.ValidAt != nil {
+		r.opt("validat", req.ValidAt.String())
+	}
+
+	var out string
+	err := c.call(ctx, r, &out)
+	return out, err
+}
+
+// PaychRedeem runs `paych redeem`, redeeming an encoded voucher.
+func (c *Client) PaychRedeem(ctx context.Context, from address.Address, voucher string, gas GasOptions) (*MessageResponse, error) {
+	return c.messageCall(ctx, newRequest("paych", "redeem").arg(voucher).fromOpt(from).gas(gas))
+}
+
+// PaychClose runs `paych close`, redeeming an encoded voucher and closing
+// its channel.
+func (c *Client) PaychClose(ctx context.Context, from address.Address, voucher string, gas GasOptions) (*MessageResponse, error) {
+	return c.messageCall(ctx, newRequest("paych", "close").arg(voucher).fromOpt(from).gas(gas))
+}
+
+// PaychReclaim runs `paych reclaim`, returning the funds of an expired
+// channel to its payer.
+func (c *Client) PaychReclaim(ctx context.Context, from address.Address, channel *types.ChannelID, gas GasOptions) (*MessageResponse, error) {
+	return c.messageCall(ctx, newRequest("paych", "reclaim").arg(channel.String()).fromOpt(from).gas(gas))
+}
+
+// PaychExtendRequest are the parameters of PaychExtend.
+type PaychExtendRequest struct {
+	GasOptions
+
+	From    address.Address
+	Channel *types.ChannelID
+	Amount  *types.AttoFIL
+	Eol     *types.BlockHeight
+}
+
+// PaychExtend runs `paych extend`, adding funds to a channel and moving its
+// expiry to Eol.
+func (c *Client) PaychExtend(ctx context.Context, req PaychExtendRequest) (*MessageResponse, error) {
+	r := newRequest("paych", "extend").
+		arg(req.Channel.String(), req.Amount.String(), req.Eol.String()).
+		fromOpt(req.From).
+		gas(req.GasOptions)
+	return c.messageCall(ctx, r)
+}
+
+// messageCall runs a command whose output is a MessageResponse.
+func (c *Client) messageCall(ctx context.Context, r *request) (*MessageResponse, error) {
+	var out MessageResponse
+	if err := c.call(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
@@ -0,0 +1,205 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+
+	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/api"
+	"github.com/filecoin-project/go-filecoin/porcelain"
+	"github.com/filecoin-project/go-filecoin/proofs"
+	"github.com/filecoin-project/go-filecoin/protocol/storage"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// ClientCat runs `client cat`, returning a reader of the data with the given
+// cid. The caller must close it.
+func (c *Client) ClientCat(ctx context.Context, data cid.Cid) (io.ReadCloser, error) {
+	res, err := c.send(ctx, newRequest("client", "cat").arg(data.String()))
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// ClientImport runs `client import`, adding the data read from r to the
+// node and returning its cid.
+func (c *Client) ClientImport(ctx context.Context, r io.Reader) (cid.Cid, error) {
+	req := newRequest("client", "import")
+	req.file = r
+
+	var out cid.Cid
+	err := c.call(ctx, req, &out)
+	return out, err
+}
+
+// ProposeStorageDealRequest are the parameters of ClientProposeStorageDeal.
+type ProposeStorageDealRequest struct {
+	Miner address.Address
+	// Data is the cid of the data to store, previously imported.
+	Data  cid.Cid
+	AskID uint64
+	// Duration is the number of blocks to store the data for.
+	Duration uint64
+	// AllowDuplicates allows proposing a deal for a piece the miner is
+	// already storing for us.
+	AllowDuplicates bool
+	// Offline delivers the data out of band, to be imported by the miner
+	// with ClientImportDealData, rather than pushing it.
+	Offline bool
+}
+
+// ClientProposeStorageDeal runs `client propose-storage-deal`.
+func (c *Client) ClientProposeStorageDeal(ctx context.Context, req ProposeStorageDealRequest) (*storage.DealResponse, error) {
+	r := newRequest("client", "propose-storage-deal").
+		arg(req.Miner.String(), req.Data.String(), strconv.FormatUint(req.AskID, 10), strconv.FormatUint(req.Duration, 10)).
+		boolOpt("allow-duplicates", req.AllowDuplicates).
+		boolOpt("offline", req.Offline)
+
+	var out storage.DealResponse
+	if err := c.call(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ClientProposeStorageDealAuto runs `client propose-storage-deal --auto`,
+// placing the data with the replicas best miners. Miner and AskID in req are
+// ignored. It returns the responses of the deals made, and an error if fewer
+// than replicas miners accepted.
+func (c *Client) ClientProposeStorageDealAuto(ctx context.Context, req ProposeStorageDealRequest, replicas uint) ([]*storage.DealResponse, error) {
+	r := newRequest("client", "propose-storage-deal").
+		arg(req.Data.String(), strconv.FormatUint(req.Duration, 10)).
+		boolOpt("auto", true).
+		opt("replicas", strconv.FormatUint(uint64(replicas), 10)).
+		boolOpt("allow-duplicates", req.AllowDuplicates).
+		boolOpt("offline", req.Offline)
+
+	var out []*storage.DealResponse
+	err := c.stream(ctx, r, func(dec *json.Decoder) error {
+		var resp storage.DealResponse
+		if err := dec.Decode(&resp); err != nil {
+			return err
+		}
+		out = append(out, &resp)
+		return nil
+	})
+	return out, err
+}
+
+// ClientImportDealData runs `client import-deal-data`, importing the data of
+// the offline deal with the given proposal cid from the CAR file read from r.
+func (c *Client) ClientImportDealData(ctx context.Context, proposal cid.Cid, r io.Reader) error {
+	req := newRequest("client", "import-deal-data").arg(proposal.String())
+	req.file = r
+
+	var out cid.Cid
+	return c.call(ctx, req, &out)
+}
+
+// ClientQueryStorageDeal runs `client query-storage-deal`, returning the
+// miner's latest response to the proposal with the given cid.
+func (c *Client) ClientQueryStorageDeal(ctx context.Context, proposal cid.Cid) (*storage.DealResponse, error) {
+	var out storage.DealResponse
+	if err := c.call(ctx, newRequest("client", "query-storage-deal").arg(proposal.String()), &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ClientDealHistory runs `client deal-history`, returning the signed
+// responses the miner sent for the proposal with the given cid.
+func (c *Client) ClientDealHistory(ctx context.Context, proposal cid.Cid) ([]*storage.DealResponse, error) {
+	var out []*storage.DealResponse
+	err := c.call(ctx, newRequest("client", "deal-history").arg(proposal.String()), &out)
+	return out, err
+}
+
+// ClientPieceCommitment runs `client piece-commitment`, returning the
+// commitment of the data with the given cid.
+func (c *Client) ClientPieceCommitment(ctx context.Context, data cid.Cid) (*proofs.PieceCommitment, error) {
+	var out proofs.PieceCommitment
+	if err := c.call(ctx, newRequest("client", "piece-commitment").arg(data.String()), &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ClientListDeals runs `client list-deals`, returning the deals this node
+// proposed as a client that match filter. Filtering by client is not
+// supported.
+func (c *Client) ClientListDeals(ctx context.Context, filter storage.DealFilter) ([]*storage.DealSummary, error) {
+	var out []*storage.DealSummary
+	err := c.call(ctx, dealFilterRequest(newRequest("client", "list-deals"), filter), &out)
+	return out, err
+}
+
+// dealFilterRequest sets the options of a list-deals request selecting the
+// deals matching filter.
+func dealFilterRequest(r *request, filter storage.DealFilter) *request {
+	if filter.State != storage.Unknown {
+		r.opt("state", filter.State.String())
+	}
+	if !filter.Miner.Empty() {
+		r.opt("miner", filter.Miner.String())
+	}
+	if !filter.Client.Empty() {
+		r.opt("client", filter.Client.String())
+	}
+	if filter.PieceRef.Defined() {
+		r.opt("piece", filter.PieceRef.String())
+	}
+	return r
+}
+
+// Ask is an ask in the storage market.
+type Ask struct {
+	Miner  address.Address
+	Price  *types.AttoFIL
+	Expiry *types.BlockHeight
+	ID     uint64
+}
+
+// ClientListAsks runs `client list-asks`.
+func (c *Client) ClientListAsks(ctx context.Context) ([]Ask, error) {
+	var out []Ask
+	err := c.stream(ctx, newRequest("client", "list-asks"), func(dec *json.Decoder) error {
+		var ask Ask
+		if err := dec.Decode(&ask); err != nil {
+			return err
+		}
+		out = append(out, ask)
+		return nil
+	})
+	return out, err
+}
+
+// ClientFindMiners runs `client find-miners`, returning the miners with
+// unexpired asks, best first.
+func (c *Client) ClientFindMiners(ctx context.Context) ([]*porcelain.MinerCandidate, error) {
+	var out []*porcelain.MinerCandidate
+	err := c.call(ctx, newRequest("client", "find-miners"), &out)
+	return out, err
+}
+
+// ClientFindProviders runs `client find-providers`, returning the peers that
+// may serve the piece with the given cid and their answers to a retrieval
+// query for it.
+func (c *Client) ClientFindProviders(ctx context.Context, piece cid.Cid) ([]*api.PieceProvider, error) {
+	var out []*api.PieceProvider
+	err := c.call(ctx, newRequest("client", "find-providers").arg(piece.String()), &out)
+	return out, err
+}
+
+// ClientPayments runs `client payments`, returning the vouchers paying for
+// the deal with the given proposal cid.
+func (c *Client) ClientPayments(ctx context.Context, proposal cid.Cid) ([]*paymentbroker.PaymentVoucher, error) {
+	var out []*paymentbroker.PaymentVoucher
+	err := c.call(ctx, newRequest("client", "payments").arg(proposal.String()), &out)
+	return out, err
+}
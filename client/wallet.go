@@ -0,0 +1,102 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// addressLsResponse is the output of `address ls` and `wallet import`.
+type addressLsResponse struct {
+	Addresses []string
+}
+
+func (r *addressLsResponse) parse() ([]address.Address, error) {
+	out := make([]address.Address, len(r.Addresses))
+	for i, s := range r.Addresses {
+		addr, err := address.NewFromString(s)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = addr
+	}
+	return out, nil
+}
+
+// WalletAddrs runs `address ls`, returning the addresses in the node's
+// wallet.
+func (c *Client) WalletAddrs(ctx context.Context) ([]address.Address, error) {
+	var out addressLsResponse
+	if err := c.call(ctx, newRequest("address", "ls"), &out); err != nil {
+		return nil, err
+	}
+	return out.parse()
+}
+
+// WalletNewAddr runs `address new`, creating a new address in the node's
+// wallet.
+func (c *Client) WalletNewAddr(ctx context.Context) (address.Address, error) {
+	var out struct {
+		Address string
+	}
+	if err := c.call(ctx, newRequest("address", "new"), &out); err != nil {
+		return address.Address{}, err
+	}
+	return address.NewFromString(out.Address)
+}
+
+// AddressLookup runs `address lookup`, returning the base58 encoded peer id
+// of the given miner.
+func (c *Client) AddressLookup(ctx context.Context, miner address.Address) (string, error) {
+	var out string
+	err := c.call(ctx, newRequest("address", "lookup").arg(miner.String()), &out)
+	return out, err
+}
+
+// WalletBalance runs `wallet balance`.
+func (c *Client) WalletBalance(ctx context.Context, addr address.Address) (*types.AttoFIL, error) {
+	var out types.AttoFIL
+	if err := c.call(ctx, newRequest("wallet", "balance").arg(addr.String()), &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// WalletExport runs `wallet export`, returning the key info of each address.
+func (c *Client) WalletExport(ctx context.Context, addrs ...address.Address) ([]*types.KeyInfo, error) {
+	r := newRequest("wallet", "export")
+	for _, addr := range addrs {
+		r.arg(addr.String())
+	}
+
+	var out struct {
+		KeyInfo []*types.KeyInfo
+	}
+	if err := c.call(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out.KeyInfo, nil
+}
+
+// WalletImport runs `wallet import`, adding the given keys to the node's
+// wallet and returning their addresses.
+func (c *Client) WalletImport(ctx context.Context, keys ...*types.KeyInfo) ([]address.Address, error) {
+	data, err := json.Marshal(struct {
+		KeyInfo []*types.KeyInfo
+	}{keys})
+	if err != nil {
+		return nil, err
+	}
+
+	r := newRequest("wallet", "import")
+	r.file = bytes.NewReader(data)
+
+	var out addressLsResponse
+	if err := c.call(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out.parse()
+}
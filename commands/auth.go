@@ -0,0 +1,113 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"gx/ipfs/QmQtQrtNioesAWtrx8csBvfY37gTe94d6wQ3VikZUjxD39/go-ipfs-cmds"
+	"gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
+
+	"github.com/filecoin-project/go-filecoin/auth"
+)
+
+var authCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Manage API authentication",
+	},
+	Subcommands: map[string]*cmds.Command{
+		"create-token": authCreateTokenCmd,
+		"revoke-token": authRevokeTokenCmd,
+	},
+}
+
+var authCreateTokenCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Create a new API token",
+		ShortDescription: `
+Creates a token granting the given permission. Permissions are read, write,
+sign and admin, each including all the permissions before it. Pass the token
+to other commands with --token or the FIL_API_TOKEN environment variable, or
+to HTTP clients in an "Authorization: Bearer <token>" header. Tokens never
+expire unless --expires-in is given, and can be revoked with revoke-token.
+`,
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("perm", "permission the token grants: read, write, sign or admin").WithDefault(string(auth.PermRead)),
+		cmdkit.StringOption("expires-in", "how long the token is valid for, e.g. 24h (default: forever)"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		perm, err := auth.ParsePermission(req.Options["perm"].(string))
+		if err != nil {
+			return err
+		}
+
+		var ttl time.Duration
+		if s, _ := req.Options["expires-in"].(string); s != "" {
+			if ttl, err = time.ParseDuration(s); err != nil || ttl <= 0 {
+				return fmt.Errorf("invalid expires-in %q, must be a positive duration such as 24h", s)
+			}
+		}
+
+		token, err := GetAuthenticator(env).CreateToken(perm, ttl)
+		if err != nil {
+			return err
+		}
+		return re.Emit(token)
+	},
+	Type: string(""),
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, token string) error {
+			_, err := fmt.Fprintln(w, token)
+			return err
+		}),
+	},
+}
+
+var authRevokeTokenCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline:          "Revoke an API token",
+		ShortDescription: `Makes the given token invalid. Requests made with it are rejected from now on.`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("token", true, false, "token to revoke"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		return GetAuthenticator(env).Revoke(req.Arguments[0])
+	},
+}
+
+// authHandler wraps an API handler, rejecting requests whose token does not
+// grant the permission required by the requested command. Requests for
+// commands which do not exist are passed through so the API can report them.
+func authHandler(a *auth.Authenticator, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// CORS preflight requests never carry credentials.
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		path := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, APIPrefix), "/"), "/")
+		if _, err := rootCmdDaemon.Resolve(path); err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		perm, err := a.Verify(auth.TokenFromRequest(r))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		required := requiredPermission(path)
+		if !perm.Includes(required) {
+			http.Error(w, fmt.Sprintf("%s permission required to run %s", required, strings.Join(path, " ")), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,83 @@
+package commands
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	ma "gx/ipfs/QmNTCey11oxhb1AxDnQBRHtdhap6Ctud872NjAYPYYXPuc/go-multiaddr"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	"gx/ipfs/QmZcLBXKaFe8ND5YHPkJRAwmhJGrVsi1JqDZNyJ4nRK5Mj/go-multiaddr-net"
+
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+)
+
+func TestAuthDaemon(t *testing.T) {
+	t.Parallel()
+
+	t.Run("requests without a token are rejected", func(t *testing.T) {
+		t.Parallel()
+		require := require.New(t)
+
+		d := th.NewDaemon(t).Start()
+		defer d.ShutdownSuccess()
+
+		maddr, err := ma.NewMultiaddr(d.CmdAddr())
+		require.NoError(err)
+		_, host, err := manet.DialArgs(maddr)
+		require.NoError(err)
+
+		res, err := http.Get(fmt.Sprintf("http://%s/api/id", host))
+		require.NoError(err)
+		require.Equal(http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("read tokens can read but not export keys", func(t *testing.T) {
+		t.Parallel()
+		assert := assert.New(t)
+
+		d := th.NewDaemon(t).Start()
+		defer d.ShutdownSuccess()
+
+		token := d.RunSuccess("auth", "create-token", "--perm=read").ReadStdoutTrimNewlines()
+		addr := d.GetDefaultAddress()
+
+		out := d.RunSuccess("id", "--token", token).ReadStdout()
+		assert.Contains(out, "ID")
+
+		d.RunFail("admin permission required", "wallet", "export", addr, "--token", token)
+	})
+
+	t.Run("invalid tokens are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		d := th.NewDaemon(t).Start()
+		defer d.ShutdownSuccess()
+
+		d.RunFail("invalid API token", "id", "--token", "not.valid")
+	})
+
+	t.Run("revoked tokens are rejected", func(t *testing.T) {
+		t.Parallel()
+		assert := assert.New(t)
+
+		d := th.NewDaemon(t).Start()
+		defer d.ShutdownSuccess()
+
+		token := d.RunSuccess("auth", "create-token", "--perm=read", "--expires-in=1h").ReadStdoutTrimNewlines()
+		assert.Contains(d.RunSuccess("id", "--token", token).ReadStdout(), "ID")
+
+		d.RunSuccess("auth", "revoke-token", token)
+		d.RunFail("revoked API token", "id", "--token", token)
+	})
+
+	t.Run("unknown permissions are refused", func(t *testing.T) {
+		t.Parallel()
+
+		d := th.NewDaemon(t).Start()
+		defer d.ShutdownSuccess()
+
+		d.RunFail("unknown permission", "auth", "create-token", "--perm=root")
+	})
+}
@@ -11,6 +11,7 @@ import (
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	"gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
 
+	"github.com/filecoin-project/go-filecoin/chain"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
@@ -19,8 +20,9 @@ var chainCmd = &cmds.Command{
 		Tagline: "Inspect the filecoin blockchain",
 	},
 	Subcommands: map[string]*cmds.Command{
-		"head": chainHeadCmd,
-		"ls":   chainLsCmd,
+		"head":   chainHeadCmd,
+		"ls":     chainLsCmd,
+		"status": chainStatusCmd,
 	},
 }
 
@@ -102,3 +104,57 @@ var chainLsCmd = &cmds.Command{
 		}),
 	},
 }
+
+var chainStatusCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline:          "Show the progress of chain syncing",
+		ShortDescription: `Shows the current sync stage, the height of the local chain and the height of the highest chain the node knows of.`,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		return re.Emit(newChainStatusResult(GetPorcelainAPI(env).ChainSyncStatus()))
+	},
+	Type: chainStatusResult{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, res *chainStatusResult) error {
+			var output strings.Builder
+			output.WriteString(fmt.Sprintf("Syncing:\t%t\n", res.Syncing))
+			output.WriteString(fmt.Sprintf("Stage:\t\t%s\n", res.Stage))
+			output.WriteString(fmt.Sprintf("Height:\t\t%d\n", res.CurrentHeight))
+			output.WriteString(fmt.Sprintf("Target Height:\t%d\n", res.TargetHeight))
+			output.WriteString(fmt.Sprintf("Target Head:\t%s\n", res.TargetHead.String()))
+			output.WriteString(fmt.Sprintf("Fetched:\t%d\n", res.FetchedTipSets))
+			output.WriteString(fmt.Sprintf("Validated:\t%d\n", res.ValidatedTipSets))
+			if res.LastError != "" {
+				output.WriteString(fmt.Sprintf("Last Error:\t%s\n", res.LastError))
+			}
+			_, err := fmt.Fprint(w, output.String())
+			return err
+		}),
+	},
+}
+
+// chainStatusResult is the output of the chain status command. The stage is
+// rendered as a string so it reads well in JSON output.
+type chainStatusResult struct {
+	Syncing          bool
+	Stage            string
+	TargetHead       types.SortedCidSet
+	TargetHeight     uint64
+	CurrentHeight    uint64
+	FetchedTipSets   uint64
+	ValidatedTipSets uint64
+	LastError        string
+}
+
+func newChainStatusResult(status chain.SyncStatus) *chainStatusResult {
+	return &chainStatusResult{
+		Syncing:          status.Syncing(),
+		Stage:            status.Stage.String(),
+		TargetHead:       status.TargetHead,
+		TargetHeight:     status.TargetHeight,
+		CurrentHeight:    status.CurrentHeight,
+		FetchedTipSets:   status.FetchedTipSets,
+		ValidatedTipSets: status.ValidatedTipSets,
+		LastError:        status.LastError,
+	}
+}
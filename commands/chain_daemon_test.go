@@ -110,4 +110,24 @@ func TestChainDaemon(t *testing.T) {
 		assert.Contains(chainLsResult, "1")
 		assert.Contains(chainLsResult, "0")
 	})
+
+	t.Run("chain status reports an idle syncer on a fresh node", func(t *testing.T) {
+		t.Parallel()
+		assert := assert.New(t)
+		require := require.New(t)
+
+		daemon := th.NewDaemon(t).Start()
+		defer daemon.ShutdownSuccess()
+
+		var status chainStatusResult
+		statusJSON := daemon.RunSuccess("chain", "status", "--enc", "json").ReadStdoutTrimNewlines()
+		require.NoError(json.Unmarshal([]byte(statusJSON), &status))
+
+		assert.False(status.Syncing)
+		assert.Equal("idle", status.Stage)
+		assert.Equal(uint64(0), status.CurrentHeight)
+
+		statusText := daemon.RunSuccess("chain", "status").ReadStdoutTrimNewlines()
+		assert.Contains(statusText, "Stage:\t\tidle")
+	})
 }
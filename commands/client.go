@@ -4,15 +4,20 @@ import (
 	"fmt"
 	"io"
 	"strconv"
+	"strings"
+	"time"
 
 	"gx/ipfs/QmQmhotPUzVrMEWNK3x1R5jQ5ZHWyL7tVUrmRPjrBrvyCb/go-ipfs-files"
 	"gx/ipfs/QmQtQrtNioesAWtrx8csBvfY37gTe94d6wQ3VikZUjxD39/go-ipfs-cmds"
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
 	"gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
 
 	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/api"
+	"github.com/filecoin-project/go-filecoin/porcelain"
+	"github.com/filecoin-project/go-filecoin/proofs"
 	"github.com/filecoin-project/go-filecoin/protocol/storage"
 )
 
@@ -24,8 +29,14 @@ var clientCmd = &cmds.Command{
 		"cat":                  clientCatCmd,
 		"import":               clientImportDataCmd,
 		"propose-storage-deal": clientProposeStorageDealCmd,
+		"import-deal-data":     clientImportDealDataCmd,
 		"query-storage-deal":   clientQueryStorageDealCmd,
+		"deal-history":         clientDealHistoryCmd,
+		"piece-commitment":     clientPieceCommitmentCmd,
+		"list-deals":           clientListDealsCmd,
 		"list-asks":            clientListAsksCmd,
+		"find-miners":          clientFindMinersCmd,
+		"find-providers":       clientFindProvidersCmd,
 		"payments":             paymentsCmd,
 	},
 }
@@ -111,20 +122,51 @@ Duration should be specified with the number of blocks for which to store the
 data. New blocks are generated about every 30 seconds, so the time given should
 be represented as a count of 30 second intervals. For example, 1 minute would
 be 2, 1 hour would be 120, and 1 day would be 2880.
+
+Once the deal is accepted the data is pushed to the miner. With --offline the
+data is instead delivered out of band, as a CAR file the miner imports with the
+following command:
+
+$ go-filecoin client import-deal-data <proposal> <file>
+
+With --auto the miner and ask are not given. The data is instead placed with
+the --replicas best miners, as ranked by the following command, and a response
+is returned for each deal made:
+
+$ go-filecoin client find-miners
+
+$ go-filecoin client propose-storage-deal --auto --replicas=3 <data> <duration>
 `,
 	},
 	Arguments: []cmdkit.Argument{
-		cmdkit.StringArg("miner", true, false, "Address of miner to send storage proposal"),
-		cmdkit.StringArg("data", true, false, "CID of the data to be stored"),
-		cmdkit.StringArg("ask", true, false, "ID of ask for which to propose a deal"),
-		cmdkit.StringArg("duration", true, false, "Time in blocks (about 30 seconds per block) to store data"),
+		cmdkit.StringArg("miner", false, false, "Address of miner to send storage proposal, unless --auto is set"),
+		cmdkit.StringArg("data", false, false, "CID of the data to be stored"),
+		cmdkit.StringArg("ask", false, false, "ID of ask for which to propose a deal, unless --auto is set"),
+		cmdkit.StringArg("duration", false, false, "Time in blocks (about 30 seconds per block) to store data"),
 	},
 	Options: []cmdkit.Option{
 		cmdkit.BoolOption("allow-duplicates", "Allows duplicate proposals to be created. Unless this flag is set, you will not be able to make more than one deal per piece per miner. This protection exists to prevent erroneous duplicate deals."),
+		cmdkit.BoolOption("offline", "Deliver the data out of band rather than pushing it to the miner"),
+		cmdkit.BoolOption("auto", "Choose the miners and asks automatically"),
+		cmdkit.UintOption("replicas", "Number of miners to store the data with when --auto is set").WithDefault(uint(1)),
 	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
 		allowDuplicates, _ := req.Options["allow-duplicates"].(bool)
 
+		transfer := storage.TransferPush
+		if offline, _ := req.Options["offline"].(bool); offline {
+			transfer = storage.TransferOffline
+		}
+
+		if auto, _ := req.Options["auto"].(bool); auto {
+			replicas, _ := req.Options["replicas"].(uint)
+			return proposeStorageDealsAuto(req, re, env, replicas, allowDuplicates, transfer)
+		}
+
+		if len(req.Arguments) != 4 {
+			return errors.New("expected a miner, data, ask and duration, or --auto with data and duration")
+		}
+
 		miner, err := address.NewFromString(req.Arguments[0])
 		if err != nil {
 			return err
@@ -145,7 +187,7 @@ be 2, 1 hour would be 120, and 1 day would be 2880.
 			return err
 		}
 
-		resp, err := GetAPI(env).Client().ProposeStorageDeal(req.Context, data, miner, askid, duration, allowDuplicates)
+		resp, err := GetAPI(env).Client().ProposeStorageDeal(req.Context, data, miner, askid, duration, allowDuplicates, transfer)
 		if err != nil {
 			return err
 		}
@@ -163,6 +205,106 @@ be 2, 1 hour would be 120, and 1 day would be 2880.
 	},
 }
 
+// proposeStorageDealsAuto proposes deals for the data to the best miners
+// found by ClientFindMiners until replicas of them accept, emitting each
+// accepted deal's response.
+func proposeStorageDealsAuto(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment, replicas uint, allowDuplicates bool, transfer storage.TransferMode) error {
+	if len(req.Arguments) != 2 {
+		return errors.New("expected data and duration with --auto")
+	}
+	if replicas == 0 {
+		return errors.New("--replicas must be at least 1")
+	}
+
+	data, err := cid.Decode(req.Arguments[0])
+	if err != nil {
+		return err
+	}
+
+	duration, err := strconv.ParseUint(req.Arguments[1], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	candidates, err := GetPorcelainAPI(env).ClientFindMiners(req.Context)
+	if err != nil {
+		return err
+	}
+
+	var placed uint
+	var failures []string
+	for _, c := range candidates {
+		if placed == replicas {
+			break
+		}
+		if !c.Reachable {
+			continue
+		}
+
+		resp, err := GetAPI(env).Client().ProposeStorageDeal(req.Context, data, c.Miner, c.AskID, duration, allowDuplicates, transfer)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", c.Miner, err))
+			continue
+		}
+		if err := re.Emit(resp); err != nil {
+			return err
+		}
+		placed++
+	}
+
+	if placed < replicas {
+		msg := fmt.Sprintf("placed %d of %d replicas", placed, replicas)
+		if len(failures) > 0 {
+			msg += ": " + strings.Join(failures, "; ")
+		}
+		return errors.New(msg)
+	}
+	return nil
+}
+
+var clientImportDealDataCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Import the data of an offline storage deal",
+		ShortDescription: `
+Imports the data of a storage deal proposed with --offline into the miner. The
+file must be a CAR file whose only root is the deal's piece. It is checked
+against the proposal before the piece is staged.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("proposal", true, false, "CID of the deal proposal"),
+		cmdkit.FileArg("file", true, false, "Path to the CAR file holding the deal's data").EnableStdin(),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		proposal, err := cid.Decode(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		iter := req.Files.Entries()
+		if !iter.Next() {
+			return fmt.Errorf("no file given: %s", iter.Err())
+		}
+
+		fi, ok := iter.Node().(files.File)
+		if !ok {
+			return fmt.Errorf("given file was not a files.File")
+		}
+
+		if err := GetAPI(env).Client().ImportDealData(req.Context, proposal, fi); err != nil {
+			return err
+		}
+
+		return re.Emit(proposal)
+	},
+	Type: cid.Cid{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, c cid.Cid) error {
+			return PrintString(w, c)
+		}),
+	},
+}
+
 var clientQueryStorageDealCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Query a storage deal's status",
@@ -170,6 +312,13 @@ var clientQueryStorageDealCmd = &cmds.Command{
 Checks the status of the storage deal proposal specified by the id. The deal
 status and deal message will be returned as a formatted string unless another
 format is specified with the --enc flag.
+
+Once the miner reports the deal posted, the client checks that the sector it
+was sealed into is committed on chain with matching commitments, and that the
+miner's piece inclusion proof is valid. If so the deal status is verified,
+otherwise the message tells which check failed. Nodes running rust-fil-proofs
+cannot check piece inclusion proofs yet, so for them the status is
+sector-verified once the sector checks pass.
 `,
 	},
 	Arguments: []cmdkit.Argument{
@@ -198,6 +347,274 @@ format is specified with the --enc flag.
 	},
 }
 
+var clientDealHistoryCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show the signed responses a miner sent for a storage deal",
+		ShortDescription: `
+Prints every distinct response the miner sent for the storage deal proposal
+specified by the id, oldest first. Each response is signed by the miner's
+worker, so they serve as evidence of what the miner agreed to in a dispute.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("id", true, false, "CID of deal to show the history of"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		propcid, err := cid.Decode(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		history, err := GetAPI(env).Client().DealHistory(req.Context, propcid)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(history)
+	},
+	Type: []*storage.DealResponse{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, history []*storage.DealResponse) error {
+			for _, resp := range history {
+				fmt.Fprintf(w, "%s\t%s\t%x\n", resp.State, resp.Message, []byte(resp.Signature)) // nolint: errcheck
+			}
+			return nil
+		}),
+	},
+}
+
+var clientPieceCommitmentCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Compute the piece commitment of imported data",
+		ShortDescription: `
+Computes the commitment (CommP) of the data with the given cid, which must be
+available to this node, as a miner would store it in a sector. Together with a
+proof from 'go-filecoin miner prove-piece' it shows that the data lies inside
+a sector the miner committed on chain.
+
+Only nodes running with insecure proofs (proofs.insecure in their config)
+compute piece commitments. rust-fil-proofs builds the CommD of a sector with
+a different tree, which these commitments cannot be checked against.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("cid", true, false, "CID of the data to compute the commitment of"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		data, err := cid.Decode(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		commitment, err := GetAPI(env).Client().PieceCommitment(req.Context, data)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(commitment)
+	},
+	Type: proofs.PieceCommitment{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, commitment *proofs.PieceCommitment) error {
+			fmt.Fprintf(w, "CommP: %x\n", commitment.CommP) // nolint: errcheck
+			fmt.Fprintf(w, "Size: %d\n", commitment.Size)   // nolint: errcheck
+			return nil
+		}),
+	},
+}
+
+var clientListDealsCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "List the storage deals made by this node",
+		ShortDescription: `
+Lists the storage deals this node proposed as a client, most recently changed
+first. Deals can be filtered by state, miner and piece. Results are returned as
+a tab separated table with the deal id, state, miner, piece, size, price,
+duration, sector and time of the last state change.
+`,
+	},
+	Options: dealFilterOptions("miner"),
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		filter, err := dealFilterFromOptions(req)
+		if err != nil {
+			return err
+		}
+
+		deals, err := GetAPI(env).Client().ListDeals(req.Context, filter)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(deals)
+	},
+	Type:     []*storage.DealSummary{},
+	Encoders: dealSummariesEncoders,
+}
+
+// dealFilterOptions returns the options of the list-deals commands. Clients
+// filter deals by miner and miners by client, as named by party.
+func dealFilterOptions(party string) []cmdkit.Option {
+	return []cmdkit.Option{
+		cmdkit.StringOption("state", "only list deals in this state, e.g. accepted, staged or posted"),
+		cmdkit.StringOption(party, fmt.Sprintf("only list deals with this %s address", party)),
+		cmdkit.StringOption("piece", "only list deals of the piece with this CID"),
+	}
+}
+
+// dealFilterFromOptions returns the filter selected by the options of a
+// list-deals command.
+func dealFilterFromOptions(req *cmds.Request) (storage.DealFilter, error) {
+	var filter storage.DealFilter
+	var err error
+
+	if s, ok := req.Options["state"].(string); ok && s != "" {
+		filter.State, err = storage.ParseDealState(s)
+		if err != nil {
+			return filter, err
+		}
+	}
+	if s, ok := req.Options["miner"].(string); ok && s != "" {
+		filter.Miner, err = address.NewFromString(s)
+		if err != nil {
+			return filter, errors.Wrap(err, "invalid miner address")
+		}
+	}
+	if s, ok := req.Options["client"].(string); ok && s != "" {
+		filter.Client, err = address.NewFromString(s)
+		if err != nil {
+			return filter, errors.Wrap(err, "invalid client address")
+		}
+	}
+	if s, ok := req.Options["piece"].(string); ok && s != "" {
+		filter.PieceRef, err = cid.Decode(s)
+		if err != nil {
+			return filter, errors.Wrap(err, "invalid piece CID")
+		}
+	}
+	return filter, nil
+}
+
+var dealSummariesEncoders = cmds.EncoderMap{
+	cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, deals []*storage.DealSummary) error {
+		if _, err := fmt.Fprintln(w, "ID\tState\tMiner\tClient\tPiece\tSize\tPrice\tDuration\tSector\tChanged"); err != nil {
+			return err
+		}
+		for _, d := range deals {
+			sector := "-"
+			if d.SectorID != nil {
+				sector = strconv.FormatUint(*d.SectorID, 10)
+			}
+			_, err := fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n", d.ProposalCid, d.State, d.Miner, d.Client,
+				d.PieceRef, d.Size, d.TotalPrice, d.Duration, sector, d.StateChanged.Format(time.RFC3339))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}),
+}
+
+var clientFindMinersCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Find and rank the miners to store data with",
+		ShortDescription: `
+Lists the miners with unexpired asks, best first. Miners are ranked by whether
+they answer a ping, then by whether they have pledged sectors left to commit,
+then by the price of their cheapest ask and finally by power. Results are
+returned as a tab separated table with the miner, ask id, price, power,
+remaining pledge and ping latency.
+`,
+	},
+	Options: []cmdkit.Option{
+		cmdkit.UintOption("limit", "Only list this many miners"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		candidates, err := GetPorcelainAPI(env).ClientFindMiners(req.Context)
+		if err != nil {
+			return err
+		}
+
+		if limit, ok := req.Options["limit"].(uint); ok && limit > 0 && int(limit) < len(candidates) {
+			candidates = candidates[:limit]
+		}
+
+		return re.Emit(candidates)
+	},
+	Type: []*porcelain.MinerCandidate{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, candidates []*porcelain.MinerCandidate) error {
+			if _, err := fmt.Fprintln(w, "Miner\tAsk\tPrice\tPower\tPledge Left\tLatency"); err != nil {
+				return err
+			}
+			for _, c := range candidates {
+				latency := "unreachable"
+				if c.Reachable {
+					latency = c.Latency.String()
+				}
+				_, err := fmt.Fprintf(w, "%s\t%d\t%s\t%d\t%d\t%s\n", c.Miner, c.AskID, c.Price, c.Power, c.PledgeRemaining, latency)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+	},
+}
+
+var clientFindProvidersCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Find the miners that can serve a piece for retrieval",
+		ShortDescription: `
+Finds the peers that may hold the piece with the given CID, from the storage
+deals this node made for it and the providers of the piece in the DHT, then
+asks each of them whether it can serve the piece. Providers that have the piece are listed first, fastest
+first. Results are returned as a tab separated table with the peer, miner,
+where it was found, whether it has the piece, its size, the price per byte and
+the query latency.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("piece", true, false, "CID of the piece to find"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		pieceCid, err := cid.Decode(req.Arguments[0])
+		if err != nil {
+			return errors.Wrap(err, "invalid piece CID")
+		}
+
+		providers, err := GetAPI(env).RetrievalClient().FindProviders(req.Context, pieceCid)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(providers)
+	},
+	Type: []*api.PieceProvider{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, providers []*api.PieceProvider) error {
+			if _, err := fmt.Fprintln(w, "Peer\tMiner\tFound In\tAvailable\tSize\tPrice\tLatency"); err != nil {
+				return err
+			}
+			for _, p := range providers {
+				miner := "-"
+				if !p.Miner.Empty() {
+					miner = p.Miner.String()
+				}
+				available := strconv.FormatBool(p.Available)
+				if p.Error != "" {
+					available = "error: " + p.Error
+				}
+				_, err := fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", p.PeerID.Pretty(), miner, strings.Join(p.Sources, ","),
+					available, p.Size, p.PricePerByte, p.Latency)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+	},
+}
+
 var clientListAsksCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "List all asks in the storage market",
@@ -67,6 +67,7 @@ func TestStorageDealsAfterRestart(t *testing.T) {
 	minerDaemon.ConnectSuccess(clientDaemon)
 
 	assert.NotEmpty(clientDaemon.RunSuccess("client", "query-storage-deal", dealCid).ReadStdout())
+	assert.NotEmpty(clientDaemon.RunSuccess("client", "deal-history", dealCid).ReadStdout())
 }
 
 func TestDuplicateDeals(t *testing.T) {
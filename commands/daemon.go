@@ -19,10 +19,13 @@ import (
 	"gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
 
 	"github.com/filecoin-project/go-filecoin/api/impl"
+	"github.com/filecoin-project/go-filecoin/auth"
 	"github.com/filecoin-project/go-filecoin/config"
+	"github.com/filecoin-project/go-filecoin/metrics"
 	"github.com/filecoin-project/go-filecoin/mining"
 	"github.com/filecoin-project/go-filecoin/node"
 	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/rpc"
 )
 
 // exposed here, to be available during testing
@@ -122,18 +125,17 @@ func getRepo(req *cmds.Request) (repo.Repo, error) {
 	return repo.OpenFSRepo(getRepoDir(req))
 }
 
-func runAPIAndWait(ctx context.Context, node *node.Node, config *config.Config, req *cmds.Request) error {
-	api := impl.New(node)
-
-	if err := api.Daemon().Start(ctx); err != nil {
-		return err
-	}
-
+// NewAPIHandler returns the handler serving the node's HTTP API: commands
+// under APIPrefix, JSON-RPC at RPCPath and, if enabled, metrics. Requests are
+// authenticated with tokens issued by authenticator if the config requires
+// it. The node must be started separately.
+func NewAPIHandler(node *node.Node, config *config.Config, authenticator *auth.Authenticator) (http.Handler, error) {
 	servenv := &Env{
 		// TODO: should this be the passed in context?
-		ctx:          context.Background(),
-		api:          api,
-		porcelainAPI: node.PorcelainAPI,
+		ctx:           context.Background(),
+		api:           impl.New(node),
+		porcelainAPI:  node.PorcelainAPI,
+		authenticator: authenticator,
 	}
 
 	cfg := cmdhttp.NewServerConfig()
@@ -142,6 +144,43 @@ func runAPIAndWait(ctx context.Context, node *node.Node, config *config.Config,
 	cfg.SetAllowedMethods(config.API.AccessControlAllowMethods...)
 	cfg.SetAllowCredentials(config.API.AccessControlAllowCredentials)
 
+	var apiHandler http.Handler = cmdhttp.NewHandler(servenv, rootCmdDaemon, cfg)
+	if config.API.AuthRequired {
+		apiHandler = authHandler(authenticator, apiHandler)
+	}
+
+	rpcServer := rpc.NewServer()
+	rpcServer.SetAllowedOrigins(config.API.AccessControlAllowOrigin...)
+	if err := rpcServer.Register(rpc.FilecoinNamespace, rpc.NewFilecoinAPI(node.PorcelainAPI)); err != nil {
+		return nil, err
+	}
+	if config.API.AuthRequired {
+		rpcServer.SetAuthorizer(rpc.TokenAuthorizer(authenticator))
+	}
+
+	handler := http.NewServeMux()
+	handler.Handle("/debug/pprof/", http.DefaultServeMux)
+	handler.Handle(APIPrefix+"/", apiHandler)
+	handler.Handle(RPCPath, rpcServer)
+	if config.Metrics.PrometheusEnabled {
+		handler.Handle(config.Metrics.PrometheusEndpoint, metrics.Handler(metrics.DefaultRegistry, node.Metrics()))
+	}
+	return handler, nil
+}
+
+func runAPIAndWait(ctx context.Context, node *node.Node, config *config.Config, req *cmds.Request) error {
+	api := impl.New(node)
+
+	if err := api.Daemon().Start(ctx); err != nil {
+		return err
+	}
+
+	secret, err := auth.LoadOrCreateSecret(node.Repo.Datastore())
+	if err != nil {
+		return err
+	}
+	authenticator := auth.NewAuthenticator(secret, node.Repo.Datastore())
+
 	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
 	defer signal.Stop(sigCh)
 
@@ -159,9 +198,20 @@ func runAPIAndWait(ctx context.Context, node *node.Node, config *config.Config,
 	}
 	config.API.Address = apiLis.Multiaddr().String()
 
-	handler := http.NewServeMux()
-	handler.Handle("/debug/pprof/", http.DefaultServeMux)
-	handler.Handle(APIPrefix+"/", cmdhttp.NewHandler(servenv, rootCmdDaemon, cfg))
+	// write an admin token for local clients to use before serving any
+	// requests
+	adminToken, err := authenticator.CreateToken(auth.PermAdmin, 0)
+	if err != nil {
+		return err
+	}
+	if err := node.Repo.SetAPIToken(adminToken); err != nil {
+		return errors.Wrap(err, "Could not save API token to repo")
+	}
+
+	handler, err := NewAPIHandler(node, config, authenticator)
+	if err != nil {
+		return err
+	}
 
 	apiserv := http.Server{
 		Handler: handler,
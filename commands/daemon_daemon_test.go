@@ -57,9 +57,13 @@ func TestDaemonCORS(t *testing.T) {
 		_, host, err := manet.DialArgs(maddr)
 		assert.NoError(err)
 
+		token, err := td.APIToken()
+		assert.NoError(err)
+
 		url := fmt.Sprintf("http://%s/api/id", host)
 		req, err := http.NewRequest("GET", url, nil)
 		assert.NoError(err)
+		req.Header.Add("Authorization", "Bearer "+token)
 		req.Header.Add("Origin", "http://localhost:8080")
 		res, err := http.DefaultClient.Do(req)
 		assert.NoError(err)
@@ -67,6 +71,7 @@ func TestDaemonCORS(t *testing.T) {
 
 		req, err = http.NewRequest("GET", url, nil)
 		assert.NoError(err)
+		req.Header.Add("Authorization", "Bearer "+token)
 		req.Header.Add("Origin", "https://localhost:8080")
 		res, err = http.DefaultClient.Do(req)
 		assert.NoError(err)
@@ -74,6 +79,7 @@ func TestDaemonCORS(t *testing.T) {
 
 		req, err = http.NewRequest("GET", url, nil)
 		assert.NoError(err)
+		req.Header.Add("Authorization", "Bearer "+token)
 		req.Header.Add("Origin", "http://127.0.0.1:8080")
 		res, err = http.DefaultClient.Do(req)
 		assert.NoError(err)
@@ -81,6 +87,7 @@ func TestDaemonCORS(t *testing.T) {
 
 		req, err = http.NewRequest("GET", url, nil)
 		assert.NoError(err)
+		req.Header.Add("Authorization", "Bearer "+token)
 		req.Header.Add("Origin", "https://127.0.0.1:8080")
 		res, err = http.DefaultClient.Do(req)
 		assert.NoError(err)
@@ -99,9 +106,13 @@ func TestDaemonCORS(t *testing.T) {
 		_, host, err := manet.DialArgs(maddr)
 		assert.NoError(err)
 
+		token, err := td.APIToken()
+		assert.NoError(err)
+
 		url := fmt.Sprintf("http://%s/api/id", host)
 		req, err := http.NewRequest("GET", url, nil)
 		assert.NoError(err)
+		req.Header.Add("Authorization", "Bearer "+token)
 		req.Header.Add("Origin", "http://disallowed.origin")
 		res, err := http.DefaultClient.Do(req)
 		assert.NoError(err)
@@ -6,14 +6,16 @@ import (
 	cmds "gx/ipfs/QmQtQrtNioesAWtrx8csBvfY37gTe94d6wQ3VikZUjxD39/go-ipfs-cmds"
 
 	"github.com/filecoin-project/go-filecoin/api"
+	"github.com/filecoin-project/go-filecoin/auth"
 	"github.com/filecoin-project/go-filecoin/porcelain"
 )
 
 // Env is the environment passed to commands. Implements cmds.Environment.
 type Env struct {
-	ctx          context.Context
-	api          api.API
-	porcelainAPI *porcelain.API
+	ctx           context.Context
+	api           api.API
+	porcelainAPI  *porcelain.API
+	authenticator *auth.Authenticator
 }
 
 var _ cmds.Environment = (*Env)(nil)
@@ -39,3 +41,9 @@ func GetPorcelainAPI(env cmds.Environment) *porcelain.API {
 	ce := env.(*Env)
 	return ce.porcelainAPI
 }
+
+// GetAuthenticator returns the API token authenticator from the environment.
+func GetAuthenticator(env cmds.Environment) *auth.Authenticator {
+	ce := env.(*Env)
+	return ce.authenticator
+}
@@ -4,9 +4,11 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"syscall"
 
 	ma "gx/ipfs/QmNTCey11oxhb1AxDnQBRHtdhap6Ctud872NjAYPYYXPuc/go-multiaddr"
@@ -19,6 +21,7 @@ import (
 	"gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
 
 	"github.com/filecoin-project/go-filecoin/api/impl"
+	"github.com/filecoin-project/go-filecoin/auth"
 	"github.com/filecoin-project/go-filecoin/repo"
 	"github.com/filecoin-project/go-filecoin/types"
 )
@@ -30,9 +33,16 @@ const (
 	// OptionRepoDir is the name of the option for specifying the directory of the repo.
 	OptionRepoDir = "repodir"
 
+	// OptionToken is the name of the option for specifying the api token.
+	OptionToken = "token"
+
 	// APIPrefix is the prefix for the http version of the api.
 	APIPrefix = "/api"
 
+	// RPCPath is the path the JSON-RPC API is served on, both to HTTP POST
+	// requests and websocket connections.
+	RPCPath = "/rpc/v0"
+
 	// OfflineMode tells us if we should try to connect this Filecoin node to the network
 	OfflineMode = "offline"
 
@@ -91,6 +101,7 @@ START RUNNING FILECOIN
   go-filecoin init                   - Initialize a filecoin repo
   go-filecoin config <key> [<value>] - Get and set filecoin config values
   go-filecoin daemon                 - Start a long-running daemon process
+  go-filecoin auth                   - Manage API authentication
   go-filecoin wallet                 - Manage your filecoin wallets
   go-filecoin address                - Interact with addresses
 
@@ -101,6 +112,7 @@ STORE AND RETRIEVE DATA
 MINE
   go-filecoin miner                  - Manage a single miner actor
   go-filecoin mining                 - Manage all mining operations for a node
+  go-filecoin seal-worker            - Seal sectors for a mining daemon
 
 VIEW DATA STRUCTURES
   go-filecoin chain                  - Inspect the filecoin blockchain
@@ -129,6 +141,7 @@ TOOL COMMANDS
 	Options: []cmdkit.Option{
 		cmdkit.StringOption(OptionAPI, "set the api port to use"),
 		cmdkit.StringOption(OptionRepoDir, "set the directory of the repo, defaults to ~/.filecoin"),
+		cmdkit.StringOption(OptionToken, "set the api token to use, defaults to the admin token of the repo's running daemon"),
 		cmds.OptionEncodingType,
 		cmdkit.BoolOption("help", "Show the full command help text."),
 		cmdkit.BoolOption("h", "Show a short version of the command help text."),
@@ -143,14 +156,16 @@ var rootCmdDaemon = &cmds.Command{
 
 // all top level commands, not available to daemon
 var rootSubcmdsLocal = map[string]*cmds.Command{
-	"daemon": daemonCmd,
-	"init":   initCmd,
+	"daemon":      daemonCmd,
+	"init":        initCmd,
+	"seal-worker": sealWorkerCmd,
 }
 
 // all top level commands, available on daemon. set during init() to avoid configuration loops.
 var rootSubcmdsDaemon = map[string]*cmds.Command{
 	"actor":            actorCmd,
 	"address":          addrsCmd,
+	"auth":             authCmd,
 	"bootstrap":        bootstrapCmd,
 	"chain":            chainCmd,
 	"config":           configCmd,
@@ -171,6 +186,66 @@ var rootSubcmdsDaemon = map[string]*cmds.Command{
 	"wallet":           walletCmd,
 }
 
+// commandPermissions lists the permission an api token must grant to run each
+// daemon command. A command not listed requires the permission of its closest
+// listed parent, and commands with no listed parent require admin.
+var commandPermissions = map[string]auth.Permission{
+	"actor":                       auth.PermRead,
+	"address":                     auth.PermRead,
+	"address/new":                 auth.PermWrite,
+	"auth":                        auth.PermAdmin,
+	"bootstrap":                   auth.PermRead,
+	"chain":                       auth.PermRead,
+	"client":                      auth.PermRead,
+	"client/import":               auth.PermWrite,
+	"client/import-deal-data":     auth.PermWrite,
+	"client/propose-storage-deal": auth.PermSign,
+	"config":                      auth.PermAdmin,
+	"dag":                         auth.PermRead,
+	"id":                          auth.PermRead,
+	"log":                         auth.PermAdmin,
+	"message":                     auth.PermRead,
+	"message/send":                auth.PermSign,
+	"miner":                       auth.PermSign,
+	"miner/list-deals":            auth.PermRead,
+	"miner/owner":                 auth.PermRead,
+	"miner/power":                 auth.PermRead,
+	"miner/prove-piece":           auth.PermRead,
+	"miner/proving":               auth.PermRead,
+	"miner/seal-now":              auth.PermWrite,
+	"miner/sectors":               auth.PermRead,
+	"miner/storage":               auth.PermRead,
+	"miner/storage/attach":        auth.PermAdmin,
+	"miner/storage/detach":        auth.PermAdmin,
+	"miner/worker":                auth.PermRead,
+	"mining":                      auth.PermWrite,
+	"mpool":                       auth.PermRead,
+	"mpool/rm":                    auth.PermWrite,
+	"paych":                       auth.PermSign,
+	"paych/ls":                    auth.PermRead,
+	"ping":                        auth.PermRead,
+	"retrieval-client":            auth.PermWrite,
+	"show":                        auth.PermRead,
+	"swarm":                       auth.PermRead,
+	"swarm/connect":               auth.PermWrite,
+	"version":                     auth.PermRead,
+	"wallet":                      auth.PermAdmin,
+	"wallet/addrs":                auth.PermRead,
+	"wallet/addrs/new":            auth.PermWrite,
+	"wallet/balance":              auth.PermRead,
+}
+
+// requiredPermission returns the permission an api token must grant to run
+// the daemon command at the given path.
+func requiredPermission(path []string) auth.Permission {
+	for i := len(path); i > 0; i-- {
+		if perm, ok := commandPermissions[strings.Join(path[:i], "/")]; ok {
+			return perm
+		}
+	}
+	return auth.PermAdmin
+}
+
 func init() {
 	for k, v := range rootSubcmdsLocal {
 		rootCmd.Subcommands[k] = v
@@ -208,6 +283,21 @@ func (e *executor) Execute(req *cmds.Request, re cmds.ResponseEmitter, env cmds.
 		return e.exec.Execute(req, re, env)
 	}
 
+	token, _ := req.Options[OptionToken].(string)
+	if token == "" {
+		var err error
+		if token, err = getAPIToken(req); err != nil {
+			return err
+		}
+	}
+	// The http client sends options as url parameters, where the token would
+	// end up in access logs, so it is sent in a header instead. The client
+	// always uses the default http client.
+	delete(req.Options, OptionToken)
+	if token != "" {
+		http.DefaultClient.Transport = &tokenTransport{token: token, next: http.DefaultTransport}
+	}
+
 	client := cmdhttp.NewClient(e.api, cmdhttp.ClientWithAPIPrefix(APIPrefix))
 
 	res, err := client.Send(req)
@@ -226,6 +316,28 @@ func (e *executor) Execute(req *cmds.Request, re cmds.ResponseEmitter, env cmds.
 	return nil
 }
 
+// tokenTransport adds a bearer Authorization header with an api token to
+// each request it sends.
+type tokenTransport struct {
+	token string
+	next  http.RoundTripper
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.WithContext(req.Context())
+	req.Header = cloneHeader(req.Header)
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	return t.next.RoundTrip(req)
+}
+
+func cloneHeader(h http.Header) http.Header {
+	c := make(http.Header, len(h)+1)
+	for k, v := range h {
+		c[k] = append([]string(nil), v...)
+	}
+	return c
+}
+
 func makeExecutor(req *cmds.Request, env interface{}) (cmds.Executor, error) {
 	isDaemonRequired := requiresDaemon(req)
 	var api string
@@ -287,6 +399,28 @@ func getAPIAddress(req *cmds.Request) (string, error) {
 	return host, nil
 }
 
+// getAPIToken returns the token to authenticate api requests with: the
+// FIL_API_TOKEN env var if set, otherwise the admin token written to the repo
+// by a running daemon, if any.
+func getAPIToken(req *cmds.Request) (string, error) {
+	if envtoken := os.Getenv("FIL_API_TOKEN"); envtoken != "" {
+		return envtoken, nil
+	}
+
+	rawPath := filepath.Join(filepath.Clean(getRepoDir(req)), repo.APITokenFile)
+	tokenFilePath, err := homedir.Expand(rawPath)
+	if err != nil {
+		return "", errors.Wrap(err, fmt.Sprintf("can't resolve local repo path %s", rawPath))
+	}
+
+	token, err := repo.APITokenFromFile(tokenFilePath)
+	if err != nil {
+		// The daemon may be remote, or may not require authentication.
+		return "", nil
+	}
+	return token, nil
+}
+
 func requiresDaemon(req *cmds.Request) bool {
 	if req.Command == daemonCmd {
 		return false
@@ -296,6 +430,10 @@ func requiresDaemon(req *cmds.Request) bool {
 		return false
 	}
 
+	if req.Command == sealWorkerCmd {
+		return false
+	}
+
 	return true
 }
 
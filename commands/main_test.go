@@ -5,10 +5,12 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"strings"
 	"testing"
 
 	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
 
+	"github.com/filecoin-project/go-filecoin/auth"
 	"github.com/filecoin-project/go-filecoin/testhelpers"
 
 	"gx/ipfs/QmQtQrtNioesAWtrx8csBvfY37gTe94d6wQ3VikZUjxD39/go-ipfs-cmds"
@@ -29,6 +31,24 @@ func TestRequiresDaemon(t *testing.T) {
 	assert.False(requiresDaemon(reqWithoutDaemon))
 }
 
+func TestRequiredPermission(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(auth.PermRead, requiredPermission([]string{"chain", "ls"}))
+	assert.Equal(auth.PermRead, requiredPermission([]string{"wallet", "balance"}))
+	assert.Equal(auth.PermWrite, requiredPermission([]string{"wallet", "addrs", "new"}))
+	assert.Equal(auth.PermSign, requiredPermission([]string{"message", "send"}))
+	assert.Equal(auth.PermAdmin, requiredPermission([]string{"wallet", "export"}))
+	assert.Equal(auth.PermAdmin, requiredPermission([]string{"config"}))
+	assert.Equal(auth.PermAdmin, requiredPermission([]string{"not-a-command"}))
+
+	// every listed command must exist
+	for path := range commandPermissions {
+		_, err := rootCmdDaemon.Resolve(strings.Split(path, "/"))
+		assert.NoError(err, path)
+	}
+}
+
 func TestNoDaemonNoHang(t *testing.T) {
 	assert := assert.New(t)
 	require := require.New(t)
@@ -5,6 +5,7 @@ import (
 	"io"
 	"math/big"
 	"strconv"
+	"time"
 
 	"gx/ipfs/QmQtQrtNioesAWtrx8csBvfY37gTe94d6wQ3VikZUjxD39/go-ipfs-cmds"
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
@@ -14,6 +15,8 @@ import (
 
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/porcelain"
+	"github.com/filecoin-project/go-filecoin/proofs/sectorbuilder"
+	"github.com/filecoin-project/go-filecoin/protocol/storage"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
@@ -24,11 +27,19 @@ var minerCmd = &cmds.Command{
 	Subcommands: map[string]*cmds.Command{
 		"create":        minerCreateCmd,
 		"add-ask":       minerAddAskCmd,
+		"change-worker": minerChangeWorkerCmd,
+		"list-deals":    minerListDealsCmd,
 		"owner":         minerOwnerCmd,
 		"pledge":        minerPledgeCmd,
 		"power":         minerPowerCmd,
+		"prove-piece":   minerProvePieceCmd,
+		"proving":       minerProvingCmd,
+		"seal-now":      minerSealNowCmd,
+		"sectors":       minerSectorsCmd,
 		"set-price":     minerSetPriceCmd,
+		"storage":       minerStorageCmd,
 		"update-peerid": minerUpdatePeerIDCmd,
+		"worker":        minerWorkerCmd,
 	},
 }
 
@@ -468,6 +479,129 @@ var minerOwnerCmd = &cmds.Command{
 	},
 }
 
+var minerWorkerCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show the worker address of <miner>",
+		ShortDescription: `
+Given <miner> miner address, output the address that may send the miner's
+operational messages, such as its sector commitments and PoSts. It is the
+miner's owner until changed with 'go-filecoin miner change-worker'.
+`,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		minerAddr, err := optionalAddr(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+		workerAddr, err := GetAPI(env).Miner().GetWorker(req.Context, minerAddr)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(&workerAddr)
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("miner", true, false, "The address of the miner"),
+	},
+	Type: address.Address{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, a *address.Address) error {
+			return PrintString(w, a)
+		}),
+	},
+}
+
+type minerChangeWorkerResult struct {
+	Cid     cid.Cid
+	GasUsed types.GasUnits
+	Preview bool
+}
+
+var minerChangeWorkerCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Change the address that sends a miner's operational messages",
+		ShortDescription: `
+Issues a new message to the network making <worker> the worker of <miner>.
+The worker commits sectors, submits PoSts, adds asks and updates the peer id
+of the miner, so that the owner's key need not be kept on the mining machine.
+The message must be sent from the miner's owner. A node mining for the miner
+sends its messages from the new worker, whose key must be in its wallet.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("miner", true, false, "Address of the miner to change the worker of"),
+		cmdkit.StringArg("worker", true, false, "Address of the new worker"),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("from", "Address to send from, which must be the miner's owner"),
+		priceOption,
+		limitOption,
+		previewOption,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		minerAddr, err := address.NewFromString(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		workerAddr, err := address.NewFromString(req.Arguments[1])
+		if err != nil {
+			return errors.Wrap(err, "worker must be an address")
+		}
+
+		fromAddr, err := optionalAddr(req.Options["from"])
+		if err != nil {
+			return err
+		}
+
+		gasPrice, gasLimit, preview, err := parseGasOptions(req)
+		if err != nil {
+			return err
+		}
+
+		if preview {
+			usedGas, err := GetPorcelainAPI(env).MessagePreview(
+				req.Context,
+				fromAddr,
+				minerAddr,
+				"changeWorker",
+				workerAddr,
+			)
+			if err != nil {
+				return err
+			}
+
+			return re.Emit(&minerChangeWorkerResult{
+				Cid:     cid.Cid{},
+				GasUsed: usedGas,
+				Preview: true,
+			})
+		}
+
+		c, err := GetAPI(env).Miner().ChangeWorker(req.Context, fromAddr, minerAddr, gasPrice, gasLimit, workerAddr)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(&minerChangeWorkerResult{
+			Cid:     c,
+			GasUsed: types.NewGasUnits(0),
+			Preview: false,
+		})
+	},
+	Type: &minerChangeWorkerResult{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, res *minerChangeWorkerResult) error {
+			if res.Preview {
+				output := strconv.FormatUint(uint64(res.GasUsed), 10)
+				_, err := w.Write([]byte(output))
+				return err
+			}
+			return PrintString(w, res.Cid)
+		}),
+	},
+}
+
 var minerPowerCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Get the power of a miner versus the total storage market power",
@@ -501,3 +635,442 @@ Values will be output as a ratio where the first number is the miner power and s
 		}),
 	},
 }
+
+// nodeMinerOption selects which of the miners the node manages a command acts
+// on.
+var nodeMinerOption = cmdkit.StringOption("miner", "Address of the node's miner to act on, its default miner if not given")
+
+// nodeMinerAddr returns the address of the miner selected by the
+// nodeMinerOption of req, or the empty address for the node's default miner.
+func nodeMinerAddr(req *cmds.Request) (address.Address, error) {
+	s, ok := req.Options["miner"].(string)
+	if !ok || s == "" {
+		return address.Address{}, nil
+	}
+	minerAddr, err := address.NewFromString(s)
+	if err != nil {
+		return address.Address{}, errors.Wrap(err, "miner must be an address")
+	}
+	return minerAddr, nil
+}
+
+var minerListDealsCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "List the storage deals made with this node's miners",
+		ShortDescription: `
+Lists the storage deals clients proposed to this node's miners, most recently
+changed first. Deals can be filtered by state, miner, client and piece.
+Results are returned as a tab separated table with the deal id, state, miner,
+client, piece, size, price, duration, sector and time of the last state
+change.
+`,
+	},
+	Options: append(dealFilterOptions("client"), cmdkit.StringOption("miner", "only list deals with the node's miner with this address")),
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		filter, err := dealFilterFromOptions(req)
+		if err != nil {
+			return err
+		}
+
+		deals, err := GetAPI(env).Miner().ListDeals(req.Context, filter)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(deals)
+	},
+	Type:     []*storage.DealSummary{},
+	Encoders: dealSummariesEncoders,
+}
+
+var minerProvePieceCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Prove that a piece lies inside a sealed sector",
+		ShortDescription: `
+Generates a piece inclusion proof showing that the piece with the given cid,
+stored by this node's miner, lies inside the CommD of the sector it was sealed
+into. Anyone holding the piece's commitment, as printed by
+'go-filecoin client piece-commitment', can check the proof against the CommD
+the miner committed on chain without retrieving the piece.
+
+Only miners running with insecure proofs (proofs.insecure in their config)
+prove pieces. rust-fil-proofs builds the CommD of a sector with a different
+tree, which these proofs cannot be checked against.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("piece", true, false, "CID of the piece to prove"),
+	},
+	Options: []cmdkit.Option{
+		nodeMinerOption,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		minerAddr, err := nodeMinerAddr(req)
+		if err != nil {
+			return err
+		}
+
+		piece, err := cid.Decode(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		pip, err := GetAPI(env).Miner().ProvePiece(req.Context, minerAddr, piece)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(pip)
+	},
+	Type: sectorbuilder.PieceInclusionProof{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, pip *sectorbuilder.PieceInclusionProof) error {
+			fmt.Fprintf(w, "Sector: %d\n", pip.SectorID) // nolint: errcheck
+			fmt.Fprintf(w, "CommD: %x\n", pip.CommD)     // nolint: errcheck
+			fmt.Fprintf(w, "CommP: %x\n", pip.CommP)     // nolint: errcheck
+			fmt.Fprintf(w, "Size: %d\n", pip.PieceSize)  // nolint: errcheck
+			fmt.Fprintf(w, "Proof: %x\n", pip.Proof)     // nolint: errcheck
+			return nil
+		}),
+	},
+}
+
+var minerSectorsCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Inspect the sectors of this node's miner",
+	},
+	Subcommands: map[string]*cmds.Command{
+		"ls":     minerSectorsLsCmd,
+		"status": minerSectorsStatusCmd,
+	},
+}
+
+var minerSectorsLsCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "List the sectors of this node's miner",
+		ShortDescription: `
+Lists the staged, sealing, sealed and failed sectors of this node's miner,
+ordered by sector id. Results are returned as a tab separated table with the
+sector id, state, number of pieces, bytes used out of the sector's capacity
+and whether the sector's commitment is in the chain.
+`,
+	},
+	Options: []cmdkit.Option{
+		nodeMinerOption,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		minerAddr, err := nodeMinerAddr(req)
+		if err != nil {
+			return err
+		}
+
+		sectors, err := GetAPI(env).Miner().ListSectors(req.Context, minerAddr)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(sectors)
+	},
+	Type: []*storage.SectorStatus{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, sectors []*storage.SectorStatus) error {
+			if _, err := fmt.Fprintln(w, "ID\tState\tPieces\tBytes\tCommitted"); err != nil {
+				return err
+			}
+			for _, s := range sectors {
+				_, err := fmt.Fprintf(w, "%d\t%s\t%d\t%d/%d\t%s\n", s.SectorID, s.State, len(s.Pieces),
+					s.UserBytes(), s.MaxUserBytes, sectorCommitStatus(s))
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+	},
+}
+
+var minerSectorsStatusCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show the status of a sector of this node's miner",
+		ShortDescription: `
+Shows the state of the sector with the given id, the pieces in it, its
+commitments once sealed, whether its commitment is in the chain and when
+sealing started and finished.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("id", true, false, "ID of the sector"),
+	},
+	Options: []cmdkit.Option{
+		nodeMinerOption,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		minerAddr, err := nodeMinerAddr(req)
+		if err != nil {
+			return err
+		}
+
+		sectorID, err := strconv.ParseUint(req.Arguments[0], 10, 64)
+		if err != nil {
+			return errors.Wrap(err, "invalid sector id")
+		}
+
+		status, err := GetAPI(env).Miner().SectorStatus(req.Context, minerAddr, sectorID)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(status)
+	},
+	Type: storage.SectorStatus{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, s *storage.SectorStatus) error {
+			fmt.Fprintf(w, "Sector: %d\n", s.SectorID)                      // nolint: errcheck
+			fmt.Fprintf(w, "State: %s\n", s.State)                          // nolint: errcheck
+			fmt.Fprintf(w, "Bytes: %d/%d\n", s.UserBytes(), s.MaxUserBytes) // nolint: errcheck
+			fmt.Fprintf(w, "Committed: %s\n", sectorCommitStatus(s))        // nolint: errcheck
+			if s.State == sectorbuilder.SectorSealed {
+				fmt.Fprintf(w, "CommD: %x\n", s.CommD)         // nolint: errcheck
+				fmt.Fprintf(w, "CommR: %x\n", s.CommR)         // nolint: errcheck
+				fmt.Fprintf(w, "CommRStar: %x\n", s.CommRStar) // nolint: errcheck
+			}
+			if !s.SealStarted.IsZero() {
+				fmt.Fprintf(w, "Seal started: %s\n", s.SealStarted.Format(time.RFC3339)) // nolint: errcheck
+			}
+			if !s.SealFinished.IsZero() {
+				fmt.Fprintf(w, "Seal finished: %s\n", s.SealFinished.Format(time.RFC3339)) // nolint: errcheck
+			}
+			if s.SealingErr != "" {
+				fmt.Fprintf(w, "Error: %s\n", s.SealingErr) // nolint: errcheck
+			}
+			fmt.Fprintln(w, "Pieces:") // nolint: errcheck
+			for _, p := range s.Pieces {
+				fmt.Fprintf(w, "  %s\t%d\n", p.Ref, p.Size) // nolint: errcheck
+			}
+			return nil
+		}),
+	},
+}
+
+// sectorCommitStatus describes whether the commitment of a sector is in the
+// chain.
+func sectorCommitStatus(s *storage.SectorStatus) string {
+	switch {
+	case s.Committed:
+		return "yes"
+	case s.Committing:
+		return "pending"
+	default:
+		return "no"
+	}
+}
+
+var minerSealNowCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Seal staged sectors now",
+		ShortDescription: `
+Seals the sector with the given id, or every staged sector holding pieces if
+no id is given, without waiting for the sealing policy. A sector whose sealing
+failed is sealed again, unless the sector builder cannot, as with
+rust-fil-proofs, which also seals every other staged sector along with the
+given one. Progress can be followed with 'go-filecoin miner sectors ls'.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("sector", false, false, "ID of the sector to seal"),
+	},
+	Options: []cmdkit.Option{
+		nodeMinerOption,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		minerAddr, err := nodeMinerAddr(req)
+		if err != nil {
+			return err
+		}
+
+		var sectorID *uint64
+		if len(req.Arguments) > 0 {
+			id, err := strconv.ParseUint(req.Arguments[0], 10, 64)
+			if err != nil {
+				return errors.Wrap(err, "invalid sector id")
+			}
+			sectorID = &id
+		}
+
+		return GetAPI(env).Miner().SealNow(req.Context, minerAddr, sectorID)
+	},
+}
+
+var minerProvingCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Follow the proofs of spacetime of this node's miner",
+	},
+	Subcommands: map[string]*cmds.Command{
+		"info": minerProvingInfoCmd,
+	},
+}
+
+var minerProvingInfoCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show the current proving period of this node's miner",
+		ShortDescription: `
+Shows the bounds of the current proving period and of its grace period, the
+height PoSt generation starts at, which is mining.postLeadBlocks before the
+end of the period, and how far the PoSt got. An alert is shown when the PoSt
+is at risk, failed or late.
+`,
+	},
+	Options: []cmdkit.Option{
+		nodeMinerOption,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		minerAddr, err := nodeMinerAddr(req)
+		if err != nil {
+			return err
+		}
+
+		info, err := GetAPI(env).Miner().ProvingInfo(req.Context, minerAddr)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(info)
+	},
+	Type: storage.ProvingInfo{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, info *storage.ProvingInfo) error {
+			if info.Height != nil {
+				fmt.Fprintf(w, "Height: %s\n", info.Height) // nolint: errcheck
+			}
+			fmt.Fprintf(w, "State: %s\n", info.State) // nolint: errcheck
+			if info.PeriodStart == nil || info.PeriodEnd == nil {
+				return nil
+			}
+			fmt.Fprintf(w, "Sectors: %d\n", info.Sectors)                                                    // nolint: errcheck
+			fmt.Fprintf(w, "Period: %s-%s\n", info.PeriodStart, info.PeriodEnd)                              // nolint: errcheck
+			fmt.Fprintf(w, "Grace period end: %s\n", info.GraceEnd)                                          // nolint: errcheck
+			fmt.Fprintf(w, "Generation start: %s (lead %d blocks)\n", info.GenerationStart, info.LeadBlocks) // nolint: errcheck
+			fmt.Fprintf(w, "Attempts: %d\n", info.Attempts)                                                  // nolint: errcheck
+			if info.LastError != "" {
+				fmt.Fprintf(w, "Error: %s\n", info.LastError) // nolint: errcheck
+			}
+			if info.Alert != storage.ProvingAlertNone {
+				fmt.Fprintf(w, "Alert: %s\n", info.Alert) // nolint: errcheck
+			}
+			return nil
+		}),
+	},
+}
+
+var minerStorageCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Manage the paths this node's miner stores sectors in",
+		ShortDescription: `
+Storage paths hold staged sectors, sealed sectors or both. New sectors are
+placed in the path holding their role with the most free space, scaled by the
+path's weight. Attach paths on new disks to grow the miner's capacity.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"attach": minerStorageAttachCmd,
+		"detach": minerStorageDetachCmd,
+		"ls":     minerStorageLsCmd,
+	},
+}
+
+var minerStorageLsCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "List the storage paths of this node's miner",
+		ShortDescription: `
+Lists the storage paths of this node's miner as a tab separated table with
+each path's role, weight, the bytes its sectors use, the bytes still free for
+sectors and its size limit, followed by the totals of all paths.
+`,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		usages, err := GetAPI(env).Miner().StorageLs(req.Context)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(usages)
+	},
+	Type: []*sectorbuilder.StoragePathUsage{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, usages []*sectorbuilder.StoragePathUsage) error {
+			if _, err := fmt.Fprintln(w, "Path\tRole\tWeight\tUsed\tFree\tMax"); err != nil {
+				return err
+			}
+			var used, free uint64
+			for _, u := range usages {
+				max := "-"
+				if u.MaxBytes > 0 {
+					max = strconv.FormatUint(u.MaxBytes, 10)
+				}
+				_, err := fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%s\n", u.Path, u.Role, u.Weight, u.UsedBytes, u.FreeBytes, max)
+				if err != nil {
+					return err
+				}
+				used += u.UsedBytes
+				free += u.FreeBytes
+			}
+			_, err := fmt.Fprintf(w, "Total\t\t\t%d\t%d\t\n", used, free)
+			return err
+		}),
+	},
+}
+
+var minerStorageAttachCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Add a path to store sectors in",
+		ShortDescription: `
+Adds a storage path, creating its directory if needed, and saves it to the
+config. The role is one of staging, sealed or both. A path with weight 0
+receives no new sectors. --max-bytes limits how much the path's sectors may
+take up, 0 meaning the free space of its filesystem. The paths new sectors
+are stored in are picked when the daemon starts mining, so a new path only
+receives sectors after the daemon restarts.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("path", true, false, "Directory to store sectors in"),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("role", "What the path holds: staging, sealed or both").WithDefault("both"),
+		cmdkit.UintOption("weight", "How much new sectors favor the path").WithDefault(uint(1)),
+		cmdkit.Uint64Option("max-bytes", "Most bytes the path's sectors may take up"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		role, err := sectorbuilder.ParseStorageRole(req.Options["role"].(string))
+		if err != nil {
+			return err
+		}
+		weight, _ := req.Options["weight"].(uint)
+		maxBytes, _ := req.Options["max-bytes"].(uint64)
+
+		return GetAPI(env).Miner().StorageAttach(req.Context, sectorbuilder.StoragePath{
+			Path:     req.Arguments[0],
+			Role:     role,
+			Weight:   weight,
+			MaxBytes: maxBytes,
+		})
+	},
+}
+
+var minerStorageDetachCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Remove an empty storage path",
+		ShortDescription: `
+Removes a storage path holding no sectors and saves the change to the config.
+To drain a path in use, set its weight to 0 in mining.storagePaths and
+restart the daemon. At least one path must remain for staged and for sealed
+sectors.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("path", true, false, "Storage path to remove"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		return GetAPI(env).Miner().StorageDetach(req.Context, req.Arguments[0])
+	},
+}
@@ -0,0 +1,99 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	ma "gx/ipfs/QmNTCey11oxhb1AxDnQBRHtdhap6Ctud872NjAYPYYXPuc/go-multiaddr"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	"gx/ipfs/QmZcLBXKaFe8ND5YHPkJRAwmhJGrVsi1JqDZNyJ4nRK5Mj/go-multiaddr-net"
+
+	"github.com/filecoin-project/go-filecoin/rpc"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+)
+
+func rpcHost(t *testing.T, d *th.TestDaemon) string {
+	maddr, err := ma.NewMultiaddr(d.CmdAddr())
+	require.NoError(t, err)
+	_, host, err := manet.DialArgs(maddr)
+	require.NoError(t, err)
+	return host
+}
+
+func TestRPCDaemon(t *testing.T) {
+	t.Parallel()
+
+	t.Run("calls over http with a token", func(t *testing.T) {
+		t.Parallel()
+		assert := assert.New(t)
+		require := require.New(t)
+
+		d := th.NewDaemon(t).Start()
+		defer d.ShutdownSuccess()
+
+		url := fmt.Sprintf("http://%s%s", rpcHost(t, d), RPCPath)
+		token := d.RunSuccess("auth", "create-token", "--perm=read").ReadStdoutTrimNewlines()
+		fc := rpc.NewFilecoinClient(rpc.NewHTTPClient(url, token))
+
+		addrs, err := fc.WalletAddresses(context.Background())
+		require.NoError(err)
+		require.Len(addrs, 1)
+		assert.Equal(d.GetDefaultAddress(), addrs[0].String())
+
+		id, err := fc.NetworkGetPeerID(context.Background())
+		require.NoError(err)
+		assert.Equal(d.GetID(), id)
+
+		// A read token may not create addresses.
+		_, err = fc.WalletNewAddress(context.Background())
+		require.Error(err)
+		assert.Contains(err.Error(), "write permission required")
+
+		// No token at all is refused.
+		_, err = rpc.NewFilecoinClient(rpc.NewHTTPClient(url, "")).WalletAddresses(context.Background())
+		require.Error(err)
+		assert.Contains(err.Error(), "missing API token")
+	})
+
+	t.Run("notifies websocket subscribers of new heads", func(t *testing.T) {
+		t.Parallel()
+		assert := assert.New(t)
+		require := require.New(t)
+
+		d := th.NewDaemon(t).Start()
+		defer d.ShutdownSuccess()
+
+		token, err := d.APIToken()
+		require.NoError(err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		c, err := rpc.Dial(ctx, fmt.Sprintf("ws://%s%s", rpcHost(t, d), RPCPath), token)
+		require.NoError(err)
+		defer c.Close() // nolint: errcheck
+		fc := rpc.NewFilecoinClient(c)
+
+		heads, sub, err := fc.ChainNotify(ctx)
+		require.NoError(err)
+		defer sub.Unsubscribe()
+
+		minedCid := th.RunSuccessFirstLine(d, "mining", "once")
+
+		select {
+		case blks := <-heads:
+			require.Len(blks, 1)
+			assert.Equal(minedCid, blks[0].Cid().String())
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for new head")
+		}
+
+		head, err := fc.ChainHead(ctx)
+		require.NoError(err)
+		require.Len(head, 1)
+		assert.Equal(minedCid, head[0].Cid().String())
+	})
+}
@@ -0,0 +1,109 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	cmds "gx/ipfs/QmQtQrtNioesAWtrx8csBvfY37gTe94d6wQ3VikZUjxD39/go-ipfs-cmds"
+	cmdkit "gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
+
+	"github.com/filecoin-project/go-filecoin/protocol/sealworker"
+)
+
+var sealWorkerCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Seal sectors for a mining daemon",
+		ShortDescription: `
+Connects to the seal worker address of a mining daemon (mining.sealWorkers.listenAddress
+in its config) and seals the staged sectors it hands out, until interrupted. The --token
+must grant admin permission; create one with 'go-filecoin auth create-token --perm=admin'
+on the daemon. Without --token, the token of the local repo's running daemon is used.
+
+Only daemons running with insecure proofs (proofs.insecure in their config) hand out
+sectors, as the Rust sector builder cannot yet export them. Workers for such a daemon
+must pass --insecure-proofs, so that their seals are the insecure ones it verifies.
+`,
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("address", "multiaddr the daemon listens for seal workers on"),
+		cmdkit.IntOption("capacity", "how many sectors to seal at once").WithDefault(1),
+		cmdkit.StringOption("id", "name the daemon knows the worker by (default: host name and process id)"),
+		cmdkit.StringOption("work-dir", "directory to seal sectors in (default: the system temporary directory)"),
+		cmdkit.BoolOption("insecure-proofs", "seal with insecure proofs, for daemons running with them"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		addr, _ := req.Options["address"].(string)
+		if addr == "" {
+			return fmt.Errorf("--address is required")
+		}
+		token, _ := req.Options[OptionToken].(string)
+		if token == "" {
+			var err error
+			if token, err = getAPIToken(req); err != nil {
+				return err
+			}
+		}
+		capacity, _ := req.Options["capacity"].(int)
+		if capacity < 1 {
+			return fmt.Errorf("capacity must be at least 1")
+		}
+
+		id, _ := req.Options["id"].(string)
+		if id == "" {
+			host, err := os.Hostname()
+			if err != nil {
+				return err
+			}
+			id = fmt.Sprintf("%s-%d", host, os.Getpid())
+		}
+		workDir, _ := req.Options["work-dir"].(string)
+		if workDir == "" {
+			workDir = os.TempDir()
+		}
+
+		var sealer sealworker.Sealer = sealworker.RustSealer{}
+		if insecure, _ := req.Options["insecure-proofs"].(bool); insecure {
+			sealer = sealworker.InsecureSealer{}
+		}
+
+		ctx, cancel := context.WithCancel(req.Context)
+		defer cancel()
+
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(sigCh)
+		go func() {
+			select {
+			case <-sigCh:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		client, err := sealworker.Dial(ctx, addr, token)
+		if err != nil {
+			return err
+		}
+		defer client.Close() // nolint: errcheck
+
+		if err := re.Emit(fmt.Sprintf("sealing sectors for %s as %s\n", addr, id)); err != nil {
+			return err
+		}
+
+		err = sealworker.NewWorker(client, id, capacity, sealer, workDir).Run(ctx)
+		if err == context.Canceled {
+			return nil
+		}
+		return err
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeEncoder(func(req *cmds.Request, w io.Writer, val interface{}) error {
+			_, err := fmt.Fprint(w, val.(string))
+			return err
+		}),
+	},
+}
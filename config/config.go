@@ -22,8 +22,11 @@ type Config struct {
 	Datastore *DatastoreConfig `json:"datastore"`
 	Swarm     *SwarmConfig     `json:"swarm"`
 	Mining    *MiningConfig    `json:"mining"`
+	Client    *ClientConfig    `json:"client"`
 	Wallet    *WalletConfig    `json:"wallet"`
 	Heartbeat *HeartbeatConfig `json:"heartbeat"`
+	Metrics   *MetricsConfig   `json:"metrics"`
+	Proofs    *ProofsConfig    `json:"proofs"`
 }
 
 // APIConfig holds all configuration options related to the api.
@@ -32,6 +35,9 @@ type APIConfig struct {
 	AccessControlAllowOrigin      []string `json:"accessControlAllowOrigin"`
 	AccessControlAllowCredentials bool     `json:"accessControlAllowCredentials"`
 	AccessControlAllowMethods     []string `json:"accessControlAllowMethods"`
+	// AuthRequired, when true, rejects api requests without a token granting
+	// the permission the requested command requires.
+	AuthRequired bool `json:"authRequired"`
 }
 
 func newDefaultAPIConfig() *APIConfig {
@@ -44,6 +50,7 @@ func newDefaultAPIConfig() *APIConfig {
 			"https://127.0.0.1:8080",
 		},
 		AccessControlAllowMethods: []string{"GET", "POST", "PUT"},
+		AuthRequired:              true,
 	}
 }
 
@@ -100,10 +107,16 @@ func newDefaultBootstrapConfig() *BootstrapConfig {
 
 // MiningConfig holds all configuration options related to mining.
 type MiningConfig struct {
-	MinerAddress            address.Address `json:"minerAddress"`
-	BlockSignerAddress      address.Address `json:"blockSignerAddress"`
-	AutoSealIntervalSeconds uint            `json:"autoSealIntervalSeconds"`
-	StoragePrice            *types.AttoFIL  `json:"storagePrice"`
+	MinerAddress            address.Address      `json:"minerAddress"`
+	BlockSignerAddress      address.Address      `json:"blockSignerAddress"`
+	AutoSealIntervalSeconds uint                 `json:"autoSealIntervalSeconds"`
+	StoragePrice            *types.AttoFIL       `json:"storagePrice"`
+	DealPolicy              *DealPolicyConfig    `json:"dealPolicy"`
+	SealPolicy              *SealPolicyConfig    `json:"sealPolicy"`
+	SealWorkers             *SealWorkersConfig   `json:"sealWorkers"`
+	StoragePaths            []*StoragePathConfig `json:"storagePaths"`
+	PoStLeadBlocks          uint64               `json:"postLeadBlocks"`
+	Miners                  []*MinerConfig       `json:"miners"`
 }
 
 func newDefaultMiningConfig() *MiningConfig {
@@ -111,6 +124,121 @@ func newDefaultMiningConfig() *MiningConfig {
 		MinerAddress:            address.Address{},
 		AutoSealIntervalSeconds: 120,
 		StoragePrice:            types.NewZeroAttoFIL(),
+		DealPolicy:              newDefaultDealPolicyConfig(),
+		SealPolicy:              &SealPolicyConfig{},
+		SealWorkers:             &SealWorkersConfig{},
+		StoragePaths:            []*StoragePathConfig{},
+		PoStLeadBlocks:          1000,
+		Miners:                  []*MinerConfig{},
+	}
+}
+
+// DealPolicyConfig holds the rules a storage miner applies to deal proposals
+// before accepting them. Zero values and empty lists impose no limit.
+type DealPolicyConfig struct {
+	// MinPieceSize and MaxPieceSize bound the size of proposed pieces, in
+	// bytes.
+	MinPieceSize uint64 `json:"minPieceSize"`
+	MaxPieceSize uint64 `json:"maxPieceSize"`
+	// MinDuration and MaxDuration bound the duration of proposed deals, in
+	// blocks.
+	MinDuration uint64 `json:"minDuration"`
+	MaxDuration uint64 `json:"maxDuration"`
+	// AllowedClients, if not empty, are the only clients deals are accepted
+	// from. DeniedClients are never accepted.
+	AllowedClients []address.Address `json:"allowedClients"`
+	DeniedClients  []address.Address `json:"deniedClients"`
+	// MaxBytesPerClient limits the bytes a single client may have in deals
+	// that have not failed.
+	MaxBytesPerClient uint64 `json:"maxBytesPerClient"`
+	// MinFreeStagingBytes is the space that must remain free in the staging
+	// directory once the proposed piece is staged.
+	MinFreeStagingBytes uint64 `json:"minFreeStagingBytes"`
+	// DecisionHook, if set, is consulted after all other rules pass. It is
+	// either an http(s) URL the proposal JSON is posted to, or the path of an
+	// executable run with the proposal JSON on stdin.
+	DecisionHook string `json:"decisionHook"`
+}
+
+func newDefaultDealPolicyConfig() *DealPolicyConfig {
+	return &DealPolicyConfig{
+		AllowedClients: []address.Address{},
+		DeniedClients:  []address.Address{},
+	}
+}
+
+// SealPolicyConfig holds the rules deciding when a storage miner seals its
+// staged sectors. Staged sectors are checked every AutoSealIntervalSeconds,
+// and a non-empty staged sector is sealed once it meets either rule. With
+// neither rule set, every non-empty staged sector is sealed at each check.
+type SealPolicyConfig struct {
+	// FillPercent seals a staged sector once its pieces take up this percent
+	// of its capacity.
+	FillPercent uint `json:"fillPercent"`
+	// MaxWaitSeconds seals a staged sector once it has held pieces for this
+	// long.
+	MaxWaitSeconds uint `json:"maxWaitSeconds"`
+	// MaxConcurrentSeals limits how many sectors are sealed at once.
+	MaxConcurrentSeals uint `json:"maxConcurrentSeals"`
+}
+
+// SealWorkersConfig holds the configuration of remote sealing. When
+// ListenAddress is set, the miner hands its staged sectors to the
+// `go-filecoin seal-worker` processes connected to it, and only seals
+// in process while none are connected. The Rust sector builder cannot yet
+// hand out its sectors, so the daemon refuses to start with ListenAddress
+// set unless it runs with insecure proofs.
+type SealWorkersConfig struct {
+	// ListenAddress is the multiaddr seal workers connect to, e.g.
+	// /ip4/0.0.0.0/tcp/3454 or /unix/tmp/filecoin-seal.sock. Workers must
+	// present a token granting admin permission.
+	ListenAddress string `json:"listenAddress"`
+}
+
+// MinerConfig is a miner actor the node manages besides MinerAddress, its
+// default miner. Each miner keeps its sectors and deals apart from the
+// others' and mines on its own. `go-filecoin miner create` adds miners here
+// once the node has a default miner.
+type MinerConfig struct {
+	Address address.Address `json:"address"`
+	// BlockSignerAddress signs the blocks mined for the miner.
+	BlockSignerAddress address.Address `json:"blockSignerAddress"`
+}
+
+// StoragePathConfig is a directory a storage miner stores sectors in. With no
+// storage paths configured, sectors are stored in the repo. Manage them with
+// `go-filecoin miner storage`.
+type StoragePathConfig struct {
+	Path string `json:"path"`
+	// Role is what the path holds: staging, sealed or both.
+	Role string `json:"role"`
+	// Weight scales how much new sectors favor the path, which otherwise
+	// get the path with the most free space. Zero places no new sectors in
+	// the path.
+	Weight uint `json:"weight"`
+	// MaxBytes, if not zero, is the most bytes sectors may take up in the
+	// path.
+	MaxBytes uint64 `json:"maxBytes"`
+}
+
+// ClientConfig holds all configuration options related to the storage
+// client. Renewals and repairs make deals, and so spend funds, on their own,
+// so both are off by default.
+type ClientConfig struct {
+	// RenewBeforeBlocks is how many blocks before a deal ends the client
+	// proposes a deal renewing it. Zero disables renewals.
+	RenewBeforeBlocks uint64 `json:"renewBeforeBlocks"`
+	// RenewWithSameMiner proposes renewals to the deal's miner first, and
+	// only to other miners if it declines.
+	RenewWithSameMiner bool `json:"renewWithSameMiner"`
+	// RepairDeals replaces deals whose miner stops proving their sector with
+	// deals with other miners, copying the piece from a remaining replica.
+	RepairDeals bool `json:"repairDeals"`
+}
+
+func newDefaultClientConfig() *ClientConfig {
+	return &ClientConfig{
+		RenewWithSameMiner: true,
 	}
 }
 
@@ -148,6 +276,40 @@ func newDefaultHeartbeatConfig() *HeartbeatConfig {
 	}
 }
 
+// MetricsConfig holds all configuration options related to node metrics.
+type MetricsConfig struct {
+	// PrometheusEnabled, when true, exposes node metrics on the API server.
+	PrometheusEnabled bool `json:"prometheusEnabled"`
+	// PrometheusEndpoint is the HTTP path on the API server metrics are served from.
+	PrometheusEndpoint string `json:"prometheusEndpoint"`
+}
+
+func newDefaultMetricsConfig() *MetricsConfig {
+	return &MetricsConfig{
+		PrometheusEnabled:  false,
+		PrometheusEndpoint: "/metrics",
+	}
+}
+
+// ProofsConfig holds all configuration options related to proofs.
+type ProofsConfig struct {
+	// Insecure, when true, replaces the Rust proofs with fast fake proofs
+	// that anyone can forge, and keeps sectors in memory. It is meant for
+	// tests and dev networks, whose genesis block must be made with
+	// insecure proofs for miners' commitments to be accepted.
+	Insecure bool `json:"insecure"`
+	// InsecureSealDelaySeconds is how long sealing a sector takes with
+	// insecure proofs.
+	InsecureSealDelaySeconds uint `json:"insecureSealDelaySeconds"`
+}
+
+func newDefaultProofsConfig() *ProofsConfig {
+	return &ProofsConfig{
+		Insecure:                 false,
+		InsecureSealDelaySeconds: 0,
+	}
+}
+
 // NewDefaultConfig returns a config object with all the fields filled out to
 // their default values
 func NewDefaultConfig() *Config {
@@ -157,8 +319,11 @@ func NewDefaultConfig() *Config {
 		Datastore: newDefaultDatastoreConfig(),
 		Swarm:     newDefaultSwarmConfig(),
 		Mining:    newDefaultMiningConfig(),
+		Client:    newDefaultClientConfig(),
 		Wallet:    newDefaultWalletConfig(),
 		Heartbeat: newDefaultHeartbeatConfig(),
+		Metrics:   newDefaultMetricsConfig(),
+		Proofs:    newDefaultProofsConfig(),
 	}
 }
 
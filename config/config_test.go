@@ -49,7 +49,8 @@ func TestWriteFile(t *testing.T) {
 			"GET",
 			"POST",
 			"PUT"
-		]
+		],
+		"authRequired": true
 	},
 	"bootstrap": {
 		"addresses": [],
@@ -67,7 +68,34 @@ func TestWriteFile(t *testing.T) {
 		"minerAddress": "",
 		"blockSignerAddress": "",
 		"autoSealIntervalSeconds": 120,
-		"storagePrice": "0"
+		"storagePrice": "0",
+		"dealPolicy": {
+			"minPieceSize": 0,
+			"maxPieceSize": 0,
+			"minDuration": 0,
+			"maxDuration": 0,
+			"allowedClients": [],
+			"deniedClients": [],
+			"maxBytesPerClient": 0,
+			"minFreeStagingBytes": 0,
+			"decisionHook": ""
+		},
+		"sealPolicy": {
+			"fillPercent": 0,
+			"maxWaitSeconds": 0,
+			"maxConcurrentSeals": 0
+		},
+		"sealWorkers": {
+			"listenAddress": ""
+		},
+		"storagePaths": [],
+		"postLeadBlocks": 1000,
+		"miners": []
+	},
+	"client": {
+		"renewBeforeBlocks": 0,
+		"renewWithSameMiner": true,
+		"repairDeals": false
 	},
 	"wallet": {
 		"defaultAddress": ""
@@ -77,6 +105,14 @@ func TestWriteFile(t *testing.T) {
 		"beatPeriod": "3s",
 		"reconnectPeriod": "10s",
 		"nickname": ""
+	},
+	"metrics": {
+		"prometheusEnabled": false,
+		"prometheusEndpoint": "/metrics"
+	},
+	"proofs": {
+		"insecure": false,
+		"insecureSealDelaySeconds": 0
 	}
 }`,
 		string(content),
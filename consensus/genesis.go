@@ -12,6 +12,7 @@ import (
 	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/storagemarket"
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/proofs"
 	"github.com/filecoin-project/go-filecoin/state"
 	"github.com/filecoin-project/go-filecoin/types"
 	"github.com/filecoin-project/go-filecoin/vm"
@@ -37,6 +38,8 @@ type Config struct {
 	accounts map[address.Address]*types.AttoFIL
 	nonces   map[address.Address]uint64
 	actors   map[address.Address]*actor.Actor
+
+	proofsMode proofs.Mode
 }
 
 // GenOption is a configuration option for the GenesisInitFunction.
@@ -68,6 +71,15 @@ func AddActor(addr address.Address, actor *actor.Actor) GenOption {
 	}
 }
 
+// ProofsMode returns a config option that sets which proofs the network's
+// miners submit.
+func ProofsMode(mode proofs.Mode) GenOption {
+	return func(gc *Config) error {
+		gc.proofsMode = mode
+		return nil
+	}
+}
+
 // NewEmptyConfig inits and returns an empty config
 func NewEmptyConfig() *Config {
 	return &Config{
@@ -112,7 +124,7 @@ func MakeGenesisFunc(opts ...GenOption) func(cst *hamt.CborIpldStore, bs blockst
 				return nil, err
 			}
 		}
-		if err := SetupDefaultActors(ctx, st, storageMap); err != nil {
+		if err := SetupDefaultActors(ctx, st, storageMap, genCfg.proofsMode); err != nil {
 			return nil, err
 		}
 		// Now add any other actors configured.
@@ -150,8 +162,9 @@ func InitGenesis(cst *hamt.CborIpldStore, bs blockstore.Blockstore) (*types.Bloc
 	return MakeGenesisFunc()(cst, bs)
 }
 
-// SetupDefaultActors inits the builtin actors that are required to run filecoin.
-func SetupDefaultActors(ctx context.Context, st state.Tree, storageMap vm.StorageMap) error {
+// SetupDefaultActors inits the builtin actors that are required to run filecoin,
+// on a network whose miners submit proofs of the given mode.
+func SetupDefaultActors(ctx context.Context, st state.Tree, storageMap vm.StorageMap, proofsMode proofs.Mode) error {
 	for addr, val := range defaultAccounts {
 		a, err := account.NewActor(val)
 		if err != nil {
@@ -167,7 +180,7 @@ func SetupDefaultActors(ctx context.Context, st state.Tree, storageMap vm.Storag
 	if err != nil {
 		return err
 	}
-	err = (&storagemarket.Actor{}).InitializeState(storageMap.NewStorage(address.StorageMarketAddress, stAct), nil)
+	err = (&storagemarket.Actor{}).InitializeState(storageMap.NewStorage(address.StorageMarketAddress, stAct), proofsMode)
 	if err != nil {
 		return err
 	}
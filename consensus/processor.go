@@ -8,6 +8,7 @@ import (
 	"github.com/filecoin-project/go-filecoin/actor"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/account"
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/metrics"
 	"github.com/filecoin-project/go-filecoin/state"
 	"github.com/filecoin-project/go-filecoin/types"
 	"github.com/filecoin-project/go-filecoin/vm"
@@ -56,6 +57,12 @@ type DefaultProcessor struct {
 
 var _ Processor = (*DefaultProcessor)(nil)
 
+var messageApplyDuration = metrics.NewHistogram("filecoin_consensus_message_apply_seconds", "Time taken to apply a single message to the state tree.")
+
+func init() {
+	metrics.DefaultRegistry.MustRegister(messageApplyDuration)
+}
+
 // NewDefaultProcessor creates a default processor from the given state tree and vms.
 func NewDefaultProcessor() *DefaultProcessor {
 	return &DefaultProcessor{
@@ -264,6 +271,7 @@ func (p *DefaultProcessor) ApplyMessage(ctx context.Context, st state.Tree, vms
 
 	applyMsgTimer := time.Now()
 	defer func() {
+		messageApplyDuration.ObserveDuration(applyMsgTimer)
 		log.Infof("[TIMER] DefaultProcessor.ApplyMessage CID: %s - elapsed time: %s", msgCid.String(), time.Since(applyMsgTimer).Round(time.Millisecond))
 	}()
 
@@ -7,11 +7,31 @@ import (
 	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	"gx/ipfs/QmdbxjQWogRCHRaxhhGnYdT1oQJzL9GdqSKzCdqWr85AP2/pubsub"
 
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
+// MessagePoolTopic is the topic on which message pool updates are published.
+const MessagePoolTopic = "mpool-update"
+
+// MessagePoolUpdateType says whether a message entered or left the pool.
+type MessagePoolUpdateType string
+
+const (
+	// MessageAdded is published when a message is added to the pool.
+	MessageAdded = MessagePoolUpdateType("add")
+	// MessageRemoved is published when a message is removed from the pool.
+	MessageRemoved = MessagePoolUpdateType("remove")
+)
+
+// MessagePoolUpdate describes a change to the contents of the pool.
+type MessagePoolUpdate struct {
+	Type    MessagePoolUpdateType
+	Message *types.SignedMessage
+}
+
 // MessagePool keeps an unordered, de-duplicated set of Messages and supports removal by CID.
 // By 'de-duplicated' we mean that insertion of a message by cid that already
 // exists is a nop. We use a MessagePool to store all messages received by this node
@@ -23,13 +43,12 @@ type MessagePool struct {
 	lk sync.RWMutex
 
 	pending map[cid.Cid]*types.SignedMessage // all pending messages
+
+	events *pubsub.PubSub
 }
 
 // Add adds a message to the pool.
 func (pool *MessagePool) Add(msg *types.SignedMessage) (cid.Cid, error) {
-	pool.lk.Lock()
-	defer pool.lk.Unlock()
-
 	c, err := msg.Cid()
 	if err != nil {
 		return cid.Undef, errors.Wrap(err, "failed to create CID")
@@ -40,7 +59,15 @@ func (pool *MessagePool) Add(msg *types.SignedMessage) (cid.Cid, error) {
 		return cid.Undef, errors.Errorf("failed to add message %s to pool: sig invalid", c.String())
 	}
 
+	pool.lk.Lock()
+	_, existed := pool.pending[c]
 	pool.pending[c] = msg
+	pool.lk.Unlock()
+
+	// Publish outside the lock so subscribers may call back into the pool.
+	if !existed {
+		pool.events.Pub(MessagePoolUpdate{Type: MessageAdded, Message: msg}, MessagePoolTopic)
+	}
 	return c, nil
 }
 
@@ -59,15 +86,26 @@ func (pool *MessagePool) Pending() []*types.SignedMessage {
 // Remove removes the message by CID from the pending pool.
 func (pool *MessagePool) Remove(c cid.Cid) {
 	pool.lk.Lock()
-	defer pool.lk.Unlock()
-
+	msg, existed := pool.pending[c]
 	delete(pool.pending, c)
+	pool.lk.Unlock()
+
+	if existed {
+		pool.events.Pub(MessagePoolUpdate{Type: MessageRemoved, Message: msg}, MessagePoolTopic)
+	}
+}
+
+// Events returns a pubsub interface that publishes a MessagePoolUpdate on
+// MessagePoolTopic each time a message is added to or removed from the pool.
+func (pool *MessagePool) Events() *pubsub.PubSub {
+	return pool.events
 }
 
 // NewMessagePool constructs a new MessagePool.
 func NewMessagePool() *MessagePool {
 	return &MessagePool{
 		pending: make(map[cid.Cid]*types.SignedMessage),
+		events:  pubsub.New(128),
 	}
 }
 
@@ -45,6 +45,39 @@ func TestMessagePoolAddRemove(t *testing.T) {
 	assert.Len(pool.Pending(), 0)
 }
 
+func TestMessagePoolEvents(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	pool := NewMessagePool()
+	updates := pool.Events().Sub(MessagePoolTopic)
+	defer pool.Events().Unsub(updates, MessagePoolTopic)
+
+	msg := newSignedMessage()
+	c, err := pool.Add(msg)
+	require.NoError(err)
+	// Re-adding a message already in the pool publishes nothing.
+	_, err = pool.Add(msg)
+	require.NoError(err)
+	pool.Remove(c)
+	// Neither does removing a message that is not in the pool.
+	pool.Remove(c)
+
+	u := (<-updates).(MessagePoolUpdate)
+	assert.Equal(MessageAdded, u.Type)
+	assert.Equal(msg, u.Message)
+
+	u = (<-updates).(MessagePoolUpdate)
+	assert.Equal(MessageRemoved, u.Type)
+	assert.Equal(msg, u.Message)
+
+	select {
+	case u := <-updates:
+		t.Fatalf("unexpected update %v", u)
+	default:
+	}
+}
+
 func TestMessagePoolAddBadSignature(t *testing.T) {
 	assert := assert.New(t)
 
@@ -121,11 +121,11 @@ func MustDecodeCid(cidStr string) cid.Cid {
 }
 
 // CreateStorages creates an empty state tree and storage map.
-func CreateStorages(ctx context.Context, t *testing.T) (state.Tree, vm.StorageMap) {
+func CreateStorages(ctx context.Context, t *testing.T, opts ...consensus.GenOption) (state.Tree, vm.StorageMap) {
 	cst := hamt.NewCborStore()
 	d := datastore.NewMapDatastore()
 	bs := blockstore.NewBlockstore(d)
-	blk, err := consensus.InitGenesis(cst, bs)
+	blk, err := consensus.MakeGenesisFunc(opts...)(cst, bs)
 	require.NoError(t, err)
 
 	st, err := state.LoadStateTree(ctx, cst, blk.StateRoot, builtin.Actors)
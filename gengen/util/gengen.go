@@ -59,6 +59,11 @@ type GenesisCfg struct {
 
 	// Miners is a list of miners that should be set up at the start of the network
 	Miners []Miner
+
+	// InsecureProofs makes the network's miners submit insecure proofs,
+	// which anyone can forge, in place of the Rust proofs. Its nodes must
+	// be configured with insecure proofs to mine.
+	InsecureProofs bool
 }
 
 // RenderedGenInfo contains information about a genesis block creation
@@ -100,7 +105,11 @@ func GenGen(ctx context.Context, cfg *GenesisCfg, cst *hamt.CborIpldStore, bs bl
 	st := state.NewEmptyStateTreeWithActors(cst, builtin.Actors)
 	storageMap := vm.NewStorageMap(bs)
 
-	if err := consensus.SetupDefaultActors(ctx, st, storageMap); err != nil {
+	proofsMode := proofs.RustMode
+	if cfg.InsecureProofs {
+		proofsMode = proofs.InsecureMode
+	}
+	if err := consensus.SetupDefaultActors(ctx, st, storageMap, proofsMode); err != nil {
 		return nil, err
 	}
 
@@ -38,12 +38,15 @@ type Heartbeat struct {
 	Height uint64
 	// Nickname is the nickname given to the filecoin node by the user
 	Nickname string
-	// TODO: add when implemented
 	// Syncing is `true` iff the node is currently syncing its chain with the network.
-	// Syncing bool
+	Syncing bool
 
 	// Address of this node's active miner. Can be empty - will return the zero address
 	MinerAddress address.Address
+
+	// ProvingAlert is set when the PoSt of the active miner is at risk, failed
+	// or late. Empty when it is on track or the node is not mining.
+	ProvingAlert string
 }
 
 // HeartbeatService is responsible for sending heartbeats.
@@ -57,6 +60,12 @@ type HeartbeatService struct {
 	// A function that returns the miner's address
 	MinerAddressGetter func() address.Address
 
+	// A function that returns whether the node is syncing its chain
+	SyncingGetter func() bool
+
+	// A function that returns the miner's proving alert
+	ProvingAlertGetter func() string
+
 	streamMu sync.Mutex
 	stream   net.Stream
 }
@@ -71,10 +80,32 @@ func WithMinerAddressGetter(ag func() address.Address) HeartbeatServiceOption {
 	}
 }
 
+// WithSyncingGetter returns an option that can be used to set the syncing getter.
+func WithSyncingGetter(sg func() bool) HeartbeatServiceOption {
+	return func(service *HeartbeatService) {
+		service.SyncingGetter = sg
+	}
+}
+
+// WithProvingAlertGetter returns an option that can be used to set the proving alert getter.
+func WithProvingAlertGetter(pg func() string) HeartbeatServiceOption {
+	return func(service *HeartbeatService) {
+		service.ProvingAlertGetter = pg
+	}
+}
+
 func defaultMinerAddressGetter() address.Address {
 	return address.Address{}
 }
 
+func defaultSyncingGetter() bool {
+	return false
+}
+
+func defaultProvingAlertGetter() string {
+	return ""
+}
+
 // NewHeartbeatService returns a HeartbeatService
 func NewHeartbeatService(h host.Host, hbc *config.HeartbeatConfig, hg func() types.TipSet, options ...HeartbeatServiceOption) *HeartbeatService {
 	srv := &HeartbeatService{
@@ -82,6 +113,8 @@ func NewHeartbeatService(h host.Host, hbc *config.HeartbeatConfig, hg func() typ
 		Config:             hbc,
 		HeadGetter:         hg,
 		MinerAddressGetter: defaultMinerAddressGetter,
+		SyncingGetter:      defaultSyncingGetter,
+		ProvingAlertGetter: defaultProvingAlertGetter,
 	}
 
 	for _, option := range options {
@@ -204,7 +237,9 @@ func (hbs *HeartbeatService) Beat() Heartbeat {
 		Head:         tipset,
 		Height:       height,
 		Nickname:     nick,
+		Syncing:      hbs.SyncingGetter(),
 		MinerAddress: addr,
+		ProvingAlert: hbs.ProvingAlertGetter(),
 	}
 }
 
@@ -152,6 +152,8 @@ func TestHeartbeatRunSuccess(t *testing.T) {
 		assert.Equal(uint64(444), hb.Height)
 		assert.Equal("BobHoblaw", hb.Nickname)
 		assert.Equal(addr, hb.MinerAddress)
+		assert.True(hb.Syncing)
+		assert.Equal("late", hb.ProvingAlert)
 		cancel()
 	})
 
@@ -169,6 +171,12 @@ func TestHeartbeatRunSuccess(t *testing.T) {
 		WithMinerAddressGetter(func() address.Address {
 			return addr
 		}),
+		WithSyncingGetter(func() bool {
+			return true
+		}),
+		WithProvingAlertGetter(func() string {
+			return "late"
+		}),
 	)
 
 	require.NoError(hbs.Connect(ctx))
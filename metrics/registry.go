@@ -0,0 +1,396 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+)
+
+// ErrAlreadyRegistered is returned when registering a collector whose name is
+// already in use in a registry.
+var ErrAlreadyRegistered = errors.New("a collector with this name is already registered")
+
+// DefaultRegistry holds process-wide collectors, i.e. those declared as package
+// level variables. Collectors bound to a particular node instance should be
+// registered with that node's own registry instead.
+var DefaultRegistry = NewRegistry()
+
+// DefaultDurationBuckets are the histogram buckets (in seconds) used for
+// duration histograms when no buckets are given.
+var DefaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300, 600, 1800, 3600}
+
+// Collector is a single named metric which can render itself in the
+// Prometheus text exposition format.
+type Collector interface {
+	// Name returns the metric name, which is unique within a registry.
+	Name() string
+
+	write(w io.Writer) error
+}
+
+// Registry is a set of collectors exposed together.
+type Registry struct {
+	lk         sync.Mutex
+	collectors map[string]Collector
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		collectors: make(map[string]Collector),
+	}
+}
+
+// Register adds the collector to the registry. It returns ErrAlreadyRegistered
+// if a collector with the same name has been registered.
+func (r *Registry) Register(c Collector) error {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	if _, ok := r.collectors[c.Name()]; ok {
+		return errors.Wrap(ErrAlreadyRegistered, c.Name())
+	}
+	r.collectors[c.Name()] = c
+	return nil
+}
+
+// MustRegister registers the given collectors and panics if any of them fail
+// to register.
+func (r *Registry) MustRegister(cs ...Collector) {
+	for _, c := range cs {
+		if err := r.Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Unregister removes the collector with the given name, if any.
+func (r *Registry) Unregister(name string) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	delete(r.collectors, name)
+}
+
+// WriteText renders all registered collectors, ordered by name.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.lk.Lock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	cs := make([]Collector, len(names))
+	for i, name := range names {
+		cs[i] = r.collectors[name]
+	}
+	r.lk.Unlock()
+
+	for _, c := range cs {
+		if err := c.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler returns an http.Handler serving the given registries in the
+// Prometheus text exposition format.
+func Handler(registries ...*Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var buf bytes.Buffer
+		for _, r := range registries {
+			if err := r.WriteText(&buf); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write(buf.Bytes()) // nolint: errcheck
+	})
+}
+
+func writeHeader(w io.Writer, name, help, typ string) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	return err
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// atomicFloat is a float64 which can be updated concurrently.
+type atomicFloat struct {
+	bits uint64
+}
+
+func (f *atomicFloat) add(v float64) {
+	for {
+		old := atomic.LoadUint64(&f.bits)
+		next := math.Float64bits(math.Float64frombits(old) + v)
+		if atomic.CompareAndSwapUint64(&f.bits, old, next) {
+			return
+		}
+	}
+}
+
+func (f *atomicFloat) set(v float64) {
+	atomic.StoreUint64(&f.bits, math.Float64bits(v))
+}
+
+func (f *atomicFloat) get() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&f.bits))
+}
+
+// Counter is a monotonically increasing value.
+type Counter struct {
+	name string
+	help string
+	val  atomicFloat
+}
+
+var _ Collector = (*Counter)(nil)
+
+// NewCounter returns a new, unregistered Counter.
+func NewCounter(name, help string) *Counter {
+	return &Counter{name: name, help: help}
+}
+
+// Name implements Collector.
+func (c *Counter) Name() string {
+	return c.name
+}
+
+// Inc increments the counter by one.
+func (c *Counter) Inc() {
+	c.val.add(1)
+}
+
+// Add increments the counter by v, which must not be negative.
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		panic("counter cannot decrease")
+	}
+	c.val.add(v)
+}
+
+// Value returns the current value of the counter.
+func (c *Counter) Value() float64 {
+	return c.val.get()
+}
+
+func (c *Counter) write(w io.Writer) error {
+	if err := writeHeader(w, c.name, c.help, "counter"); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s %s\n", c.name, formatFloat(c.Value()))
+	return err
+}
+
+// Gauge is a value which can go up and down.
+type Gauge struct {
+	name string
+	help string
+	val  atomicFloat
+}
+
+var _ Collector = (*Gauge)(nil)
+
+// NewGauge returns a new, unregistered Gauge.
+func NewGauge(name, help string) *Gauge {
+	return &Gauge{name: name, help: help}
+}
+
+// Name implements Collector.
+func (g *Gauge) Name() string {
+	return g.name
+}
+
+// Set sets the gauge to v.
+func (g *Gauge) Set(v float64) {
+	g.val.set(v)
+}
+
+// Add adds v, which may be negative, to the gauge.
+func (g *Gauge) Add(v float64) {
+	g.val.add(v)
+}
+
+// Value returns the current value of the gauge.
+func (g *Gauge) Value() float64 {
+	return g.val.get()
+}
+
+func (g *Gauge) write(w io.Writer) error {
+	if err := writeHeader(w, g.name, g.help, "gauge"); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(g.Value()))
+	return err
+}
+
+// GaugeFunc is a gauge whose value is computed by calling a function each time
+// the metric is collected.
+type GaugeFunc struct {
+	name string
+	help string
+	fn   func() float64
+}
+
+var _ Collector = (*GaugeFunc)(nil)
+
+// NewGaugeFunc returns a new, unregistered GaugeFunc.
+func NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	return &GaugeFunc{name: name, help: help, fn: fn}
+}
+
+// Name implements Collector.
+func (g *GaugeFunc) Name() string {
+	return g.name
+}
+
+func (g *GaugeFunc) write(w io.Writer) error {
+	if err := writeHeader(w, g.name, g.help, "gauge"); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(g.fn()))
+	return err
+}
+
+// CounterFunc is a counter whose value is read by calling a function each time
+// the metric is collected. The function must return a value which never
+// decreases, such as a running total kept by another component.
+type CounterFunc struct {
+	name string
+	help string
+	fn   func() float64
+}
+
+var _ Collector = (*CounterFunc)(nil)
+
+// NewCounterFunc returns a new, unregistered CounterFunc.
+func NewCounterFunc(name, help string, fn func() float64) *CounterFunc {
+	return &CounterFunc{name: name, help: help, fn: fn}
+}
+
+// Name implements Collector.
+func (c *CounterFunc) Name() string {
+	return c.name
+}
+
+func (c *CounterFunc) write(w io.Writer) error {
+	if err := writeHeader(w, c.name, c.help, "counter"); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s %s\n", c.name, formatFloat(c.fn()))
+	return err
+}
+
+// Histogram counts observations in configurable buckets.
+type Histogram struct {
+	name    string
+	help    string
+	buckets []float64
+
+	lk     sync.Mutex
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+var _ Collector = (*Histogram)(nil)
+
+// NewHistogram returns a new, unregistered Histogram. Buckets are upper bounds
+// and must be sorted in increasing order. If no buckets are given
+// DefaultDurationBuckets is used.
+func NewHistogram(name, help string, buckets ...float64) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultDurationBuckets
+	}
+	if !sort.Float64sAreSorted(buckets) {
+		panic("histogram buckets must be sorted")
+	}
+	return &Histogram{
+		name:    name,
+		help:    help,
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+// Name implements Collector.
+func (h *Histogram) Name() string {
+	return h.name
+}
+
+// Observe adds a single observation to the histogram.
+func (h *Histogram) Observe(v float64) {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// ObserveDuration observes the number of seconds elapsed since start.
+func (h *Histogram) ObserveDuration(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+// Count returns the number of observations made.
+func (h *Histogram) Count() uint64 {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+	return h.count
+}
+
+func (h *Histogram) write(w io.Writer) error {
+	h.lk.Lock()
+	counts := make([]uint64, len(h.counts))
+	copy(counts, h.counts)
+	sum, count := h.sum, h.count
+	h.lk.Unlock()
+
+	if err := writeHeader(w, h.name, h.help, "histogram"); err != nil {
+		return err
+	}
+
+	var cumulative uint64
+	for i, upper := range h.buckets {
+		cumulative += counts[i]
+		if _, err := fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", h.name, formatFloat(upper), cumulative); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, count); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "%s_sum %s\n", h.name, formatFloat(sum)); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s_count %d\n", h.name, count)
+	return err
+}
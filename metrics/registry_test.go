@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+)
+
+func TestRegistryWriteText(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	r := NewRegistry()
+	c := NewCounter("test_counter_total", "A counter.")
+	g := NewGauge("test_gauge", "A gauge.")
+	gf := NewGaugeFunc("test_gauge_func", "A gauge func.", func() float64 { return 42 })
+	cf := NewCounterFunc("test_counter_func_total", "A counter func.", func() float64 { return 9 })
+	h := NewHistogram("test_histogram_seconds", "A histogram.", 1, 5)
+	r.MustRegister(c, g, gf, cf, h)
+
+	c.Inc()
+	c.Add(2)
+	g.Set(7)
+	g.Add(-2.5)
+	h.Observe(0.5)
+	h.Observe(3)
+	h.Observe(10)
+
+	var buf bytes.Buffer
+	require.NoError(r.WriteText(&buf))
+
+	expected := `# HELP test_counter_func_total A counter func.
+# TYPE test_counter_func_total counter
+test_counter_func_total 9
+# HELP test_counter_total A counter.
+# TYPE test_counter_total counter
+test_counter_total 3
+# HELP test_gauge A gauge.
+# TYPE test_gauge gauge
+test_gauge 4.5
+# HELP test_gauge_func A gauge func.
+# TYPE test_gauge_func gauge
+test_gauge_func 42
+# HELP test_histogram_seconds A histogram.
+# TYPE test_histogram_seconds histogram
+test_histogram_seconds_bucket{le="1"} 1
+test_histogram_seconds_bucket{le="5"} 2
+test_histogram_seconds_bucket{le="+Inf"} 3
+test_histogram_seconds_sum 13.5
+test_histogram_seconds_count 3
+`
+	assert.Equal(expected, buf.String())
+}
+
+func TestRegistryRejectsDuplicates(t *testing.T) {
+	assert := assert.New(t)
+
+	r := NewRegistry()
+	assert.NoError(r.Register(NewGauge("dup", "")))
+	assert.Error(r.Register(NewCounter("dup", "")))
+
+	r.Unregister("dup")
+	assert.NoError(r.Register(NewCounter("dup", "")))
+}
+
+func TestHandlerServesAllRegistries(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	r1 := NewRegistry()
+	r1.MustRegister(NewGauge("first", "first gauge"))
+	r2 := NewRegistry()
+	r2.MustRegister(NewGauge("second", "second gauge"))
+
+	srv := httptest.NewServer(Handler(r1, r2))
+	defer srv.Close()
+
+	res, err := srv.Client().Get(srv.URL)
+	require.NoError(err)
+	defer res.Body.Close() // nolint: errcheck
+
+	body, err := ioutil.ReadAll(res.Body)
+	require.NoError(err)
+	assert.Contains(string(body), "first 0\n")
+	assert.Contains(string(body), "second 0\n")
+	assert.Contains(res.Header.Get("Content-Type"), "text/plain")
+}
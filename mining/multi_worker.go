@@ -0,0 +1,43 @@
+package mining
+
+import (
+	"context"
+	"sync"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// MultiWorker mines for several miners at once, one Worker per miner, so that
+// a single node can take part in mining with each of its miner actors.
+type MultiWorker struct {
+	workers []Worker
+}
+
+// NewMultiWorker returns a MultiWorker mining with each of workers.
+func NewMultiWorker(workers ...Worker) *MultiWorker {
+	return &MultiWorker{workers: workers}
+}
+
+// Mine runs every worker on base concurrently and returns once all of them
+// are done. Each winning worker sends its block to outCh. Mine returns true
+// if any of them won.
+func (w *MultiWorker) Mine(ctx context.Context, base types.TipSet, nullBlkCount int, outCh chan<- Output) bool {
+	var wg sync.WaitGroup
+	var lk sync.Mutex
+	won := false
+
+	for _, worker := range w.workers {
+		wg.Add(1)
+		go func(worker Worker) {
+			defer wg.Done()
+			if worker.Mine(ctx, base, nullBlkCount, outCh) {
+				lk.Lock()
+				won = true
+				lk.Unlock()
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	return won
+}
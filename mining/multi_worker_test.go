@@ -0,0 +1,29 @@
+package mining
+
+import (
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestMultiWorker(t *testing.T) {
+	assert, _, ts := newTestUtils(t)
+
+	winner := func(ctx context.Context, base types.TipSet, nullBlkCount int, outCh chan<- Output) bool {
+		outCh <- NewOutput(&types.Block{Nonce: types.Uint64(nullBlkCount)}, nil)
+		return true
+	}
+	loser := func(ctx context.Context, base types.TipSet, nullBlkCount int, outCh chan<- Output) bool {
+		return false
+	}
+
+	outCh := make(chan Output, 2)
+	w := NewMultiWorker(NewTestWorkerWithDeps(winner), NewTestWorkerWithDeps(loser), NewTestWorkerWithDeps(winner))
+	assert.True(w.Mine(context.Background(), ts, 3, outCh))
+	assert.Len(outCh, 2)
+	assert.Equal(types.Uint64(3), (<-outCh).NewBlock.Nonce)
+
+	w = NewMultiWorker(NewTestWorkerWithDeps(loser), NewTestWorkerWithDeps(loser))
+	assert.False(w.Mine(context.Background(), ts, 0, outCh))
+}
@@ -0,0 +1,161 @@
+package node
+
+import (
+	"context"
+
+	"gx/ipfs/QmXixGGfd98hN2dA5YiPHWANY3sjmHfZBQk3mLiQUo6NLJ/go-bitswap"
+
+	"github.com/filecoin-project/go-filecoin/metrics"
+	"github.com/filecoin-project/go-filecoin/protocol/storage"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+var (
+	blocksMined = metrics.NewCounter("filecoin_mining_blocks_mined_total", "Number of blocks mined by this node.")
+	blocksWon   = metrics.NewCounter("filecoin_mining_blocks_won_total", "Number of blocks mined by this node which became part of its heaviest chain.")
+)
+
+func init() {
+	metrics.DefaultRegistry.MustRegister(blocksMined, blocksWon)
+}
+
+// nodeMetrics holds the state backing the metrics of a single node instance.
+type nodeMetrics struct {
+	// registry holds the collectors bound to the node.
+	registry *metrics.Registry
+
+	// chainWeight is updated whenever a new heaviest tipset is handled, since
+	// computing the weight requires loading state.
+	chainWeight *metrics.Gauge
+}
+
+// setupMetrics creates the node's metrics registry and registers collectors
+// for chain, message pool, network and proving state.
+func (node *Node) setupMetrics() {
+	node.metrics.registry = metrics.NewRegistry()
+	node.metrics.chainWeight = metrics.NewGauge("filecoin_chain_head_weight", "Weight of the heaviest tipset.")
+
+	node.metrics.registry.MustRegister(
+		node.metrics.chainWeight,
+		metrics.NewGaugeFunc("filecoin_chain_head_height", "Height of the heaviest tipset.", func() float64 {
+			return float64(node.headHeight())
+		}),
+		metrics.NewGaugeFunc("filecoin_chain_sync_target_height", "Height of the highest chain the syncer has been asked to sync.", func() float64 {
+			return float64(node.Syncer.Status().TargetHeight)
+		}),
+		metrics.NewGaugeFunc("filecoin_chain_sync_lag", "Number of blocks the heaviest tipset is behind the syncer's target.", func() float64 {
+			status := node.Syncer.Status()
+			if status.TargetHeight <= status.CurrentHeight {
+				return 0
+			}
+			return float64(status.TargetHeight - status.CurrentHeight)
+		}),
+		metrics.NewGaugeFunc("filecoin_mpool_size", "Number of messages in the message pool.", func() float64 {
+			return float64(len(node.MsgPool.Pending()))
+		}),
+		metrics.NewGaugeFunc("filecoin_net_peers", "Number of connected peers.", func() float64 {
+			return float64(len(node.Host().Network().Peers()))
+		}),
+		metrics.NewGaugeFunc("filecoin_proving_blocks_until_deadline", "Fewest blocks left in the proving period of any of the node's miners.", func() float64 {
+			return float64(node.blocksUntilProvingDeadline())
+		}),
+		metrics.NewGaugeFunc("filecoin_proving_alert", "1 if the PoSt of any of the node's miners is at risk, failed or late, 0 otherwise.", func() float64 {
+			if node.provingAlert() == "" {
+				return 0
+			}
+			return 1
+		}),
+	)
+
+	bswap, ok := node.Exchange.(*bitswap.Bitswap)
+	if !ok {
+		return
+	}
+	bitswapStat := func(f func(*bitswap.Stat) uint64) func() float64 {
+		return func() float64 {
+			st, err := bswap.Stat()
+			if err != nil {
+				return 0
+			}
+			return float64(f(st))
+		}
+	}
+	node.metrics.registry.MustRegister(
+		metrics.NewCounterFunc("filecoin_bitswap_blocks_received_total", "Number of blocks received over bitswap.", bitswapStat(func(st *bitswap.Stat) uint64 { return st.BlocksReceived })),
+		metrics.NewCounterFunc("filecoin_bitswap_blocks_sent_total", "Number of blocks sent over bitswap.", bitswapStat(func(st *bitswap.Stat) uint64 { return st.BlocksSent })),
+		metrics.NewCounterFunc("filecoin_bitswap_data_received_bytes_total", "Number of bytes received over bitswap.", bitswapStat(func(st *bitswap.Stat) uint64 { return st.DataReceived })),
+		metrics.NewCounterFunc("filecoin_bitswap_data_sent_bytes_total", "Number of bytes sent over bitswap.", bitswapStat(func(st *bitswap.Stat) uint64 { return st.DataSent })),
+	)
+}
+
+// Metrics returns the registry of metrics bound to this node. Process-wide
+// metrics are found in metrics.DefaultRegistry.
+func (node *Node) Metrics() *metrics.Registry {
+	return node.metrics.registry
+}
+
+// headHeight returns the height of the heaviest tipset, or zero if it cannot be
+// determined.
+func (node *Node) headHeight() uint64 {
+	h, err := node.ChainReader.Head().Height()
+	if err != nil {
+		return 0
+	}
+	return h
+}
+
+// provingInfos returns the proving info of each of the node's storage miners.
+func (node *Node) provingInfos() []*storage.ProvingInfo {
+	var infos []*storage.ProvingInfo
+	for _, sm := range node.StorageMiners() {
+		infos = append(infos, sm.ProvingInfo())
+	}
+	return infos
+}
+
+// blocksUntilProvingDeadline returns the fewest blocks left in the proving
+// period of any of the node's storage miners, or zero if it is not mining.
+func (node *Node) blocksUntilProvingDeadline() uint64 {
+	var least uint64
+	found := false
+	for _, info := range node.provingInfos() {
+		if info.Height == nil || info.PeriodEnd == nil {
+			continue
+		}
+		var left uint64
+		if info.Height.LessThan(info.PeriodEnd) {
+			left = info.PeriodEnd.Sub(info.Height).AsBigInt().Uint64()
+		}
+		if !found || left < least {
+			least, found = left, true
+		}
+	}
+	return least
+}
+
+// provingAlert returns the first proving alert raised by the node's storage
+// miners, or the empty string if there is none.
+func (node *Node) provingAlert() string {
+	for _, info := range node.provingInfos() {
+		if info.Alert != storage.ProvingAlertNone {
+			return string(info.Alert)
+		}
+	}
+	return ""
+}
+
+// observeHead updates metrics derived from a new heaviest tipset.
+func (node *Node) observeHead(ctx context.Context, head types.TipSet) {
+	w, err := node.tipSetWeight(ctx, head)
+	if err != nil {
+		log.Warningf("failed to compute weight of new head: %s", err)
+		return
+	}
+	wf, err := types.FixedToBig(w)
+	if err != nil {
+		log.Warningf("failed to convert weight of new head: %s", err)
+		return
+	}
+	f, _ := wf.Float64()
+	node.metrics.chainWeight.Set(f)
+}
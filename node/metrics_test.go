@@ -0,0 +1,31 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+)
+
+func TestNodeMetrics(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	nd := MakeOfflineNode(t)
+	require.NoError(nd.Start(ctx))
+	defer nd.Stop(ctx)
+
+	var buf bytes.Buffer
+	require.NoError(nd.Metrics().WriteText(&buf))
+
+	out := buf.String()
+	assert.Contains(out, "filecoin_chain_head_height 0\n")
+	assert.Contains(out, "filecoin_chain_sync_target_height 0\n")
+	assert.Contains(out, "filecoin_chain_sync_lag 0\n")
+	assert.Contains(out, "filecoin_mpool_size 0\n")
+	assert.Contains(out, "filecoin_net_peers 0\n")
+}
@@ -0,0 +1,197 @@
+package node
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore/namespace"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/config"
+	"github.com/filecoin-project/go-filecoin/proofs/sectorbuilder"
+	"github.com/filecoin-project/go-filecoin/protocol/storage"
+	"github.com/filecoin-project/go-filecoin/repo"
+)
+
+// ErrUnknownMiner is returned when a miner address is not one of the miners
+// the node manages.
+var ErrUnknownMiner = errors.New("not a miner managed by this node")
+
+// minerInstance is one of the miner actors a node manages, with what the node
+// runs for it.
+type minerInstance struct {
+	addr address.Address
+
+	// sectorBuilder fills and seals the miner's sectors.
+	sectorBuilder sectorbuilder.SectorBuilder
+
+	// storageMiner and sealScheduler are set once the node starts mining.
+	storageMiner  *storage.Miner
+	sealScheduler *sectorbuilder.SealScheduler
+}
+
+// minerNode is the node as seen by the storage miner of one of its miners:
+// the node, with the sector builder of that miner.
+type minerNode struct {
+	*Node
+	miner *minerInstance
+}
+
+// SectorBuilder returns the sector builder of the miner.
+func (mn *minerNode) SectorBuilder() sectorbuilder.SectorBuilder {
+	return mn.miner.sectorBuilder
+}
+
+// minerConfigs returns the miner actors the node manages, its default miner
+// first, or ErrNoMinerAddress if it has no default miner.
+func (node *Node) minerConfigs() ([]config.MinerConfig, error) {
+	cfg := node.Repo.Config().Mining
+	if cfg.MinerAddress == (address.Address{}) {
+		return nil, ErrNoMinerAddress
+	}
+
+	miners := []config.MinerConfig{{Address: cfg.MinerAddress, BlockSignerAddress: cfg.BlockSignerAddress}}
+	for _, m := range cfg.Miners {
+		if m.Address == cfg.MinerAddress {
+			continue
+		}
+		miners = append(miners, *m)
+	}
+	return miners, nil
+}
+
+// minerSignerAddress returns the address signing the blocks mined for the
+// miner with the given address.
+func (node *Node) minerSignerAddress(minerAddr address.Address) address.Address {
+	configs, err := node.minerConfigs()
+	if err != nil {
+		return address.Address{}
+	}
+	for _, m := range configs {
+		if m.Address == minerAddr {
+			return m.BlockSignerAddress
+		}
+	}
+	return address.Address{}
+}
+
+// managedMiner returns the miner with the given address, or the node's
+// default miner if addr is empty. It fails if the node does not manage the
+// miner, and returns nil if its sector builder is not set up yet.
+func (node *Node) managedMiner(addr address.Address) (*minerInstance, error) {
+	configs, err := node.minerConfigs()
+	if err != nil {
+		return nil, err
+	}
+	if addr == (address.Address{}) {
+		addr = configs[0].Address
+	}
+
+	known := false
+	for _, m := range configs {
+		known = known || m.Address == addr
+	}
+	if !known {
+		return nil, errors.Wrap(ErrUnknownMiner, addr.String())
+	}
+
+	for _, m := range node.miners {
+		if m.addr == addr {
+			return m, nil
+		}
+	}
+	return nil, nil
+}
+
+// StorageMinerFor returns the storage miner of the node's miner with the given
+// address, or of its default miner if addr is empty. It is nil while the node
+// is not mining.
+func (node *Node) StorageMinerFor(addr address.Address) (*storage.Miner, error) {
+	m, err := node.managedMiner(addr)
+	if err != nil || m == nil {
+		return nil, err
+	}
+	return m.storageMiner, nil
+}
+
+// SealSchedulerFor returns the seal scheduler of the node's miner with the
+// given address, or of its default miner if addr is empty. It is nil while
+// the node is not mining.
+func (node *Node) SealSchedulerFor(addr address.Address) (*sectorbuilder.SealScheduler, error) {
+	m, err := node.managedMiner(addr)
+	if err != nil || m == nil {
+		return nil, err
+	}
+	return m.sealScheduler, nil
+}
+
+// StorageMiners returns the storage miners of the node's miners, the default
+// miner's first. It is empty while the node is not mining.
+func (node *Node) StorageMiners() []*storage.Miner {
+	var miners []*storage.Miner
+	for _, m := range node.miners {
+		if m.storageMiner != nil {
+			miners = append(miners, m.storageMiner)
+		}
+	}
+	return miners
+}
+
+// StorageMinerForDeal returns the storage miner the proposal with the given
+// cid was made to, or nil if none of the node's miners received it.
+func (node *Node) StorageMinerForDeal(proposalCid cid.Cid) *storage.Miner {
+	sm, _ := node.storageRouter.MinerForDeal(proposalCid)
+	return sm
+}
+
+// minerSectorDirs returns the directories the sector builder of the miner
+// with the given address keeps its metadata, staged and sealed sectors in,
+// and the subdirectory of the storage paths it stores sectors in. The
+// default miner uses the repo's directories; the others get a subdirectory
+// named after them.
+func (node *Node) minerSectorDirs(minerAddr address.Address, isDefault bool) (staging, sealed, subdir string, err error) {
+	if isDefault {
+		return node.Repo.StagingDir(), node.Repo.SealedDir(), "", nil
+	}
+
+	subdir = minerAddr.String()
+	staging = filepath.Join(node.Repo.StagingDir(), subdir)
+	sealed = filepath.Join(node.Repo.SealedDir(), subdir)
+	for _, dir := range []string{staging, sealed} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", "", "", errors.Wrapf(err, "failed to create sector directory %s", dir)
+		}
+	}
+	return staging, sealed, subdir, nil
+}
+
+// minerDatastore returns the datastore the storage miner of the miner with
+// the given address keeps its deals in. The default miner uses the repo's
+// deals datastore; the others a namespace of it.
+func (node *Node) minerDatastore(minerAddr address.Address, isDefault bool) repo.Datastore {
+	if isDefault {
+		return node.Repo.DealsDatastore()
+	}
+	return namespace.Wrap(node.Repo.DealsDatastore(), datastore.NewKey("minerdeals").ChildString(minerAddr.String()))
+}
+
+// ReadSealedPiece returns a reader for the piece with the given cid, read
+// from the sealed sectors of whichever of the node's miners holds it.
+func (node *Node) ReadSealedPiece(pieceRef cid.Cid) (io.Reader, error) {
+	err := errors.New("node is not mining")
+	for _, m := range node.miners {
+		if m.sectorBuilder == nil {
+			continue
+		}
+		var r io.Reader
+		r, err = m.sectorBuilder.ReadPieceFromSealedSector(pieceRef)
+		if err == nil {
+			return r, nil
+		}
+	}
+	return nil, err
+}
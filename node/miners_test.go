@@ -0,0 +1,71 @@
+package node
+
+import (
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/config"
+	"github.com/filecoin-project/go-filecoin/repo"
+)
+
+func TestNodeMiners(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	addrGetter := address.NewForTestGetter()
+	nd := &Node{Repo: repo.NewInMemoryRepo()}
+
+	_, err := nd.minerConfigs()
+	assert.Equal(ErrNoMinerAddress, err)
+
+	// The first miner saved becomes the default, the others are added to it.
+	first, firstSigner := addrGetter(), addrGetter()
+	second, secondSigner := addrGetter(), addrGetter()
+	require.NoError(nd.saveMinerConfig(first, firstSigner))
+	require.NoError(nd.saveMinerConfig(second, secondSigner))
+	assert.Equal(first, nd.Repo.Config().Mining.MinerAddress)
+
+	// Listing the default miner among the others does not add it twice.
+	cfg := nd.Repo.Config()
+	cfg.Mining.Miners = append(cfg.Mining.Miners, &config.MinerConfig{Address: first})
+	require.NoError(nd.Repo.ReplaceConfig(cfg))
+
+	configs, err := nd.minerConfigs()
+	require.NoError(err)
+	assert.Equal([]config.MinerConfig{
+		{Address: first, BlockSignerAddress: firstSigner},
+		{Address: second, BlockSignerAddress: secondSigner},
+	}, configs)
+	assert.Equal(secondSigner, nd.minerSignerAddress(second))
+
+	// Miners the node manages have no storage miner until it mines.
+	sm, err := nd.StorageMinerFor(second)
+	assert.NoError(err)
+	assert.Nil(sm)
+
+	nd.miners = []*minerInstance{{addr: first}, {addr: second}}
+	m, err := nd.managedMiner(address.Address{})
+	require.NoError(err)
+	assert.Equal(first, m.addr)
+	m, err = nd.managedMiner(second)
+	require.NoError(err)
+	assert.Equal(second, m.addr)
+
+	_, err = nd.StorageMinerFor(addrGetter())
+	assert.Equal(ErrUnknownMiner, errors.Cause(err))
+
+	// Miners but the default keep their deals in a namespace of their own.
+	dealKey := datastore.KeyWithNamespaces([]string{"miner", "deal"})
+	require.NoError(nd.minerDatastore(second, false).Put(dealKey, []byte("deal")))
+	has, err := nd.minerDatastore(first, true).Has(dealKey)
+	require.NoError(err)
+	assert.False(has)
+	has, err = nd.Repo.DealsDatastore().Has(datastore.KeyWithNamespaces([]string{"minerdeals", second.String(), "miner", "deal"}))
+	require.NoError(err)
+	assert.True(has)
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"math/big"
 	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
@@ -38,8 +39,10 @@ import (
 
 	"github.com/filecoin-project/go-filecoin/abi"
 	"github.com/filecoin-project/go-filecoin/actor/builtin"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/miner"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/storagemarket"
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/auth"
 	"github.com/filecoin-project/go-filecoin/chain"
 	"github.com/filecoin-project/go-filecoin/config"
 	"github.com/filecoin-project/go-filecoin/consensus"
@@ -59,10 +62,13 @@ import (
 	"github.com/filecoin-project/go-filecoin/proofs/sectorbuilder"
 	"github.com/filecoin-project/go-filecoin/protocol/hello"
 	"github.com/filecoin-project/go-filecoin/protocol/retrieval"
+	"github.com/filecoin-project/go-filecoin/protocol/sealworker"
 	"github.com/filecoin-project/go-filecoin/protocol/storage"
 	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/rpc"
 	"github.com/filecoin-project/go-filecoin/state"
 	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm"
 	vmErrors "github.com/filecoin-project/go-filecoin/vm/errors"
 	"github.com/filecoin-project/go-filecoin/wallet"
 )
@@ -113,7 +119,12 @@ type Node struct {
 
 	// Storage Market Interfaces
 	StorageMinerClient *storage.Client
-	StorageMiner       *storage.Miner
+	// StorageMiner is the storage miner of the node's default miner. The
+	// storage miners of all its miners are kept in miners.
+	StorageMiner *storage.Miner
+	// storageRouter hands the storage protocol requests to the storage miner
+	// they are for.
+	storageRouter *storage.MinerRouter
 
 	// Retrieval Interfaces
 	RetrievalClient *retrieval.Client
@@ -133,9 +144,18 @@ type Node struct {
 	// it contains all persistent artifacts of the filecoin node
 	Repo repo.Repo
 
-	// SectorBuilder is used by the miner to fill and seal sectors.
+	// SectorBuilder is used by the default miner to fill and seal sectors.
 	sectorBuilder sectorbuilder.SectorBuilder
 
+	// miners are the miner actors the node manages, its default miner first.
+	miners []*minerInstance
+
+	// SectorStorage holds the paths the sector builder stores sectors in.
+	SectorStorage *sectorbuilder.SectorStorage
+
+	// SealScheduler seals the default miner's staged sectors while mining.
+	SealScheduler *sectorbuilder.SealScheduler
+
 	// Exchange is the interface for fetching data from other nodes.
 	Exchange exchange.Interface
 
@@ -159,6 +179,17 @@ type Node struct {
 
 	// Router is a router from IPFS
 	Router routing.IpfsRouting
+
+	// metrics holds the collectors bound to this node.
+	metrics nodeMetrics
+
+	// verifier checks proofs, both in consensus and for the storage client.
+	verifier proofs.Verifier
+
+	// insecureProofs, when true, replaces the Rust sector builder with a
+	// MemorySectorBuilder sealing sectors in insecureSealDelay.
+	insecureProofs    bool
+	insecureSealDelay time.Duration
 }
 
 // Config is a helper to aid in the construction of a filecoin node.
@@ -170,6 +201,9 @@ type Config struct {
 	Rewarder    consensus.BlockRewarder
 	Repo        repo.Repo
 	IsRelay     bool
+
+	InsecureProofs    bool
+	InsecureSealDelay time.Duration
 }
 
 // ConfigOpt is a configuration option for a filecoin node.
@@ -219,6 +253,17 @@ func VerifierConfigOption(verifier proofs.Verifier) ConfigOpt {
 	}
 }
 
+// InsecureProofs makes the node use fake proofs that anyone can forge, and
+// keep its sectors in memory, sealing each in sealDelay. It overrides the
+// proofs section of the repo's config.
+func InsecureProofs(sealDelay time.Duration) ConfigOpt {
+	return func(c *Config) error {
+		c.InsecureProofs = true
+		c.InsecureSealDelay = sealDelay
+		return nil
+	}
+}
+
 // RewarderConfigOption returns a function that sets the rewarder to use in the node consensus
 func RewarderConfigOption(rewarder consensus.BlockRewarder) ConfigOpt {
 	return func(c *Config) error {
@@ -375,13 +420,32 @@ func (nc *Config) Build(ctx context.Context) (*Node, error) {
 		processor = consensus.NewConfiguredProcessor(consensus.NewDefaultMessageValidator(), nc.Rewarder)
 	}
 
-	var nodeConsensus consensus.Protocol
-	if nc.Verifier == nil {
-		nodeConsensus = consensus.NewExpected(&cstOffline, bs, processor, powerTable, genCid, &proofs.RustVerifier{})
-	} else {
-		nodeConsensus = consensus.NewExpected(&cstOffline, bs, processor, powerTable, genCid, nc.Verifier)
+	insecureProofs, insecureSealDelay := nc.InsecureProofs, nc.InsecureSealDelay
+	if proofsCfg := nc.Repo.Config().Proofs; !insecureProofs && proofsCfg != nil && proofsCfg.Insecure {
+		insecureProofs = true
+		insecureSealDelay = time.Duration(proofsCfg.InsecureSealDelaySeconds) * time.Second
+	}
+
+	// The Rust sector builder cannot export its staged sectors, so seal
+	// workers connecting to it would never be given any.
+	if workersCfg := nc.Repo.Config().Mining.SealWorkers; !insecureProofs && workersCfg != nil && workersCfg.ListenAddress != "" {
+		return nil, errors.New("seal workers need insecure proofs: the Rust sector builder cannot hand its sectors to them, unset mining.sealWorkers.listenAddress")
 	}
 
+	storagePaths, err := sectorStoragePaths(nc.Repo)
+	if err != nil {
+		return nil, err
+	}
+
+	var verifier proofs.Verifier = &proofs.RustVerifier{}
+	if insecureProofs {
+		verifier = &proofs.InsecureVerifier{}
+	}
+	if nc.Verifier != nil {
+		verifier = nc.Verifier
+	}
+	nodeConsensus := consensus.NewExpected(&cstOffline, bs, processor, powerTable, genCid, verifier)
+
 	// only the syncer gets the storage which is online connected
 	chainSyncer := chain.NewDefaultSyncer(&cstOnline, &cstOffline, nodeConsensus, chainStore)
 	chainReader, ok := chainStore.(chain.ReadStore)
@@ -401,7 +465,14 @@ func (nc *Config) Build(ctx context.Context) (*Node, error) {
 	}
 	fcWallet := wallet.New(backend)
 
-	PorcelainAPI := porcelain.New(plumbing.New(&plumbing.APIDeps{
+	// On-chain lookup service. Its queries are sent from the default sender
+	// address, which only the porcelain API can pick.
+	var PorcelainAPI *porcelain.API
+	peerLookup := lookup.NewChainLookupService(chainReader, func() (address.Address, error) {
+		return PorcelainAPI.GetAndMaybeSetDefaultSenderAddress()
+	}, bs)
+
+	PorcelainAPI = porcelain.New(plumbing.New(&plumbing.APIDeps{
 		Chain:        chainReader,
 		Config:       cfg.NewConfig(nc.Repo),
 		MsgPool:      msgPool,
@@ -411,8 +482,10 @@ func (nc *Config) Build(ctx context.Context) (*Node, error) {
 		MsgWaiter:    msg.NewWaiter(chainReader, bs, &cstOffline),
 		Subscriber:   ps.NewSubscriber(fsub),
 		Publisher:    ps.NewPublisher(fsub),
-		Network:      ntwk.NewNetwork(peerHost),
+		Network:      ntwk.NewNetwork(peerHost, pinger),
+		PeerLookup:   peerLookup,
 		SigGetter:    mthdsig.NewGetter(chainReader),
+		Syncer:       chainSyncer,
 		Wallet:       fcWallet,
 	}))
 
@@ -432,10 +505,18 @@ func (nc *Config) Build(ctx context.Context) (*Node, error) {
 		OfflineMode:  nc.OfflineMode,
 		PeerHost:     peerHost,
 		Ping:         pinger,
+		lookup:       peerLookup,
 		Repo:         nc.Repo,
 		Wallet:       fcWallet,
 		blockTime:    nc.BlockTime,
 		Router:       router,
+		verifier:     verifier,
+
+		SectorStorage: sectorbuilder.NewSectorStorage(storagePaths),
+		storageRouter: storage.NewMinerRouter(peerHost),
+
+		insecureProofs:    insecureProofs,
+		insecureSealDelay: insecureSealDelay,
 	}
 
 	// Bootstrapping network peers.
@@ -454,11 +535,7 @@ func (nc *Config) Build(ctx context.Context) (*Node, error) {
 	minPeerThreshold := nd.Repo.Config().Bootstrap.MinPeerThreshold
 	nd.Bootstrapper = filnet.NewBootstrapper(bpi, nd.Host(), nd.Host().Network(), nd.Router, minPeerThreshold, period)
 
-	// On-chain lookup service
-	defaultAddressGetter := func() (address.Address, error) {
-		return nd.PorcelainAPI.GetAndMaybeSetDefaultSenderAddress()
-	}
-	nd.lookup = lookup.NewChainLookupService(nd.ChainReader, defaultAddressGetter, bs)
+	nd.setupMetrics()
 
 	return nd, nil
 }
@@ -491,7 +568,7 @@ func (node *Node) Start(ctx context.Context) error {
 
 	cni := storage.NewClientNodeImpl(dag.NewDAGService(node.BlockService()), node.Host(), node.GetBlockTime())
 	var err error
-	node.StorageMinerClient, err = storage.NewClient(cni, node.PorcelainAPI, node.Repo.DealsDatastore())
+	node.StorageMinerClient, err = storage.NewClient(cni, node.PorcelainAPI, node.Repo.DealsDatastore(), node.verifier)
 	if err != nil {
 		return errors.Wrap(err, "Could not make new storage client")
 	}
@@ -538,8 +615,11 @@ func (node *Node) Start(ctx context.Context) error {
 
 		return addr
 	}
+	syncing := func() bool {
+		return node.Syncer.Status().Syncing()
+	}
 	// start the primary heartbeat service
-	hbs := metrics.NewHeartbeatService(node.Host(), node.Repo.Config().Heartbeat, node.ChainReader.Head, metrics.WithMinerAddressGetter(mag))
+	hbs := metrics.NewHeartbeatService(node.Host(), node.Repo.Config().Heartbeat, node.ChainReader.Head, metrics.WithMinerAddressGetter(mag), metrics.WithSyncingGetter(syncing), metrics.WithProvingAlertGetter(node.provingAlert))
 	go hbs.Start(ctx)
 
 	// check if we want to connect to an alert service. An alerting service is a heartbeat
@@ -550,12 +630,14 @@ func (node *Node) Start(ctx context.Context) error {
 			BeatPeriod:      "10s",
 			ReconnectPeriod: "10s",
 			Nickname:        node.Repo.Config().Heartbeat.Nickname,
-		}, node.ChainReader.Head, metrics.WithMinerAddressGetter(mag))
+		}, node.ChainReader.Head, metrics.WithMinerAddressGetter(mag), metrics.WithSyncingGetter(syncing), metrics.WithProvingAlertGetter(node.provingAlert))
 		go ahbs.Start(ctx)
 	}
 	return nil
 }
 
+// setupMining initializes a sector builder for each of the node's miners that
+// does not have one yet. Seal workers seal the sectors of the default miner.
 func (node *Node) setupMining(ctx context.Context) error {
 	// configure the underlying sector store, defaulting to the non-test version
 	sectorStoreType := proofs.Live
@@ -563,13 +645,76 @@ func (node *Node) setupMining(ctx context.Context) error {
 		sectorStoreType = proofs.Test
 	}
 
-	// initialize a sector builder
-	sectorBuilder, err := initSectorBuilderForNode(ctx, node, sectorStoreType)
+	configs, err := node.minerConfigs()
+	if err != nil {
+		return err
+	}
+
+	for i, cfg := range configs {
+		if m, err := node.managedMiner(cfg.Address); err != nil || m != nil {
+			continue
+		}
+		isDefault := i == 0
+
+		// initialize a sector builder
+		sectorBuilder, err := initSectorBuilderForNode(ctx, node, cfg.Address, isDefault, sectorStoreType)
+		if err != nil {
+			return errors.Wrap(err, "failed to initialize sector builder")
+		}
+
+		if isDefault {
+			node.sectorBuilder = sectorBuilder
+			if workersCfg := node.Repo.Config().Mining.SealWorkers; workersCfg != nil && workersCfg.ListenAddress != "" {
+				if err := node.setupSealWorkers(sectorStoreType, workersCfg.ListenAddress); err != nil {
+					return errors.Wrap(err, "failed to set up seal workers")
+				}
+			}
+			sectorBuilder = node.sectorBuilder
+		}
+
+		node.miners = append(node.miners, &minerInstance{addr: cfg.Address, sectorBuilder: sectorBuilder})
+	}
+
+	return nil
+}
+
+// setupSealWorkers wraps the node's sector builder so that sealing is handed
+// to the seal workers connecting on listenAddr.
+func (node *Node) setupSealWorkers(sectorStoreType proofs.SectorStoreType, listenAddr string) error {
+	minerAddr, err := node.miningAddress()
+	if err != nil {
+		return errors.Wrap(err, "failed to get node's mining address")
+	}
+
+	secret, err := auth.LoadOrCreateSecret(node.Repo.Datastore())
+	if err != nil {
+		return errors.Wrap(err, "failed to load API secret")
+	}
+
+	// Replicas uploaded by workers are kept next to, but out of, the sealed
+	// sector directory until they are imported.
+	sb, err := sealworker.NewSectorBuilder(node.sectorBuilder, sealworker.CoordinatorConfig{
+		MinerAddr:       minerAddr,
+		SectorStoreType: sectorStoreType,
+		BlockService:    node.blockservice,
+		ReplicaDir:      filepath.Join(filepath.Dir(node.Repo.SealedDir()), "incoming"),
+		Verifier:        node.verifier,
+	}, rpc.TokenAuthorizer(auth.NewAuthenticator(secret, node.Repo.Datastore())))
 	if err != nil {
-		return errors.Wrap(err, "failed to initialize sector builder")
+		return err
 	}
-	node.sectorBuilder = sectorBuilder
 
+	lis, err := sealworker.Listen(listenAddr)
+	if err != nil {
+		return errors.Wrapf(err, "failed to listen for seal workers on %s", listenAddr)
+	}
+	go func() {
+		if err := sb.Serve(lis); err != nil {
+			log.Errorf("stopped serving seal workers: %s", err)
+		}
+	}()
+
+	node.sectorBuilder = sb
 	return nil
 }
 
@@ -600,6 +745,7 @@ func (node *Node) handleNewMiningOutput(miningOutCh <-chan mining.Output) {
 			if output.Err != nil {
 				log.Errorf("problem mining a block: %s", output.Err.Error())
 			} else {
+				blocksMined.Inc()
 				node.miningDoneWg.Add(1)
 				go func() {
 					if node.isMining() {
@@ -637,9 +783,15 @@ func (node *Node) handleNewHeaviestTipSet(ctx context.Context, head types.TipSet
 				continue
 			}
 			head = newHead
+			node.observeHead(ctx, newHead)
 
-			if node.StorageMiner != nil {
-				node.StorageMiner.OnNewHeaviestTipSet(newHead)
+			for _, m := range node.miners {
+				if m.storageMiner != nil {
+					m.storageMiner.OnNewHeaviestTipSet(newHead)
+				}
+			}
+			if node.StorageMinerClient != nil {
+				node.StorageMinerClient.OnNewHeaviestTipSet(newHead)
 			}
 			node.HeaviestTipSetHandled()
 		case <-ctx.Done():
@@ -672,12 +824,16 @@ func (node *Node) Stop(ctx context.Context) {
 	node.cancelSubscriptions()
 	node.ChainReader.Stop()
 
-	if node.SectorBuilder() != nil {
-		if err := node.SectorBuilder().Close(); err != nil {
-			fmt.Printf("error closing sector builder: %s\n", err)
+	for _, m := range node.miners {
+		if m.storageMiner != nil {
+			m.storageMiner.Stop()
+		}
+		if err := m.sectorBuilder.Close(); err != nil {
+			fmt.Printf("error closing sector builder of miner %s: %s\n", m.addr, err)
 		}
-		node.sectorBuilder = nil
 	}
+	node.miners = nil
+	node.sectorBuilder = nil
 
 	if err := node.Host().Close(); err != nil {
 		fmt.Printf("error closing host: %s\n", err)
@@ -698,9 +854,39 @@ func (node *Node) addNewlyMinedBlock(ctx context.Context, b *types.Block) {
 	log.Debugf("Got a newly mined block from the mining worker: %s", b)
 	if err := node.AddNewBlock(ctx, b); err != nil {
 		log.Warningf("error adding new mined block: %s. err: %s", b.Cid().String(), err.Error())
+		return
+	}
+	if _, ok := node.ChainReader.Head()[b.Cid()]; ok {
+		blocksWon.Inc()
 	}
 }
 
+// getStateFromKey loads the state tree of the tipset with the given key.
+func (node *Node) getStateFromKey(ctx context.Context, tsKey string) (state.Tree, error) {
+	tsas, err := node.ChainReader.GetTipSetAndState(ctx, tsKey)
+	if err != nil {
+		return nil, err
+	}
+	return state.LoadStateTree(ctx, node.CborStore(), tsas.TipSetStateRoot, builtin.Actors)
+}
+
+// tipSetWeight returns the consensus weight of the given tipset.
+func (node *Node) tipSetWeight(ctx context.Context, ts types.TipSet) (uint64, error) {
+	parent, err := ts.Parents()
+	if err != nil {
+		return uint64(0), err
+	}
+	// TODO handle genesis cid more gracefully
+	if parent.Len() == 0 {
+		return node.Consensus.Weight(ctx, ts, nil)
+	}
+	pSt, err := node.getStateFromKey(ctx, parent.String())
+	if err != nil {
+		return uint64(0), err
+	}
+	return node.Consensus.Weight(ctx, ts, pSt)
+}
+
 // miningAddress returns the address of the mining actor mining on behalf of
 // the node.
 func (node *Node) miningAddress() (address.Address, error) {
@@ -739,63 +925,42 @@ func StartMining(ctx context.Context, node *Node) error {
 }
 
 // StartMining causes the node to start feeding blocks to the mining worker and initializes
-// the SectorBuilder for the mining address.
+// the SectorBuilder and storage miner of each of the node's miners.
 func (node *Node) StartMining(ctx context.Context) error {
 	if node.isMining() {
 		return errors.New("Node is already mining")
 	}
-	minerAddr, err := node.miningAddress()
-	if err != nil {
+	if _, err := node.miningAddress(); err != nil {
 		return errors.Wrap(err, "failed to get mining address")
 	}
 
-	// ensure we have a sector builder
-	if node.SectorBuilder() == nil {
-		if err := node.setupMining(ctx); err != nil {
-			return err
-		}
-	}
-
-	minerOwnerAddr, err := node.miningOwnerAddress(ctx, minerAddr)
-	minerSigningAddress := node.MiningSignerAddress()
-	if err != nil {
-		return errors.Wrapf(err, "failed to get mining owner address for miner %s", minerAddr)
+	// ensure each miner has a sector builder
+	if err := node.setupMining(ctx); err != nil {
+		return err
 	}
 
 	blockTime, mineDelay := node.MiningTimes()
 
 	if node.MiningScheduler == nil {
-		getStateFromKey := func(ctx context.Context, tsKey string) (state.Tree, error) {
-			tsas, err := node.ChainReader.GetTipSetAndState(ctx, tsKey)
-			if err != nil {
-				return nil, err
-			}
-			return state.LoadStateTree(ctx, node.CborStore(), tsas.TipSetStateRoot, builtin.Actors)
-		}
 		getState := func(ctx context.Context, ts types.TipSet) (state.Tree, error) {
-			return getStateFromKey(ctx, ts.String())
-		}
-		getWeight := func(ctx context.Context, ts types.TipSet) (uint64, error) {
-			parent, err := ts.Parents()
-			if err != nil {
-				return uint64(0), err
-			}
-			// TODO handle genesis cid more gracefully
-			if parent.Len() == 0 {
-				return node.Consensus.Weight(ctx, ts, nil)
-			}
-			pSt, err := getStateFromKey(ctx, parent.String())
-			if err != nil {
-				return uint64(0), err
-			}
-			return node.Consensus.Weight(ctx, ts, pSt)
+			return node.getStateFromKey(ctx, ts.String())
 		}
+		getWeight := node.tipSetWeight
 		getAncestors := func(ctx context.Context, ts types.TipSet, newBlockHeight *types.BlockHeight) ([]types.TipSet, error) {
 			return chain.GetRecentAncestors(ctx, ts, node.ChainReader, newBlockHeight, consensus.AncestorRoundsNeeded, consensus.LookBackParameter)
 		}
 		processor := consensus.NewDefaultProcessor()
-		worker := mining.NewDefaultWorker(node.MsgPool, getState, getWeight, getAncestors, processor, node.PowerTable,
-			node.Blockstore, node.CborStore(), minerAddr, minerSigningAddress, node.Wallet, blockTime)
+
+		// each miner mines with its own worker, all on the same heads
+		var workers []mining.Worker
+		for _, m := range node.miners {
+			workers = append(workers, mining.NewDefaultWorker(node.MsgPool, getState, getWeight, getAncestors, processor, node.PowerTable,
+				node.Blockstore, node.CborStore(), m.addr, node.minerSignerAddress(m.addr), node.Wallet, blockTime))
+		}
+		worker := workers[0]
+		if len(workers) > 1 {
+			worker = mining.NewMultiWorker(workers...)
+		}
 		node.MiningScheduler = mining.NewScheduler(worker, mineDelay, node.ChainReader.Head)
 	}
 
@@ -810,50 +975,46 @@ func (node *Node) StartMining(ctx context.Context) error {
 		go node.handleNewMiningOutput(outCh)
 	}
 
+	for i, m := range node.miners {
+		if err := node.startStorageMiner(ctx, m, i == 0); err != nil {
+			return err
+		}
+	}
+	node.StorageMiner = node.miners[0].storageMiner
+	node.SealScheduler = node.miners[0].sealScheduler
+
+	if node.Repo.Config().Mining.AutoSealIntervalSeconds == 0 {
+		log.Debug("auto-seal is disabled")
+	}
+
+	node.setIsMining(true)
+
+	return nil
+}
+
+// startStorageMiner initializes a storage miner for m, routes the storage
+// protocol requests for m to it and schedules sealing of m's staged sectors.
+func (node *Node) startStorageMiner(ctx context.Context, m *minerInstance, isDefault bool) error {
 	// initialize a storage miner
-	storageMiner, err := initStorageMinerForNode(ctx, node)
+	storageMiner, err := initStorageMinerForNode(ctx, node, m, isDefault)
 	if err != nil {
-		return errors.Wrap(err, "failed to initialize storage miner")
+		return errors.Wrapf(err, "failed to initialize storage miner for miner %s", m.addr)
 	}
-	node.StorageMiner = storageMiner
+	m.storageMiner = storageMiner
+	node.storageRouter.Add(storageMiner)
 
-	// loop, turning sealing-results into commitSector messages to be included
-	// in the chain
+	// loop, handing sealing-results to the storage miner, which commits the
+	// sectors in the chain
 	go func() {
 		for {
 			select {
-			case result := <-node.SectorBuilder().SectorSealResults():
+			case result := <-m.sectorBuilder.SectorSealResults():
 				if result.SealingErr != nil {
 					log.Errorf("failed to seal sector with id %d: %s", result.SectorID, result.SealingErr.Error())
 				} else if result.SealingResult != nil {
-
-					// TODO: determine these algorithmically by simulating call and querying historical prices
-					gasPrice := types.NewGasPrice(0)
-					gasUnits := types.NewGasUnits(300)
-
-					val := result.SealingResult
-					// This call can fail due to, e.g. nonce collisions. Our miners existence depends on this.
-					// We should deal with this, but MessageSendWithRetry is problematic.
-					_, err := node.PorcelainAPI.MessageSend(
-						node.miningCtx,
-						minerOwnerAddr,
-						minerAddr,
-						nil,
-						gasPrice,
-						gasUnits,
-						"commitSector",
-						val.SectorID,
-						val.CommD[:],
-						val.CommR[:],
-						val.CommRStar[:],
-						val.Proof[:],
-					)
-					if err != nil {
-						log.Errorf("failed to send commitSector message from %s to %s for sector with id %d: %s", minerOwnerAddr, minerAddr, val.SectorID, err)
-						continue
+					if err := storageMiner.CommitSector(result.SealingResult); err != nil {
+						log.Errorf("failed to commit sector with id %d: %s", result.SectorID, err)
 					}
-
-					node.StorageMiner.OnCommitmentAddedToChain(val, nil)
 				}
 			case <-node.miningCtx.Done():
 				return
@@ -862,29 +1023,26 @@ func (node *Node) StartMining(ctx context.Context) error {
 	}()
 
 	// schedules sealing of staged piece-data
-	if node.Repo.Config().Mining.AutoSealIntervalSeconds > 0 {
-		go func() {
-			for {
-				select {
-				case <-node.miningCtx.Done():
-					return
-				case <-time.After(time.Duration(node.Repo.Config().Mining.AutoSealIntervalSeconds) * time.Second):
-					log.Info("auto-seal has been triggered")
-					if err := node.SectorBuilder().SealAllStagedSectors(node.miningCtx); err != nil {
-						log.Errorf("scheduler received error from node.SectorBuilder.SealAllStagedSectors (%s) - exiting", err.Error())
-						return
-					}
-				}
-			}
-		}()
-	} else {
-		log.Debug("auto-seal is disabled")
-	}
-	node.setIsMining(true)
+	m.sealScheduler = sectorbuilder.NewSealScheduler(m.sectorBuilder, node.sealPolicy)
+	go m.sealScheduler.Run(node.miningCtx)
 
 	return nil
 }
 
+// sealPolicy returns the sealing policy set in the node's config.
+func (node *Node) sealPolicy() sectorbuilder.SealPolicy {
+	cfg := node.Repo.Config().Mining
+	policy := sectorbuilder.SealPolicy{
+		Interval: time.Duration(cfg.AutoSealIntervalSeconds) * time.Second,
+	}
+	if cfg.SealPolicy != nil {
+		policy.FillPercent = cfg.SealPolicy.FillPercent
+		policy.MaxWait = time.Duration(cfg.SealPolicy.MaxWaitSeconds) * time.Second
+		policy.MaxConcurrentSeals = cfg.SealPolicy.MaxConcurrentSeals
+	}
+	return policy
+}
+
 func (node *Node) getLastUsedSectorID(ctx context.Context, minerAddr address.Address) (uint64, error) {
 	rets, methodSignature, err := node.PorcelainAPI.MessageQuery(
 		ctx,
@@ -908,15 +1066,24 @@ func (node *Node) getLastUsedSectorID(ctx context.Context, minerAddr address.Add
 	return lastUsedSectorID, nil
 }
 
-func initSectorBuilderForNode(ctx context.Context, node *Node, sectorStoreType proofs.SectorStoreType) (sectorbuilder.SectorBuilder, error) {
-	minerAddr, err := node.miningAddress()
+func initSectorBuilderForNode(ctx context.Context, node *Node, minerAddr address.Address, isDefault bool, sectorStoreType proofs.SectorStoreType) (sectorbuilder.SectorBuilder, error) {
+	lastUsedSectorID, err := node.getLastUsedSectorID(ctx, minerAddr)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get node's mining address")
+		return nil, errors.Wrapf(err, "failed to get last used sector id for miner w/address %s", minerAddr.String())
 	}
 
-	lastUsedSectorID, err := node.getLastUsedSectorID(ctx, minerAddr)
+	if node.insecureProofs {
+		return sectorbuilder.NewMemorySectorBuilder(sectorbuilder.MemorySectorBuilderConfig{
+			BlockService:     node.blockservice,
+			LastUsedSectorID: lastUsedSectorID,
+			MinerAddr:        minerAddr,
+			SealDelay:        node.insecureSealDelay,
+		}), nil
+	}
+
+	stagingDir, sealedDir, storageSubdir, err := node.minerSectorDirs(minerAddr, isDefault)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to get last used sector id for miner w/address %s", minerAddr.String())
+		return nil, err
 	}
 
 	// TODO: Where should we store the RustSectorBuilder metadata? Currently, we
@@ -926,11 +1093,13 @@ func initSectorBuilderForNode(ctx context.Context, node *Node, sectorStoreType p
 	cfg := sectorbuilder.RustSectorBuilderConfig{
 		BlockService:     node.blockservice,
 		LastUsedSectorID: lastUsedSectorID,
-		MetadataDir:      node.Repo.StagingDir(),
+		MetadataDir:      stagingDir,
 		MinerAddr:        minerAddr,
-		SealedSectorDir:  node.Repo.SealedDir(),
+		SealedSectorDir:  sealedDir,
 		SectorStoreType:  sectorStoreType,
-		StagedSectorDir:  node.Repo.StagingDir(),
+		StagedSectorDir:  stagingDir,
+		Storage:          node.SectorStorage,
+		StorageSubdir:    storageSubdir,
 	}
 
 	sb, err := sectorbuilder.NewRustSectorBuilder(cfg)
@@ -941,18 +1110,22 @@ func initSectorBuilderForNode(ctx context.Context, node *Node, sectorStoreType p
 	return sb, nil
 }
 
-func initStorageMinerForNode(ctx context.Context, node *Node) (*storage.Miner, error) {
-	minerAddr, err := node.miningAddress()
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to get node's mining address")
-	}
-
+func initStorageMinerForNode(ctx context.Context, node *Node, m *minerInstance, isDefault bool) (*storage.Miner, error) {
+	minerAddr := m.addr
 	miningOwnerAddr, err := node.miningOwnerAddress(ctx, minerAddr)
 	if err != nil {
 		return nil, errors.Wrap(err, "no mining owner available, skipping storage miner setup")
 	}
 
-	miner, err := storage.NewMiner(ctx, minerAddr, miningOwnerAddr, node, node.Repo.DealsDatastore(), node.PorcelainAPI)
+	// The storage miner sends its sector commitments and PoSts from the
+	// miner's worker, so the node needs its key.
+	if workerAddr, err := node.PorcelainAPI.MinerGetWorkerAddress(ctx, minerAddr); err != nil {
+		log.Warningf("failed to get the worker of miner %s: %s", minerAddr, err)
+	} else if !node.Wallet.HasAddress(workerAddr) {
+		log.Warningf("wallet has no key for worker %s of miner %s, so its sector commitments and PoSts cannot be sent", workerAddr, minerAddr)
+	}
+
+	miner, err := storage.NewMiner(ctx, minerAddr, miningOwnerAddr, &minerNode{Node: node, miner: m}, node.minerDatastore(minerAddr, isDefault), node.PorcelainAPI)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to instantiate storage miner")
 	}
@@ -982,16 +1155,12 @@ func (node *Node) NewAddress() (address.Address, error) {
 
 // CreateMiner creates a new miner actor for the given account and returns its address.
 // It will wait for the the actor to appear on-chain and add set the address to mining.minerAddress in the config.
+// If the node already has a miner, the new one is added to mining.miners instead, and
+// mines from the next time the node starts.
 // TODO: This should live in a MinerAPI or some such. It's here until we have a proper API layer.
 // TODO: add ability to pass in a KeyInfo to store for signing blocks.
 //       See https://github.com/filecoin-project/go-filecoin/issues/1843
 func (node *Node) CreateMiner(ctx context.Context, accountAddr address.Address, gasPrice types.AttoFIL, gasLimit types.GasUnits, pledge uint64, pid libp2ppeer.ID, collateral *types.AttoFIL) (_ *address.Address, err error) {
-
-	// Only create a miner if we don't already have one.
-	if _, err := node.miningAddress(); err != ErrNoMinerAddress {
-		return nil, fmt.Errorf("can only have one miner per node")
-	}
-
 	ctx = log.Start(ctx, "Node.CreateMiner")
 	defer func() {
 		log.FinishWithErr(ctx, err)
@@ -1046,12 +1215,57 @@ func (node *Node) CreateMiner(ctx context.Context, accountAddr address.Address,
 	return &minerAddr, err
 }
 
-// saveMinerConfig updates the Node Mining config with the MinerAddress and the BlockSignerAddress.
+// AttachStorage adds a path to the node's sector storage and saves it to the
+// config.
+func (node *Node) AttachStorage(p sectorbuilder.StoragePath) error {
+	if err := node.SectorStorage.Attach(p); err != nil {
+		return err
+	}
+	return node.saveStorageConfig()
+}
+
+// DetachStorage removes an empty path from the node's sector storage and
+// saves the change to the config.
+func (node *Node) DetachStorage(path string) error {
+	if err := node.SectorStorage.Detach(path); err != nil {
+		return err
+	}
+	return node.saveStorageConfig()
+}
+
+// saveStorageConfig writes the node's storage paths to the Node Mining
+// config, including the repo directories used when none were configured.
+func (node *Node) saveStorageConfig() error {
+	var configured []*config.StoragePathConfig
+	for _, p := range node.SectorStorage.Paths() {
+		configured = append(configured, &config.StoragePathConfig{
+			Path:     p.Path,
+			Role:     string(p.Role),
+			Weight:   p.Weight,
+			MaxBytes: p.MaxBytes,
+		})
+	}
+
+	r := node.Repo
+	newConfig := r.Config()
+	newConfig.Mining.StoragePaths = configured
+	return r.ReplaceConfig(newConfig)
+}
+
+// saveMinerConfig updates the Node Mining config with the MinerAddress and the BlockSignerAddress,
+// or adds them to its Miners if the node already has a MinerAddress.
 func (node *Node) saveMinerConfig(minerAddr address.Address, signerAddr address.Address) error {
 	r := node.Repo
 	newConfig := r.Config()
-	newConfig.Mining.MinerAddress = minerAddr
-	newConfig.Mining.BlockSignerAddress = signerAddr
+	if newConfig.Mining.MinerAddress == (address.Address{}) {
+		newConfig.Mining.MinerAddress = minerAddr
+		newConfig.Mining.BlockSignerAddress = signerAddr
+	} else {
+		newConfig.Mining.Miners = append(newConfig.Mining.Miners, &config.MinerConfig{
+			Address:            minerAddr,
+			BlockSignerAddress: signerAddr,
+		})
+	}
 	return r.ReplaceConfig(newConfig)
 }
 
@@ -1122,11 +1336,89 @@ func (node *Node) Host() host.Host {
 	return node.host
 }
 
-// SectorBuilder returns the nodes sectorBuilder.
+// SectorBuilder returns the sector builder of the node's default miner.
 func (node *Node) SectorBuilder() sectorbuilder.SectorBuilder {
 	return node.sectorBuilder
 }
 
+// InsecureProofs returns whether the node seals and verifies sectors with
+// insecure proofs rather than rust-fil-proofs.
+func (node *Node) InsecureProofs() bool {
+	return node.insecureProofs
+}
+
+// FreeStagingBytes returns the most bytes a staged sector can take up in
+// any of the node's staging paths.
+func (node *Node) FreeStagingBytes() (uint64, error) {
+	return node.SectorStorage.FreeBytes(sectorbuilder.StorageStaging)
+}
+
+// ChainRandomness returns the chain randomness a block on top of ts samples,
+// the same the consensus processor gives its messages.
+func (node *Node) ChainRandomness(ctx context.Context, ts types.TipSet) (miner.Randomness, error) {
+	height, err := ts.Height()
+	if err != nil {
+		return nil, err
+	}
+
+	ancestors, err := chain.GetRecentAncestors(ctx, ts, node.ChainReader, types.NewBlockHeight(height+1), consensus.AncestorRoundsNeeded, consensus.LookBackParameter)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get ancestors")
+	}
+
+	return vm.NewVMContext(vm.NewContextParams{
+		Ancestors: ancestors,
+		LookBack:  consensus.LookBackParameter,
+	}), nil
+}
+
+// sectorStoragePaths returns the storage paths configured in r, or its
+// staging and sealed directories if none are.
+func sectorStoragePaths(r repo.Repo) ([]sectorbuilder.StoragePath, error) {
+	configured := r.Config().Mining.StoragePaths
+	if len(configured) == 0 {
+		return []sectorbuilder.StoragePath{
+			{Path: r.StagingDir(), Role: sectorbuilder.StorageStaging, Weight: 1},
+			{Path: r.SealedDir(), Role: sectorbuilder.StorageSealed, Weight: 1},
+		}, nil
+	}
+
+	var paths []sectorbuilder.StoragePath
+	for _, p := range configured {
+		role, err := sectorbuilder.ParseStorageRole(p.Role)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid storage path %s", p.Path)
+		}
+		paths = append(paths, sectorbuilder.StoragePath{
+			Path:     p.Path,
+			Role:     role,
+			Weight:   p.Weight,
+			MaxBytes: p.MaxBytes,
+		})
+	}
+	return paths, nil
+}
+
+// AnnouncePiece advertises on the DHT that the node can serve the piece with
+// the given cid.
+func (node *Node) AnnouncePiece(ctx context.Context, pieceRef cid.Cid) error {
+	return node.Router.Provide(ctx, pieceRef, true)
+}
+
+// SealedPieceSize returns the size of the piece with the given cid, and
+// whether one of the node's storage miners holds it in a sealed sector.
+func (node *Node) SealedPieceSize(pieceRef cid.Cid) (uint64, bool) {
+	for _, m := range node.miners {
+		if m.storageMiner == nil {
+			continue
+		}
+		if size, ok := m.storageMiner.SealedPieceSize(pieceRef); ok {
+			return size, true
+		}
+	}
+	return 0, false
+}
+
 // BlockService returns the nodes blockservice.
 func (node *Node) BlockService() bserv.BlockService {
 	return node.blockservice
@@ -166,7 +166,7 @@ func TestNodeStartMining(t *testing.T) {
 		MsgQueryer:   msg.NewQueryer(minerNode.Repo, minerNode.Wallet, minerNode.ChainReader, minerNode.CborStore(), minerNode.Blockstore),
 		MsgSender:    msg.NewSender(minerNode.Repo, minerNode.Wallet, minerNode.ChainReader, minerNode.MsgPool, minerNode.PorcelainAPI.PubSubPublish),
 		MsgWaiter:    msg.NewWaiter(minerNode.ChainReader, minerNode.Blockstore, minerNode.CborStore()),
-		Network:      ntwk.NewNetwork(minerNode.Host()),
+		Network:      ntwk.NewNetwork(minerNode.Host(), minerNode.Ping),
 		SigGetter:    mthdsig.NewGetter(minerNode.ChainReader),
 		Wallet:       wallet.New(walletBackend),
 	})
@@ -357,6 +357,34 @@ func TestOptionWithError(t *testing.T) {
 
 }
 
+func TestSealWorkersNeedInsecureProofs(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	assert := assert.New(t)
+	require := require.New(t)
+
+	r := repo.NewInMemoryRepo()
+	require.NoError(Init(ctx, r, consensus.InitGenesis))
+	r.Config().Mining.SealWorkers.ListenAddress = "/unix/tmp/filecoin-seal.sock"
+
+	opts, err := OptionsFromRepo(r)
+	require.NoError(err)
+
+	_, err = New(ctx, append(opts, func(c *Config) error {
+		c.OfflineMode = true
+		return nil
+	})...)
+	require.Error(err)
+	assert.Contains(err.Error(), "seal workers need insecure proofs")
+
+	nd, err := New(ctx, append(opts, InsecureProofs(0), func(c *Config) error {
+		c.OfflineMode = true
+		return nil
+	})...)
+	require.NoError(err)
+	nd.Stop(ctx)
+}
+
 func TestMakePrivateKey(t *testing.T) {
 	t.Parallel()
 	assert := assert.New(t)
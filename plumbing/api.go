@@ -2,6 +2,7 @@ package plumbing
 
 import (
 	"context"
+	"time"
 
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	"gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
@@ -13,6 +14,7 @@ import (
 	"github.com/filecoin-project/go-filecoin/chain"
 	"github.com/filecoin-project/go-filecoin/core"
 	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/lookup"
 	"github.com/filecoin-project/go-filecoin/plumbing/cfg"
 	"github.com/filecoin-project/go-filecoin/plumbing/msg"
 	"github.com/filecoin-project/go-filecoin/plumbing/mthdsig"
@@ -40,7 +42,9 @@ type API struct {
 	subscriber   *ps.Subscriber
 	publisher    *ps.Publisher
 	network      *ntwk.Network
+	peerLookup   lookup.PeerLookupService
 	sigGetter    *mthdsig.Getter
+	syncer       chain.Syncer
 	wallet       *wallet.Wallet
 }
 
@@ -56,7 +60,9 @@ type APIDeps struct {
 	Subscriber   *ps.Subscriber
 	Publisher    *ps.Publisher
 	Network      *ntwk.Network
+	PeerLookup   lookup.PeerLookupService
 	SigGetter    *mthdsig.Getter
+	Syncer       chain.Syncer
 	Wallet       *wallet.Wallet
 }
 
@@ -75,7 +81,9 @@ func New(deps *APIDeps) *API {
 		subscriber:   deps.Subscriber,
 		publisher:    deps.Publisher,
 		network:      deps.Network,
+		peerLookup:   deps.PeerLookup,
 		sigGetter:    deps.SigGetter,
+		syncer:       deps.Syncer,
 		wallet:       deps.Wallet,
 	}
 }
@@ -113,6 +121,52 @@ func (api *API) ChainLs(ctx context.Context) <-chan interface{} {
 	return api.chain.BlockHistory(ctx, api.chain.Head())
 }
 
+// ChainNotify returns a channel on which each new head of the chain is sent
+// until the context is canceled. The channel is closed early if the receiver
+// falls too far behind.
+func (api *API) ChainNotify(ctx context.Context) <-chan types.TipSet {
+	out := make(chan types.TipSet)
+	events := api.subscribe(ctx, api.chain.HeadEvents(), chain.NewHeadTopic)
+
+	go func() {
+		defer close(out)
+		for e := range events {
+			ts, ok := e.(types.TipSet)
+			if !ok {
+				continue
+			}
+			select {
+			case out <- ts:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// ChainSyncStatus returns the progress of the chain syncer
+func (api *API) ChainSyncStatus() chain.SyncStatus {
+	return api.syncer.Status()
+}
+
+// ActorLs returns the addresses and actors in the latest state on the chain
+func (api *API) ActorLs(ctx context.Context) ([]address.Address, []*actor.Actor, error) {
+	state, err := api.chain.LatestState(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var addrs []address.Address
+	var actors []*actor.Actor
+	err = state.ForEachActor(ctx, func(addr address.Address, act *actor.Actor) error {
+		addrs = append(addrs, addr)
+		actors = append(actors, act)
+		return nil
+	})
+	return addrs, actors, err
+}
+
 // ActorGet returns an actor from the latest state on the chain
 func (api *API) ActorGet(ctx context.Context, addr address.Address) (*actor.Actor, error) {
 	state, err := api.chain.LatestState(ctx)
@@ -132,6 +186,26 @@ func (api *API) MessagePoolPending() []*types.SignedMessage {
 	return api.msgPool.Pending()
 }
 
+// MessagePoolNotify returns a channel on which each message added to or
+// removed from the pool is sent until the context is canceled. The channel is
+// closed early if the receiver falls too far behind.
+func (api *API) MessagePoolNotify(ctx context.Context) <-chan core.MessagePoolUpdate {
+	out := make(chan core.MessagePoolUpdate)
+	events := api.subscribe(ctx, api.msgPool.Events(), core.MessagePoolTopic)
+
+	go func() {
+		defer close(out)
+		for e := range events {
+			select {
+			case out <- e.(core.MessagePoolUpdate):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
 // MessagePoolRemove removes a message from the message pool
 func (api *API) MessagePoolRemove(cid cid.Cid) {
 	api.msgPool.Remove(cid)
@@ -183,6 +257,16 @@ func (api *API) NetworkGetPeerID() peer.ID {
 	return api.network.GetPeerID()
 }
 
+// NetworkPing pings the given peer once, returning the round trip time
+func (api *API) NetworkPing(ctx context.Context, pid peer.ID) (time.Duration, error) {
+	return api.network.Ping(ctx, pid)
+}
+
+// MinerLookupPeerID looks up the libp2p identity of the given miner
+func (api *API) MinerLookupPeerID(ctx context.Context, minerAddr address.Address) (peer.ID, error) {
+	return api.peerLookup.GetPeerIDByMinerAddress(ctx, minerAddr)
+}
+
 // SignBytes uses private key information associated with the given address to sign the given bytes.
 func (api *API) SignBytes(data []byte, addr address.Address) (types.Signature, error) {
 	return api.wallet.SignBytes(data, addr)
@@ -0,0 +1,59 @@
+package plumbing
+
+import (
+	"context"
+
+	"gx/ipfs/QmdbxjQWogRCHRaxhhGnYdT1oQJzL9GdqSKzCdqWr85AP2/pubsub"
+)
+
+// maxPendingEvents is the number of events a subscriber may fall behind by
+// before its subscription is ended.
+const maxPendingEvents = 1024
+
+// subscribe returns a channel on which each event published on topic is sent
+// until the context is canceled. Events are queued while the receiver is
+// slow, so it never holds up the publisher; if it falls maxPendingEvents
+// behind, the channel is closed instead.
+func (api *API) subscribe(ctx context.Context, events *pubsub.PubSub, topic string) <-chan interface{} {
+	out := make(chan interface{})
+	sub := events.Sub(topic)
+
+	go func() {
+		defer close(out)
+		defer func() {
+			// Drain the subscription until it is closed so the publisher
+			// never blocks on us while we unsubscribe.
+			go func() {
+				for range sub {
+				}
+			}()
+			events.Unsub(sub, topic)
+		}()
+
+		var pending []interface{}
+		for {
+			var send chan<- interface{}
+			var next interface{}
+			if len(pending) > 0 {
+				send, next = out, pending[0]
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case e, ok := <-sub:
+				if !ok {
+					return
+				}
+				if len(pending) >= maxPendingEvents {
+					api.logger.Warningf("ending subscription to %s, its receiver is %d events behind", topic, len(pending))
+					return
+				}
+				pending = append(pending, e)
+			case send <- next:
+				pending = pending[1:]
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,61 @@
+package plumbing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	logging "gx/ipfs/QmbkT7eMTyXfpeyB3ZMxxcxg7XH8t6uXp49jqzz4HB7BGF/go-log"
+	"gx/ipfs/QmdbxjQWogRCHRaxhhGnYdT1oQJzL9GdqSKzCdqWr85AP2/pubsub"
+)
+
+func TestSubscribe(t *testing.T) {
+	t.Parallel()
+
+	t.Run("delivers events in order", func(t *testing.T) {
+		assert := assert.New(t)
+		api := &API{logger: logging.Logger("test")}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		events := pubsub.New(1)
+		ch := api.subscribe(ctx, events, "topic")
+		for i := 0; i < 3; i++ {
+			events.Pub(i, "topic")
+		}
+		for i := 0; i < 3; i++ {
+			assert.Equal(i, <-ch)
+		}
+
+		cancel()
+		for range ch {
+		}
+	})
+
+	t.Run("a receiver that falls behind does not block the publisher", func(t *testing.T) {
+		api := &API{logger: logging.Logger("test")}
+		events := pubsub.New(1)
+		ch := api.subscribe(context.Background(), events, "topic")
+
+		published := make(chan struct{})
+		go func() {
+			defer close(published)
+			for i := 0; i <= maxPendingEvents+1; i++ {
+				events.Pub(i, "topic")
+			}
+		}()
+		select {
+		case <-published:
+		case <-time.After(5 * time.Second):
+			t.Fatal("publisher blocked on a slow subscriber")
+		}
+
+		// The subscription ends once the receiver is too far behind.
+		n := 0
+		for range ch {
+			n++
+		}
+		assert.True(t, n <= maxPendingEvents)
+	})
+}
@@ -1,21 +1,48 @@
 package ntwk
 
 import (
+	"context"
+	"errors"
+	"time"
+
 	"gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
+	"gx/ipfs/QmcNGX5RaxPPCYwa6yGXM1EcUbrreTTinixLcYGmMwf1sx/go-libp2p/p2p/protocol/ping"
 	"gx/ipfs/Qmd52WKRSwrBK5gUaJKawryZQ5by6UbNB8KVW2Zy6JtbyW/go-libp2p-host"
 )
 
 // Network is a unified interface for dealing with libp2p
 type Network struct {
-	host host.Host
+	host   host.Host
+	pinger *ping.PingService
 }
 
 // NewNetwork returns a new Network
-func NewNetwork(host host.Host) *Network {
-	return &Network{host: host}
+func NewNetwork(host host.Host, pinger *ping.PingService) *Network {
+	return &Network{host: host, pinger: pinger}
 }
 
 // GetPeerID gets the current peer id from libp2p-host
 func (network *Network) GetPeerID() peer.ID {
 	return network.host.ID()
 }
+
+// Ping pings the peer once, returning the round trip time.
+func (network *Network) Ping(ctx context.Context, pid peer.ID) (time.Duration, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	times, err := network.pinger.Ping(ctx, pid)
+	if err != nil {
+		return 0, err
+	}
+
+	select {
+	case t, ok := <-times:
+		if !ok {
+			return 0, errors.New("ping failed")
+		}
+		return t, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
@@ -46,6 +46,11 @@ func (a *API) ChainBlockHeight(ctx context.Context) (*types.BlockHeight, error)
 	return ChainBlockHeight(ctx, a)
 }
 
+// ClientFindMiners returns the miners with unexpired asks, best first
+func (a *API) ClientFindMiners(ctx context.Context) ([]*MinerCandidate, error) {
+	return ClientFindMiners(ctx, a)
+}
+
 // CreatePayments establishes a payment channel and create multiple payments against it
 func (a *API) CreatePayments(ctx context.Context, config CreatePaymentsParams) (*CreatePaymentsReturn, error) {
 	return CreatePayments(ctx, a, config)
@@ -103,11 +108,28 @@ func (a *API) MinerGetOwnerAddress(ctx context.Context, minerAddr address.Addres
 	return MinerGetOwnerAddress(ctx, a, minerAddr)
 }
 
+// MinerGetWorkerAddress queries for the worker address of the given miner
+func (a *API) MinerGetWorkerAddress(ctx context.Context, minerAddr address.Address) (address.Address, error) {
+	return MinerGetWorkerAddress(ctx, a, minerAddr)
+}
+
 // MinerGetPeerID queries for the peer id of the given miner
 func (a *API) MinerGetPeerID(ctx context.Context, minerAddr address.Address) (peer.ID, error) {
 	return MinerGetPeerID(ctx, a, minerAddr)
 }
 
+// MinerGetSectorCommitments queries for the commitments of the sectors the
+// given miner has sealed
+func (a *API) MinerGetSectorCommitments(ctx context.Context, minerAddr address.Address) (map[string]types.Commitments, error) {
+	return MinerGetSectorCommitments(ctx, a, minerAddr)
+}
+
+// MinerGetProvingPeriodStart queries for the start of the given miner's
+// current proving period
+func (a *API) MinerGetProvingPeriodStart(ctx context.Context, minerAddr address.Address) (*types.BlockHeight, error) {
+	return MinerGetProvingPeriodStart(ctx, a, minerAddr)
+}
+
 // MinerSetPrice configures the price of storage. See implementation for details.
 func (a *API) MinerSetPrice(ctx context.Context, from address.Address, miner address.Address, gasPrice types.AttoFIL, gasLimit types.GasUnits, price *types.AttoFIL, expiry *big.Int) (MinerSetPriceResponse, error) {
 	return MinerSetPrice(ctx, a, from, miner, gasPrice, gasLimit, price, expiry)
@@ -0,0 +1,197 @@
+package porcelain
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// findMinersPingTimeout is how long ClientFindMiners waits for a miner to
+// answer a ping before deeming it unreachable.
+const findMinersPingTimeout = 5 * time.Second
+
+// MinerCandidate is a miner a client could make a storage deal with, as
+// found by ClientFindMiners.
+type MinerCandidate struct {
+	Miner address.Address
+	// AskID, Price and Expiry describe the miner's cheapest unexpired ask.
+	AskID  uint64
+	Price  *types.AttoFIL
+	Expiry *types.BlockHeight
+	// Power is the number of sectors the miner proves.
+	Power uint64
+	// PledgeRemaining is the number of pledged sectors the miner has not
+	// committed yet.
+	PledgeRemaining uint64
+	PeerID          peer.ID
+	// Reachable is whether the miner answered a ping, and Latency how
+	// long it took.
+	Reachable bool
+	Latency   time.Duration
+}
+
+// cfmAPI is the subset of the plumbing.API that ClientFindMiners uses.
+type cfmAPI interface {
+	ActorLs(ctx context.Context) ([]address.Address, []*actor.Actor, error)
+	ChainLs(ctx context.Context) <-chan interface{}
+	MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error)
+	MinerLookupPeerID(ctx context.Context, minerAddr address.Address) (peer.ID, error)
+	NetworkPing(ctx context.Context, pid peer.ID) (time.Duration, error)
+}
+
+// ClientFindMiners returns the miners with unexpired asks, best first.
+// Miners are ranked by reachability, then by whether they have pledged
+// capacity left, then by price, and finally by power. Reachability is
+// checked by pinging the peer the miner's peer lookup resolves to. Miners that
+// cannot be queried are left out.
+func ClientFindMiners(ctx context.Context, plumbing cfmAPI) ([]*MinerCandidate, error) {
+	height, err := ChainBlockHeight(ctx, plumbing)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs, actors, err := plumbing.ActorLs(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not list actors")
+	}
+
+	var candidates []*MinerCandidate
+	for i, act := range actors {
+		if !types.MinerActorCodeCid.Equals(act.Code) && !types.BootstrapMinerActorCodeCid.Equals(act.Code) {
+			continue
+		}
+
+		candidate, err := newMinerCandidate(ctx, plumbing, addrs[i], height)
+		if err != nil {
+			log.Warningf("skipping miner %s, which could not be queried: %s", addrs[i], err)
+			continue
+		}
+		if candidate != nil {
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, candidate := range candidates {
+		wg.Add(1)
+		go func(c *MinerCandidate) {
+			defer wg.Done()
+			pingMinerCandidate(ctx, plumbing, c)
+		}(candidate)
+	}
+	wg.Wait()
+
+	rankMinerCandidates(candidates)
+	return candidates, nil
+}
+
+// newMinerCandidate returns the candidate for the miner at minerAddr, or nil
+// if it has no ask unexpired at height.
+func newMinerCandidate(ctx context.Context, plumbing cfmAPI, minerAddr address.Address, height *types.BlockHeight) (*MinerCandidate, error) {
+	ret, _, err := plumbing.MessageQuery(ctx, address.Address{}, minerAddr, "getAsks")
+	if err != nil {
+		return nil, err
+	}
+	var askIDs []uint64
+	if err := cbor.DecodeInto(ret[0], &askIDs); err != nil {
+		return nil, err
+	}
+
+	var candidate *MinerCandidate
+	for _, id := range askIDs {
+		ask, err := MinerGetAsk(ctx, plumbing, minerAddr, id)
+		if err != nil {
+			return nil, err
+		}
+		if ask.Expiry.LessThan(height) {
+			continue
+		}
+		if candidate == nil || ask.Price.LessThan(candidate.Price) {
+			candidate = &MinerCandidate{
+				Miner:  minerAddr,
+				AskID:  ask.ID.Uint64(),
+				Price:  ask.Price,
+				Expiry: ask.Expiry,
+			}
+		}
+	}
+	if candidate == nil {
+		return nil, nil
+	}
+
+	power, err := queryMinerInt(ctx, plumbing, minerAddr, "getPower")
+	if err != nil {
+		return nil, err
+	}
+	candidate.Power = power.Uint64()
+
+	pledge, err := queryMinerInt(ctx, plumbing, minerAddr, "getPledge")
+	if err != nil {
+		return nil, err
+	}
+	commitments, err := MinerGetSectorCommitments(ctx, plumbing, minerAddr)
+	if err != nil {
+		return nil, err
+	}
+	if committed := uint64(len(commitments)); pledge.Uint64() > committed {
+		candidate.PledgeRemaining = pledge.Uint64() - committed
+	}
+
+	return candidate, nil
+}
+
+func queryMinerInt(ctx context.Context, plumbing cfmAPI, minerAddr address.Address, method string) (*big.Int, error) {
+	ret, _, err := plumbing.MessageQuery(ctx, address.Address{}, minerAddr, method)
+	if err != nil {
+		return nil, err
+	}
+	return big.NewInt(0).SetBytes(ret[0]), nil
+}
+
+// pingMinerCandidate looks up the candidate's peer and pings it, recording
+// whether it is reachable.
+func pingMinerCandidate(ctx context.Context, plumbing cfmAPI, c *MinerCandidate) {
+	pid, err := plumbing.MinerLookupPeerID(ctx, c.Miner)
+	if err != nil {
+		return
+	}
+	c.PeerID = pid
+
+	ctx, cancel := context.WithTimeout(ctx, findMinersPingTimeout)
+	defer cancel()
+
+	latency, err := plumbing.NetworkPing(ctx, pid)
+	if err != nil {
+		return
+	}
+	c.Reachable = true
+	c.Latency = latency
+}
+
+// rankMinerCandidates sorts candidates from the best.
+func rankMinerCandidates(candidates []*MinerCandidate) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.Reachable != b.Reachable {
+			return a.Reachable
+		}
+		if hasRoomA, hasRoomB := a.PledgeRemaining > 0, b.PledgeRemaining > 0; hasRoomA != hasRoomB {
+			return hasRoomA
+		}
+		if !a.Price.Equal(b.Price) {
+			return a.Price.LessThan(b.Price)
+		}
+		return a.Power > b.Power
+	})
+}
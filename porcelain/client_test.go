@@ -0,0 +1,163 @@
+package porcelain
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	"gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
+
+	"github.com/filecoin-project/go-filecoin/abi"
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/miner"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// findMinersTestMiner is the on-chain and network state of a miner.
+type findMinersTestMiner struct {
+	asks      []miner.Ask
+	power     int64
+	pledge    int64
+	committed int
+	reachable bool
+	// broken miners fail every query.
+	broken bool
+}
+
+type findMinersPlumbing struct {
+	height uint64
+	miners map[address.Address]*findMinersTestMiner
+}
+
+func (fmp *findMinersPlumbing) ActorLs(ctx context.Context) ([]address.Address, []*actor.Actor, error) {
+	addrs := []address.Address{address.TestAddress}
+	actors := []*actor.Actor{actor.NewActor(types.AccountActorCodeCid, nil)}
+	for addr := range fmp.miners {
+		addrs = append(addrs, addr)
+		actors = append(actors, actor.NewActor(types.MinerActorCodeCid, nil))
+	}
+	return addrs, actors, nil
+}
+
+func (fmp *findMinersPlumbing) ChainLs(ctx context.Context) <-chan interface{} {
+	ts, err := types.NewTipSet(&types.Block{Height: types.Uint64(fmp.height)})
+	if err != nil {
+		panic("could not create tipset")
+	}
+	out := make(chan interface{}, 1)
+	out <- ts
+	close(out)
+	return out
+}
+
+func (fmp *findMinersPlumbing) MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error) {
+	m, ok := fmp.miners[to]
+	if !ok {
+		return nil, nil, errors.New("no such miner")
+	}
+	if m.broken {
+		return nil, nil, errors.New("miner actor in a bad state")
+	}
+
+	var out []byte
+	var err error
+	switch method {
+	case "getAsks":
+		var ids []uint64
+		for _, ask := range m.asks {
+			ids = append(ids, ask.ID.Uint64())
+		}
+		out, err = cbor.DumpObject(ids)
+	case "getAsk":
+		out, err = cbor.DumpObject(m.asks[params[0].(*big.Int).Int64()])
+	case "getPower":
+		out = big.NewInt(m.power).Bytes()
+	case "getPledge":
+		out = big.NewInt(m.pledge).Bytes()
+	case "getSectorCommitments":
+		commitments := map[string]types.Commitments{}
+		for i := 0; i < m.committed; i++ {
+			commitments[big.NewInt(int64(i)).String()] = types.Commitments{}
+		}
+		out, err = (&abi.Value{Type: abi.CommitmentsMap, Val: commitments}).Serialize()
+	default:
+		return nil, nil, errors.New("unexpected method " + method)
+	}
+	return [][]byte{out}, nil, err
+}
+
+func (fmp *findMinersPlumbing) MinerLookupPeerID(ctx context.Context, minerAddr address.Address) (peer.ID, error) {
+	return peer.ID(minerAddr.String()), nil
+}
+
+func (fmp *findMinersPlumbing) NetworkPing(ctx context.Context, pid peer.ID) (time.Duration, error) {
+	for addr, m := range fmp.miners {
+		if peer.ID(addr.String()) == pid && m.reachable {
+			return time.Millisecond, nil
+		}
+	}
+	return 0, errors.New("no route to peer")
+}
+
+func testAsks(prices ...uint64) []miner.Ask {
+	var asks []miner.Ask
+	for i, price := range prices {
+		asks = append(asks, miner.Ask{
+			ID:     big.NewInt(int64(i)),
+			Price:  types.NewAttoFILFromFIL(price),
+			Expiry: types.NewBlockHeight(100),
+		})
+	}
+	return asks
+}
+
+func TestClientFindMiners(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	newAddr := address.NewForTestGetter()
+	cheap, dear, full, unreachable, expired, powerful, broken := newAddr(), newAddr(), newAddr(), newAddr(), newAddr(), newAddr(), newAddr()
+
+	expiredAsks := testAsks(1)
+	expiredAsks[0].Expiry = types.NewBlockHeight(5)
+
+	plumbing := &findMinersPlumbing{
+		height: 10,
+		miners: map[address.Address]*findMinersTestMiner{
+			cheap:       {asks: testAsks(9, 3), power: 1, pledge: 10, reachable: true},
+			dear:        {asks: testAsks(5), power: 1, pledge: 10, reachable: true},
+			powerful:    {asks: testAsks(5), power: 8, pledge: 10, committed: 8, reachable: true},
+			full:        {asks: testAsks(1), power: 10, pledge: 10, committed: 10, reachable: true},
+			unreachable: {asks: testAsks(1), power: 1, pledge: 10},
+			expired:     {asks: expiredAsks, power: 1, pledge: 10, reachable: true},
+			broken:      {asks: testAsks(1), power: 1, pledge: 10, reachable: true, broken: true},
+		},
+	}
+
+	candidates, err := ClientFindMiners(context.Background(), plumbing)
+	require.NoError(err)
+
+	var ranked []address.Address
+	for _, c := range candidates {
+		ranked = append(ranked, c.Miner)
+	}
+	assert.Equal([]address.Address{cheap, powerful, dear, full, unreachable}, ranked)
+
+	best := candidates[0]
+	assert.Equal(uint64(1), best.AskID)
+	assert.Equal(types.NewAttoFILFromFIL(3), best.Price)
+	assert.Equal(uint64(10), best.PledgeRemaining)
+	assert.True(best.Reachable)
+	assert.Equal(peer.ID(cheap.String()), best.PeerID)
+
+	assert.Equal(uint64(2), candidates[1].PledgeRemaining)
+	assert.Equal(uint64(0), candidates[3].PledgeRemaining)
+	assert.False(candidates[4].Reachable)
+}
@@ -11,6 +11,7 @@ import (
 	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
 	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
 
+	"github.com/filecoin-project/go-filecoin/abi"
 	minerActor "github.com/filecoin-project/go-filecoin/actor/builtin/miner"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/exec"
@@ -21,7 +22,6 @@ import (
 
 // mpcAPI is the subset of the plumbing.API that MinerPreviewCreate uses.
 type mpcAPI interface {
-	ConfigGet(dottedPath string) (interface{}, error)
 	GetAndMaybeSetDefaultSenderAddress() (address.Address, error)
 	MessagePreview(ctx context.Context, from, to address.Address, method string, params ...interface{}) (types.GasUnits, error)
 	NetworkGetPeerID() peer.ID
@@ -48,10 +48,6 @@ func MinerPreviewCreate(
 		pid = plumbing.NetworkGetPeerID()
 	}
 
-	if _, err := plumbing.ConfigGet("mining.minerAddress"); err != nil {
-		return types.NewGasUnits(0), fmt.Errorf("can only have one miner per node")
-	}
-
 	ctx = log.Start(ctx, "Node.CreateMiner")
 	defer func() {
 		log.FinishWithErr(ctx, err)
@@ -199,7 +195,8 @@ func MinerPreviewSetPrice(ctx context.Context, plumbing mpspAPI, from address.Ad
 	return usedGas, nil
 }
 
-// mgoaAPI is the subset of the plumbing.API that MinerGetOwnerAddress uses.
+// mgoaAPI is the subset of the plumbing.API that MinerGetOwnerAddress and
+// MinerGetWorkerAddress use.
 type mgoaAPI interface {
 	MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error)
 }
@@ -214,6 +211,16 @@ func MinerGetOwnerAddress(ctx context.Context, plumbing mgoaAPI, minerAddr addre
 	return address.NewFromBytes(res[0])
 }
 
+// MinerGetWorkerAddress queries for the worker address of the given miner
+func MinerGetWorkerAddress(ctx context.Context, plumbing mgoaAPI, minerAddr address.Address) (address.Address, error) {
+	res, _, err := plumbing.MessageQuery(ctx, address.Address{}, minerAddr, "getWorker")
+	if err != nil {
+		return address.Address{}, err
+	}
+
+	return address.NewFromBytes(res[0])
+}
+
 // mgaAPI is the subset of the plumbing.API that MinerGetAsk uses.
 type mgaAPI interface {
 	MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error)
@@ -252,3 +259,53 @@ func MinerGetPeerID(ctx context.Context, plumbing mgpidAPI, minerAddr address.Ad
 	}
 	return pid, nil
 }
+
+// mgscAPI is the subset of the plumbing.API that MinerGetSectorCommitments uses.
+type mgscAPI interface {
+	MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error)
+}
+
+// MinerGetSectorCommitments queries for the commitments of the sectors the
+// given miner has sealed, keyed by stringified sector id.
+func MinerGetSectorCommitments(ctx context.Context, plumbing mgscAPI, minerAddr address.Address) (map[string]types.Commitments, error) {
+	res, _, err := plumbing.MessageQuery(ctx, address.Address{}, minerAddr, "getSectorCommitments")
+	if err != nil {
+		return nil, err
+	}
+
+	val, err := abi.Deserialize(res[0], abi.CommitmentsMap)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not decode sector commitments")
+	}
+
+	commitments, ok := val.Val.(map[string]types.Commitments)
+	if !ok {
+		return nil, fmt.Errorf("expected sector commitments, got %T", val.Val)
+	}
+	return commitments, nil
+}
+
+// mgppsAPI is the subset of the plumbing.API that MinerGetProvingPeriodStart uses.
+type mgppsAPI interface {
+	MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error)
+}
+
+// MinerGetProvingPeriodStart queries for the height at which the given
+// miner's current proving period started.
+func MinerGetProvingPeriodStart(ctx context.Context, plumbing mgppsAPI, minerAddr address.Address) (*types.BlockHeight, error) {
+	res, _, err := plumbing.MessageQuery(ctx, address.Address{}, minerAddr, "getProvingPeriodStart")
+	if err != nil {
+		return nil, err
+	}
+
+	val, err := abi.Deserialize(res[0], abi.BlockHeight)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not decode proving period start")
+	}
+
+	start, ok := val.Val.(*types.BlockHeight)
+	if !ok {
+		return nil, fmt.Errorf("expected a block height, got %T", val.Val)
+	}
+	return start, nil
+}
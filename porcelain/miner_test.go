@@ -10,6 +10,7 @@ import (
 	"gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
 	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
 
+	"github.com/filecoin-project/go-filecoin/abi"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/miner"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/exec"
@@ -365,6 +366,25 @@ func TestMinerGetOwnerAddress(t *testing.T) {
 	assert.Equal(address.TestAddress, addr)
 }
 
+type minerGetWorkerPlumbing struct {
+	method string
+}
+
+func (mgwp *minerGetWorkerPlumbing) MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error) {
+	mgwp.method = method
+	return [][]byte{address.TestAddress.Bytes()}, nil, nil
+}
+
+func TestMinerGetWorkerAddress(t *testing.T) {
+	assert := assert.New(t)
+
+	plumbing := &minerGetWorkerPlumbing{}
+	addr, err := MinerGetWorkerAddress(context.Background(), plumbing, address.TestAddress2)
+	assert.NoError(err)
+	assert.Equal(address.TestAddress, addr)
+	assert.Equal("getWorker", plumbing.method)
+}
+
 type minerGetPeerIDPlumbing struct{}
 
 func (mgop *minerGetPeerIDPlumbing) MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error) {
@@ -411,6 +431,54 @@ func TestMinerGetAsk(t *testing.T) {
 	assert.Equal(big.NewInt(4), ask.ID)
 }
 
+type minerGetSectorCommitmentsPlumbing struct {
+	commitments map[string]types.Commitments
+}
+
+func (mgscp *minerGetSectorCommitmentsPlumbing) MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error) {
+	out, err := (&abi.Value{Type: abi.CommitmentsMap, Val: mgscp.commitments}).Serialize()
+	if err != nil {
+		panic("Could not encode commitments")
+	}
+	return [][]byte{out}, nil, nil
+}
+
+func TestMinerGetSectorCommitments(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var comms types.Commitments
+	comms.CommD[0] = 1
+	comms.CommR[0] = 2
+	comms.CommRStar[0] = 3
+	plumbing := &minerGetSectorCommitmentsPlumbing{
+		commitments: map[string]types.Commitments{"7": comms},
+	}
+
+	commitments, err := MinerGetSectorCommitments(context.Background(), plumbing, address.TestAddress2)
+	require.NoError(err)
+	assert.Equal(plumbing.commitments, commitments)
+}
+
+type minerGetProvingPeriodStartPlumbing struct{}
+
+func (mgppsp *minerGetProvingPeriodStartPlumbing) MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error) {
+	out, err := (&abi.Value{Type: abi.BlockHeight, Val: types.NewBlockHeight(1234)}).Serialize()
+	if err != nil {
+		panic("Could not encode block height")
+	}
+	return [][]byte{out}, nil, nil
+}
+
+func TestMinerGetProvingPeriodStart(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	start, err := MinerGetProvingPeriodStart(context.Background(), &minerGetProvingPeriodStartPlumbing{}, address.TestAddress2)
+	require.NoError(err)
+	assert.Equal(types.NewBlockHeight(1234), start)
+}
+
 func requirePeerID() peer.ID {
 	id, err := peer.IDB58Decode("QmWbMozPyW6Ecagtxq7SXBXXLY5BNdP1GwHB2WoZCKMvcb")
 	if err != nil {
@@ -0,0 +1,102 @@
+package proofs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+)
+
+// Insecure proofs stand in for the Rust proofs in tests and dev networks.
+// They are hashes of their public inputs, so they are fast and deterministic,
+// but anyone can forge them. They are made by sectorbuilder's
+// MemorySectorBuilder and checked by InsecureVerifier.
+
+// InsecureVerifier checks insecure proofs.
+type InsecureVerifier struct{}
+
+var _ Verifier = &InsecureVerifier{}
+
+// VerifySeal returns whether the proof and replica commitments of req are
+// the insecure ones of its data commitment, prover and sector.
+func (iv *InsecureVerifier) VerifySeal(req VerifySealRequest) (VerifySealResponse, error) {
+	commR := InsecureCommR(req.ProverID, req.SectorID, req.CommD)
+	commRStar := InsecureCommRStar(commR)
+	proof := InsecureSealProof(req.ProverID, req.SectorID, req.CommD, commR, commRStar)
+
+	return VerifySealResponse{
+		IsValid: req.CommR == commR && req.CommRStar == commRStar && req.Proof == proof,
+	}, nil
+}
+
+// VerifyPoST returns whether the proof of req is the insecure
+// proof-of-spacetime of its replicas for its challenge seed.
+func (iv *InsecureVerifier) VerifyPoST(req VerifyPoSTRequest) (VerifyPoSTResponse, error) {
+	return VerifyPoSTResponse{
+		IsValid: req.Proof == InsecurePoStProof(req.ChallengeSeed, req.CommRs),
+	}, nil
+}
+
+// VerifyPieceInclusionProof checks a piece inclusion proof against the data
+// commitment of its sector, which insecure proofs compute like real ones.
+func (iv *InsecureVerifier) VerifyPieceInclusionProof(req VerifyPieceInclusionProofRequest) (VerifyPieceInclusionProofResponse, error) {
+	return VerifyPieceInclusionProofResponse{
+		IsValid: VerifyPieceInclusionProof(req.CommD, req.CommP, req.PieceSize, req.Proof),
+	}, nil
+}
+
+// InsecureCommR returns the insecure replica commitment of a sector.
+func InsecureCommR(proverID, sectorID [31]byte, commD CommD) CommR {
+	var commR CommR
+	insecureHash(commR[:], "commR", proverID[:], sectorID[:], commD[:])
+	return commR
+}
+
+// InsecureCommRStar returns the insecure CommRStar of a sector.
+func InsecureCommRStar(commR CommR) CommRStar {
+	var commRStar CommRStar
+	insecureHash(commRStar[:], "commRStar", commR[:])
+	return commRStar
+}
+
+// InsecureSealProof returns the insecure proof of replication of a sector.
+func InsecureSealProof(proverID, sectorID [31]byte, commD CommD, commR CommR, commRStar CommRStar) SealProof {
+	var proof SealProof
+	insecureHash(proof[:], "seal", proverID[:], sectorID[:], commD[:], commR[:], commRStar[:])
+	return proof
+}
+
+// InsecurePoStProof returns the insecure proof-of-spacetime of the replicas
+// with the given commitments, in any order, for a challenge seed.
+func InsecurePoStProof(challengeSeed PoStChallengeSeed, commRs []CommR) PoStProof {
+	sorted := make([]CommR, len(commRs))
+	copy(sorted, commRs)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i][:], sorted[j][:]) < 0
+	})
+
+	parts := [][]byte{challengeSeed[:]}
+	for i := range sorted {
+		parts = append(parts, sorted[i][:])
+	}
+
+	var proof PoStProof
+	insecureHash(proof[:], "post", parts...)
+	return proof
+}
+
+// insecureHash fills out with sha256 hashes of a counter, domain and parts,
+// so that the proofs of different domains never collide.
+func insecureHash(out []byte, domain string, parts ...[]byte) {
+	for i := 0; len(out) > 0; i++ {
+		h := sha256.New()
+		var counter [8]byte
+		binary.BigEndian.PutUint64(counter[:], uint64(i))
+		h.Write(counter[:])     // nolint: errcheck
+		h.Write([]byte(domain)) // nolint: errcheck
+		for _, p := range parts {
+			h.Write(p) // nolint: errcheck
+		}
+		out = out[copy(out, h.Sum(nil)):]
+	}
+}
@@ -19,6 +19,21 @@ type VerifyPoSTRequest struct {
 	Proof         PoStProof
 }
 
+// VerifyPieceInclusionProofRequest represents a request to verify that a
+// piece lies inside a sealed sector.
+type VerifyPieceInclusionProofRequest struct {
+	CommD     CommD  // the sector's data commitment, as posted on chain
+	CommP     CommP  // the piece's commitment
+	PieceSize uint64 // number of bytes in the piece
+	Proof     []byte // generated by the miner storing the piece
+}
+
+// VerifyPieceInclusionProofResponse communicates the validity of a provided
+// piece inclusion proof.
+type VerifyPieceInclusionProofResponse struct {
+	IsValid bool
+}
+
 // VerifyPoSTResponse communicates the validity of a provided proof-of-spacetime.
 type VerifyPoSTResponse struct {
 	IsValid bool
@@ -33,6 +48,7 @@ type VerifySealResponse struct {
 type Verifier interface {
 	VerifyPoST(VerifyPoSTRequest) (VerifyPoSTResponse, error)
 	VerifySeal(VerifySealRequest) (VerifySealResponse, error)
+	VerifyPieceInclusionProof(VerifyPieceInclusionProofRequest) (VerifyPieceInclusionProofResponse, error)
 }
 
 // SectorStoreType configures the behavior of the SectorStore used by the SectorBuilder.
@@ -45,3 +61,23 @@ const (
 	// Test configures the SectorBuilder to be used with large sectors, in tests.
 	Test
 )
+
+// Mode is which proofs the miners of a network submit. It is chosen in the
+// network's genesis block, so that every node verifies proofs alike.
+type Mode uint64
+
+const (
+	// RustMode uses the proofs of rust-fil-proofs.
+	RustMode = Mode(iota)
+	// InsecureMode uses the insecure proofs checked by InsecureVerifier,
+	// which anyone can forge. It is meant for tests and dev networks.
+	InsecureMode
+)
+
+// ModeVerifier returns the Verifier of the proofs of the given mode.
+func ModeVerifier(mode Mode) Verifier {
+	if mode == InsecureMode {
+		return &InsecureVerifier{}
+	}
+	return &RustVerifier{}
+}
@@ -0,0 +1,241 @@
+package proofs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+)
+
+// Piece commitments are the roots of binary merkle trees whose leaves are a
+// piece's bytes in 32 byte chunks, the last one zero-padded, and whose leaf
+// count is padded with zero leaves to a power of two. Each inner node is the
+// sha256 of its two children.
+//
+// Pieces are laid out in a sector one after the other, each starting at a
+// leaf index that is a multiple of its padded leaf count. The tree of each
+// piece is then a subtree of the tree of the sector, and a piece inclusion
+// proof is the path from the piece's subtree to the sector's root.
+//
+// These trees do not match the CommD rust-fil-proofs computes when sealing,
+// so only the in-memory sector builder and the insecure verifier use them.
+// The Rust sector builder and verifier fail with
+// ErrPieceInclusionProofsUnsupported instead.
+//
+// TODO: use the hasher of rust-fil-proofs once it exposes piece commitments.
+
+// pieceLeafBytes is the number of piece bytes in a leaf.
+const pieceLeafBytes = uint64(CommitmentBytesLen)
+
+// pieceNodeBytes is the number of bytes of each node in a proof.
+const pieceNodeBytes = int(CommitmentBytesLen)
+
+// PieceCommitment is the commitment and size of a piece in a sector.
+type PieceCommitment struct {
+	CommP CommP
+	Size  uint64
+}
+
+// GeneratePieceCommitment computes the commitment of the size bytes of piece
+// data read from r. It reads the data a leaf at a time and keeps only the
+// roots of the subtrees not yet complete, at most one per height.
+func GeneratePieceCommitment(r io.Reader, size uint64) (CommP, error) {
+	height := log2(pieceLeafCount(size))
+
+	var stack []pieceSubtree
+	for read := uint64(0); read < size; read += pieceLeafBytes {
+		n := size - read
+		if n > pieceLeafBytes {
+			n = pieceLeafBytes
+		}
+		var leaf [CommitmentBytesLen]byte
+		if _, err := io.ReadFull(r, leaf[:n]); err != nil {
+			return CommP{}, errors.Wrap(err, "failed to read piece data")
+		}
+
+		stack = append(stack, pieceSubtree{root: leaf})
+		for len(stack) > 1 && stack[len(stack)-2].height == stack[len(stack)-1].height {
+			stack = mergePieceSubtrees(stack)
+		}
+	}
+
+	// Pad with zero subtrees until a single one spans the whole piece.
+	if len(stack) == 0 {
+		stack = append(stack, pieceSubtree{})
+	}
+	for len(stack) > 1 || stack[0].height < height {
+		top := stack[len(stack)-1]
+		if len(stack) == 1 || stack[len(stack)-2].height != top.height {
+			stack = append(stack, pieceSubtree{root: zeroSubtreeRoot(top.height), height: top.height})
+		}
+		stack = mergePieceSubtrees(stack)
+	}
+	return CommP(stack[0].root), nil
+}
+
+// pieceSubtree is a complete subtree of a piece's tree.
+type pieceSubtree struct {
+	root   [CommitmentBytesLen]byte
+	height uint
+}
+
+// mergePieceSubtrees replaces the two subtrees on top of stack, which have
+// the same height, with their parent.
+func mergePieceSubtrees(stack []pieceSubtree) []pieceSubtree {
+	left, right := stack[len(stack)-2], stack[len(stack)-1]
+	stack = stack[:len(stack)-2]
+	return append(stack, pieceSubtree{root: hashPieceNodes(left.root, right.root), height: left.height + 1})
+}
+
+// ComputeDataCommitment returns the root of the tree of a sector holding
+// pieces, in order.
+func ComputeDataCommitment(pieces []PieceCommitment) CommD {
+	placed, height := placePieces(pieces)
+	return CommD(subtreeRoot(placed, 0, height))
+}
+
+// GeneratePieceInclusionProof proves that the i-th of the pieces in a sector
+// lies inside the sector's CommD, as computed by ComputeDataCommitment.
+func GeneratePieceInclusionProof(pieces []PieceCommitment, i int) ([]byte, error) {
+	if i < 0 || i >= len(pieces) {
+		return nil, errors.Errorf("sector has no piece %d", i)
+	}
+
+	placed, height := placePieces(pieces)
+	piece := placed[i]
+
+	// Walk down from the root to the piece, collecting the siblings on the
+	// way, then write them out from the bottom up.
+	var siblings [][CommitmentBytesLen]byte
+	start := uint64(0)
+	for h := height; h > piece.height; h-- {
+		half := uint64(1) << (h - 1)
+		if piece.start < start+half {
+			siblings = append(siblings, subtreeRoot(placed, start+half, h-1))
+		} else {
+			siblings = append(siblings, subtreeRoot(placed, start, h-1))
+			start += half
+		}
+	}
+
+	proof := make([]byte, 8, 8+len(siblings)*pieceNodeBytes)
+	binary.BigEndian.PutUint64(proof, piece.start)
+	for j := len(siblings) - 1; j >= 0; j-- {
+		proof = append(proof, siblings[j][:]...)
+	}
+	return proof, nil
+}
+
+// VerifyPieceInclusionProof returns whether proof shows that the piece with
+// commitment commP and size bytes lies inside the sector with commitment
+// commD.
+func VerifyPieceInclusionProof(commD CommD, commP CommP, size uint64, proof []byte) bool {
+	if len(proof) < 8 || (len(proof)-8)%pieceNodeBytes != 0 {
+		return false
+	}
+
+	start := binary.BigEndian.Uint64(proof[:8])
+	leaves := pieceLeafCount(size)
+	if start%leaves != 0 {
+		return false
+	}
+
+	index := start / leaves
+	node := [CommitmentBytesLen]byte(commP)
+	for rest := proof[8:]; len(rest) > 0; rest = rest[pieceNodeBytes:] {
+		var sibling [CommitmentBytesLen]byte
+		copy(sibling[:], rest)
+		if index%2 == 0 {
+			node = hashPieceNodes(node, sibling)
+		} else {
+			node = hashPieceNodes(sibling, node)
+		}
+		index /= 2
+	}
+
+	return index == 0 && bytes.Equal(node[:], commD[:])
+}
+
+// placedPiece is a piece's subtree in the tree of a sector.
+type placedPiece struct {
+	start  uint64 // index of the piece's first leaf
+	height uint   // height of the piece's subtree
+	root   [CommitmentBytesLen]byte
+}
+
+// placePieces lays pieces out in a sector, and returns them with the height
+// of the sector's tree.
+func placePieces(pieces []PieceCommitment) ([]placedPiece, uint) {
+	placed := make([]placedPiece, len(pieces))
+	end := uint64(0)
+	for i, p := range pieces {
+		leaves := pieceLeafCount(p.Size)
+		start := (end + leaves - 1) / leaves * leaves
+		placed[i] = placedPiece{start: start, height: log2(leaves), root: p.CommP}
+		end = start + leaves
+	}
+	if end == 0 {
+		end = 1
+	}
+	return placed, log2(nextPowerOfTwo(end))
+}
+
+// subtreeRoot returns the root of the subtree of the given height whose
+// first leaf is at start, in the tree of a sector holding placed.
+func subtreeRoot(placed []placedPiece, start uint64, height uint) [CommitmentBytesLen]byte {
+	end := start + uint64(1)<<height
+	empty := true
+	for _, p := range placed {
+		if p.start == start && p.height == height {
+			return p.root
+		}
+		if p.start < end && start < p.start+uint64(1)<<p.height {
+			empty = false
+		}
+	}
+	if empty {
+		return zeroSubtreeRoot(height)
+	}
+
+	half := uint64(1) << (height - 1)
+	return hashPieceNodes(subtreeRoot(placed, start, height-1), subtreeRoot(placed, start+half, height-1))
+}
+
+// zeroSubtreeRoot returns the root of a subtree of the given height whose
+// leaves are all zero.
+func zeroSubtreeRoot(height uint) [CommitmentBytesLen]byte {
+	var node [CommitmentBytesLen]byte
+	for h := uint(0); h < height; h++ {
+		node = hashPieceNodes(node, node)
+	}
+	return node
+}
+
+func hashPieceNodes(left, right [CommitmentBytesLen]byte) [CommitmentBytesLen]byte {
+	return sha256.Sum256(append(left[:], right[:]...))
+}
+
+// pieceLeafCount returns the number of leaves, padding included, in the tree
+// of a piece of size bytes.
+func pieceLeafCount(size uint64) uint64 {
+	return nextPowerOfTwo((size + pieceLeafBytes - 1) / pieceLeafBytes)
+}
+
+func nextPowerOfTwo(n uint64) uint64 {
+	p := uint64(1)
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
+
+func log2(n uint64) uint {
+	h := uint(0)
+	for n > 1 {
+		n >>= 1
+		h++
+	}
+	return h
+}
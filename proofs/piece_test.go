@@ -0,0 +1,103 @@
+package proofs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+)
+
+func testPieceCommitment(require *require.Assertions, data []byte) PieceCommitment {
+	commP, err := GeneratePieceCommitment(bytes.NewReader(data), uint64(len(data)))
+	require.NoError(err)
+	return PieceCommitment{CommP: commP, Size: uint64(len(data))}
+}
+
+func TestGeneratePieceCommitment(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	t.Run("pads the last leaf and the leaf count with zeros", func(t *testing.T) {
+		data := bytes.Repeat([]byte{7}, 70)
+
+		var leaves [4][32]byte
+		copy(leaves[0][:], data[:32])
+		copy(leaves[1][:], data[32:64])
+		copy(leaves[2][:], data[64:])
+		expected := hashPieceNodes(hashPieceNodes(leaves[0], leaves[1]), hashPieceNodes(leaves[2], leaves[3]))
+
+		commP, err := GeneratePieceCommitment(bytes.NewReader(data), uint64(len(data)))
+		require.NoError(err)
+		assert.Equal(CommP(expected), commP)
+	})
+
+	t.Run("uses a single leaf as the root", func(t *testing.T) {
+		commP, err := GeneratePieceCommitment(bytes.NewReader([]byte{1, 2, 3}), 3)
+		require.NoError(err)
+		assert.Equal(CommP{1, 2, 3}, commP)
+	})
+
+	t.Run("commits to the piece as if it were zero-padded", func(t *testing.T) {
+		data := bytes.Repeat([]byte{9}, 33*32+1)
+		padded := append(append([]byte{}, data...), make([]byte, 64*32-len(data))...)
+
+		commP, err := GeneratePieceCommitment(bytes.NewReader(data), uint64(len(data)))
+		require.NoError(err)
+		paddedCommP, err := GeneratePieceCommitment(bytes.NewReader(padded), uint64(len(padded)))
+		require.NoError(err)
+		assert.Equal(paddedCommP, commP)
+	})
+
+	t.Run("fails on short data", func(t *testing.T) {
+		_, err := GeneratePieceCommitment(bytes.NewReader([]byte{1, 2, 3}), 100)
+		assert.Error(err)
+	})
+}
+
+func TestPieceInclusionProofs(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	pieces := []PieceCommitment{
+		testPieceCommitment(require, bytes.Repeat([]byte{1}, 40)),
+		testPieceCommitment(require, bytes.Repeat([]byte{2}, 200)),
+		testPieceCommitment(require, bytes.Repeat([]byte{3}, 10)),
+	}
+	commD := ComputeDataCommitment(pieces)
+
+	t.Run("sector root matches the root of the laid out data", func(t *testing.T) {
+		// The first piece takes leaves 0-1, the second is aligned to leaf 8
+		// and takes 8-15, and the third takes leaf 16. 32 leaves in all.
+		sector := make([]byte, 32*32)
+		copy(sector, bytes.Repeat([]byte{1}, 40))
+		copy(sector[8*32:], bytes.Repeat([]byte{2}, 200))
+		copy(sector[16*32:], bytes.Repeat([]byte{3}, 10))
+
+		sectorCommitment := testPieceCommitment(require, sector)
+		assert.Equal(CommD(sectorCommitment.CommP), commD)
+	})
+
+	t.Run("proves each piece", func(t *testing.T) {
+		for i, p := range pieces {
+			proof, err := GeneratePieceInclusionProof(pieces, i)
+			require.NoError(err)
+			assert.True(VerifyPieceInclusionProof(commD, p.CommP, p.Size, proof), "piece %d", i)
+		}
+	})
+
+	t.Run("rejects proofs of other pieces and sectors", func(t *testing.T) {
+		proof, err := GeneratePieceInclusionProof(pieces, 1)
+		require.NoError(err)
+
+		assert.False(VerifyPieceInclusionProof(commD, pieces[0].CommP, pieces[1].Size, proof))
+		assert.False(VerifyPieceInclusionProof(CommD(sha256.Sum256([]byte("other"))), pieces[1].CommP, pieces[1].Size, proof))
+		assert.False(VerifyPieceInclusionProof(commD, pieces[1].CommP, pieces[1].Size, proof[:len(proof)-1]))
+	})
+
+	t.Run("rejects out of range pieces", func(t *testing.T) {
+		_, err := GeneratePieceInclusionProof(pieces, len(pieces))
+		assert.Error(err)
+	})
+}
@@ -124,6 +124,20 @@ func (rp *RustVerifier) VerifyPoST(req VerifyPoSTRequest) (VerifyPoSTResponse, e
 	}, nil
 }
 
+// ErrPieceInclusionProofsUnsupported is returned when generating or verifying
+// a piece inclusion proof with a version of rust-fil-proofs that cannot.
+var ErrPieceInclusionProofsUnsupported = errors.New("piece inclusion proofs are not supported by this version of rust-fil-proofs")
+
+// VerifyPieceInclusionProof verifies that a piece lies inside a sector. It
+// always fails with ErrPieceInclusionProofsUnsupported, so storage clients
+// using the Rust verifier only check the sectors of deals, which are then
+// SectorVerified rather than Verified.
+//
+// TODO: call into rust-fil-proofs once it exposes piece inclusion proofs.
+func (rp *RustVerifier) VerifyPieceInclusionProof(req VerifyPieceInclusionProofRequest) (VerifyPieceInclusionProofResponse, error) {
+	return VerifyPieceInclusionProofResponse{}, ErrPieceInclusionProofsUnsupported
+}
+
 // cUint64s copies the contents of a slice into a C heap-allocated array and
 // returns a pointer to that array and its size. Callers are responsible for
 // freeing the pointer. If they do not do that, the array will be leaked.
@@ -8,6 +8,13 @@ import (
 // ErrPieceTooLarge is an error indicating that a piece cannot be larger than the sector into which it is written.
 var ErrPieceTooLarge = errors.New("piece too large for sector")
 
+// ErrSectorNotFound is an error indicating that the sector builder does not manage the requested sector.
+var ErrSectorNotFound = errors.New("sector not found")
+
+// ErrSectorExportUnsupported is an error indicating that the sector builder cannot export staged sectors to be
+// sealed elsewhere, nor import the replicas sealed from them.
+var ErrSectorExportUnsupported = errors.New("sector builder cannot export or import sectors")
+
 // ErrCouldNotRevertUnsealedSector is an error indicating that a revert of an unsealed sector failed due to
 // rollbackErr. This revert was originally triggered by the rollbackCause error
 type ErrCouldNotRevertUnsealedSector struct {
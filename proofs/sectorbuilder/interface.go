@@ -3,6 +3,7 @@ package sectorbuilder
 import (
 	"context"
 	"io"
+	"time"
 
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
@@ -36,6 +37,23 @@ type SectorBuilder interface {
 	// SealAllStagedSectors seals any non-empty staged sectors.
 	SealAllStagedSectors(ctx context.Context) error
 
+	// SealSector seals the staged sector with the given id, or seals again a
+	// sector whose sealing failed if the SectorBuilder can. It returns
+	// ErrSectorNotFound if the SectorBuilder manages no such sector.
+	SealSector(ctx context.Context, sectorID uint64) error
+
+	// ExportStagedSector stops the staged sector with the given id from
+	// accepting pieces, so that it can be sealed elsewhere. The sector is
+	// reported as sealing until a replica of it is imported. It returns
+	// ErrSectorExportUnsupported if the SectorBuilder cannot export sectors.
+	ExportStagedSector(sectorID uint64) error
+
+	// ImportSealedSector moves the replica at replicaPath, sealed elsewhere
+	// from a sector exported with ExportStagedSector, into the sealed sector
+	// store. The sector's seal result is then sent on SectorSealResults like
+	// that of any other sector.
+	ImportSealedSector(meta *SealedSectorMetadata, replicaPath string) error
+
 	// SectorSealResults returns an unbuffered channel that is sent a value
 	// whenever sealing completes. All calls to SectorSealResults will get the
 	// same channel. Values will be either a *SealedSectorMetadata or an error. A
@@ -47,12 +65,26 @@ type SectorBuilder interface {
 	// which will fit into a newly-provisioned staged sector.
 	GetMaxUserBytesPerStagedSector() (uint64, error)
 
+	// ListSectors describes every staged, sealing, sealed and failed sector
+	// managed by the SectorBuilder, ordered by sector id.
+	ListSectors() ([]*SectorInfo, error)
+
+	// SectorStatus describes the sector with the given id, or returns
+	// ErrSectorNotFound if the SectorBuilder does not manage it.
+	SectorStatus(sectorID uint64) (*SectorInfo, error)
+
 	// GeneratePoST creates a proof-of-spacetime for the replicas managed by
 	// the SectorBuilder. Its output includes the proof-of-spacetime proof which
 	// is posted to the blockchain along with any faults. The proof can be
 	// verified by the VerifyPoSt method on the Verifier interface.
 	GeneratePoST(GeneratePoSTRequest) (GeneratePoSTResponse, error)
 
+	// GeneratePieceInclusionProof proves that the piece with the given cid
+	// lies inside the CommD of the sealed sector holding it. The proof can be
+	// verified by the VerifyPieceInclusionProof method on the Verifier
+	// interface.
+	GeneratePieceInclusionProof(pieceCid cid.Cid) (*PieceInclusionProof, error)
+
 	// Close signals that this SectorBuilder is no longer in use. SectorBuilder
 	// metadata will not be deleted when Close is called; an equivalent
 	// SectorBuilder can be created later by applying the Init function to the
@@ -73,6 +105,69 @@ type SectorSealResult struct {
 	SealingResult *SealedSectorMetadata
 }
 
+// SectorState is where a sector is in its lifecycle.
+type SectorState int
+
+const (
+	// SectorStaged means the sector is accepting pieces.
+	SectorStaged = SectorState(iota)
+
+	// SectorSealing means the sector is being sealed.
+	SectorSealing
+
+	// SectorSealed means the sector has been sealed.
+	SectorSealed
+
+	// SectorFailed means sealing the sector failed.
+	SectorFailed
+)
+
+func (s SectorState) String() string {
+	switch s {
+	case SectorStaged:
+		return "staged"
+	case SectorSealing:
+		return "sealing"
+	case SectorSealed:
+		return "sealed"
+	case SectorFailed:
+		return "failed"
+	default:
+		return "<unknown>"
+	}
+}
+
+// SectorInfo describes a sector managed by a SectorBuilder.
+type SectorInfo struct {
+	SectorID uint64
+	State    SectorState
+	Pieces   []*PieceInfo
+
+	// CommD, CommR and CommRStar are set once the sector is sealed.
+	CommD     proofs.CommD
+	CommR     proofs.CommR
+	CommRStar proofs.CommRStar
+
+	// SealingErr is why sealing failed, if it did.
+	SealingErr string
+
+	// SealStarted and SealFinished are when the SectorBuilder saw sealing
+	// start and finish. They are zero if it did not since it was created, or
+	// if it does not keep them: the Rust SectorBuilder only reports when
+	// sealing started, while the sector is sealing.
+	SealStarted  time.Time
+	SealFinished time.Time
+}
+
+// UserBytes returns the number of piece bytes in the sector.
+func (si *SectorInfo) UserBytes() uint64 {
+	var n uint64
+	for _, p := range si.Pieces {
+		n += p.Size
+	}
+	return n
+}
+
 // PieceInfo is information about a filecoin piece
 type PieceInfo struct {
 	Ref  cid.Cid `json:"ref"`
@@ -89,6 +184,15 @@ type SealedSectorMetadata struct {
 	SectorID  uint64
 }
 
+// PieceInclusionProof proves that a piece lies inside a sealed sector.
+type PieceInclusionProof struct {
+	SectorID  uint64
+	CommD     proofs.CommD
+	CommP     proofs.CommP
+	PieceSize uint64
+	Proof     []byte
+}
+
 // GeneratePoSTRequest represents a request to generate a proof-of-spacetime.
 type GeneratePoSTRequest struct {
 	CommRs        []proofs.CommR
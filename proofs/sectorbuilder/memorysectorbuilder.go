@@ -0,0 +1,435 @@
+package sectorbuilder
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	dag "gx/ipfs/QmNRAuGmvnVw8urHkUZQirhu42VTiZjVWASa2aTznEMmpP/go-merkledag"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	uio "gx/ipfs/QmRDWTzVdbHXdtat7tVJ7YC7kRaW7rTZTEF79yykcLYa49/go-unixfs/io"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	bserv "gx/ipfs/QmZsGVGCqMCNzHLNMB6q4F6yyvomqf1VxwhJwSfgo1NGaF/go-blockservice"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/proofs"
+)
+
+// DefaultMemorySectorBytes is the number of user piece-bytes which fit into a
+// sector of a MemorySectorBuilder by default.
+const DefaultMemorySectorBytes = 1016
+
+// MemorySectorBuilder is a SectorBuilder which keeps its sectors in memory and
+// seals them with the insecure proofs of proofs.InsecureVerifier. It needs no
+// Rust, and is meant for tests and dev networks.
+type MemorySectorBuilder struct {
+	blockService bserv.BlockService
+	proverID     [31]byte
+	maxBytes     uint64
+	sealDelay    time.Duration
+
+	sectorSealResults chan SectorSealResult
+
+	// lk protects lastUsedSectorID, sectors and staged.
+	lk               sync.Mutex
+	lastUsedSectorID uint64
+	sectors          map[uint64]*memorySector
+
+	// staged is the sector accepting pieces, if any.
+	staged *memorySector
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+var _ SectorBuilder = &MemorySectorBuilder{}
+
+// memorySector is a sector of a MemorySectorBuilder.
+type memorySector struct {
+	info SectorInfo
+
+	// data holds the bytes of each piece of info.Pieces.
+	data [][]byte
+}
+
+// MemorySectorBuilderConfig configures a MemorySectorBuilder. BlockService
+// and MinerAddr are required.
+type MemorySectorBuilderConfig struct {
+	BlockService     bserv.BlockService
+	LastUsedSectorID uint64
+	MinerAddr        address.Address
+
+	// MaxBytesPerSector is the number of user piece-bytes which fit into a
+	// sector, DefaultMemorySectorBytes if zero.
+	MaxBytesPerSector uint64
+
+	// SealDelay is how long sealing a sector takes.
+	SealDelay time.Duration
+}
+
+// NewMemorySectorBuilder returns a MemorySectorBuilder without sectors.
+func NewMemorySectorBuilder(cfg MemorySectorBuilderConfig) *MemorySectorBuilder {
+	maxBytes := cfg.MaxBytesPerSector
+	if maxBytes == 0 {
+		maxBytes = DefaultMemorySectorBytes
+	}
+
+	return &MemorySectorBuilder{
+		blockService:      cfg.BlockService,
+		proverID:          AddressToProverID(cfg.MinerAddr),
+		maxBytes:          maxBytes,
+		sealDelay:         cfg.SealDelay,
+		sectorSealResults: make(chan SectorSealResult),
+		lastUsedSectorID:  cfg.LastUsedSectorID,
+		sectors:           make(map[uint64]*memorySector),
+		done:              make(chan struct{}),
+	}
+}
+
+// GetMaxUserBytesPerStagedSector produces the number of user piece-bytes which
+// will fit into a newly-provisioned staged sector.
+func (sb *MemorySectorBuilder) GetMaxUserBytesPerStagedSector() (uint64, error) {
+	return sb.maxBytes, nil
+}
+
+// AddPiece writes the given piece into the staged sector, sealing the staged
+// sector first if the piece does not fit, and sealing it after if the piece
+// fills it.
+func (sb *MemorySectorBuilder) AddPiece(ctx context.Context, pi *PieceInfo) (uint64, error) {
+	if pi.Size > sb.maxBytes {
+		return 0, ErrPieceTooLarge
+	}
+
+	dagService := dag.NewDAGService(sb.blockService)
+	rootIpldNode, err := dagService.Get(ctx, pi.Ref)
+	if err != nil {
+		return 0, err
+	}
+	r, err := uio.NewDagReader(ctx, rootIpldNode, dagService)
+	if err != nil {
+		return 0, err
+	}
+	pieceBytes := make([]byte, pi.Size)
+	if _, err := io.ReadFull(r, pieceBytes); err != nil {
+		return 0, errors.Wrapf(err, "error reading piece bytes into buffer")
+	}
+
+	sb.lk.Lock()
+	defer sb.lk.Unlock()
+
+	if sb.staged != nil && sb.staged.info.UserBytes()+pi.Size > sb.maxBytes {
+		sb.seal(sb.staged)
+	}
+	if sb.staged == nil {
+		sb.lastUsedSectorID++
+		sb.staged = &memorySector{info: SectorInfo{
+			SectorID: sb.lastUsedSectorID,
+			State:    SectorStaged,
+		}}
+		sb.sectors[sb.staged.info.SectorID] = sb.staged
+	}
+
+	s := sb.staged
+	s.info.Pieces = append(s.info.Pieces, &PieceInfo{Ref: pi.Ref, Size: pi.Size})
+	s.data = append(s.data, pieceBytes)
+	if s.info.UserBytes() == sb.maxBytes {
+		sb.seal(s)
+	}
+
+	return s.info.SectorID, nil
+}
+
+// ReadPieceFromSealedSector produces a Reader used to get original piece-bytes
+// from a sealed sector.
+func (sb *MemorySectorBuilder) ReadPieceFromSealedSector(pieceCid cid.Cid) (io.Reader, error) {
+	sb.lk.Lock()
+	defer sb.lk.Unlock()
+
+	s, i := sb.findSealedPiece(pieceCid)
+	if s == nil {
+		return nil, errors.Errorf("no sealed sector holds piece %s", pieceCid)
+	}
+	return bytes.NewReader(s.data[i]), nil
+}
+
+// SealAllStagedSectors seals the staged sector, if it holds any pieces.
+func (sb *MemorySectorBuilder) SealAllStagedSectors(ctx context.Context) error {
+	sb.lk.Lock()
+	defer sb.lk.Unlock()
+
+	if sb.staged != nil && len(sb.staged.info.Pieces) > 0 {
+		sb.seal(sb.staged)
+	}
+	return nil
+}
+
+// SealSector seals the staged or failed sector with the given id.
+func (sb *MemorySectorBuilder) SealSector(ctx context.Context, sectorID uint64) error {
+	sb.lk.Lock()
+	defer sb.lk.Unlock()
+
+	s, ok := sb.sectors[sectorID]
+	if !ok {
+		return ErrSectorNotFound
+	}
+	if s.info.State != SectorStaged && s.info.State != SectorFailed {
+		return errors.Errorf("sector %d is %s", sectorID, s.info.State)
+	}
+
+	sb.seal(s)
+	return nil
+}
+
+// ExportStagedSector stops the staged sector with the given id from accepting
+// pieces, so that it can be sealed elsewhere.
+func (sb *MemorySectorBuilder) ExportStagedSector(sectorID uint64) error {
+	sb.lk.Lock()
+	defer sb.lk.Unlock()
+
+	s, ok := sb.sectors[sectorID]
+	if !ok {
+		return ErrSectorNotFound
+	}
+	if s.info.State != SectorStaged {
+		return errors.Errorf("sector %d is %s", sectorID, s.info.State)
+	}
+
+	if sb.staged == s {
+		sb.staged = nil
+	}
+	s.info.State = SectorSealing
+	s.info.SealStarted = time.Now()
+	return nil
+}
+
+// ImportSealedSector marks the exported sector described by meta as sealed.
+// The replica at replicaPath is removed, as the sector's pieces are already
+// held in memory.
+func (sb *MemorySectorBuilder) ImportSealedSector(meta *SealedSectorMetadata, replicaPath string) error {
+	sb.lk.Lock()
+	s, ok := sb.sectors[meta.SectorID]
+	if !ok {
+		sb.lk.Unlock()
+		return ErrSectorNotFound
+	}
+	if s.info.State != SectorSealing {
+		sb.lk.Unlock()
+		return errors.Errorf("sector %d is %s", meta.SectorID, s.info.State)
+	}
+	sb.lk.Unlock()
+
+	if err := os.Remove(replicaPath); err != nil {
+		return errors.Wrap(err, "failed to remove replica")
+	}
+
+	sb.wg.Add(1)
+	go func() {
+		defer sb.wg.Done()
+		sb.sealed(s, meta)
+	}()
+	return nil
+}
+
+// ListSectors describes every sector managed by the sector builder, ordered
+// by sector id.
+func (sb *MemorySectorBuilder) ListSectors() ([]*SectorInfo, error) {
+	sb.lk.Lock()
+	defer sb.lk.Unlock()
+
+	infos := make([]*SectorInfo, 0, len(sb.sectors))
+	for _, s := range sb.sectors {
+		infos = append(infos, s.describe())
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].SectorID < infos[j].SectorID
+	})
+	return infos, nil
+}
+
+// SectorStatus describes the sector with the given id.
+func (sb *MemorySectorBuilder) SectorStatus(sectorID uint64) (*SectorInfo, error) {
+	sb.lk.Lock()
+	defer sb.lk.Unlock()
+
+	s, ok := sb.sectors[sectorID]
+	if !ok {
+		return nil, ErrSectorNotFound
+	}
+	return s.describe(), nil
+}
+
+// SectorSealResults returns an unbuffered channel that is sent a value whenever
+// sealing completes.
+func (sb *MemorySectorBuilder) SectorSealResults() <-chan SectorSealResult {
+	return sb.sectorSealResults
+}
+
+// GeneratePoST produces an insecure proof-of-spacetime for the provided
+// commitment replicas.
+func (sb *MemorySectorBuilder) GeneratePoST(req GeneratePoSTRequest) (GeneratePoSTResponse, error) {
+	return GeneratePoSTResponse{
+		Faults: []uint64{},
+		Proof:  proofs.InsecurePoStProof(req.ChallengeSeed, req.CommRs),
+	}, nil
+}
+
+// GeneratePieceInclusionProof proves that a piece lies inside its sealed
+// sector.
+func (sb *MemorySectorBuilder) GeneratePieceInclusionProof(pieceCid cid.Cid) (*PieceInclusionProof, error) {
+	sb.lk.Lock()
+	defer sb.lk.Unlock()
+
+	s, i := sb.findSealedPiece(pieceCid)
+	if s == nil {
+		return nil, errors.Errorf("no sealed sector holds piece %s", pieceCid)
+	}
+
+	commitments, err := s.pieceCommitments()
+	if err != nil {
+		return nil, err
+	}
+	proof, err := proofs.GeneratePieceInclusionProof(commitments, i)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PieceInclusionProof{
+		SectorID:  s.info.SectorID,
+		CommD:     s.info.CommD,
+		CommP:     commitments[i].CommP,
+		PieceSize: commitments[i].Size,
+		Proof:     proof,
+	}, nil
+}
+
+// Close stops sealing. Sectors still sealing stay that way.
+func (sb *MemorySectorBuilder) Close() error {
+	close(sb.done)
+	sb.wg.Wait()
+	return nil
+}
+
+// seal starts sealing s. Callers must hold lk.
+func (sb *MemorySectorBuilder) seal(s *memorySector) {
+	if sb.staged == s {
+		sb.staged = nil
+	}
+	s.info.State = SectorSealing
+	s.info.SealingErr = ""
+	s.info.SealStarted = time.Now()
+
+	sb.wg.Add(1)
+	go func() {
+		defer sb.wg.Done()
+
+		select {
+		case <-time.After(sb.sealDelay):
+		case <-sb.done:
+			return
+		}
+
+		meta, err := sb.sealMetadata(s)
+		if err != nil {
+			sb.sealFailed(s, err)
+			return
+		}
+		sb.sealed(s, meta)
+	}()
+}
+
+// sealMetadata computes the insecure commitments and proof of s.
+func (sb *MemorySectorBuilder) sealMetadata(s *memorySector) (*SealedSectorMetadata, error) {
+	sb.lk.Lock()
+	defer sb.lk.Unlock()
+
+	commitments, err := s.pieceCommitments()
+	if err != nil {
+		return nil, err
+	}
+
+	sectorID := SectorIDToBytes(s.info.SectorID)
+	commD := proofs.ComputeDataCommitment(commitments)
+	commR := proofs.InsecureCommR(sb.proverID, sectorID, commD)
+	commRStar := proofs.InsecureCommRStar(commR)
+
+	return &SealedSectorMetadata{
+		CommD:     commD,
+		CommR:     commR,
+		CommRStar: commRStar,
+		Pieces:    s.info.Pieces,
+		Proof:     proofs.InsecureSealProof(sb.proverID, sectorID, commD, commR, commRStar),
+		SectorID:  s.info.SectorID,
+	}, nil
+}
+
+// sealed records that s was sealed with meta, and reports it.
+func (sb *MemorySectorBuilder) sealed(s *memorySector, meta *SealedSectorMetadata) {
+	sb.lk.Lock()
+	s.info.State = SectorSealed
+	s.info.CommD = meta.CommD
+	s.info.CommR = meta.CommR
+	s.info.CommRStar = meta.CommRStar
+	s.info.SealFinished = time.Now()
+	sb.lk.Unlock()
+
+	sb.report(SectorSealResult{SectorID: meta.SectorID, SealingResult: meta})
+}
+
+// sealFailed records that sealing s failed, and reports it.
+func (sb *MemorySectorBuilder) sealFailed(s *memorySector, err error) {
+	sb.lk.Lock()
+	s.info.State = SectorFailed
+	s.info.SealingErr = err.Error()
+	s.info.SealFinished = time.Now()
+	sb.lk.Unlock()
+
+	sb.report(SectorSealResult{SectorID: s.info.SectorID, SealingErr: err})
+}
+
+func (sb *MemorySectorBuilder) report(result SectorSealResult) {
+	select {
+	case sb.sectorSealResults <- result:
+	case <-sb.done:
+	}
+}
+
+// findSealedPiece returns the sealed sector holding the piece with the given
+// cid and the index of the piece in it, or nil. Callers must hold lk.
+func (sb *MemorySectorBuilder) findSealedPiece(pieceCid cid.Cid) (*memorySector, int) {
+	for _, s := range sb.sectors {
+		if s.info.State != SectorSealed {
+			continue
+		}
+		for i, p := range s.info.Pieces {
+			if p.Ref.Equals(pieceCid) {
+				return s, i
+			}
+		}
+	}
+	return nil, 0
+}
+
+// describe returns a copy of the sector's info.
+func (s *memorySector) describe() *SectorInfo {
+	info := s.info
+	info.Pieces = make([]*PieceInfo, len(s.info.Pieces))
+	copy(info.Pieces, s.info.Pieces)
+	return &info
+}
+
+// pieceCommitments returns the commitments of the sector's pieces, in order.
+func (s *memorySector) pieceCommitments() ([]proofs.PieceCommitment, error) {
+	commitments := make([]proofs.PieceCommitment, len(s.data))
+	for i, data := range s.data {
+		commP, err := proofs.GeneratePieceCommitment(bytes.NewReader(data), uint64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+		commitments[i] = proofs.PieceCommitment{CommP: commP, Size: uint64(len(data))}
+	}
+	return commitments, nil
+}
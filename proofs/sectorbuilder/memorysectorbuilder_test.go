@@ -0,0 +1,229 @@
+package sectorbuilder
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	dag "gx/ipfs/QmNRAuGmvnVw8urHkUZQirhu42VTiZjVWASa2aTznEMmpP/go-merkledag"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	"gx/ipfs/QmRu7tiRnFk9mMPpVECQTBQJqXtmG132jJxA1w9A7TtpBz/go-ipfs-blockstore"
+	"gx/ipfs/QmSz8kAe2JCKp2dWSG8gHSWnwSmne8YfRXTeK5HBmc9L7t/go-ipfs-exchange-offline"
+	ds "gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+	dssync "gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore/sync"
+	bserv "gx/ipfs/QmZsGVGCqMCNzHLNMB6q4F6yyvomqf1VxwhJwSfgo1NGaF/go-blockservice"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/proofs"
+)
+
+type memoryTestHarness struct {
+	sb        *MemorySectorBuilder
+	bs        bserv.BlockService
+	minerAddr address.Address
+}
+
+func newMemoryTestHarness(maxBytes uint64) *memoryTestHarness {
+	bstore := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	bs := bserv.New(bstore, offline.Exchange(bstore))
+	minerAddr := address.MakeTestAddress("memory")
+
+	return &memoryTestHarness{
+		sb: NewMemorySectorBuilder(MemorySectorBuilderConfig{
+			BlockService:      bs,
+			MinerAddr:         minerAddr,
+			MaxBytesPerSector: maxBytes,
+		}),
+		bs:        bs,
+		minerAddr: minerAddr,
+	}
+}
+
+func (h *memoryTestHarness) addPiece(t *testing.T, data string) (uint64, *PieceInfo) {
+	nd := dag.NewRawNode([]byte(data))
+	require.NoError(t, h.bs.AddBlock(nd))
+
+	pi := &PieceInfo{Ref: nd.Cid(), Size: uint64(len(data))}
+	sectorID, err := h.sb.AddPiece(context.Background(), pi)
+	require.NoError(t, err)
+	return sectorID, pi
+}
+
+func (h *memoryTestHarness) nextResult(t *testing.T) SectorSealResult {
+	select {
+	case result := <-h.sb.SectorSealResults():
+		return result
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "timed out waiting for a seal result")
+		return SectorSealResult{}
+	}
+}
+
+func TestMemorySectorBuilder(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("seals pieces with proofs the insecure verifier accepts", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		h := newMemoryTestHarness(0)
+		defer h.sb.Close() // nolint: errcheck
+
+		sectorID, piece := h.addPiece(t, "hello")
+		otherSectorID, _ := h.addPiece(t, "world")
+		assert.Equal(sectorID, otherSectorID)
+
+		require.NoError(h.sb.SealAllStagedSectors(ctx))
+		result := h.nextResult(t)
+		require.NoError(result.SealingErr)
+		meta := result.SealingResult
+		assert.Equal(sectorID, meta.SectorID)
+
+		verifier := &proofs.InsecureVerifier{}
+		req := proofs.VerifySealRequest{
+			CommD:     meta.CommD,
+			CommR:     meta.CommR,
+			CommRStar: meta.CommRStar,
+			Proof:     meta.Proof,
+			ProverID:  AddressToProverID(h.minerAddr),
+			SectorID:  SectorIDToBytes(sectorID),
+		}
+		res, err := verifier.VerifySeal(req)
+		require.NoError(err)
+		assert.True(res.IsValid)
+
+		req.SectorID = SectorIDToBytes(sectorID + 1)
+		res, err = verifier.VerifySeal(req)
+		require.NoError(err)
+		assert.False(res.IsValid)
+
+		r, err := h.sb.ReadPieceFromSealedSector(piece.Ref)
+		require.NoError(err)
+		data, err := ioutil.ReadAll(r)
+		require.NoError(err)
+		assert.Equal("hello", string(data))
+
+		pip, err := h.sb.GeneratePieceInclusionProof(piece.Ref)
+		require.NoError(err)
+		assert.Equal(meta.CommD, pip.CommD)
+		pipRes, err := verifier.VerifyPieceInclusionProof(proofs.VerifyPieceInclusionProofRequest{
+			CommD:     pip.CommD,
+			CommP:     pip.CommP,
+			PieceSize: pip.PieceSize,
+			Proof:     pip.Proof,
+		})
+		require.NoError(err)
+		assert.True(pipRes.IsValid)
+
+		info, err := h.sb.SectorStatus(sectorID)
+		require.NoError(err)
+		assert.Equal(SectorSealed, info.State)
+		assert.Equal(meta.CommR, info.CommR)
+	})
+
+	t.Run("seals sectors as they fill up", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		h := newMemoryTestHarness(10)
+		defer h.sb.Close() // nolint: errcheck
+
+		first, _ := h.addPiece(t, "123456")
+		second, _ := h.addPiece(t, "1234")
+		assert.Equal(first, second)
+		result := h.nextResult(t)
+		require.NoError(result.SealingErr)
+		assert.Equal(first, result.SectorID)
+
+		third, _ := h.addPiece(t, "1234567")
+		fourth, _ := h.addPiece(t, "12345")
+		assert.NotEqual(first, third)
+		assert.NotEqual(third, fourth)
+		assert.Equal(third, h.nextResult(t).SectorID)
+
+		infos, err := h.sb.ListSectors()
+		require.NoError(err)
+		require.Len(infos, 3)
+		assert.Equal(SectorStaged, infos[2].State)
+
+		_, err = h.sb.AddPiece(ctx, &PieceInfo{Ref: dag.NewRawNode(make([]byte, 11)).Cid(), Size: 11})
+		assert.Equal(ErrPieceTooLarge, err)
+	})
+
+	t.Run("imports sectors sealed elsewhere", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		h := newMemoryTestHarness(0)
+		defer h.sb.Close() // nolint: errcheck
+
+		sectorID, _ := h.addPiece(t, "exported")
+		require.NoError(h.sb.ExportStagedSector(sectorID))
+		info, err := h.sb.SectorStatus(sectorID)
+		require.NoError(err)
+		assert.Equal(SectorSealing, info.State)
+
+		// The next piece goes into a new sector.
+		nextSectorID, _ := h.addPiece(t, "next")
+		assert.NotEqual(sectorID, nextSectorID)
+
+		dir, err := ioutil.TempDir("", "memorysectorbuilder")
+		require.NoError(err)
+		defer os.RemoveAll(dir) // nolint: errcheck
+		replicaPath := filepath.Join(dir, "replica")
+		require.NoError(ioutil.WriteFile(replicaPath, []byte("replica"), 0644))
+
+		meta := &SealedSectorMetadata{SectorID: sectorID, CommR: proofs.CommR{1}}
+		require.NoError(h.sb.ImportSealedSector(meta, replicaPath))
+		assert.Equal(meta, h.nextResult(t).SealingResult)
+
+		info, err = h.sb.SectorStatus(sectorID)
+		require.NoError(err)
+		assert.Equal(SectorSealed, info.State)
+		assert.Equal(proofs.CommR{1}, info.CommR)
+	})
+
+	t.Run("generates deterministic proofs-of-spacetime", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		h := newMemoryTestHarness(0)
+		defer h.sb.Close() // nolint: errcheck
+
+		req := GeneratePoSTRequest{
+			CommRs:        []proofs.CommR{{1}, {2}},
+			ChallengeSeed: proofs.PoStChallengeSeed{3},
+		}
+		res, err := h.sb.GeneratePoST(req)
+		require.NoError(err)
+		assert.Equal(proofs.InsecurePoStProof(req.ChallengeSeed, []proofs.CommR{{2}, {1}}), res.Proof)
+		assert.Empty(res.Faults)
+
+		req.ChallengeSeed = proofs.PoStChallengeSeed{4}
+		other, err := h.sb.GeneratePoST(req)
+		require.NoError(err)
+		assert.NotEqual(res.Proof, other.Proof)
+	})
+
+	t.Run("seals after the configured delay", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		h := newMemoryTestHarness(0)
+		h.sb.sealDelay = time.Hour
+		defer h.sb.Close() // nolint: errcheck
+
+		sectorID, _ := h.addPiece(t, "slow")
+		require.NoError(h.sb.SealSector(ctx, sectorID))
+		info, err := h.sb.SectorStatus(sectorID)
+		require.NoError(err)
+		assert.Equal(SectorSealing, info.State)
+
+		assert.Equal(ErrSectorNotFound, h.sb.SealSector(ctx, sectorID+1))
+		assert.Error(h.sb.SealSector(ctx, sectorID))
+	})
+}
@@ -4,11 +4,15 @@ import (
 	"bytes"
 	"context"
 	"io"
+	"os"
+	"path/filepath"
 	"runtime"
+	"sync"
 	"time"
 	"unsafe"
 
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/metrics"
 	"github.com/filecoin-project/go-filecoin/proofs"
 
 	dag "gx/ipfs/QmNRAuGmvnVw8urHkUZQirhu42VTiZjVWASa2aTznEMmpP/go-merkledag"
@@ -24,7 +28,16 @@ import (
 // #include "../include/libfilecoin_proofs.h"
 import "C"
 
-var log = logging.Logger("sectorbuilder") // nolint: deadcode
+var log = logging.Logger("sectorbuilder")
+
+var (
+	sealDuration = metrics.NewHistogram("filecoin_sectorbuilder_seal_seconds", "Time taken to seal a sector, measured from when sealing was first observed.")
+	postDuration = metrics.NewHistogram("filecoin_sectorbuilder_post_seconds", "Time taken to generate a proof-of-spacetime.")
+)
+
+func init() {
+	metrics.DefaultRegistry.MustRegister(sealDuration, postDuration)
+}
 
 // MaxNumStagedSectors configures the maximum number of staged sectors which can
 // be open and accepting data at any time.
@@ -56,12 +69,32 @@ type RustSectorBuilder struct {
 	// sealStatusPoller polls for sealing status for the sectors whose ids it
 	// knows about.
 	sealStatusPoller *sealStatusPoller
+
+	// lastUsedSectorID is the LastUsedSectorID the sector builder was
+	// created with.
+	lastUsedSectorID uint64
+
+	// stagedPiecesLk protects stagedPieces.
+	stagedPiecesLk sync.Mutex
+
+	// stagedPieces records the pieces added to each sector not yet sealed,
+	// which rust-fil-proofs does not report. Pieces added before the sector
+	// builder was created are not known.
+	stagedPieces map[uint64][]*PieceInfo
+
+	// sealStartsLk protects sealStarts.
+	sealStartsLk sync.Mutex
+
+	// sealStarts records when each sector being sealed was first seen
+	// sealing, and is used to report seal durations.
+	sealStarts map[uint64]time.Time
 }
 
 var _ SectorBuilder = &RustSectorBuilder{}
 
 // RustSectorBuilderConfig is a configuration object used when instantiating a
-// Rust-backed SectorBuilder through the FFI. All fields are required.
+// Rust-backed SectorBuilder through the FFI. All fields but Storage are
+// required.
 type RustSectorBuilderConfig struct {
 	BlockService     bserv.BlockService
 	LastUsedSectorID uint64
@@ -70,6 +103,19 @@ type RustSectorBuilderConfig struct {
 	SealedSectorDir  string
 	SectorStoreType  proofs.SectorStoreType
 	StagedSectorDir  string
+
+	// Storage, if not nil, places new sectors in its storage paths instead
+	// of StagedSectorDir and SealedSectorDir. rust-fil-proofs takes the
+	// directories of new sectors once, when the sector builder is created,
+	// so the paths are picked then and hold every sector staged until the
+	// sector builder is created again.
+	//
+	// TODO: place each new sector once rust-fil-proofs can.
+	Storage *SectorStorage
+	// StorageSubdir, if set, keeps the sectors placed by Storage in this
+	// subdirectory of its paths, so that several sector builders can share
+	// them.
+	StorageSubdir string
 }
 
 // NewRustSectorBuilder instantiates a SectorBuilder through the FFI.
@@ -84,10 +130,19 @@ func NewRustSectorBuilder(cfg RustSectorBuilderConfig) (*RustSectorBuilder, erro
 	proverIDCBytes := C.CBytes(proverID[:])
 	defer C.free(proverIDCBytes)
 
-	cStagedSectorDir := C.CString(cfg.StagedSectorDir)
+	stagedSectorDir, sealedSectorDir := cfg.StagedSectorDir, cfg.SealedSectorDir
+	if cfg.Storage != nil {
+		var err error
+		stagedSectorDir, sealedSectorDir, err = placeSectorDirs(cfg.Storage, cfg.StorageSubdir)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to place sectors")
+		}
+	}
+
+	cStagedSectorDir := C.CString(stagedSectorDir)
 	defer C.free(unsafe.Pointer(cStagedSectorDir))
 
-	cSealedSectorDir := C.CString(cfg.SealedSectorDir)
+	cSealedSectorDir := C.CString(sealedSectorDir)
 	defer C.free(unsafe.Pointer(cSealedSectorDir))
 
 	scfg, err := proofs.CSectorStoreType(cfg.SectorStoreType)
@@ -114,6 +169,9 @@ func NewRustSectorBuilder(cfg RustSectorBuilderConfig) (*RustSectorBuilder, erro
 		blockService:      cfg.BlockService,
 		ptr:               unsafe.Pointer(resPtr.sector_builder),
 		sectorSealResults: make(chan SectorSealResult),
+		lastUsedSectorID:  cfg.LastUsedSectorID,
+		stagedPieces:      make(map[uint64][]*PieceInfo),
+		sealStarts:        make(map[uint64]time.Time),
 	}
 
 	// load staged sector metadata and use it to initialize the poller
@@ -193,9 +251,14 @@ func (sb *RustSectorBuilder) AddPiece(ctx context.Context, pi *PieceInfo) (secto
 		return 0, errors.New(C.GoString(resPtr.error_msg))
 	}
 
-	go sb.sealStatusPoller.addSectorID(uint64(resPtr.sector_id))
+	sectorID = uint64(resPtr.sector_id)
+	sb.stagedPiecesLk.Lock()
+	sb.stagedPieces[sectorID] = append(sb.stagedPieces[sectorID], pi)
+	sb.stagedPiecesLk.Unlock()
+
+	go sb.sealStatusPoller.addSectorID(sectorID)
 
-	return uint64(resPtr.sector_id), nil
+	return sectorID, nil
 }
 
 func (sb *RustSectorBuilder) findSealedSectorMetadata(sectorID uint64) (*SealedSectorMetadata, error) {
@@ -207,12 +270,16 @@ func (sb *RustSectorBuilder) findSealedSectorMetadata(sectorID uint64) (*SealedS
 	}
 
 	if resPtr.seal_status_code == C.Failed {
+		sb.sealFinished(sectorID, false)
 		return nil, errors.New(C.GoString(resPtr.seal_error_msg))
 	} else if resPtr.seal_status_code == C.Pending {
 		return nil, nil
 	} else if resPtr.seal_status_code == C.Sealing {
+		sb.sealStarted(sectorID)
 		return nil, nil
 	} else if resPtr.seal_status_code == C.Sealed {
+		sb.sealFinished(sectorID, true)
+
 		commRSlice := C.GoBytes(unsafe.Pointer(&resPtr.comm_r[0]), 32)
 		var commR proofs.CommR
 		copy(commR[:], commRSlice)
@@ -248,6 +315,49 @@ func (sb *RustSectorBuilder) findSealedSectorMetadata(sectorID uint64) (*SealedS
 	}
 }
 
+// sealStarted records the time at which sealing of the sector was first
+// observed.
+func (sb *RustSectorBuilder) sealStarted(sectorID uint64) {
+	sb.sealStartsLk.Lock()
+	defer sb.sealStartsLk.Unlock()
+
+	if _, ok := sb.sealStarts[sectorID]; !ok {
+		sb.sealStarts[sectorID] = time.Now()
+	}
+}
+
+// sealFinished forgets the sector's seal start time, reporting the seal
+// duration if sealing succeeded, and its staged pieces if it is sealed.
+func (sb *RustSectorBuilder) sealFinished(sectorID uint64, success bool) {
+	if success {
+		sb.stagedPiecesLk.Lock()
+		delete(sb.stagedPieces, sectorID)
+		sb.stagedPiecesLk.Unlock()
+	}
+
+	sb.sealStartsLk.Lock()
+	defer sb.sealStartsLk.Unlock()
+
+	start, ok := sb.sealStarts[sectorID]
+	if !ok {
+		return
+	}
+	delete(sb.sealStarts, sectorID)
+
+	if success {
+		sealDuration.ObserveDuration(start)
+	}
+}
+
+// sealStart returns when sealing of the sector was first seen, if it is
+// being sealed.
+func (sb *RustSectorBuilder) sealStart(sectorID uint64) time.Time {
+	sb.sealStartsLk.Lock()
+	defer sb.sealStartsLk.Unlock()
+
+	return sb.sealStarts[sectorID]
+}
+
 // ReadPieceFromSealedSector produces a Reader used to get original piece-bytes
 // from a sealed sector.
 func (sb *RustSectorBuilder) ReadPieceFromSealedSector(pieceCid cid.Cid) (io.Reader, error) {
@@ -276,6 +386,69 @@ func (sb *RustSectorBuilder) SealAllStagedSectors(ctx context.Context) error {
 	return nil
 }
 
+// SealSector schedules sealing of the staged sector with the given id.
+// rust-fil-proofs can only seal all staged sectors at once, so the other
+// staged sectors are sealed along with it, and cannot seal a sector whose
+// sealing failed again.
+//
+// TODO: seal the one sector once rust-fil-proofs can.
+func (sb *RustSectorBuilder) SealSector(ctx context.Context, sectorID uint64) error {
+	info, err := sb.SectorStatus(sectorID)
+	if err != nil {
+		return err
+	}
+	if info.State == SectorFailed {
+		return errors.Errorf("sector %d failed to seal and cannot be sealed again: %s", sectorID, info.SealingErr)
+	}
+	if info.State != SectorStaged {
+		return errors.Errorf("sector %d is %s", sectorID, info.State)
+	}
+
+	return sb.SealAllStagedSectors(ctx)
+}
+
+// ExportStagedSector always fails with ErrSectorExportUnsupported, as the
+// pinned rust-fil-proofs cannot stop a staged sector from accepting pieces
+// without sealing it.
+//
+// TODO: export staged sectors once rust-fil-proofs can.
+func (sb *RustSectorBuilder) ExportStagedSector(sectorID uint64) error {
+	return ErrSectorExportUnsupported
+}
+
+// ImportSealedSector always fails with ErrSectorExportUnsupported, as the
+// pinned rust-fil-proofs cannot take in a replica sealed elsewhere.
+//
+// TODO: import sealed sectors once rust-fil-proofs can.
+func (sb *RustSectorBuilder) ImportSealedSector(meta *SealedSectorMetadata, replicaPath string) error {
+	return ErrSectorExportUnsupported
+}
+
+// placeSectorDirs returns the directories of storage, in their subdir, that
+// new staged and sealed sectors are stored in.
+func placeSectorDirs(storage *SectorStorage, subdir string) (stagedDir string, sealedDir string, err error) {
+	// The size of sectors is not known before the Rust sector builder is
+	// created, so the paths with the most free space are picked.
+	stagedDir, err = storage.Place(StorageStaging, 0)
+	if err != nil {
+		return "", "", err
+	}
+	sealedDir, err = storage.Place(StorageSealed, 0)
+	if err != nil {
+		return "", "", err
+	}
+	if subdir != "" {
+		stagedDir = filepath.Join(stagedDir, subdir)
+		sealedDir = filepath.Join(sealedDir, subdir)
+		for _, dir := range []string{stagedDir, sealedDir} {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return "", "", errors.Wrapf(err, "failed to create sector directory %s", dir)
+			}
+		}
+	}
+	return stagedDir, sealedDir, nil
+}
+
 // stagedSectors returns a slice of all staged sector metadata for the sector builder, or an error.
 func (sb *RustSectorBuilder) stagedSectors() ([]*stagedSectorMetadata, error) {
 	resPtr := (*C.GetStagedSectorsResponse)(unsafe.Pointer(C.get_staged_sectors((*C.SectorBuilder)(sb.ptr))))
@@ -293,6 +466,102 @@ func (sb *RustSectorBuilder) stagedSectors() ([]*stagedSectorMetadata, error) {
 	return meta, nil
 }
 
+// sectorInfo describes the sector with the given id, or fails if the sector
+// builder does not manage it.
+func (sb *RustSectorBuilder) sectorInfo(sectorID uint64) (*SectorInfo, error) {
+	resPtr := (*C.GetSealStatusResponse)(unsafe.Pointer(C.get_seal_status((*C.SectorBuilder)(sb.ptr), C.uint64_t(sectorID))))
+	defer C.destroy_get_seal_status_response(resPtr)
+
+	if resPtr.status_code != 0 {
+		return nil, errors.New(C.GoString(resPtr.error_msg))
+	}
+
+	info := &SectorInfo{SectorID: sectorID, Pieces: sb.stagedSectorPieces(sectorID)}
+	switch resPtr.seal_status_code {
+	case C.Pending:
+		info.State = SectorStaged
+	case C.Sealing:
+		info.State = SectorSealing
+		info.SealStarted = sb.sealStart(sectorID)
+	case C.Failed:
+		info.State = SectorFailed
+		info.SealingErr = C.GoString(resPtr.seal_error_msg)
+	case C.Sealed:
+		info.State = SectorSealed
+		copy(info.CommD[:], C.GoBytes(unsafe.Pointer(&resPtr.comm_d[0]), 32))
+		copy(info.CommR[:], C.GoBytes(unsafe.Pointer(&resPtr.comm_r[0]), 32))
+		copy(info.CommRStar[:], C.GoBytes(unsafe.Pointer(&resPtr.comm_r_star[0]), 32))
+
+		ps, err := goPieceInfos((*C.FFIPieceMetadata)(unsafe.Pointer(resPtr.pieces_ptr)), resPtr.pieces_len)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to marshal from string to cid")
+		}
+		info.Pieces = ps
+	default:
+		return nil, errors.New("unexpected seal status")
+	}
+
+	return info, nil
+}
+
+// stagedSectorPieces returns the pieces known to be added to the sector
+// with the given id, which is not yet sealed.
+func (sb *RustSectorBuilder) stagedSectorPieces(sectorID uint64) []*PieceInfo {
+	sb.stagedPiecesLk.Lock()
+	defer sb.stagedPiecesLk.Unlock()
+
+	return append([]*PieceInfo(nil), sb.stagedPieces[sectorID]...)
+}
+
+// ListSectors describes every sector managed by the sector builder, ordered
+// by sector id. Sectors not yet sealed only list the pieces added since the
+// sector builder was created.
+//
+// rust-fil-proofs cannot list its sealed sectors, so the sector ids up to the
+// last one used when the sector builder was created or staged since are
+// looked up one by one, then those after them until one is not found, as
+// sector ids are handed out in order.
+//
+// TODO: list sectors in one call once rust-fil-proofs can.
+func (sb *RustSectorBuilder) ListSectors() ([]*SectorInfo, error) {
+	staged, err := sb.stagedSectors()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get staged sectors")
+	}
+
+	last := sb.lastUsedSectorID
+	for _, m := range staged {
+		if m.sectorID > last {
+			last = m.sectorID
+		}
+	}
+
+	var infos []*SectorInfo
+	for sectorID := uint64(1); ; sectorID++ {
+		info, err := sb.sectorInfo(sectorID)
+		if err != nil {
+			if sectorID > last {
+				break
+			}
+			continue
+		}
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+// SectorStatus describes the sector with the given id.
+func (sb *RustSectorBuilder) SectorStatus(sectorID uint64) (*SectorInfo, error) {
+	info, err := sb.sectorInfo(sectorID)
+	if err != nil {
+		log.Debugf("failed to get status of sector %d: %s", sectorID, err)
+		return nil, ErrSectorNotFound
+	}
+
+	return info, nil
+}
+
 // SectorSealResults returns an unbuffered channel that is sent a value whenever
 // sealing completes.
 func (sb *RustSectorBuilder) SectorSealResults() <-chan SectorSealResult {
@@ -308,6 +577,7 @@ func (sb *RustSectorBuilder) Close() error {
 // GeneratePoST produces a proof-of-spacetime for the provided commitment replicas.
 func (sb *RustSectorBuilder) GeneratePoST(req GeneratePoSTRequest) (GeneratePoSTResponse, error) {
 	defer elapsed("GeneratePoST")()
+	defer postDuration.ObserveDuration(time.Now())
 
 	// flattening the byte slice makes it easier to copy into the C heap
 	flattened := make([]byte, 32*len(req.CommRs))
@@ -340,6 +610,16 @@ func (sb *RustSectorBuilder) GeneratePoST(req GeneratePoSTRequest) (GeneratePoST
 	}, nil
 }
 
+// GeneratePieceInclusionProof proves that a piece lies inside its sector. It
+// always fails with proofs.ErrPieceInclusionProofsUnsupported, as the proofs
+// of package proofs would not match the CommD of sectors sealed by
+// rust-fil-proofs.
+//
+// TODO: call into rust-fil-proofs once it exposes piece inclusion proofs.
+func (sb *RustSectorBuilder) GeneratePieceInclusionProof(pieceCid cid.Cid) (*PieceInclusionProof, error) {
+	return nil, proofs.ErrPieceInclusionProofsUnsupported
+}
+
 // goUint64s accepts a pointer to a C-allocated uint64 and a size and produces
 // a Go-managed slice of uint64. Note that this function copies values into the
 // Go heap from C.
@@ -0,0 +1,195 @@
+package sectorbuilder
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+)
+
+// sealSchedulerIdleInterval is how often a SealScheduler whose policy
+// disables automatic sealing checks whether it was enabled.
+const sealSchedulerIdleInterval = time.Minute
+
+// sealSchedulerMaxBackoff bounds how many check intervals a SealScheduler
+// waits after consecutive failed checks.
+const sealSchedulerMaxBackoff = 8
+
+// SealPolicy decides when a SealScheduler seals staged sectors.
+type SealPolicy struct {
+	// Interval is how often staged sectors are checked. Zero disables
+	// automatic sealing.
+	Interval time.Duration
+
+	// FillPercent seals a staged sector once its pieces take up this percent
+	// of its capacity, and MaxWait once it has held pieces this long. A
+	// sector is sealed when it meets either rule. With neither set, every
+	// non-empty staged sector is sealed at each check.
+	FillPercent uint
+	MaxWait     time.Duration
+
+	// MaxConcurrentSeals limits how many sectors seal at once. Zero is no
+	// limit.
+	MaxConcurrentSeals uint
+}
+
+// SealScheduler seals the staged sectors of a SectorBuilder according to a
+// SealPolicy, and on demand.
+type SealScheduler struct {
+	sb     SectorBuilder
+	policy func() SealPolicy
+	now    func() time.Time
+
+	// lk protects firstSeen.
+	lk sync.Mutex
+
+	// firstSeen records when each staged sector was first seen holding
+	// pieces, and is used to apply SealPolicy.MaxWait.
+	firstSeen map[uint64]time.Time
+}
+
+// NewSealScheduler returns a SealScheduler sealing the sectors of sb. policy
+// is called before every check, so that policy changes apply without a
+// restart.
+func NewSealScheduler(sb SectorBuilder, policy func() SealPolicy) *SealScheduler {
+	return &SealScheduler{
+		sb:        sb,
+		policy:    policy,
+		now:       time.Now,
+		firstSeen: make(map[uint64]time.Time),
+	}
+}
+
+// Run checks staged sectors on the policy's interval until ctx is done.
+// Failed checks are logged and retried, waiting longer after each
+// consecutive failure.
+func (s *SealScheduler) Run(ctx context.Context) {
+	failures := 0
+	for {
+		interval := s.policy().Interval
+		wait := interval
+		if interval == 0 {
+			wait = sealSchedulerIdleInterval
+		} else if failures > 0 {
+			wait = interval * time.Duration(backoffFactor(failures))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		if interval == 0 || s.policy().Interval == 0 {
+			continue
+		}
+
+		log.Info("auto-seal has been triggered")
+		if err := s.SealDue(ctx); err != nil {
+			failures++
+			log.Errorf("failed to seal staged sectors (%d consecutive failures): %s", failures, err)
+			continue
+		}
+		failures = 0
+	}
+}
+
+// SealDue seals the staged sectors that are due under the policy, up to the
+// policy's limit of concurrent seals.
+func (s *SealScheduler) SealDue(ctx context.Context) error {
+	policy := s.policy()
+
+	infos, err := s.sb.ListSectors()
+	if err != nil {
+		return errors.Wrap(err, "failed to list sectors")
+	}
+	maxBytes, err := s.sb.GetMaxUserBytesPerStagedSector()
+	if err != nil {
+		return errors.Wrap(err, "failed to get sector size")
+	}
+
+	sealing := uint(0)
+	var due []uint64
+	now := s.now()
+
+	s.lk.Lock()
+	staged := make(map[uint64]bool)
+	for _, info := range infos {
+		switch info.State {
+		case SectorSealing:
+			sealing++
+		case SectorStaged:
+			if len(info.Pieces) == 0 {
+				continue
+			}
+			staged[info.SectorID] = true
+			first, ok := s.firstSeen[info.SectorID]
+			if !ok {
+				first = now
+				s.firstSeen[info.SectorID] = now
+			}
+			if isSealDue(policy, info.UserBytes(), maxBytes, now.Sub(first)) {
+				due = append(due, info.SectorID)
+			}
+		}
+	}
+	for id := range s.firstSeen {
+		if !staged[id] {
+			delete(s.firstSeen, id)
+		}
+	}
+	s.lk.Unlock()
+
+	// Keep going past sectors that fail to seal, so that one bad sector does
+	// not hold up the others, and report the first failure.
+	var firstErr error
+	for _, id := range due {
+		if policy.MaxConcurrentSeals > 0 && sealing >= policy.MaxConcurrentSeals {
+			log.Infof("not sealing sector %d: %d sectors are already sealing", id, sealing)
+			break
+		}
+		if err := s.sb.SealSector(ctx, id); err != nil {
+			log.Errorf("failed to seal sector %d: %s", id, err)
+			if firstErr == nil {
+				firstErr = errors.Wrapf(err, "failed to seal sector %d", id)
+			}
+			continue
+		}
+		sealing++
+	}
+
+	return firstErr
+}
+
+// SealNow seals the sector with the given id, or every non-empty staged
+// sector if sectorID is nil, regardless of the policy. Sealing a sector
+// whose sealing failed seals it again if the SectorBuilder can.
+func (s *SealScheduler) SealNow(ctx context.Context, sectorID *uint64) error {
+	if sectorID == nil {
+		return s.sb.SealAllStagedSectors(ctx)
+	}
+	return s.sb.SealSector(ctx, *sectorID)
+}
+
+// isSealDue returns whether a staged sector holding userBytes of maxBytes,
+// which has held pieces for waited, is due to be sealed under policy.
+func isSealDue(policy SealPolicy, userBytes, maxBytes uint64, waited time.Duration) bool {
+	if policy.FillPercent == 0 && policy.MaxWait == 0 {
+		return true
+	}
+	if policy.FillPercent > 0 && userBytes*100 >= uint64(policy.FillPercent)*maxBytes {
+		return true
+	}
+	return policy.MaxWait > 0 && waited >= policy.MaxWait
+}
+
+// backoffFactor returns how many check intervals to wait after the given
+// number of consecutive failed checks.
+func backoffFactor(failures int) int {
+	factor := 1
+	for i := 1; i < failures && factor < sealSchedulerMaxBackoff; i++ {
+		factor *= 2
+	}
+	return factor
+}
@@ -0,0 +1,142 @@
+package sectorbuilder
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// schedulerTestSectorBuilder holds a fixed list of sectors and records the
+// sectors it is asked to seal.
+type schedulerTestSectorBuilder struct {
+	SectorBuilder
+
+	sectors   []*SectorInfo
+	failSeals map[uint64]bool
+	sealed    []uint64
+	sealedAll bool
+}
+
+func (sb *schedulerTestSectorBuilder) ListSectors() ([]*SectorInfo, error) {
+	return sb.sectors, nil
+}
+
+func (sb *schedulerTestSectorBuilder) GetMaxUserBytesPerStagedSector() (uint64, error) {
+	return 100, nil
+}
+
+func (sb *schedulerTestSectorBuilder) SealSector(ctx context.Context, sectorID uint64) error {
+	if sb.failSeals[sectorID] {
+		return errors.New("sealing failed")
+	}
+	sb.sealed = append(sb.sealed, sectorID)
+	return nil
+}
+
+func (sb *schedulerTestSectorBuilder) SealAllStagedSectors(ctx context.Context) error {
+	sb.sealedAll = true
+	return nil
+}
+
+func stagedTestSector(sectorID uint64, size uint64) *SectorInfo {
+	return &SectorInfo{
+		SectorID: sectorID,
+		State:    SectorStaged,
+		Pieces:   []*PieceInfo{{Ref: types.SomeCid(), Size: size}},
+	}
+}
+
+func TestSealScheduler(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("seals every non-empty staged sector without rules", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		sb := &schedulerTestSectorBuilder{sectors: []*SectorInfo{
+			stagedTestSector(1, 10),
+			{SectorID: 2, State: SectorStaged},
+			{SectorID: 3, State: SectorSealed},
+		}}
+		s := NewSealScheduler(sb, func() SealPolicy { return SealPolicy{} })
+
+		require.NoError(s.SealDue(ctx))
+		assert.Equal([]uint64{1}, sb.sealed)
+	})
+
+	t.Run("seals sectors once full enough or waited long enough", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		sb := &schedulerTestSectorBuilder{sectors: []*SectorInfo{
+			stagedTestSector(1, 80),
+			stagedTestSector(2, 10),
+		}}
+		s := NewSealScheduler(sb, func() SealPolicy {
+			return SealPolicy{FillPercent: 80, MaxWait: time.Hour}
+		})
+		now := time.Unix(1000, 0)
+		s.now = func() time.Time { return now }
+
+		require.NoError(s.SealDue(ctx))
+		assert.Equal([]uint64{1}, sb.sealed)
+
+		// Sector 2 has held its pieces since the first check.
+		sb.sectors = sb.sectors[1:]
+		now = now.Add(time.Hour)
+		require.NoError(s.SealDue(ctx))
+		assert.Equal([]uint64{1, 2}, sb.sealed)
+	})
+
+	t.Run("limits concurrent seals", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		sb := &schedulerTestSectorBuilder{sectors: []*SectorInfo{
+			{SectorID: 1, State: SectorSealing},
+			stagedTestSector(2, 10),
+			stagedTestSector(3, 10),
+		}}
+		s := NewSealScheduler(sb, func() SealPolicy { return SealPolicy{MaxConcurrentSeals: 2} })
+
+		require.NoError(s.SealDue(ctx))
+		assert.Equal([]uint64{2}, sb.sealed)
+	})
+
+	t.Run("keeps sealing past sectors that fail", func(t *testing.T) {
+		assert := assert.New(t)
+
+		sb := &schedulerTestSectorBuilder{
+			sectors:   []*SectorInfo{stagedTestSector(1, 10), stagedTestSector(2, 10)},
+			failSeals: map[uint64]bool{1: true},
+		}
+		s := NewSealScheduler(sb, func() SealPolicy { return SealPolicy{} })
+
+		err := s.SealDue(ctx)
+		assert.Error(err)
+		assert.Contains(err.Error(), "sector 1")
+		assert.Equal([]uint64{2}, sb.sealed)
+	})
+
+	t.Run("seals on demand", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		sb := &schedulerTestSectorBuilder{}
+		s := NewSealScheduler(sb, func() SealPolicy { return SealPolicy{} })
+
+		sectorID := uint64(7)
+		require.NoError(s.SealNow(ctx, &sectorID))
+		assert.Equal([]uint64{7}, sb.sealed)
+		assert.False(sb.sealedAll)
+
+		require.NoError(s.SealNow(ctx, nil))
+		assert.True(sb.sealedAll)
+	})
+}
@@ -0,0 +1,279 @@
+package sectorbuilder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+)
+
+// StorageRole is what a storage path holds.
+type StorageRole string
+
+const (
+	// StorageStaging paths hold staged sectors.
+	StorageStaging = StorageRole("staging")
+
+	// StorageSealed paths hold sealed sectors.
+	StorageSealed = StorageRole("sealed")
+
+	// StorageBoth paths hold staged and sealed sectors.
+	StorageBoth = StorageRole("both")
+)
+
+// ParseStorageRole parses a role name.
+func ParseStorageRole(s string) (StorageRole, error) {
+	switch r := StorageRole(s); r {
+	case StorageStaging, StorageSealed, StorageBoth:
+		return r, nil
+	default:
+		return "", fmt.Errorf("unknown storage role %q, expected staging, sealed or both", s)
+	}
+}
+
+// holds returns whether paths with role r hold sectors with role want.
+func (r StorageRole) holds(want StorageRole) bool {
+	return r == want || r == StorageBoth
+}
+
+// StoragePath is a directory sectors are stored in.
+type StoragePath struct {
+	Path string
+	Role StorageRole
+
+	// Weight scales how much new sectors favor the path. Zero stops new
+	// sectors from being placed there, to drain it before detaching it.
+	Weight uint
+
+	// MaxBytes, if not zero, is the most bytes sectors may take up in the
+	// path.
+	MaxBytes uint64
+}
+
+// StoragePathUsage describes how much of a storage path is used.
+type StoragePathUsage struct {
+	StoragePath
+
+	// UsedBytes is the size of the files in the path.
+	UsedBytes uint64
+
+	// FreeBytes is how many more bytes sectors can take up in the path,
+	// bounded by both MaxBytes and the space left on its filesystem.
+	FreeBytes uint64
+}
+
+// SectorStorage places new sectors in the storage path with the most free
+// space, scaled by weight, of those holding their role.
+type SectorStorage struct {
+	// lk protects paths.
+	lk    sync.Mutex
+	paths []StoragePath
+
+	// freeDiskSpace returns the bytes available on the filesystem holding a
+	// path.
+	freeDiskSpace func(path string) (uint64, error)
+}
+
+// NewSectorStorage returns a SectorStorage storing sectors in paths.
+func NewSectorStorage(paths []StoragePath) *SectorStorage {
+	return &SectorStorage{
+		paths:         append([]StoragePath(nil), paths...),
+		freeDiskSpace: freeDiskSpace,
+	}
+}
+
+// Paths returns the storage paths.
+func (s *SectorStorage) Paths() []StoragePath {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return append([]StoragePath(nil), s.paths...)
+}
+
+// Usage describes how much of each storage path is used.
+func (s *SectorStorage) Usage() ([]*StoragePathUsage, error) {
+	var usages []*StoragePathUsage
+	for _, p := range s.Paths() {
+		u, err := s.usage(p)
+		if err != nil {
+			return nil, err
+		}
+		usages = append(usages, u)
+	}
+	return usages, nil
+}
+
+// Attach adds a storage path, creating its directory if needed.
+func (s *SectorStorage) Attach(p StoragePath) error {
+	if _, err := ParseStorageRole(string(p.Role)); err != nil {
+		return err
+	}
+	path, err := filepath.Abs(p.Path)
+	if err != nil {
+		return err
+	}
+	p.Path = path
+
+	if err := os.MkdirAll(p.Path, 0755); err != nil {
+		return errors.Wrapf(err, "failed to create storage path %s", p.Path)
+	}
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	for _, existing := range s.paths {
+		if existing.Path == p.Path {
+			return fmt.Errorf("storage path %s is already attached", p.Path)
+		}
+	}
+	s.paths = append(s.paths, p)
+	return nil
+}
+
+// Detach removes an empty storage path. Storage must remain for both staged
+// and sealed sectors.
+func (s *SectorStorage) Detach(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	i := -1
+	for j, p := range s.paths {
+		if p.Path == path {
+			i = j
+		}
+	}
+	if i < 0 {
+		return fmt.Errorf("storage path %s is not attached", path)
+	}
+
+	used, err := dirBytes(path)
+	if err != nil {
+		return err
+	}
+	if used > 0 {
+		return fmt.Errorf("storage path %s still holds %d bytes of sectors", path, used)
+	}
+
+	rest := append(append([]StoragePath(nil), s.paths[:i]...), s.paths[i+1:]...)
+	for _, role := range []StorageRole{StorageStaging, StorageSealed} {
+		if !hasRole(rest, role) {
+			return fmt.Errorf("storage path %s is the last to hold %s sectors", path, role)
+		}
+	}
+	s.paths = rest
+	return nil
+}
+
+// Place returns the storage path a new sector with the given role and size
+// is stored in.
+func (s *SectorStorage) Place(role StorageRole, sectorBytes uint64) (string, error) {
+	var best string
+	var bestScore float64
+	for _, p := range s.Paths() {
+		if !p.Role.holds(role) || p.Weight == 0 {
+			continue
+		}
+		u, err := s.usage(p)
+		if err != nil {
+			log.Warningf("skipping storage path %s: %s", p.Path, err)
+			continue
+		}
+		if u.FreeBytes < sectorBytes {
+			continue
+		}
+		if score := float64(u.FreeBytes) * float64(p.Weight); best == "" || score > bestScore {
+			best, bestScore = p.Path, score
+		}
+	}
+
+	if best == "" {
+		return "", fmt.Errorf("no %s storage path has %d bytes free", role, sectorBytes)
+	}
+	return best, nil
+}
+
+// FreeBytes returns the most bytes a new sector with the given role can take
+// up in any storage path.
+func (s *SectorStorage) FreeBytes(role StorageRole) (uint64, error) {
+	var most uint64
+	for _, p := range s.Paths() {
+		if !p.Role.holds(role) || p.Weight == 0 {
+			continue
+		}
+		u, err := s.usage(p)
+		if err != nil {
+			return 0, err
+		}
+		if u.FreeBytes > most {
+			most = u.FreeBytes
+		}
+	}
+	return most, nil
+}
+
+func (s *SectorStorage) usage(p StoragePath) (*StoragePathUsage, error) {
+	used, err := dirBytes(p.Path)
+	if err != nil {
+		return nil, err
+	}
+	free, err := s.freeDiskSpace(p.Path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get free space of %s", p.Path)
+	}
+
+	if p.MaxBytes > 0 {
+		left := uint64(0)
+		if used < p.MaxBytes {
+			left = p.MaxBytes - used
+		}
+		if left < free {
+			free = left
+		}
+	}
+
+	return &StoragePathUsage{StoragePath: p, UsedBytes: used, FreeBytes: free}, nil
+}
+
+func hasRole(paths []StoragePath, role StorageRole) bool {
+	for _, p := range paths {
+		if p.Role.holds(role) {
+			return true
+		}
+	}
+	return false
+}
+
+// dirBytes returns the size of the files under dir.
+func dirBytes(dir string) (uint64, error) {
+	var total uint64
+	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			total += uint64(info.Size())
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to measure %s", dir)
+	}
+	return total, nil
+}
+
+// freeDiskSpace returns the bytes available to unprivileged users on the
+// filesystem holding path.
+func freeDiskSpace(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,153 @@
+package sectorbuilder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+)
+
+// newTestStorage returns a SectorStorage whose paths are fresh directories
+// under a temporary directory, with free space reported by free.
+func newTestStorage(t *testing.T, free map[string]uint64, paths ...StoragePath) (*SectorStorage, string) {
+	root, err := ioutil.TempDir("", "sectorstorage")
+	require.NoError(t, err)
+
+	for i := range paths {
+		paths[i].Path = filepath.Join(root, paths[i].Path)
+		require.NoError(t, os.MkdirAll(paths[i].Path, 0755))
+	}
+
+	s := NewSectorStorage(paths)
+	s.freeDiskSpace = func(path string) (uint64, error) {
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return 0, err
+		}
+		return free[rel], nil
+	}
+	return s, root
+}
+
+func TestSectorStoragePlace(t *testing.T) {
+	t.Run("places sectors by free space scaled by weight", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		free := map[string]uint64{"a": 100, "b": 300}
+		s, root := newTestStorage(t, free,
+			StoragePath{Path: "a", Role: StorageBoth, Weight: 1},
+			StoragePath{Path: "b", Role: StorageBoth, Weight: 1},
+		)
+		defer os.RemoveAll(root) // nolint: errcheck
+
+		path, err := s.Place(StorageStaging, 10)
+		require.NoError(err)
+		assert.Equal(filepath.Join(root, "b"), path)
+
+		free["b"] = 50
+		path, err = s.Place(StorageStaging, 10)
+		require.NoError(err)
+		assert.Equal(filepath.Join(root, "a"), path)
+
+		_, err = s.Place(StorageStaging, 200)
+		assert.Error(err)
+	})
+
+	t.Run("favors heavier paths and skips weight 0", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		free := map[string]uint64{"a": 100, "b": 300, "c": 1000}
+		s, root := newTestStorage(t, free,
+			StoragePath{Path: "a", Role: StorageBoth, Weight: 4},
+			StoragePath{Path: "b", Role: StorageBoth, Weight: 1},
+			StoragePath{Path: "c", Role: StorageBoth, Weight: 0},
+		)
+		defer os.RemoveAll(root) // nolint: errcheck
+
+		path, err := s.Place(StorageSealed, 10)
+		require.NoError(err)
+		assert.Equal(filepath.Join(root, "a"), path)
+
+		most, err := s.FreeBytes(StorageSealed)
+		require.NoError(err)
+		assert.Equal(uint64(300), most)
+	})
+
+	t.Run("limits paths to their max bytes", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		free := map[string]uint64{"a": 1000, "b": 500}
+		s, root := newTestStorage(t, free,
+			StoragePath{Path: "a", Role: StorageBoth, Weight: 1, MaxBytes: 100},
+			StoragePath{Path: "b", Role: StorageBoth, Weight: 1},
+		)
+		defer os.RemoveAll(root) // nolint: errcheck
+
+		require.NoError(ioutil.WriteFile(filepath.Join(root, "a", "sector"), make([]byte, 40), 0644))
+
+		usages, err := s.Usage()
+		require.NoError(err)
+		require.Len(usages, 2)
+		assert.Equal(uint64(40), usages[0].UsedBytes)
+		assert.Equal(uint64(60), usages[0].FreeBytes)
+
+		path, err := s.Place(StorageStaging, 10)
+		require.NoError(err)
+		assert.Equal(filepath.Join(root, "b"), path)
+	})
+
+	t.Run("only places sectors in paths holding their role", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		free := map[string]uint64{"staging": 100, "sealed": 300}
+		s, root := newTestStorage(t, free,
+			StoragePath{Path: "staging", Role: StorageStaging, Weight: 1},
+			StoragePath{Path: "sealed", Role: StorageSealed, Weight: 1},
+		)
+		defer os.RemoveAll(root) // nolint: errcheck
+
+		path, err := s.Place(StorageStaging, 10)
+		require.NoError(err)
+		assert.Equal(filepath.Join(root, "staging"), path)
+
+		path, err = s.Place(StorageSealed, 10)
+		require.NoError(err)
+		assert.Equal(filepath.Join(root, "sealed"), path)
+	})
+}
+
+func TestSectorStorageAttachDetach(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	free := map[string]uint64{"staging": 100, "sealed": 100, "new": 100}
+	s, root := newTestStorage(t, free,
+		StoragePath{Path: "staging", Role: StorageStaging, Weight: 1},
+		StoragePath{Path: "sealed", Role: StorageSealed, Weight: 1},
+	)
+	defer os.RemoveAll(root) // nolint: errcheck
+
+	newPath := filepath.Join(root, "new")
+	assert.Error(s.Attach(StoragePath{Path: newPath, Role: "archive", Weight: 1}))
+	require.NoError(s.Attach(StoragePath{Path: newPath, Role: StorageBoth, Weight: 1}))
+	assert.Error(s.Attach(StoragePath{Path: newPath, Role: StorageBoth, Weight: 1}))
+	assert.Len(s.Paths(), 3)
+
+	// Sectors must be moved off a path before it is detached.
+	require.NoError(ioutil.WriteFile(filepath.Join(root, "staging", "sector"), []byte("data"), 0644))
+	assert.Error(s.Detach(filepath.Join(root, "staging")))
+
+	require.NoError(s.Detach(filepath.Join(root, "sealed")))
+	assert.Len(s.Paths(), 2)
+
+	// The new path is the last one holding sealed sectors.
+	assert.Error(s.Detach(newPath))
+	assert.Error(s.Detach(filepath.Join(root, "missing")))
+}
@@ -21,3 +21,10 @@ func (fp FakeVerifier) VerifyPoST(VerifyPoSTRequest) (VerifyPoSTResponse, error)
 func (FakeVerifier) VerifySeal(VerifySealRequest) (VerifySealResponse, error) {
 	panic("boom")
 }
+
+// VerifyPieceInclusionProof finds every proof valid or invalid alike, as the
+// verifier was configured, so that tests of deal verification control the
+// outcome without building real proofs.
+func (fp FakeVerifier) VerifyPieceInclusionProof(VerifyPieceInclusionProofRequest) (VerifyPieceInclusionProofResponse, error) {
+	return VerifyPieceInclusionProofResponse{IsValid: fp.verifyPostValid}, fp.verifyPostError
+}
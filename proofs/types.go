@@ -29,6 +29,10 @@ type CommR [CommitmentBytesLen]byte
 // sector sealing (PoRep) process.
 type CommD [CommitmentBytesLen]byte
 
+// CommP is the merkle root of a piece's data. A piece inclusion proof shows
+// that the piece with a given CommP lies inside a sector with a given CommD.
+type CommP [CommitmentBytesLen]byte
+
 // CommRStar is a hash of intermediate layers. It is an output of the sector
 // sealing (PoRep) process.
 type CommRStar [CommitmentBytesLen]byte
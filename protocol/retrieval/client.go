@@ -36,6 +36,31 @@ func NewClient(nd clientNode) *Client {
 	}
 }
 
+// QueryPiece asks a miner whether it can serve a piece, and at what price.
+func (sc *Client) QueryPiece(ctx context.Context, minerPeerID peer.ID, pieceCID cid.Cid) (*QueryPieceResponse, error) {
+	s, err := sc.node.Host().NewStream(ctx, minerPeerID, retrievalQueryProtocol)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create stream to retrieval miner")
+	}
+
+	defer s.Close() // nolint: errcheck
+
+	req := QueryPieceRequest{
+		PieceRef: pieceCID,
+	}
+
+	if err := cbu.NewMsgWriter(s).WriteMsg(&req); err != nil {
+		return nil, errors.Wrap(err, "failed to write query message to stream")
+	}
+
+	var res QueryPieceResponse
+	if err := cbu.NewMsgReader(s).ReadMsg(&res); err != nil {
+		return nil, errors.Wrap(err, "failed to read query response from stream")
+	}
+
+	return &res, nil
+}
+
 // RetrievePiece connects to a miner and transfers a piece of content.
 func (sc *Client) RetrievePiece(ctx context.Context, minerPeerID peer.ID, pieceCID cid.Cid) (io.ReadCloser, error) {
 	s, err := sc.node.Host().NewStream(ctx, minerPeerID, retrievalFreeProtocol)
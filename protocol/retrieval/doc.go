@@ -5,4 +5,11 @@
 // 3. MINER sends CLIENT a RetrievePieceResponse with Status set to Success if it has PieceRef in a sealed sector
 // 4. MINER sends CLIENT RetrievePieceChunks until all data associated with PieceRef has been sent
 // 5. CLIENT reads RetrievePieceChunk from stream until EOF and then closes stream
+//
+// Before retrieving, a CLIENT may ask a MINER whether it can serve a piece:
+//
+// 1. CLIENT opens /fil/retrieval/qry/0.0.0 stream to MINER
+// 2. CLIENT sends MINER a QueryPieceRequest
+// 3. MINER sends CLIENT a QueryPieceResponse with Status set to Available if it has PieceRef in a sealed sector
+// 4. CLIENT reads the piece's Size and PricePerByte from the QueryPieceResponse and then closes stream
 package retrieval
@@ -1,25 +1,33 @@
 package retrieval
 
 import (
+	"io"
 	"io/ioutil"
 
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	inet "gx/ipfs/QmTGxDz2CjBucFzPNTiWwzQmTWdrBnzqbqrMucDYMsjuPb/go-libp2p-net"
 	"gx/ipfs/QmZNkThpqfVXs9GNbexPrfBbXSLNYeKrE7jwFM2oqHbyqN/go-libp2p-protocol"
 	logging "gx/ipfs/QmbkT7eMTyXfpeyB3ZMxxcxg7XH8t6uXp49jqzz4HB7BGF/go-log"
 	host "gx/ipfs/Qmd52WKRSwrBK5gUaJKawryZQ5by6UbNB8KVW2Zy6JtbyW/go-libp2p-host"
 
 	cbu "github.com/filecoin-project/go-filecoin/cborutil"
-	"github.com/filecoin-project/go-filecoin/proofs/sectorbuilder"
+	"github.com/filecoin-project/go-filecoin/types"
 )
 
 var log = logging.Logger("/fil/retrieval")
 
 const retrievalFreeProtocol = protocol.ID("/fil/retrieval/free/0.0.0")
+const retrievalQueryProtocol = protocol.ID("/fil/retrieval/qry/0.0.0")
 
 // TODO: better name
 type minerNode interface {
 	Host() host.Host
-	SectorBuilder() sectorbuilder.SectorBuilder
+	// ReadSealedPiece returns a reader for the piece with the given cid, read
+	// from the sealed sectors of the node's miners.
+	ReadSealedPiece(pieceRef cid.Cid) (io.Reader, error)
+	// SealedPieceSize returns the size of the piece with the given cid, and
+	// whether the node holds it in a sealed sector.
+	SealedPieceSize(pieceRef cid.Cid) (uint64, bool)
 }
 
 // Miner serves requests for pieces from RetrievalClients.
@@ -34,10 +42,35 @@ func NewMiner(nd minerNode) *Miner {
 	}
 
 	nd.Host().SetStreamHandler(retrievalFreeProtocol, rm.handleRetrievePieceForFree)
+	nd.Host().SetStreamHandler(retrievalQueryProtocol, rm.handleQueryPiece)
 
 	return rm
 }
 
+func (rm *Miner) handleQueryPiece(s inet.Stream) {
+	defer s.Close() // nolint: errcheck
+
+	var req QueryPieceRequest
+	if err := cbu.NewMsgReader(s).ReadMsg(&req); err != nil {
+		log.Errorf("failed to read piece query: %s", err)
+		return
+	}
+
+	resp := QueryPieceResponse{Status: Unavailable}
+	if size, ok := rm.node.SealedPieceSize(req.PieceRef); ok {
+		// Pieces are only served by the free protocol for now.
+		resp = QueryPieceResponse{
+			Status:       Available,
+			Size:         size,
+			PricePerByte: types.ZeroAttoFIL,
+		}
+	}
+
+	if err := cbu.NewMsgWriter(s).WriteMsg(&resp); err != nil {
+		log.Warningf("failed to write query response for piece with CID %s: %s", req.PieceRef.String(), err)
+	}
+}
+
 func (rm *Miner) handleRetrievePieceForFree(s inet.Stream) {
 	defer s.Close() // nolint: errcheck
 
@@ -47,7 +80,7 @@ func (rm *Miner) handleRetrievePieceForFree(s inet.Stream) {
 		return
 	}
 
-	reader, err := rm.node.SectorBuilder().ReadPieceFromSealedSector(req.PieceRef)
+	reader, err := rm.node.ReadSealedPiece(req.PieceRef)
 	if err != nil {
 		log.Warningf("failed to obtain a reader for piece with CID %s: %s", req.PieceRef.String(), err)
 
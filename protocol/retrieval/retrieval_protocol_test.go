@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"testing"
 
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
 	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 
@@ -12,6 +13,7 @@ import (
 	"github.com/filecoin-project/go-filecoin/api"
 	"github.com/filecoin-project/go-filecoin/api/impl"
 	"github.com/filecoin-project/go-filecoin/node"
+	"github.com/filecoin-project/go-filecoin/protocol/retrieval"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
@@ -35,6 +37,29 @@ func TestRetrievalProtocolPieceNotFound(t *testing.T) {
 	require.Error(err)
 }
 
+func TestRetrievalQueryPieceNotFound(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	minerNode, clientNode, _, _ := configureMinerAndClient(t)
+
+	require.NoError(minerNode.StartMining(ctx))
+	defer minerNode.StopMining(ctx)
+
+	someRandomCid := types.NewCidForTestGetter()()
+
+	resp, err := clientNode.RetrievalClient.QueryPiece(ctx, minerNode.Host().ID(), someRandomCid)
+	require.NoError(err)
+	assert.Equal(retrieval.Unavailable, resp.Status)
+
+	// The client made no deals for the piece and nobody provides it.
+	providers, err := impl.New(clientNode).RetrievalClient().FindProviders(ctx, someRandomCid)
+	require.NoError(err)
+	assert.Empty(providers)
+}
+
 func retrievePieceBytes(ctx context.Context, retrievalClient api.RetrievalClient, data cid.Cid, addr address.Address) ([]byte, error) {
 	r, err := retrievalClient.RetrievePiece(ctx, data, addr)
 	if err != nil {
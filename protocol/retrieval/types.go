@@ -3,12 +3,16 @@ package retrieval
 import (
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
+
+	"github.com/filecoin-project/go-filecoin/types"
 )
 
 func init() {
 	cbor.RegisterCborType(RetrievePieceRequest{})
 	cbor.RegisterCborType(RetrievePieceResponse{})
 	cbor.RegisterCborType(RetrievePieceChunk{})
+	cbor.RegisterCborType(QueryPieceRequest{})
+	cbor.RegisterCborType(QueryPieceResponse{})
 }
 
 // RetrievePieceStatus communicates a successful (or failed) piece retrieval
@@ -40,3 +44,30 @@ type RetrievePieceResponse struct {
 type RetrievePieceChunk struct {
 	Data []byte
 }
+
+// QueryPieceStatus communicates whether a miner can serve a piece
+type QueryPieceStatus int
+
+const (
+	// QueryUnset is the default status
+	QueryUnset = QueryPieceStatus(iota)
+
+	// Unavailable indicates that the miner does not hold the piece
+	Unavailable
+
+	// Available indicates that the miner holds the piece in a sealed sector
+	Available
+)
+
+// QueryPieceRequest asks a retrieval miner whether it can serve a piece.
+type QueryPieceRequest struct {
+	PieceRef cid.Cid
+}
+
+// QueryPieceResponse tells a retrieval client whether, and at what price, a
+// miner can serve a piece.
+type QueryPieceResponse struct {
+	Status       QueryPieceStatus
+	Size         uint64
+	PricePerByte *types.AttoFIL
+}
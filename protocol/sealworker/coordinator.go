@@ -0,0 +1,530 @@
+package sealworker
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	dag "gx/ipfs/QmNRAuGmvnVw8urHkUZQirhu42VTiZjVWASa2aTznEMmpP/go-merkledag"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	bserv "gx/ipfs/QmZsGVGCqMCNzHLNMB6q4F6yyvomqf1VxwhJwSfgo1NGaF/go-blockservice"
+	logging "gx/ipfs/QmbkT7eMTyXfpeyB3ZMxxcxg7XH8t6uXp49jqzz4HB7BGF/go-log"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/proofs"
+	"github.com/filecoin-project/go-filecoin/proofs/sectorbuilder"
+	"github.com/filecoin-project/go-filecoin/rpc"
+)
+
+var log = logging.Logger("sealworker")
+
+// maxTaskAttempts is how many times workers may fail to seal a sector
+// before the coordinator gives up on it.
+const maxTaskAttempts = 3
+
+// maxWorkerCapacity bounds the capacity a worker may report.
+const maxWorkerCapacity = 64
+
+// blockPageSize is the most blocks sent in a BlockPage.
+const blockPageSize = 64
+
+// CoordinatorConfig configures a Coordinator.
+type CoordinatorConfig struct {
+	MinerAddr       address.Address
+	SectorStoreType proofs.SectorStoreType
+
+	// BlockService holds the data of the pieces in staged sectors.
+	BlockService bserv.BlockService
+
+	// ReplicaDir is where replicas uploaded by workers are kept until they
+	// are imported.
+	ReplicaDir string
+
+	// Verifier checks the seal proofs of the sectors workers seal before
+	// their replicas are imported.
+	Verifier proofs.Verifier
+
+	// Import imports a replica sealed by a worker.
+	Import func(meta *sectorbuilder.SealedSectorMetadata, replicaPath string) error
+
+	// Failed is called when workers failed to seal a sector too many times.
+	Failed func(sectorID uint64, err error)
+}
+
+// Coordinator hands sectors to the seal workers connected to it.
+type Coordinator struct {
+	cfg CoordinatorConfig
+
+	lk      sync.Mutex
+	workers map[string]*worker
+	// conns maps the ids of the connections workers registered over to
+	// the workers. A worker acts only through its own connection.
+	conns map[string]*worker
+	tasks map[uint64]*task
+	// queue holds the ids of the sectors waiting for a worker, oldest first.
+	queue []uint64
+}
+
+// worker is a connected seal worker.
+type worker struct {
+	id       string
+	conn     string
+	capacity int
+	tasks    map[uint64]bool
+	send     chan *Task
+}
+
+// task is a sector handed to the coordinator for sealing.
+type task struct {
+	Task
+	worker   string
+	attempts int
+
+	// blocks caches the cids of the blocks of each piece's DAG.
+	blocks map[cid.Cid][]cid.Cid
+}
+
+// NewCoordinator returns a coordinator without workers or tasks.
+func NewCoordinator(cfg CoordinatorConfig) *Coordinator {
+	return &Coordinator{
+		cfg:     cfg,
+		workers: make(map[string]*worker),
+		conns:   make(map[string]*worker),
+		tasks:   make(map[uint64]*task),
+	}
+}
+
+// HasWorkers returns whether any worker is connected.
+func (c *Coordinator) HasWorkers() bool {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	return len(c.workers) > 0
+}
+
+// IsSealing returns whether the sector with the given id is queued or being
+// sealed by a worker.
+func (c *Coordinator) IsSealing(sectorID uint64) bool {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	_, ok := c.tasks[sectorID]
+	return ok
+}
+
+// Submit queues the exported sector with the given id and pieces for
+// sealing by a worker.
+func (c *Coordinator) Submit(sectorID uint64, pieces []*sectorbuilder.PieceInfo) error {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if _, ok := c.tasks[sectorID]; ok {
+		return fmt.Errorf("sector %d is already being sealed", sectorID)
+	}
+	c.tasks[sectorID] = &task{
+		Task: Task{
+			SectorID:        sectorID,
+			MinerAddr:       c.cfg.MinerAddr,
+			SectorStoreType: c.cfg.SectorStoreType,
+			Pieces:          pieces,
+		},
+		blocks: make(map[cid.Cid][]cid.Cid),
+	}
+	c.queue = append(c.queue, sectorID)
+	c.assign()
+	return nil
+}
+
+// assign hands queued tasks to the workers with the most free capacity.
+// Callers must hold lk.
+func (c *Coordinator) assign() {
+	for len(c.queue) > 0 {
+		var best *worker
+		for _, w := range c.workers {
+			free := w.capacity - len(w.tasks)
+			if free > 0 && (best == nil || free > best.capacity-len(best.tasks)) {
+				best = w
+			}
+		}
+		if best == nil {
+			return
+		}
+
+		t := c.tasks[c.queue[0]]
+		c.queue = c.queue[1:]
+		t.worker = best.id
+		best.tasks[t.SectorID] = true
+		// The send channel holds maxWorkerCapacity tasks, which bounds
+		// capacity, so this never blocks.
+		best.send <- &t.Task
+		log.Infof("handed sector %d to seal worker %s", t.SectorID, best.id)
+	}
+}
+
+// register connects a worker, sending it its tasks until ctx is done. The
+// worker is bound to the connection ctx belongs to, over which it must make
+// all its other calls.
+func (c *Coordinator) register(ctx context.Context, reg Registration) (<-chan *Task, error) {
+	if reg.WorkerID == "" {
+		return nil, errors.New("worker id is required")
+	}
+	conn, ok := rpc.ConnID(ctx)
+	if !ok {
+		return nil, errors.New("workers must connect over a websocket")
+	}
+
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if _, ok := c.workers[reg.WorkerID]; ok {
+		return nil, fmt.Errorf("a worker with id %s is already connected", reg.WorkerID)
+	}
+	if w, ok := c.conns[conn]; ok {
+		return nil, fmt.Errorf("connection is already registered as worker %s", w.id)
+	}
+	w := &worker{
+		id:       reg.WorkerID,
+		conn:     conn,
+		capacity: clampCapacity(reg.Capacity),
+		tasks:    make(map[uint64]bool),
+		send:     make(chan *Task, maxWorkerCapacity),
+	}
+	c.workers[w.id] = w
+	c.conns[conn] = w
+	log.Infof("seal worker %s connected with capacity %d", w.id, w.capacity)
+	c.assign()
+
+	go func() {
+		<-ctx.Done()
+		c.disconnect(w)
+	}()
+
+	return w.send, nil
+}
+
+// disconnect forgets a worker whose connection closed, and hands its tasks
+// to other workers.
+func (c *Coordinator) disconnect(w *worker) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	delete(c.workers, w.id)
+	delete(c.conns, w.conn)
+	close(w.send)
+
+	var requeued []uint64
+	for id := range w.tasks {
+		t := c.tasks[id]
+		t.worker = ""
+		requeued = append(requeued, id)
+		c.removeReplica(id)
+	}
+	sort.Slice(requeued, func(i, j int) bool { return requeued[i] < requeued[j] })
+	// Tasks of a dead worker go ahead of tasks that never started.
+	c.queue = append(requeued, c.queue...)
+	log.Warningf("seal worker %s disconnected, requeued %d sectors", w.id, len(requeued))
+	c.assign()
+}
+
+func (c *Coordinator) setCapacity(ctx context.Context, capacity int) error {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	w, err := c.connWorker(ctx)
+	if err != nil {
+		return err
+	}
+	w.capacity = clampCapacity(capacity)
+	c.assign()
+	return nil
+}
+
+// connWorker returns the worker registered over the connection the call
+// whose ctx is given was made over. Callers must hold lk.
+func (c *Coordinator) connWorker(ctx context.Context) (*worker, error) {
+	conn, ok := rpc.ConnID(ctx)
+	if !ok {
+		return nil, errors.New("workers must connect over a websocket")
+	}
+	w, ok := c.conns[conn]
+	if !ok {
+		return nil, errors.New("connection is not registered as a worker")
+	}
+	return w, nil
+}
+
+// workerTask returns the worker registered over the connection of ctx and
+// its task for the sector with the given id. Callers must hold lk.
+func (c *Coordinator) workerTask(ctx context.Context, sectorID uint64) (*worker, *task, error) {
+	w, err := c.connWorker(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	t, ok := c.tasks[sectorID]
+	if !ok || t.worker != w.id {
+		return nil, nil, fmt.Errorf("sector %d is not assigned to worker %s", sectorID, w.id)
+	}
+	return w, t, nil
+}
+
+func (c *Coordinator) pieceBlocks(ctx context.Context, sectorID uint64, piece cid.Cid, offset int) (*BlockPage, error) {
+	c.lk.Lock()
+	_, t, err := c.workerTask(ctx, sectorID)
+	if err != nil {
+		c.lk.Unlock()
+		return nil, err
+	}
+	cids, ok := t.blocks[piece]
+	c.lk.Unlock()
+
+	if !ok {
+		found := false
+		for _, p := range t.Pieces {
+			found = found || p.Ref.Equals(piece)
+		}
+		if !found {
+			return nil, fmt.Errorf("sector %d has no piece %s", sectorID, piece)
+		}
+
+		cids, err = c.dagCids(ctx, piece)
+		if err != nil {
+			return nil, err
+		}
+		c.lk.Lock()
+		t.blocks[piece] = cids
+		c.lk.Unlock()
+	}
+
+	if offset < 0 || offset > len(cids) {
+		return nil, fmt.Errorf("invalid offset %d", offset)
+	}
+	end := offset + blockPageSize
+	if end > len(cids) {
+		end = len(cids)
+	}
+
+	page := &BlockPage{}
+	for _, bc := range cids[offset:end] {
+		b, err := c.cfg.BlockService.GetBlock(ctx, bc)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get block %s", bc)
+		}
+		page.Blocks = append(page.Blocks, Block{Cid: bc, Data: b.RawData()})
+	}
+	if end < len(cids) {
+		page.Next = end
+	}
+	return page, nil
+}
+
+// dagCids returns the cids of the blocks of the DAG rooted at root.
+func (c *Coordinator) dagCids(ctx context.Context, root cid.Cid) ([]cid.Cid, error) {
+	dagService := dag.NewDAGService(c.cfg.BlockService)
+
+	cids := []cid.Cid{root}
+	seen := map[cid.Cid]bool{root: true}
+	for i := 0; i < len(cids); i++ {
+		nd, err := dagService.Get(ctx, cids[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get piece block %s", cids[i])
+		}
+		for _, l := range nd.Links() {
+			if !seen[l.Cid] {
+				seen[l.Cid] = true
+				cids = append(cids, l.Cid)
+			}
+		}
+	}
+	return cids, nil
+}
+
+func (c *Coordinator) writeReplica(ctx context.Context, sectorID uint64, offset int64, data []byte) error {
+	c.lk.Lock()
+	_, _, err := c.workerTask(ctx, sectorID)
+	c.lk.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// The write is not done under lk, so that uploads do not hold up other
+	// workers. Should the worker disconnect meanwhile, the write may land
+	// after its replica was removed, leaving a partial replica that the next
+	// worker handed the sector overwrites.
+	if offset < 0 {
+		return fmt.Errorf("invalid offset %d", offset)
+	}
+	f, err := os.OpenFile(c.replicaPath(sectorID), os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrap(err, "failed to open replica")
+	}
+	defer f.Close() // nolint: errcheck
+
+	if _, err := f.WriteAt(data, offset); err != nil {
+		return errors.Wrap(err, "failed to write replica")
+	}
+	return nil
+}
+
+func (c *Coordinator) complete(ctx context.Context, sectorID uint64, meta *sectorbuilder.SealedSectorMetadata, sealErr string) error {
+	c.lk.Lock()
+	w, t, err := c.workerTask(ctx, sectorID)
+	if err != nil {
+		c.lk.Unlock()
+		return err
+	}
+	workerID := w.id
+	delete(w.tasks, sectorID)
+	t.worker = ""
+	c.lk.Unlock()
+
+	if sealErr == "" && (meta == nil || meta.SectorID != sectorID) {
+		sealErr = "worker returned no metadata for the sector"
+	}
+	if sealErr == "" {
+		if err := c.verify(&t.Task, meta); err != nil {
+			sealErr = err.Error()
+		}
+	}
+	if sealErr == "" {
+		if err := c.cfg.Import(meta, c.replicaPath(sectorID)); err != nil {
+			sealErr = errors.Wrap(err, "failed to import replica").Error()
+		}
+	}
+
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	c.removeReplica(sectorID)
+
+	if sealErr == "" {
+		delete(c.tasks, sectorID)
+		log.Infof("seal worker %s sealed sector %d", workerID, sectorID)
+		c.assign()
+		return nil
+	}
+
+	t.attempts++
+	log.Warningf("seal worker %s failed to seal sector %d (attempt %d): %s", workerID, sectorID, t.attempts, sealErr)
+	if t.attempts >= maxTaskAttempts {
+		delete(c.tasks, sectorID)
+		go c.cfg.Failed(sectorID, fmt.Errorf("sealing failed on workers %d times: %s", t.attempts, sealErr))
+	} else {
+		c.queue = append(c.queue, sectorID)
+	}
+	c.assign()
+	return nil
+}
+
+// verify checks that meta describes the sector of task, sealed with a valid
+// proof, before its replica is imported.
+func (c *Coordinator) verify(task *Task, meta *sectorbuilder.SealedSectorMetadata) error {
+	if len(meta.Pieces) != len(task.Pieces) {
+		return fmt.Errorf("worker sealed %d pieces instead of %d", len(meta.Pieces), len(task.Pieces))
+	}
+	for i, p := range task.Pieces {
+		if meta.Pieces[i] == nil || !meta.Pieces[i].Ref.Equals(p.Ref) || meta.Pieces[i].Size != p.Size {
+			return fmt.Errorf("worker sealed other pieces than those of sector %d", task.SectorID)
+		}
+	}
+
+	res, err := c.cfg.Verifier.VerifySeal(proofs.VerifySealRequest{
+		CommD:     meta.CommD,
+		CommR:     meta.CommR,
+		CommRStar: meta.CommRStar,
+		Proof:     meta.Proof,
+		ProverID:  sectorbuilder.AddressToProverID(c.cfg.MinerAddr),
+		SectorID:  sectorbuilder.SectorIDToBytes(task.SectorID),
+		StoreType: c.cfg.SectorStoreType,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to verify seal proof")
+	}
+	if !res.IsValid {
+		return errors.New("worker returned an invalid seal proof")
+	}
+	return nil
+}
+
+func (c *Coordinator) replicaPath(sectorID uint64) string {
+	return filepath.Join(c.cfg.ReplicaDir, fmt.Sprintf("replica-%d", sectorID))
+}
+
+// removeReplica removes whatever was uploaded of the replica of a sector.
+func (c *Coordinator) removeReplica(sectorID uint64) {
+	if err := os.Remove(c.replicaPath(sectorID)); err != nil && !os.IsNotExist(err) {
+		log.Warningf("failed to remove replica of sector %d: %s", sectorID, err)
+	}
+}
+
+// cleanReplicaDir removes replicas left over from a previous run.
+func (c *Coordinator) cleanReplicaDir() error {
+	if err := os.MkdirAll(c.cfg.ReplicaDir, 0755); err != nil {
+		return errors.Wrap(err, "failed to create replica dir")
+	}
+	files, err := ioutil.ReadDir(c.cfg.ReplicaDir)
+	if err != nil {
+		return errors.Wrap(err, "failed to read replica dir")
+	}
+	for _, f := range files {
+		if err := os.Remove(filepath.Join(c.cfg.ReplicaDir, f.Name())); err != nil {
+			return errors.Wrap(err, "failed to remove old replica")
+		}
+	}
+	return nil
+}
+
+func clampCapacity(capacity int) int {
+	if capacity < 0 {
+		return 0
+	}
+	if capacity > maxWorkerCapacity {
+		return maxWorkerCapacity
+	}
+	return capacity
+}
+
+// Service is the JSON-RPC service seal workers call, registered under
+// Namespace.
+type Service struct {
+	c *Coordinator
+}
+
+// NewService returns the service workers call to seal c's sectors.
+func NewService(c *Coordinator) *Service {
+	return &Service{c: c}
+}
+
+// Work connects a worker and sends it tasks until it disconnects.
+func (s *Service) Work(ctx context.Context, reg Registration) (<-chan *Task, error) {
+	return s.c.register(ctx, reg)
+}
+
+// The methods below act for the worker that called Work over the same
+// connection, so that no worker can act on the sectors of another.
+
+// SetCapacity changes how many sectors the worker seals at once.
+func (s *Service) SetCapacity(ctx context.Context, capacity int) error {
+	return s.c.setCapacity(ctx, capacity)
+}
+
+// PieceBlocks returns the page starting at offset of the blocks of the DAG
+// of a piece in a sector assigned to the worker.
+func (s *Service) PieceBlocks(ctx context.Context, sectorID uint64, piece cid.Cid, offset int) (*BlockPage, error) {
+	return s.c.pieceBlocks(ctx, sectorID, piece, offset)
+}
+
+// WriteReplica writes data at offset into the replica of a sector assigned
+// to the worker.
+func (s *Service) WriteReplica(ctx context.Context, sectorID uint64, offset int64, data []byte) error {
+	return s.c.writeReplica(ctx, sectorID, offset, data)
+}
+
+// Complete reports the outcome of sealing a sector assigned to the worker:
+// the metadata of the sealed sector, whose replica the worker uploaded, or
+// why sealing failed. The seal proof in the metadata is verified before the
+// replica is imported.
+func (s *Service) Complete(ctx context.Context, sectorID uint64, meta *sectorbuilder.SealedSectorMetadata, sealErr string) error {
+	return s.c.complete(ctx, sectorID, meta, sealErr)
+}
@@ -0,0 +1,27 @@
+// Package sealworker lets a miner seal its sectors on other processes, and
+// other machines, than the one running its daemon. It works on high level
+// like this:
+//
+// 1. WORKER opens a JSON-RPC websocket to the DAEMON's seal worker address
+// 2. WORKER subscribes to SealWorker.Work with its id and capacity
+// 3. DAEMON exports a staged sector and sends WORKER a Task describing it
+// 4. WORKER fetches the blocks of the task's pieces with SealWorker.PieceBlocks
+// 5. WORKER seals the sector and uploads the replica with SealWorker.WriteReplica
+// 6. WORKER reports the SealedSectorMetadata with SealWorker.Complete
+// 7. DAEMON verifies the seal proof and imports the replica into its sector
+//    builder, which commits it
+//
+// Every call after Work acts for the worker that subscribed over the same
+// websocket, so a worker can only touch the sectors handed to it. The Rust
+// sector builder cannot yet export or import sectors, so only daemons running
+// with insecure proofs accept workers, which seal with an InsecureSealer.
+//
+// A worker never has more tasks than its capacity, which it can change with
+// SealWorker.SetCapacity. When a worker's websocket closes, its tasks are
+// handed to other workers. A task that fails on workers maxTaskAttempts times
+// is reported as a sealing failure, and sealing the sector again with
+// `miner seal-now` retries it.
+//
+// Workers connect to a multiaddr, so that the daemon and workers on a single
+// machine can talk over a unix socket, e.g. /unix/tmp/filecoin-seal.sock.
+package sealworker
@@ -0,0 +1,150 @@
+package sealworker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	bserv "gx/ipfs/QmZsGVGCqMCNzHLNMB6q4F6yyvomqf1VxwhJwSfgo1NGaF/go-blockservice"
+
+	"github.com/filecoin-project/go-filecoin/proofs/sectorbuilder"
+)
+
+// RustSealer seals sectors with a RustSectorBuilder of their own.
+type RustSealer struct{}
+
+var _ Sealer = RustSealer{}
+
+// Seal stages the pieces of task in a new sector builder, whose first sector
+// is the task's, and seals them.
+func (RustSealer) Seal(ctx context.Context, task *Task, bs bserv.BlockService, dir string) (*sectorbuilder.SealedSectorMetadata, string, error) {
+	if task.SectorID == 0 {
+		return nil, "", errors.New("invalid sector id 0")
+	}
+
+	sealedDir := filepath.Join(dir, "sealed")
+	stagingDir := filepath.Join(dir, "staging")
+	for _, d := range []string{sealedDir, stagingDir} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return nil, "", err
+		}
+	}
+
+	sb, err := sectorbuilder.NewRustSectorBuilder(sectorbuilder.RustSectorBuilderConfig{
+		BlockService:     bs,
+		LastUsedSectorID: task.SectorID - 1,
+		MetadataDir:      stagingDir,
+		MinerAddr:        task.MinerAddr,
+		SealedSectorDir:  sealedDir,
+		SectorStoreType:  task.SectorStoreType,
+		StagedSectorDir:  stagingDir,
+	})
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to create sector builder")
+	}
+	defer sb.Close() // nolint: errcheck
+
+	meta, err := sealTask(ctx, sb, task)
+	if err != nil {
+		return nil, "", err
+	}
+
+	files, err := ioutil.ReadDir(sealedDir)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to find replica")
+	}
+	if len(files) != 1 {
+		return nil, "", fmt.Errorf("expected one replica, found %d files", len(files))
+	}
+	return meta, filepath.Join(sealedDir, files[0].Name()), nil
+}
+
+// InsecureSealer seals sectors with a MemorySectorBuilder of their own, for
+// daemons running with insecure proofs. Its replicas hold the sector's
+// pieces unsealed.
+type InsecureSealer struct{}
+
+var _ Sealer = InsecureSealer{}
+
+// Seal stages the pieces of task in a new sector builder, whose first sector
+// is the task's, and seals them.
+func (InsecureSealer) Seal(ctx context.Context, task *Task, bs bserv.BlockService, dir string) (*sectorbuilder.SealedSectorMetadata, string, error) {
+	if task.SectorID == 0 {
+		return nil, "", errors.New("invalid sector id 0")
+	}
+
+	// Leave room for one more byte, so that the sector is not sealed as
+	// soon as its last piece fills it.
+	var size uint64
+	for _, p := range task.Pieces {
+		size += p.Size
+	}
+	sb := sectorbuilder.NewMemorySectorBuilder(sectorbuilder.MemorySectorBuilderConfig{
+		BlockService:      bs,
+		LastUsedSectorID:  task.SectorID - 1,
+		MinerAddr:         task.MinerAddr,
+		MaxBytesPerSector: size + 1,
+	})
+	defer sb.Close() // nolint: errcheck
+
+	meta, err := sealTask(ctx, sb, task)
+	if err != nil {
+		return nil, "", err
+	}
+
+	replicaPath := filepath.Join(dir, "replica")
+	replica, err := os.Create(replicaPath)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to create replica")
+	}
+	defer replica.Close() // nolint: errcheck
+
+	for _, p := range task.Pieces {
+		r, err := sb.ReadPieceFromSealedSector(p.Ref)
+		if err != nil {
+			return nil, "", errors.Wrapf(err, "failed to read piece %s", p.Ref)
+		}
+		if _, err := io.Copy(replica, r); err != nil {
+			return nil, "", errors.Wrap(err, "failed to write replica")
+		}
+	}
+	return meta, replicaPath, nil
+}
+
+// sealTask adds the pieces of task to sb, whose next sector must be the
+// task's, seals the sector and waits for it to be sealed.
+func sealTask(ctx context.Context, sb sectorbuilder.SectorBuilder, task *Task) (*sectorbuilder.SealedSectorMetadata, error) {
+	for _, p := range task.Pieces {
+		sectorID, err := sb.AddPiece(ctx, p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to add piece %s", p.Ref)
+		}
+		if sectorID != task.SectorID {
+			return nil, fmt.Errorf("piece %s was added to sector %d instead of %d", p.Ref, sectorID, task.SectorID)
+		}
+	}
+
+	results := sb.SectorSealResults()
+	if err := sb.SealSector(ctx, task.SectorID); err != nil {
+		return nil, err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case res := <-results:
+			if res.SectorID != task.SectorID {
+				continue
+			}
+			if res.SealingErr != nil {
+				return nil, res.SealingErr
+			}
+			return res.SealingResult, nil
+		}
+	}
+}
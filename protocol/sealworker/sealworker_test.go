@@ -0,0 +1,493 @@
+package sealworker
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	dag "gx/ipfs/QmNRAuGmvnVw8urHkUZQirhu42VTiZjVWASa2aTznEMmpP/go-merkledag"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	"gx/ipfs/QmRu7tiRnFk9mMPpVECQTBQJqXtmG132jJxA1w9A7TtpBz/go-ipfs-blockstore"
+	"gx/ipfs/QmSz8kAe2JCKp2dWSG8gHSWnwSmne8YfRXTeK5HBmc9L7t/go-ipfs-exchange-offline"
+	ds "gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+	dssync "gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore/sync"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	bserv "gx/ipfs/QmZsGVGCqMCNzHLNMB6q4F6yyvomqf1VxwhJwSfgo1NGaF/go-blockservice"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/proofs"
+	"github.com/filecoin-project/go-filecoin/proofs/sectorbuilder"
+)
+
+// testLocalSectorBuilder holds staged sectors in memory, and records the
+// sectors it seals itself and the replicas imported into it.
+type testLocalSectorBuilder struct {
+	sectorbuilder.SectorBuilder
+
+	// exportErr, if set, is returned by ExportStagedSector.
+	exportErr error
+
+	lk       sync.Mutex
+	sectors  map[uint64]*sectorbuilder.SectorInfo
+	imported map[uint64][]byte
+	sealed   []uint64
+	results  chan sectorbuilder.SectorSealResult
+}
+
+func (sb *testLocalSectorBuilder) SectorStatus(sectorID uint64) (*sectorbuilder.SectorInfo, error) {
+	sb.lk.Lock()
+	defer sb.lk.Unlock()
+
+	info, ok := sb.sectors[sectorID]
+	if !ok {
+		return nil, errors.New("no such sector")
+	}
+	cpy := *info
+	return &cpy, nil
+}
+
+func (sb *testLocalSectorBuilder) ListSectors() ([]*sectorbuilder.SectorInfo, error) {
+	sb.lk.Lock()
+	defer sb.lk.Unlock()
+
+	var infos []*sectorbuilder.SectorInfo
+	for _, info := range sb.sectors {
+		cpy := *info
+		infos = append(infos, &cpy)
+	}
+	return infos, nil
+}
+
+func (sb *testLocalSectorBuilder) SealSector(ctx context.Context, sectorID uint64) error {
+	sb.lk.Lock()
+	defer sb.lk.Unlock()
+
+	sb.sealed = append(sb.sealed, sectorID)
+	return nil
+}
+
+func (sb *testLocalSectorBuilder) SealAllStagedSectors(ctx context.Context) error {
+	sb.lk.Lock()
+	defer sb.lk.Unlock()
+
+	for id, info := range sb.sectors {
+		if info.State == sectorbuilder.SectorStaged {
+			sb.sealed = append(sb.sealed, id)
+		}
+	}
+	return nil
+}
+
+func (sb *testLocalSectorBuilder) ExportStagedSector(sectorID uint64) error {
+	if sb.exportErr != nil {
+		return sb.exportErr
+	}
+
+	sb.lk.Lock()
+	defer sb.lk.Unlock()
+
+	sb.sectors[sectorID].State = sectorbuilder.SectorSealing
+	return nil
+}
+
+func (sb *testLocalSectorBuilder) ImportSealedSector(meta *sectorbuilder.SealedSectorMetadata, replicaPath string) error {
+	replica, err := ioutil.ReadFile(replicaPath)
+	if err != nil {
+		return err
+	}
+
+	sb.lk.Lock()
+	sb.imported[meta.SectorID] = replica
+	sb.sectors[meta.SectorID].State = sectorbuilder.SectorSealed
+	sb.lk.Unlock()
+
+	sb.results <- sectorbuilder.SectorSealResult{SectorID: meta.SectorID, SealingResult: meta}
+	return nil
+}
+
+func (sb *testLocalSectorBuilder) SectorSealResults() <-chan sectorbuilder.SectorSealResult {
+	return sb.results
+}
+
+func (sb *testLocalSectorBuilder) Close() error {
+	return nil
+}
+
+func (sb *testLocalSectorBuilder) importedReplica(sectorID uint64) string {
+	sb.lk.Lock()
+	defer sb.lk.Unlock()
+	return string(sb.imported[sectorID])
+}
+
+// testSealer "seals" a sector by concatenating its pieces into the replica,
+// and proves it with an insecure proof. With release set, it waits for
+// release to close before sealing. With forge set, the proof is invalid.
+type testSealer struct {
+	started chan uint64
+	release chan struct{}
+	err     error
+	forge   bool
+}
+
+func (s *testSealer) Seal(ctx context.Context, task *Task, bs bserv.BlockService, dir string) (*sectorbuilder.SealedSectorMetadata, string, error) {
+	if s.started != nil {
+		s.started <- task.SectorID
+	}
+	if s.release != nil {
+		<-s.release
+	}
+	if s.err != nil {
+		return nil, "", s.err
+	}
+
+	var replica []byte
+	for _, p := range task.Pieces {
+		b, err := bs.GetBlock(ctx, p.Ref)
+		if err != nil {
+			return nil, "", err
+		}
+		replica = append(replica, b.RawData()...)
+	}
+
+	replicaPath := filepath.Join(dir, "replica")
+	if err := ioutil.WriteFile(replicaPath, replica, 0644); err != nil {
+		return nil, "", err
+	}
+
+	proverID := sectorbuilder.AddressToProverID(task.MinerAddr)
+	sectorID := sectorbuilder.SectorIDToBytes(task.SectorID)
+	var commD proofs.CommD
+	copy(commD[:], replica)
+	commR := proofs.InsecureCommR(proverID, sectorID, commD)
+	commRStar := proofs.InsecureCommRStar(commR)
+	proof := proofs.InsecureSealProof(proverID, sectorID, commD, commR, commRStar)
+	if s.forge {
+		proof[0]++
+	}
+
+	return &sectorbuilder.SealedSectorMetadata{
+		SectorID:  task.SectorID,
+		Pieces:    task.Pieces,
+		CommD:     commD,
+		CommR:     commR,
+		CommRStar: commRStar,
+		Proof:     proof,
+	}, replicaPath, nil
+}
+
+type testSealWorkers struct {
+	sb    *SectorBuilder
+	local *testLocalSectorBuilder
+	addr  string
+	dir   string
+}
+
+// newTestSealWorkers returns a SectorBuilder serving workers on a unix
+// socket, wrapping a local sector builder with a staged sector holding a
+// piece for each of pieces.
+func newTestSealWorkers(t *testing.T, pieces ...string) *testSealWorkers {
+	dir, err := ioutil.TempDir("", "sealworker")
+	require.NoError(t, err)
+
+	bstore := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	bs := bserv.New(bstore, offline.Exchange(bstore))
+
+	local := &testLocalSectorBuilder{
+		sectors:  make(map[uint64]*sectorbuilder.SectorInfo),
+		imported: make(map[uint64][]byte),
+		results:  make(chan sectorbuilder.SectorSealResult, 8),
+	}
+	for i, data := range pieces {
+		nd := dag.NewRawNode([]byte(data))
+		require.NoError(t, bs.AddBlock(nd))
+		sectorID := uint64(i + 1)
+		local.sectors[sectorID] = &sectorbuilder.SectorInfo{
+			SectorID: sectorID,
+			State:    sectorbuilder.SectorStaged,
+			Pieces:   []*sectorbuilder.PieceInfo{{Ref: nd.Cid(), Size: uint64(len(data))}},
+		}
+	}
+
+	sb, err := NewSectorBuilder(local, CoordinatorConfig{
+		MinerAddr:    address.NewForTestGetter()(),
+		BlockService: bs,
+		ReplicaDir:   filepath.Join(dir, "replicas"),
+		Verifier:     &proofs.InsecureVerifier{},
+	}, nil)
+	require.NoError(t, err)
+
+	addr := "/unix/" + filepath.Join(dir, "sealworker.sock")
+	lis, err := Listen(addr)
+	require.NoError(t, err)
+	go sb.Serve(lis) // nolint: errcheck
+
+	return &testSealWorkers{sb: sb, local: local, addr: addr, dir: dir}
+}
+
+func (tw *testSealWorkers) close() {
+	tw.sb.Close()        // nolint: errcheck
+	os.RemoveAll(tw.dir) // nolint: errcheck
+}
+
+// startWorker connects a worker and waits for the daemon to see it.
+func (tw *testSealWorkers) startWorker(ctx context.Context, t *testing.T, id string, capacity int, sealer Sealer) {
+	client, err := Dial(ctx, tw.addr, "")
+	require.NoError(t, err)
+	go func() {
+		defer client.Close()                                     // nolint: errcheck
+		NewWorker(client, id, capacity, sealer, tw.dir).Run(ctx) // nolint: errcheck
+	}()
+	tw.waitForWorkers(t, true)
+}
+
+func (tw *testSealWorkers) waitForWorkers(t *testing.T, connected bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for tw.sb.coordinator.HasWorkers() != connected {
+		require.True(t, time.Now().Before(deadline), "timed out waiting for workers")
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (tw *testSealWorkers) nextResult(t *testing.T) sectorbuilder.SectorSealResult {
+	select {
+	case result := <-tw.sb.SectorSealResults():
+		return result
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "timed out waiting for a seal result")
+		return sectorbuilder.SectorSealResult{}
+	}
+}
+
+func TestSealWorkers(t *testing.T) {
+	t.Run("seals locally without workers", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		tw := newTestSealWorkers(t, "piece")
+		defer tw.close()
+
+		require.NoError(tw.sb.SealSector(context.Background(), 1))
+		assert.Equal([]uint64{1}, tw.local.sealed)
+	})
+
+	t.Run("imports sectors sealed by workers", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		tw := newTestSealWorkers(t, "piece one", "piece two")
+		defer tw.close()
+		tw.startWorker(ctx, t, "worker", 2, &testSealer{})
+
+		require.NoError(tw.sb.SealAllStagedSectors(ctx))
+		sealed := map[uint64]bool{}
+		for i := 0; i < 2; i++ {
+			result := tw.nextResult(t)
+			require.NoError(result.SealingErr)
+			sealed[result.SectorID] = true
+		}
+
+		assert.Equal(map[uint64]bool{1: true, 2: true}, sealed)
+		assert.Equal("piece one", tw.local.importedReplica(1))
+		assert.Equal("piece two", tw.local.importedReplica(2))
+		assert.Empty(tw.local.sealed)
+	})
+
+	t.Run("hands sectors of disconnected workers to other workers", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		tw := newTestSealWorkers(t, "piece")
+		defer tw.close()
+
+		// A worker that takes a task and then goes away.
+		client, err := Dial(ctx, tw.addr, "")
+		require.NoError(err)
+		tasks := make(chan *Task, 1)
+		_, err = client.Subscribe(ctx, Namespace+".Work", tasks, Registration{WorkerID: "dead", Capacity: 1})
+		require.NoError(err)
+		tw.waitForWorkers(t, true)
+
+		require.NoError(tw.sb.SealSector(ctx, 1))
+		task := <-tasks
+		assert.Equal(uint64(1), task.SectorID)
+		require.NoError(client.Close())
+		tw.waitForWorkers(t, false)
+
+		tw.startWorker(ctx, t, "live", 1, &testSealer{})
+		result := tw.nextResult(t)
+		require.NoError(result.SealingErr)
+		assert.Equal(uint64(1), result.SectorID)
+		assert.Equal("piece", tw.local.importedReplica(1))
+	})
+
+	t.Run("hands workers no more sectors than their capacity", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		tw := newTestSealWorkers(t, "piece one", "piece two")
+		defer tw.close()
+		sealer := &testSealer{started: make(chan uint64, 2), release: make(chan struct{})}
+		tw.startWorker(ctx, t, "worker", 1, sealer)
+
+		require.NoError(tw.sb.SealSector(ctx, 1))
+		require.NoError(tw.sb.SealSector(ctx, 2))
+		assert.Equal(uint64(1), <-sealer.started)
+		select {
+		case id := <-sealer.started:
+			assert.Fail("worker was handed a second sector", "sector %d", id)
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		close(sealer.release)
+		assert.Equal(uint64(1), tw.nextResult(t).SectorID)
+		assert.Equal(uint64(2), <-sealer.started)
+		assert.Equal(uint64(2), tw.nextResult(t).SectorID)
+	})
+
+	t.Run("seals in process sectors that cannot be exported", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		tw := newTestSealWorkers(t, "piece")
+		defer tw.close()
+		tw.local.exportErr = sectorbuilder.ErrSectorExportUnsupported
+		tw.startWorker(ctx, t, "worker", 1, &testSealer{})
+
+		require.NoError(tw.sb.SealSector(ctx, 1))
+		assert.Equal([]uint64{1}, tw.local.sealed)
+		assert.False(tw.sb.coordinator.IsSealing(1))
+	})
+
+	t.Run("does not import sectors sealed with invalid proofs", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		tw := newTestSealWorkers(t, "piece")
+		defer tw.close()
+		tw.startWorker(ctx, t, "worker", 1, &testSealer{forge: true})
+
+		require.NoError(tw.sb.SealSector(ctx, 1))
+		result := tw.nextResult(t)
+		require.Error(result.SealingErr)
+		assert.Contains(result.SealingErr.Error(), "invalid seal proof")
+		assert.Empty(tw.local.importedReplica(1))
+	})
+
+	t.Run("workers act only on their own sectors", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		tw := newTestSealWorkers(t, "piece")
+		defer tw.close()
+
+		owner, err := Dial(ctx, tw.addr, "")
+		require.NoError(err)
+		defer owner.Close() // nolint: errcheck
+		tasks := make(chan *Task, 1)
+		_, err = owner.Subscribe(ctx, Namespace+".Work", tasks, Registration{WorkerID: "owner", Capacity: 1})
+		require.NoError(err)
+		tw.waitForWorkers(t, true)
+
+		require.NoError(tw.sb.SealSector(ctx, 1))
+		task := <-tasks
+
+		// Another worker cannot touch the sector.
+		other, err := Dial(ctx, tw.addr, "")
+		require.NoError(err)
+		defer other.Close() // nolint: errcheck
+		_, err = other.Subscribe(ctx, Namespace+".Work", make(chan *Task, 1), Registration{WorkerID: "other", Capacity: 0})
+		require.NoError(err)
+		assert.Error(other.Call(ctx, Namespace+".WriteReplica", nil, task.SectorID, int64(0), []byte("forged")))
+		assert.Error(other.Call(ctx, Namespace+".Complete", nil, task.SectorID, nil, "failed on purpose"))
+
+		// Nor can a connection that never registered.
+		stranger, err := Dial(ctx, tw.addr, "")
+		require.NoError(err)
+		defer stranger.Close() // nolint: errcheck
+		assert.Error(stranger.Call(ctx, Namespace+".Complete", nil, task.SectorID, nil, "failed on purpose"))
+
+		assert.True(tw.sb.coordinator.IsSealing(1))
+		var page BlockPage
+		assert.NoError(owner.Call(ctx, Namespace+".PieceBlocks", &page, task.SectorID, task.Pieces[0].Ref, 0))
+		assert.Len(page.Blocks, 1)
+	})
+
+	t.Run("gives up on sectors workers keep failing to seal", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		tw := newTestSealWorkers(t, "piece")
+		defer tw.close()
+		tw.startWorker(ctx, t, "worker", 1, &testSealer{err: errors.New("out of disk")})
+
+		require.NoError(tw.sb.SealSector(ctx, 1))
+		result := tw.nextResult(t)
+		require.Error(result.SealingErr)
+		assert.Contains(result.SealingErr.Error(), "out of disk")
+
+		info, err := tw.sb.SectorStatus(1)
+		require.NoError(err)
+		assert.Equal(sectorbuilder.SectorFailed, info.State)
+		assert.Contains(info.SealingErr, "3 times")
+	})
+}
+
+func TestInsecureSealer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "sealworker")
+	require.NoError(err)
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	bstore := blockstore.NewBlockstore(ds.NewMapDatastore())
+	bs := bserv.New(bstore, offline.Exchange(bstore))
+	var pieces []*sectorbuilder.PieceInfo
+	for _, data := range []string{"first piece", "second piece"} {
+		nd := dag.NewRawNode([]byte(data))
+		require.NoError(bs.AddBlock(nd))
+		pieces = append(pieces, &sectorbuilder.PieceInfo{Ref: nd.Cid(), Size: uint64(len(data))})
+	}
+
+	task := &Task{SectorID: 5, MinerAddr: address.NewForTestGetter()(), Pieces: pieces}
+	meta, replicaPath, err := InsecureSealer{}.Seal(ctx, task, bs, dir)
+	require.NoError(err)
+	assert.Equal(uint64(5), meta.SectorID)
+	assert.Equal(pieces, meta.Pieces)
+
+	replica, err := ioutil.ReadFile(replicaPath)
+	require.NoError(err)
+	assert.Equal("first piecesecond piece", string(replica))
+
+	// The daemon's insecure verifier accepts the seal.
+	res, err := (&proofs.InsecureVerifier{}).VerifySeal(proofs.VerifySealRequest{
+		CommD:     meta.CommD,
+		CommR:     meta.CommR,
+		CommRStar: meta.CommRStar,
+		Proof:     meta.Proof,
+		ProverID:  sectorbuilder.AddressToProverID(task.MinerAddr),
+		SectorID:  sectorbuilder.SectorIDToBytes(task.SectorID),
+	})
+	require.NoError(err)
+	assert.True(res.IsValid)
+}
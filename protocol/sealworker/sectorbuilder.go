@@ -0,0 +1,235 @@
+package sealworker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/proofs/sectorbuilder"
+	"github.com/filecoin-project/go-filecoin/rpc"
+)
+
+// SectorBuilder is a sectorbuilder.SectorBuilder that hands the sectors it
+// is asked to seal to seal workers while any are connected, and seals them
+// with the wrapped SectorBuilder otherwise.
+type SectorBuilder struct {
+	sectorbuilder.SectorBuilder
+
+	coordinator *Coordinator
+	server      *http.Server
+
+	results chan sectorbuilder.SectorSealResult
+	done    chan struct{}
+
+	// failedLk protects failed.
+	failedLk sync.Mutex
+
+	// failed holds why workers failed to seal the sectors they gave up on.
+	failed map[uint64]string
+}
+
+var _ sectorbuilder.SectorBuilder = &SectorBuilder{}
+
+// NewSectorBuilder wraps local so that sealing is handed to the workers that
+// connect to the returned SectorBuilder's Serve. authorize, if not nil, is
+// consulted before every call workers make. The Import and Failed fields of
+// cfg are set by NewSectorBuilder.
+func NewSectorBuilder(local sectorbuilder.SectorBuilder, cfg CoordinatorConfig, authorize rpc.Authorizer) (*SectorBuilder, error) {
+	sb := &SectorBuilder{
+		SectorBuilder: local,
+		results:       make(chan sectorbuilder.SectorSealResult),
+		done:          make(chan struct{}),
+		failed:        make(map[uint64]string),
+	}
+
+	cfg.Import = local.ImportSealedSector
+	cfg.Failed = sb.onWorkersFailed
+	sb.coordinator = NewCoordinator(cfg)
+	if err := sb.coordinator.cleanReplicaDir(); err != nil {
+		return nil, err
+	}
+
+	server := rpc.NewServer()
+	if err := server.Register(Namespace, NewService(sb.coordinator)); err != nil {
+		return nil, err
+	}
+	if authorize != nil {
+		server.SetAuthorizer(authorize)
+	}
+	sb.server = &http.Server{Handler: server}
+
+	go sb.forwardResults()
+	return sb, nil
+}
+
+// Serve serves seal workers on lis until Close is called.
+func (sb *SectorBuilder) Serve(lis net.Listener) error {
+	err := sb.server.Serve(lis)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// SealSector hands the sector with the given id to a worker, if any is
+// connected and the wrapped SectorBuilder can export the sector. A sector
+// whose sealing failed on workers is handed to them again.
+func (sb *SectorBuilder) SealSector(ctx context.Context, sectorID uint64) error {
+	sb.failedLk.Lock()
+	_, failedOnWorkers := sb.failed[sectorID]
+	sb.failedLk.Unlock()
+
+	if !sb.coordinator.HasWorkers() && !failedOnWorkers {
+		return sb.SectorBuilder.SealSector(ctx, sectorID)
+	}
+
+	info, err := sb.SectorBuilder.SectorStatus(sectorID)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case failedOnWorkers:
+		// The sector is still exported.
+	case info.State == sectorbuilder.SectorStaged:
+		err := sb.SectorBuilder.ExportStagedSector(sectorID)
+		if err == sectorbuilder.ErrSectorExportUnsupported {
+			log.Warningf("sealing sector %d in process: %s", sectorID, err)
+			return sb.SectorBuilder.SealSector(ctx, sectorID)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to export sector %d", sectorID)
+		}
+	case info.State == sectorbuilder.SectorFailed:
+		// The sector failed to seal in process, so seal it there again.
+		return sb.SectorBuilder.SealSector(ctx, sectorID)
+	default:
+		return fmt.Errorf("sector %d is %s", sectorID, info.State)
+	}
+
+	return sb.submit(info)
+}
+
+// submit hands the exported sector described by info to the workers.
+func (sb *SectorBuilder) submit(info *sectorbuilder.SectorInfo) error {
+	if err := sb.coordinator.Submit(info.SectorID, info.Pieces); err != nil {
+		return err
+	}
+
+	sb.failedLk.Lock()
+	delete(sb.failed, info.SectorID)
+	sb.failedLk.Unlock()
+	return nil
+}
+
+// SealAllStagedSectors hands every non-empty staged sector to the workers,
+// if any are connected. Sectors the wrapped SectorBuilder cannot export are
+// sealed in process.
+func (sb *SectorBuilder) SealAllStagedSectors(ctx context.Context) error {
+	if !sb.coordinator.HasWorkers() {
+		return sb.SectorBuilder.SealAllStagedSectors(ctx)
+	}
+
+	infos, err := sb.SectorBuilder.ListSectors()
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		if info.State != sectorbuilder.SectorStaged || len(info.Pieces) == 0 {
+			continue
+		}
+		err := sb.SectorBuilder.ExportStagedSector(info.SectorID)
+		if err == sectorbuilder.ErrSectorExportUnsupported {
+			log.Warningf("sealing staged sectors in process: %s", err)
+			return sb.SectorBuilder.SealAllStagedSectors(ctx)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to export sector %d", info.SectorID)
+		}
+		if err := sb.submit(info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListSectors describes the sectors of the wrapped SectorBuilder, reporting
+// the sectors workers failed to seal as failed.
+func (sb *SectorBuilder) ListSectors() ([]*sectorbuilder.SectorInfo, error) {
+	infos, err := sb.SectorBuilder.ListSectors()
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range infos {
+		sb.markFailed(info)
+	}
+	return infos, nil
+}
+
+// SectorStatus describes a sector of the wrapped SectorBuilder, reporting a
+// sector workers failed to seal as failed.
+func (sb *SectorBuilder) SectorStatus(sectorID uint64) (*sectorbuilder.SectorInfo, error) {
+	info, err := sb.SectorBuilder.SectorStatus(sectorID)
+	if err != nil {
+		return nil, err
+	}
+	sb.markFailed(info)
+	return info, nil
+}
+
+func (sb *SectorBuilder) markFailed(info *sectorbuilder.SectorInfo) {
+	sb.failedLk.Lock()
+	defer sb.failedLk.Unlock()
+
+	if sealErr, ok := sb.failed[info.SectorID]; ok {
+		info.State = sectorbuilder.SectorFailed
+		info.SealingErr = sealErr
+	}
+}
+
+// SectorSealResults returns the seal results of the wrapped SectorBuilder,
+// which include those of sectors sealed by workers, and the failures of
+// sectors workers gave up on.
+func (sb *SectorBuilder) SectorSealResults() <-chan sectorbuilder.SectorSealResult {
+	return sb.results
+}
+
+// Close stops serving workers and closes the wrapped SectorBuilder.
+func (sb *SectorBuilder) Close() error {
+	close(sb.done)
+	if err := sb.server.Close(); err != nil {
+		log.Warningf("failed to stop serving seal workers: %s", err)
+	}
+	return sb.SectorBuilder.Close()
+}
+
+func (sb *SectorBuilder) forwardResults() {
+	local := sb.SectorBuilder.SectorSealResults()
+	for {
+		select {
+		case result := <-local:
+			select {
+			case sb.results <- result:
+			case <-sb.done:
+				return
+			}
+		case <-sb.done:
+			return
+		}
+	}
+}
+
+func (sb *SectorBuilder) onWorkersFailed(sectorID uint64, err error) {
+	sb.failedLk.Lock()
+	sb.failed[sectorID] = err.Error()
+	sb.failedLk.Unlock()
+
+	select {
+	case sb.results <- sectorbuilder.SectorSealResult{SectorID: sectorID, SealingErr: err}:
+	case <-sb.done:
+	}
+}
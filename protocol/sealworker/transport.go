@@ -0,0 +1,50 @@
+package sealworker
+
+import (
+	"context"
+	"net"
+
+	ma "gx/ipfs/QmNTCey11oxhb1AxDnQBRHtdhap6Ctud872NjAYPYYXPuc/go-multiaddr"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	"gx/ipfs/QmZcLBXKaFe8ND5YHPkJRAwmhJGrVsi1JqDZNyJ4nRK5Mj/go-multiaddr-net"
+
+	"github.com/filecoin-project/go-filecoin/rpc"
+)
+
+// handshakeURL is the url of the websocket handshake workers make. Only its
+// path matters, as the connection is already open.
+const handshakeURL = "ws://sealworker/"
+
+// Listen listens for seal workers on the multiaddr addr, which may be a TCP
+// address or a unix socket.
+func Listen(addr string) (net.Listener, error) {
+	maddr, err := ma.NewMultiaddr(addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid seal worker address %s", addr)
+	}
+	lis, err := manet.Listen(maddr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to listen for seal workers on %s", addr)
+	}
+	return manet.NetListener(lis), nil
+}
+
+// Dial connects to the daemon listening for seal workers on the multiaddr
+// addr, authenticating with token if it is not empty.
+func Dial(ctx context.Context, addr, token string) (*rpc.Client, error) {
+	maddr, err := ma.NewMultiaddr(addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid seal worker address %s", addr)
+	}
+	network, host, err := manet.DialArgs(maddr)
+	if err != nil {
+		return nil, err
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, host)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect to %s", addr)
+	}
+	return rpc.DialConn(ctx, conn, handshakeURL, token)
+}
@@ -0,0 +1,45 @@
+package sealworker
+
+import (
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/proofs"
+	"github.com/filecoin-project/go-filecoin/proofs/sectorbuilder"
+)
+
+// Namespace is the JSON-RPC namespace of the methods seal workers call.
+const Namespace = "SealWorker"
+
+// Registration is how a worker introduces itself when it subscribes to
+// tasks.
+type Registration struct {
+	// WorkerID names the worker. No two connected workers may share an id.
+	WorkerID string
+	// Capacity is how many sectors the worker can seal at once.
+	Capacity int
+}
+
+// Task asks a worker to seal a sector.
+type Task struct {
+	SectorID        uint64
+	MinerAddr       address.Address
+	SectorStoreType proofs.SectorStoreType
+
+	// Pieces are the pieces of the sector, in the order they were added to
+	// it.
+	Pieces []*sectorbuilder.PieceInfo
+}
+
+// Block is a block of a piece's DAG.
+type Block struct {
+	Cid  cid.Cid
+	Data []byte
+}
+
+// BlockPage is a page of the blocks of a piece's DAG.
+type BlockPage struct {
+	Blocks []Block
+	// Next is the offset of the next page, or zero after the last page.
+	Next int
+}
@@ -0,0 +1,181 @@
+package sealworker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"gx/ipfs/QmRu7tiRnFk9mMPpVECQTBQJqXtmG132jJxA1w9A7TtpBz/go-ipfs-blockstore"
+	"gx/ipfs/QmSz8kAe2JCKp2dWSG8gHSWnwSmne8YfRXTeK5HBmc9L7t/go-ipfs-exchange-offline"
+	ds "gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+	dssync "gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore/sync"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+	bserv "gx/ipfs/QmZsGVGCqMCNzHLNMB6q4F6yyvomqf1VxwhJwSfgo1NGaF/go-blockservice"
+
+	"github.com/filecoin-project/go-filecoin/proofs/sectorbuilder"
+	"github.com/filecoin-project/go-filecoin/rpc"
+)
+
+// replicaChunkSize is the most replica bytes uploaded in one call.
+const replicaChunkSize = 4 << 20
+
+// Sealer seals the sector of a task, whose pieces' blocks are in bs, using
+// dir as scratch space. It returns the sealed sector's metadata and the path
+// of its replica.
+type Sealer interface {
+	Seal(ctx context.Context, task *Task, bs bserv.BlockService, dir string) (*sectorbuilder.SealedSectorMetadata, string, error)
+}
+
+// Worker seals the sectors a daemon hands it.
+type Worker struct {
+	client   *rpc.Client
+	id       string
+	capacity int
+	sealer   Sealer
+	workDir  string
+}
+
+// NewWorker returns a worker with the given id sealing up to capacity
+// sectors at once for the daemon client is connected to. Each sector is
+// sealed in its own directory under workDir.
+func NewWorker(client *rpc.Client, id string, capacity int, sealer Sealer, workDir string) *Worker {
+	return &Worker{
+		client:   client,
+		id:       id,
+		capacity: capacity,
+		sealer:   sealer,
+		workDir:  workDir,
+	}
+}
+
+// Run seals the sectors the daemon hands the worker until ctx is done or the
+// connection to the daemon closes.
+func (w *Worker) Run(ctx context.Context) error {
+	tasks := make(chan *Task, maxWorkerCapacity)
+	sub, err := w.client.Subscribe(ctx, Namespace+".Work", tasks, Registration{WorkerID: w.id, Capacity: w.capacity})
+	if err != nil {
+		return errors.Wrap(err, "failed to register with daemon")
+	}
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case task, ok := <-tasks:
+			if !ok {
+				if err := <-sub.Err(); err != nil {
+					return err
+				}
+				return errors.New("daemon stopped sending tasks")
+			}
+			go w.handle(ctx, task)
+		}
+	}
+}
+
+// SetCapacity changes how many sectors the daemon hands the worker at once.
+func (w *Worker) SetCapacity(ctx context.Context, capacity int) error {
+	return w.client.Call(ctx, Namespace+".SetCapacity", nil, capacity)
+}
+
+// handle seals the sector of task and reports the outcome to the daemon.
+func (w *Worker) handle(ctx context.Context, task *Task) {
+	log.Infof("sealing sector %d", task.SectorID)
+
+	meta, err := w.seal(ctx, task)
+	sealErr := ""
+	if err != nil {
+		log.Errorf("failed to seal sector %d: %s", task.SectorID, err)
+		sealErr = err.Error()
+	}
+
+	if err := w.client.Call(ctx, Namespace+".Complete", nil, task.SectorID, meta, sealErr); err != nil {
+		log.Errorf("failed to report sealing of sector %d: %s", task.SectorID, err)
+		return
+	}
+	if sealErr == "" {
+		log.Infof("sealed sector %d", task.SectorID)
+	}
+}
+
+func (w *Worker) seal(ctx context.Context, task *Task) (*sectorbuilder.SealedSectorMetadata, error) {
+	dir, err := ioutil.TempDir(w.workDir, fmt.Sprintf("sector-%d-", task.SectorID))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create work dir")
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	bs, err := w.fetchPieces(ctx, task)
+	if err != nil {
+		return nil, err
+	}
+
+	meta, replicaPath, err := w.sealer.Seal(ctx, task, bs, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := w.uploadReplica(ctx, task.SectorID, replicaPath); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// fetchPieces returns a block service holding the blocks of the pieces of
+// task.
+func (w *Worker) fetchPieces(ctx context.Context, task *Task) (bserv.BlockService, error) {
+	bstore := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	for _, p := range task.Pieces {
+		offset := 0
+		for {
+			var page BlockPage
+			if err := w.client.Call(ctx, Namespace+".PieceBlocks", &page, task.SectorID, p.Ref, offset); err != nil {
+				return nil, errors.Wrapf(err, "failed to fetch blocks of piece %s", p.Ref)
+			}
+			for _, b := range page.Blocks {
+				blk, err := blocks.NewBlockWithCid(b.Data, b.Cid)
+				if err != nil {
+					return nil, errors.Wrapf(err, "invalid block of piece %s", p.Ref)
+				}
+				if err := bstore.Put(blk); err != nil {
+					return nil, err
+				}
+			}
+			if page.Next == 0 {
+				break
+			}
+			offset = page.Next
+		}
+	}
+	return bserv.New(bstore, offline.Exchange(bstore)), nil
+}
+
+func (w *Worker) uploadReplica(ctx context.Context, sectorID uint64, replicaPath string) error {
+	f, err := os.Open(replicaPath)
+	if err != nil {
+		return errors.Wrap(err, "failed to open replica")
+	}
+	defer f.Close() // nolint: errcheck
+
+	buf := make([]byte, replicaChunkSize)
+	var offset int64
+	for {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			if err := w.client.Call(ctx, Namespace+".WriteReplica", nil, sectorID, offset, buf[:n]); err != nil {
+				return errors.Wrap(err, "failed to upload replica")
+			}
+			offset += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to read replica")
+		}
+	}
+}
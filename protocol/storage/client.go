@@ -1,14 +1,18 @@
 package storage
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"math/big"
 	"sync"
 	"time"
 
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	uio "gx/ipfs/QmRDWTzVdbHXdtat7tVJ7YC7kRaW7rTZTEF79yykcLYa49/go-unixfs/io"
 	ipld "gx/ipfs/QmRL22E4paat7ky7vx9MLpR97JHHbFPrg3ytFQw6qp1y1s/go-ipld-format"
+	inet "gx/ipfs/QmTGxDz2CjBucFzPNTiWwzQmTWdrBnzqbqrMucDYMsjuPb/go-libp2p-net"
 	"gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
 	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
 	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore/query"
@@ -23,6 +27,8 @@ import (
 	"github.com/filecoin-project/go-filecoin/address"
 	cbu "github.com/filecoin-project/go-filecoin/cborutil"
 	"github.com/filecoin-project/go-filecoin/porcelain"
+	"github.com/filecoin-project/go-filecoin/proofs"
+	"github.com/filecoin-project/go-filecoin/protocol/retrieval"
 	"github.com/filecoin-project/go-filecoin/repo"
 	"github.com/filecoin-project/go-filecoin/types"
 	"github.com/filecoin-project/go-filecoin/util/convert"
@@ -57,17 +63,26 @@ const (
 
 type clientNode interface {
 	GetFileSize(context.Context, cid.Cid) (uint64, error)
+	GetPieceCommitment(ctx context.Context, c cid.Cid, size uint64) (proofs.CommP, error)
 	MakeProtocolRequest(ctx context.Context, protocol protocol.ID, peer peer.ID, request interface{}, response interface{}) error
+	OpenStream(ctx context.Context, peer peer.ID, protocol protocol.ID) (inet.Stream, error)
+	DAGService() ipld.DAGService
 	GetBlockTime() time.Duration
+	RetrievePiece(ctx context.Context, miner peer.ID, piece cid.Cid) (io.ReadCloser, error)
 }
 
 type clientPorcelainAPI interface {
 	ChainBlockHeight(ctx context.Context) (*types.BlockHeight, error)
+	ClientFindMiners(ctx context.Context) ([]*porcelain.MinerCandidate, error)
+	ConfigGet(dottedPath string) (interface{}, error)
 	CreatePayments(ctx context.Context, config porcelain.CreatePaymentsParams) (*porcelain.CreatePaymentsReturn, error)
 	GetAndMaybeSetDefaultSenderAddress() (address.Address, error)
 	MinerGetAsk(ctx context.Context, minerAddr address.Address, askID uint64) (miner.Ask, error)
 	MinerGetOwnerAddress(ctx context.Context, minerAddr address.Address) (address.Address, error)
 	MinerGetPeerID(ctx context.Context, minerAddr address.Address) (peer.ID, error)
+	MinerGetProvingPeriodStart(ctx context.Context, minerAddr address.Address) (*types.BlockHeight, error)
+	MinerGetSectorCommitments(ctx context.Context, minerAddr address.Address) (map[string]types.Commitments, error)
+	MinerGetWorkerAddress(ctx context.Context, minerAddr address.Address) (address.Address, error)
 	types.Signer
 }
 
@@ -75,6 +90,40 @@ type clientDeal struct {
 	Miner    address.Address
 	Proposal *DealProposal
 	Response *DealResponse
+	// CommP is the commitment of the deal's piece, computed by the client
+	// when proposing the deal. The miner must report the same one.
+	CommP []byte
+	// TransferComplete is set once the data of a pushed deal has been sent.
+	TransferComplete bool
+	// StateChanged is when Response.State last changed, in seconds since
+	// the epoch.
+	StateChanged int64
+	// StartHeight is the chain height when the deal was proposed. The deal
+	// ends Proposal.Duration blocks later. It is zero for deals made before
+	// it was recorded, whose end is unknown.
+	StartHeight uint64
+	// RenewedBy is the proposal cid of the deal renewing this one, if any.
+	RenewedBy *cid.Cid
+	// ReplacedBy is the proposal cid of the deal that took over this deal's
+	// piece after its miner stopped proving it, if any.
+	ReplacedBy *cid.Cid
+	// ManageAttempts counts the failed attempts to renew or repair the deal,
+	// and NextManageHeight is the height from which it is tried again.
+	ManageAttempts   int
+	NextManageHeight uint64
+	// SignedResponses holds each distinct response the miner sent for the
+	// deal, as signed by its worker, oldest first. Unlike Response, which
+	// the client updates with its own findings, they are kept unchanged as
+	// evidence of what the miner agreed to.
+	SignedResponses []*DealResponse
+}
+
+// endHeight returns the height at which the deal ends, or zero if unknown.
+func (d *clientDeal) endHeight() uint64 {
+	if d.StartHeight == 0 {
+		return 0
+	}
+	return d.StartHeight + d.Proposal.Duration
 }
 
 // Client is used to make deals directly with storage miners.
@@ -82,31 +131,42 @@ type Client struct {
 	deals   map[cid.Cid]*clientDeal
 	dealsDs repo.Datastore
 	dealsLk sync.Mutex
+	// index indexes deals in dealsDs for ListDeals. Use getDealIndex.
+	index *dealIndex
+
+	node     clientNode
+	api      clientPorcelainAPI
+	verifier proofs.Verifier
 
-	node clientNode
-	api  clientPorcelainAPI
+	// managing is set while deals are being renewed and repaired.
+	managing int32
 }
 
 func init() {
 	cbor.RegisterCborType(clientDeal{})
 }
 
-// NewClient creates a new storage client.
-func NewClient(nd clientNode, api clientPorcelainAPI, dealsDs repo.Datastore) (*Client, error) {
+// NewClient creates a new storage client. verifier checks the proofs miners
+// send for sealed deals.
+func NewClient(nd clientNode, api clientPorcelainAPI, dealsDs repo.Datastore, verifier proofs.Verifier) (*Client, error) {
 	smc := &Client{
-		deals:   make(map[cid.Cid]*clientDeal),
-		node:    nd,
-		api:     api,
-		dealsDs: dealsDs,
+		deals:    make(map[cid.Cid]*clientDeal),
+		node:     nd,
+		api:      api,
+		dealsDs:  dealsDs,
+		verifier: verifier,
 	}
 	if err := smc.loadDeals(); err != nil {
 		return nil, errors.Wrap(err, "failed to load client deals")
 	}
+	smc.resumeTransfers()
 	return smc, nil
 }
 
-// ProposeDeal is
-func (smc *Client) ProposeDeal(ctx context.Context, miner address.Address, data cid.Cid, askID uint64, duration uint64, allowDuplicates bool) (*DealResponse, error) {
+// ProposeDeal proposes a deal to store data with miner. If the miner accepts
+// and transfer is TransferPush, the data is then pushed to it in the
+// background.
+func (smc *Client) ProposeDeal(ctx context.Context, miner address.Address, data cid.Cid, askID uint64, duration uint64, allowDuplicates bool, transfer TransferMode) (*DealResponse, error) {
 	ctx, cancel := context.WithTimeout(ctx, 4*smc.node.GetBlockTime())
 	defer cancel()
 	size, err := smc.node.GetFileSize(ctx, data)
@@ -114,6 +174,11 @@ func (smc *Client) ProposeDeal(ctx context.Context, miner address.Address, data
 		return nil, errors.Wrap(err, "failed to determine the size of the data")
 	}
 
+	commP, err := smc.node.GetPieceCommitment(ctx, data, size)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to compute the piece commitment of the data")
+	}
+
 	ask, err := smc.api.MinerGetAsk(ctx, miner, askID)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get ask price")
@@ -135,6 +200,11 @@ func (smc *Client) ProposeDeal(ctx context.Context, miner address.Address, data
 		return nil, err
 	}
 
+	minerWorker, err := smc.api.MinerGetWorkerAddress(ctx, miner)
+	if err != nil {
+		return nil, err
+	}
+
 	totalPrice := price.MulBigInt(big.NewInt(int64(size * duration)))
 
 	proposal := &DealProposal{
@@ -143,12 +213,24 @@ func (smc *Client) ProposeDeal(ctx context.Context, miner address.Address, data
 		TotalPrice:   totalPrice,
 		Duration:     duration,
 		MinerAddress: miner,
+		TransferMode: transfer,
 	}
 
 	if smc.isMaybeDupDeal(proposal) && !allowDuplicates {
 		return nil, Errors[ErrDupicateDeal]
 	}
 
+	pid, err := smc.api.MinerGetPeerID(ctx, miner)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make sure the miner would accept the deal before paying for it.
+	proposal.Payment.Payer = fromAddress
+	if err := smc.checkProposal(ctx, pid, proposal); err != nil {
+		return nil, err
+	}
+
 	// create payment information
 	cpResp, err := smc.api.CreatePayments(ctx, porcelain.CreatePaymentsParams{
 		From:            fromAddress,
@@ -166,7 +248,6 @@ func (smc *Client) ProposeDeal(ctx context.Context, miner address.Address, data
 
 	proposal.Payment.Channel = cpResp.Channel
 	proposal.Payment.PayChActor = address.PaymentBrokerAddress
-	proposal.Payment.Payer = fromAddress
 	proposal.Payment.ChannelMsgCid = &cpResp.ChannelMsgCid
 	proposal.Payment.Vouchers = cpResp.Vouchers
 
@@ -176,31 +257,47 @@ func (smc *Client) ProposeDeal(ctx context.Context, miner address.Address, data
 	}
 
 	// send proposal
-	pid, err := smc.api.MinerGetPeerID(ctx, miner)
-	if err != nil {
-		return nil, err
-	}
-
 	var response DealResponse
 	err = smc.node.MakeProtocolRequest(ctx, makeDealProtocol, pid, signedProposal, &response)
 	if err != nil {
 		return nil, errors.Wrap(err, "error sending proposal")
 	}
 
-	if err := smc.checkDealResponse(ctx, &response); err != nil {
+	if err := smc.checkDealResponse(ctx, &response, minerWorker); err != nil {
 		return nil, errors.Wrap(err, "response check failed")
 	}
 
-	// Note: currently the miner requests the data out of band
-
-	if err := smc.recordResponse(&response, miner, &signedProposal.DealProposal); err != nil {
+	if err := smc.recordResponse(&response, miner, &signedProposal.DealProposal, commP, chainHeight); err != nil {
 		return nil, errors.Wrap(err, "failed to track response")
 	}
 
+	if transfer == TransferPush {
+		go smc.pushDealData(response.ProposalCid)
+	}
+
 	return &response, nil
 }
 
-func (smc *Client) recordResponse(resp *DealResponse, miner address.Address, p *DealProposal) error {
+// checkProposal asks the miner whether it would accept the proposal, which
+// does not carry its payment yet, so that no payment channel is created for a
+// deal the miner rejects.
+func (smc *Client) checkProposal(ctx context.Context, pid peer.ID, p *DealProposal) error {
+	signedProposal, err := p.NewSignedProposal(p.Payment.Payer, smc.api)
+	if err != nil {
+		return err
+	}
+
+	var response DealResponse
+	if err := smc.node.MakeProtocolRequest(ctx, checkProposalProtocol, pid, signedProposal, &response); err != nil {
+		return errors.Wrap(err, "error checking proposal")
+	}
+	if response.State != Accepted {
+		return fmt.Errorf("deal rejected: %s", response.Message)
+	}
+	return nil
+}
+
+func (smc *Client) recordResponse(resp *DealResponse, miner address.Address, p *DealProposal, commP proofs.CommP, startHeight *types.BlockHeight) error {
 	proposalCid, err := convert.ToCid(p)
 	if err != nil {
 		return errors.New("failed to get cid of proposal")
@@ -216,14 +313,23 @@ func (smc *Client) recordResponse(resp *DealResponse, miner address.Address, p *
 	}
 
 	smc.deals[proposalCid] = &clientDeal{
-		Miner:    miner,
-		Proposal: p,
-		Response: resp,
+		Miner:        miner,
+		Proposal:     p,
+		Response:     resp,
+		CommP:        commP[:],
+		StateChanged: time.Now().Unix(),
+		StartHeight:  startHeight.AsBigInt().Uint64(),
+		// resp is handed back to the caller, so keep a copy as evidence.
+		SignedResponses: []*DealResponse{copyDealResponse(resp)},
 	}
 	return smc.saveDeal(proposalCid)
 }
 
-func (smc *Client) checkDealResponse(ctx context.Context, resp *DealResponse) error {
+func (smc *Client) checkDealResponse(ctx context.Context, resp *DealResponse, minerWorker address.Address) error {
+	if !resp.VerifySignature(minerWorker) {
+		return fmt.Errorf("response is not signed by miner worker %s", minerWorker)
+	}
+
 	switch resp.State {
 	case Rejected:
 		return fmt.Errorf("deal rejected: %s", resp.Message)
@@ -236,25 +342,38 @@ func (smc *Client) checkDealResponse(ctx context.Context, resp *DealResponse) er
 	}
 }
 
-func (smc *Client) minerForProposal(c cid.Cid) (address.Address, error) {
+// getDeal returns a copy of the deal with the given proposal cid.
+func (smc *Client) getDeal(c cid.Cid) (clientDeal, error) {
 	smc.dealsLk.Lock()
 	defer smc.dealsLk.Unlock()
-	st, ok := smc.deals[c]
+	d, ok := smc.deals[c]
 	if !ok {
-		return address.Address{}, fmt.Errorf("no such proposal by cid: %s", c)
+		return clientDeal{}, fmt.Errorf("no such proposal by cid: %s", c)
 	}
 
-	return st.Miner, nil
+	return *d, nil
 }
 
-// QueryDeal queries an in-progress proposal.
+// QueryDeal queries an in-progress proposal. Once the miner reports the deal
+// posted, the client verifies it and reports it Verified if all checks pass,
+// or SectorVerified if only its sector could be checked.
 func (smc *Client) QueryDeal(ctx context.Context, proposalCid cid.Cid) (*DealResponse, error) {
-	mineraddr, err := smc.minerForProposal(proposalCid)
+	deal, err := smc.getDeal(proposalCid)
 	if err != nil {
 		return nil, err
 	}
+	// Replaced deals were failed by the client itself; the miner would
+	// still report them as it last saw them.
+	if deal.Response.State == Verified || deal.ReplacedBy != nil {
+		return deal.Response, nil
+	}
 
-	minerpid, err := smc.api.MinerGetPeerID(ctx, mineraddr)
+	minerpid, err := smc.api.MinerGetPeerID(ctx, deal.Miner)
+	if err != nil {
+		return nil, err
+	}
+
+	minerWorker, err := smc.api.MinerGetWorkerAddress(ctx, deal.Miner)
 	if err != nil {
 		return nil, err
 	}
@@ -265,10 +384,62 @@ func (smc *Client) QueryDeal(ctx context.Context, proposalCid cid.Cid) (*DealRes
 	if err != nil {
 		return nil, errors.Wrap(err, "error querying deal")
 	}
+	if !resp.VerifySignature(minerWorker) {
+		return nil, fmt.Errorf("query response is not signed by miner worker %s", minerWorker)
+	}
+	signed := copyDealResponse(&resp)
+
+	if resp.State == Posted {
+		state, err := smc.verifyDeal(ctx, &deal, &resp)
+		if err != nil {
+			resp.Message = fmt.Sprintf("posted but not verified: %s", err)
+		} else {
+			resp.State = state
+		}
+	}
+
+	if err := smc.updateDealResponse(proposalCid, &resp, signed); err != nil {
+		return nil, err
+	}
 
 	return &resp, nil
 }
 
+// updateDealResponse sets the deal's response to resp, and adds signed, the
+// response as the miner sent it, to its history unless it is unchanged.
+func (smc *Client) updateDealResponse(proposalCid cid.Cid, resp *DealResponse, signed *DealResponse) error {
+	smc.dealsLk.Lock()
+	defer smc.dealsLk.Unlock()
+
+	d, ok := smc.deals[proposalCid]
+	if !ok {
+		return fmt.Errorf("no such proposal by cid: %s", proposalCid)
+	}
+	if d.Response == nil || d.Response.State != resp.State {
+		d.StateChanged = time.Now().Unix()
+	}
+	d.Response = resp
+	if n := len(d.SignedResponses); n == 0 || !bytes.Equal(d.SignedResponses[n-1].Signature, signed.Signature) {
+		d.SignedResponses = append(d.SignedResponses, signed)
+	}
+	return smc.saveDeal(proposalCid)
+}
+
+// DealHistory returns the signed responses the miner sent for the deal with
+// the given proposal cid, oldest first.
+func (smc *Client) DealHistory(proposalCid cid.Cid) ([]*DealResponse, error) {
+	deal, err := smc.getDeal(proposalCid)
+	if err != nil {
+		return nil, err
+	}
+	return deal.SignedResponses, nil
+}
+
+func copyDealResponse(resp *DealResponse) *DealResponse {
+	c := *resp
+	return &c
+}
+
 func (smc *Client) loadDeals() error {
 	res, err := smc.dealsDs.Query(query.Query{
 		Prefix: "/" + clientDatastorePrefix,
@@ -278,6 +449,7 @@ func (smc *Client) loadDeals() error {
 	}
 
 	smc.deals = make(map[cid.Cid]*clientDeal)
+	indexed := make(map[cid.Cid]map[string]string)
 
 	for entry := range res.Next() {
 		var deal clientDeal
@@ -285,9 +457,10 @@ func (smc *Client) loadDeals() error {
 			return errors.Wrap(err, "failed to unmarshal deals from datastore")
 		}
 		smc.deals[deal.Response.ProposalCid] = &deal
+		indexed[deal.Response.ProposalCid] = indexFields(deal.Proposal, deal.Response.State)
 	}
 
-	return nil
+	return smc.getDealIndex().rebuild(indexed)
 }
 
 func (smc *Client) saveDeal(cid cid.Cid) error {
@@ -305,7 +478,63 @@ func (smc *Client) saveDeal(cid cid.Cid) error {
 	if err != nil {
 		return errors.Wrap(err, "could not save client deal to disk, in-memory deals differ from persisted deals!")
 	}
-	return nil
+	return smc.getDealIndex().update(cid, indexFields(deal.Proposal, deal.Response.State))
+}
+
+// getDealIndex returns the index of the client's deals. Callers must hold
+// dealsLk, or otherwise have the client to themselves.
+func (smc *Client) getDealIndex() *dealIndex {
+	if smc.index == nil {
+		smc.index = newDealIndex(smc.dealsDs, clientDatastorePrefix)
+	}
+	return smc.index
+}
+
+// ListDeals returns the client's deals matching filter, most recently changed
+// first.
+func (smc *Client) ListDeals(filter DealFilter) ([]*DealSummary, error) {
+	smc.dealsLk.Lock()
+	defer smc.dealsLk.Unlock()
+
+	matches, err := smc.getDealIndex().find(filterFields(filter))
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the deals the index matched are visited, unless every deal does.
+	if matches == nil {
+		matches = make(map[cid.Cid]bool, len(smc.deals))
+		for c := range smc.deals {
+			matches[c] = true
+		}
+	}
+
+	var deals []*DealSummary
+	for c := range matches {
+		d, ok := smc.deals[c]
+		if !ok {
+			continue
+		}
+		summary := &DealSummary{
+			ProposalCid:  c,
+			State:        d.Response.State,
+			Message:      d.Response.Message,
+			Miner:        d.Miner,
+			Client:       d.Proposal.Payment.Payer,
+			PieceRef:     d.Proposal.PieceRef,
+			Size:         d.Proposal.Size,
+			TotalPrice:   d.Proposal.TotalPrice,
+			Duration:     d.Proposal.Duration,
+			StateChanged: time.Unix(d.StateChanged, 0),
+		}
+		if d.Response.ProofInfo != nil {
+			sectorID := d.Response.ProofInfo.SectorID
+			summary.SectorID = &sectorID
+		}
+		deals = append(deals, summary)
+	}
+	sortDealSummaries(deals)
+	return deals, nil
 }
 
 func (smc *Client) isMaybeDupDeal(p *DealProposal) bool {
@@ -367,15 +596,53 @@ func (cni *ClientNodeImpl) GetFileSize(ctx context.Context, c cid.Cid) (uint64,
 	return getFileSize(ctx, c, cni.dserv)
 }
 
-// MakeProtocolRequest makes a request and expects a response from the host using the given protocol.
-func (cni *ClientNodeImpl) MakeProtocolRequest(ctx context.Context, protocol protocol.ID, peer peer.ID, request interface{}, response interface{}) error {
+// GetPieceCommitment computes the commitment of the first size bytes of the
+// file referenced by 'c', as miners compute it when staging the file.
+func (cni *ClientNodeImpl) GetPieceCommitment(ctx context.Context, c cid.Cid, size uint64) (proofs.CommP, error) {
+	nd, err := cni.dserv.Get(ctx, c)
+	if err != nil {
+		return proofs.CommP{}, err
+	}
+	r, err := uio.NewDagReader(ctx, nd, cni.dserv)
+	if err != nil {
+		return proofs.CommP{}, err
+	}
+	return proofs.GeneratePieceCommitment(r, size)
+}
+
+// OpenStream opens a stream to the peer using the given protocol.
+func (cni *ClientNodeImpl) OpenStream(ctx context.Context, peer peer.ID, protocol protocol.ID) (inet.Stream, error) {
 	s, err := cni.host.NewStream(ctx, peer, protocol)
 	if err != nil {
 		if err == multistream.ErrNotSupported {
-			return errors.New("could not establish connection with peer. Peer does not support protocol")
+			return nil, errors.New("could not establish connection with peer. Peer does not support protocol")
 		}
 
-		return errors.Wrap(err, "failed to establish connection with the peer")
+		return nil, errors.Wrap(err, "failed to establish connection with the peer")
+	}
+	return s, nil
+}
+
+// Host returns the client node's libp2p host.
+func (cni *ClientNodeImpl) Host() host.Host {
+	return cni.host
+}
+
+// RetrievePiece retrieves the piece from the miner with the given peer id.
+func (cni *ClientNodeImpl) RetrievePiece(ctx context.Context, miner peer.ID, piece cid.Cid) (io.ReadCloser, error) {
+	return retrieval.NewClient(cni).RetrievePiece(ctx, miner, piece)
+}
+
+// DAGService returns the DAG service holding the client's data.
+func (cni *ClientNodeImpl) DAGService() ipld.DAGService {
+	return cni.dserv
+}
+
+// MakeProtocolRequest makes a request and expects a response from the host using the given protocol.
+func (cni *ClientNodeImpl) MakeProtocolRequest(ctx context.Context, protocol protocol.ID, peer peer.ID, request interface{}, response interface{}) error {
+	s, err := cni.OpenStream(ctx, peer, protocol)
+	if err != nil {
+		return err
 	}
 
 	if err := cbu.NewMsgWriter(s).WriteMsg(request); err != nil {
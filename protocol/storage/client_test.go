@@ -2,20 +2,26 @@ package storage
 
 import (
 	"context"
+	"io"
 	"math/big"
 	"testing"
 	"time"
 
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	ipld "gx/ipfs/QmRL22E4paat7ky7vx9MLpR97JHHbFPrg3ytFQw6qp1y1s/go-ipld-format"
+	inet "gx/ipfs/QmTGxDz2CjBucFzPNTiWwzQmTWdrBnzqbqrMucDYMsjuPb/go-libp2p-net"
 	"gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
 	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore/query"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
 	"gx/ipfs/QmZNkThpqfVXs9GNbexPrfBbXSLNYeKrE7jwFM2oqHbyqN/go-libp2p-protocol"
 	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
 
 	"github.com/filecoin-project/go-filecoin/actor/builtin/miner"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/config"
 	"github.com/filecoin-project/go-filecoin/porcelain"
+	"github.com/filecoin-project/go-filecoin/proofs"
 	"github.com/filecoin-project/go-filecoin/repo"
 	"github.com/filecoin-project/go-filecoin/types"
 	"github.com/filecoin-project/go-filecoin/util/convert"
@@ -25,6 +31,16 @@ import (
 
 var testSignature = types.Signature("<test signature>")
 
+// testMinerSigner holds the keys of testMinerWorker and testMinerOwner, the
+// worker and owner of every miner test clients deal with. testClientNode
+// signs responses with the worker key.
+var testMinerSigner = types.NewMockSigner(types.MustGenerateKeyInfo(2, types.GenerateKeyInfoSeed()))
+var testMinerWorker = testMinerSigner.Addresses[0]
+var testMinerOwner = testMinerSigner.Addresses[1]
+
+// testCommP is the piece commitment test client nodes compute for any data.
+var testCommP = proofs.CommP{3}
+
 func TestProposeDeal(t *testing.T) {
 	require := require.New(t)
 	assert := assert.New(t)
@@ -51,7 +67,7 @@ func TestProposeDeal(t *testing.T) {
 	testAPI := newTestClientAPI(require)
 	testRepo := repo.NewInMemoryRepo()
 
-	client, err := NewClient(testNode, testAPI, testRepo.DealsDs)
+	client, err := NewClient(testNode, testAPI, testRepo.DealsDs, proofs.NewFakeVerifier(true, nil))
 	require.NoError(err)
 
 	dataCid := cidCreator()
@@ -59,7 +75,7 @@ func TestProposeDeal(t *testing.T) {
 	ctx := context.Background()
 	askID := uint64(67)
 	duration := uint64(10000)
-	dealResponse, err := client.ProposeDeal(ctx, minerAddr, dataCid, askID, duration, false)
+	dealResponse, err := client.ProposeDeal(ctx, minerAddr, dataCid, askID, duration, false, TransferOffline)
 	require.NoError(err)
 
 	t.Run("and creates proposal from parameters", func(t *testing.T) {
@@ -67,6 +83,7 @@ func TestProposeDeal(t *testing.T) {
 		assert.Equal(duration, proposal.Duration)
 		assert.Equal(minerAddr, proposal.MinerAddress)
 		assert.Equal(testSignature, proposal.Signature)
+		assert.Equal(TransferOffline, proposal.TransferMode)
 	})
 
 	t.Run("and creates proposal with file size", func(t *testing.T) {
@@ -104,6 +121,12 @@ func TestProposeDeal(t *testing.T) {
 		}
 	})
 
+	t.Run("and records the piece commitment of the data", func(t *testing.T) {
+		deal, err := client.getDeal(dealResponse.ProposalCid)
+		require.NoError(err)
+		assert.Equal(testCommP[:], deal.CommP)
+	})
+
 	t.Run("and sends proposal and stores response", func(t *testing.T) {
 		assert.NotNil(dealResponse)
 
@@ -128,14 +151,231 @@ func TestProposeDeal(t *testing.T) {
 	})
 }
 
+func TestProposeDealChecksBeforePaying(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// The miner rejects the proposal when asked whether it would accept it.
+	testNode := newTestClientNode(func(request interface{}) (interface{}, error) {
+		p := request.(*SignedDealProposal)
+		require.Nil(p.Payment.Channel)
+		return &DealResponse{State: Rejected, Message: "too busy"}, nil
+	})
+	testAPI := newTestClientAPI(require)
+
+	client, err := NewClient(testNode, testAPI, repo.NewInMemoryRepo().DealsDs, proofs.NewFakeVerifier(true, nil))
+	require.NoError(err)
+
+	_, err = client.ProposeDeal(context.Background(), address.TestAddress, types.SomeCid(), 1, 10000, false, TransferOffline)
+	require.Error(err)
+	assert.Contains(err.Error(), "too busy")
+	assert.Equal(0, testAPI.paymentsCreated)
+}
+
+func TestQueryDealVerification(t *testing.T) {
+	cidCreator := types.NewCidForTestGetter()
+
+	var sector types.Commitments
+	sector.CommD[0] = 1
+	sector.CommR[0] = 2
+	commP := testCommP[:]
+
+	tests := []struct {
+		name      string
+		proofInfo *ProofInfo
+		verifier  proofs.Verifier
+		state     DealState
+		message   string
+	}{
+		{
+			name:      "verifies deals sealed into a committed sector",
+			proofInfo: &ProofInfo{SectorID: 7, CommR: sector.CommR[:], CommD: sector.CommD[:], CommP: commP, PieceInclusionProof: []byte{1}},
+			verifier:  proofs.NewFakeVerifier(true, nil),
+			state:     Verified,
+		},
+		{
+			name:      "rejects sectors not committed on chain",
+			proofInfo: &ProofInfo{SectorID: 8, CommR: sector.CommR[:], CommD: sector.CommD[:], CommP: commP, PieceInclusionProof: []byte{1}},
+			verifier:  proofs.NewFakeVerifier(true, nil),
+			state:     Posted,
+			message:   "sector 8 is not committed on chain",
+		},
+		{
+			name:      "rejects commitments differing from the chain",
+			proofInfo: &ProofInfo{SectorID: 7, CommR: sector.CommR[:], CommD: make([]byte, 32), CommP: commP, PieceInclusionProof: []byte{1}},
+			verifier:  proofs.NewFakeVerifier(true, nil),
+			state:     Posted,
+			message:   "CommD of sector 7 does not match",
+		},
+		{
+			name:      "rejects piece commitments differing from the deal's",
+			proofInfo: &ProofInfo{SectorID: 7, CommR: sector.CommR[:], CommD: sector.CommD[:], CommP: make([]byte, 32), PieceInclusionProof: []byte{1}},
+			verifier:  proofs.NewFakeVerifier(true, nil),
+			state:     Posted,
+			message:   "piece commitment does not match",
+		},
+		{
+			name:      "requires a piece inclusion proof",
+			proofInfo: &ProofInfo{SectorID: 7, CommR: sector.CommR[:], CommD: sector.CommD[:], CommP: commP},
+			verifier:  proofs.NewFakeVerifier(true, nil),
+			state:     Posted,
+			message:   "no piece inclusion proof",
+		},
+		{
+			name:      "rejects invalid piece inclusion proofs",
+			proofInfo: &ProofInfo{SectorID: 7, CommR: sector.CommR[:], CommD: sector.CommD[:], CommP: commP, PieceInclusionProof: []byte{1}},
+			verifier:  proofs.NewFakeVerifier(false, nil),
+			state:     Posted,
+			message:   "invalid piece inclusion proof",
+		},
+		{
+			name:      "only verifies the sector without piece inclusion proof support",
+			proofInfo: &ProofInfo{SectorID: 7, CommR: sector.CommR[:], CommD: sector.CommD[:]},
+			verifier:  proofs.NewFakeVerifier(false, proofs.ErrPieceInclusionProofsUnsupported),
+			state:     SectorVerified,
+		},
+		{
+			name:      "checks the sector without piece inclusion proof support",
+			proofInfo: &ProofInfo{SectorID: 7, CommR: make([]byte, 32), CommD: sector.CommD[:]},
+			verifier:  proofs.NewFakeVerifier(false, proofs.ErrPieceInclusionProofsUnsupported),
+			state:     Posted,
+			message:   "CommR of sector 7 does not match",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			proposalCid := cidCreator()
+			testNode := newTestClientNode(func(request interface{}) (interface{}, error) {
+				return &DealResponse{State: Posted, ProposalCid: proposalCid, ProofInfo: test.proofInfo}, nil
+			})
+			testAPI := newTestClientAPI(require)
+			testAPI.commitments = map[string]types.Commitments{"7": sector}
+
+			client, err := NewClient(testNode, testAPI, repo.NewInMemoryRepo().DealsDs, test.verifier)
+			require.NoError(err)
+			client.deals[proposalCid] = &clientDeal{
+				Miner:    address.TestAddress,
+				Proposal: &DealProposal{Size: types.NewBytesAmount(100)},
+				Response: &DealResponse{State: Accepted, ProposalCid: proposalCid},
+				CommP:    testCommP[:],
+			}
+
+			resp, err := client.QueryDeal(context.Background(), proposalCid)
+			require.NoError(err)
+			assert.Equal(test.state, resp.State)
+			assert.Contains(resp.Message, test.message)
+
+			// The outcome is recorded in the client's deal store.
+			deal, err := client.getDeal(proposalCid)
+			require.NoError(err)
+			assert.Equal(test.state, deal.Response.State)
+
+			// The miner's response is kept as it signed it.
+			require.Len(deal.SignedResponses, 1)
+			assert.Equal(Posted, deal.SignedResponses[0].State)
+			assert.True(deal.SignedResponses[0].VerifySignature(testMinerWorker))
+		})
+	}
+}
+
+func TestDealResponseSignatures(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	var state DealState
+	var signature types.Signature
+	var signer address.Address
+	testNode := newTestClientNode(func(request interface{}) (interface{}, error) {
+		resp := &DealResponse{State: state, Signature: signature}
+		if p, ok := request.(*SignedDealProposal); ok {
+			pcid, err := convert.ToCid(p.DealProposal)
+			require.NoError(err)
+			resp.ProposalCid = pcid
+		} else {
+			resp.ProposalCid = request.(queryRequest).Cid
+		}
+		if signer != (address.Address{}) {
+			require.NoError(resp.Sign(signer, testMinerSigner))
+		}
+		return resp, nil
+	})
+	testAPI := newTestClientAPI(require)
+
+	client, err := NewClient(testNode, testAPI, repo.NewInMemoryRepo().DealsDs, proofs.NewFakeVerifier(true, nil))
+	require.NoError(err)
+
+	cidCreator := types.NewCidForTestGetter()
+	minerAddr := address.NewForTestGetter()()
+
+	t.Run("rejects proposal responses not signed by the miner worker", func(t *testing.T) {
+		state, signature = Accepted, testSignature
+		_, err := client.ProposeDeal(ctx, minerAddr, cidCreator(), 1, 10000, false, TransferOffline)
+		require.Error(err)
+		assert.Contains(err.Error(), "not signed by miner worker")
+	})
+
+	t.Run("rejects proposal responses signed by the miner owner", func(t *testing.T) {
+		state, signature, signer = Accepted, nil, testMinerOwner
+		defer func() { signer = address.Address{} }()
+
+		_, err := client.ProposeDeal(ctx, minerAddr, cidCreator(), 1, 10000, false, TransferOffline)
+		require.Error(err)
+		assert.Contains(err.Error(), "not signed by miner worker")
+	})
+
+	state, signature = Accepted, nil
+	resp, err := client.ProposeDeal(ctx, minerAddr, cidCreator(), 1, 10000, false, TransferOffline)
+	require.NoError(err)
+	proposalCid := resp.ProposalCid
+
+	t.Run("rejects query responses not signed by the miner worker", func(t *testing.T) {
+		state, signature = Staged, testSignature
+		_, err := client.QueryDeal(ctx, proposalCid)
+		require.Error(err)
+		assert.Contains(err.Error(), "not signed by miner worker")
+
+		deal, err := client.getDeal(proposalCid)
+		require.NoError(err)
+		assert.Equal(Accepted, deal.Response.State)
+	})
+
+	t.Run("keeps each distinct signed response", func(t *testing.T) {
+		state, signature = Staged, nil
+		_, err := client.QueryDeal(ctx, proposalCid)
+		require.NoError(err)
+		_, err = client.QueryDeal(ctx, proposalCid)
+		require.NoError(err)
+
+		history, err := client.DealHistory(proposalCid)
+		require.NoError(err)
+		require.Len(history, 2)
+		assert.Equal(Accepted, history[0].State)
+		assert.Equal(Staged, history[1].State)
+		for _, resp := range history {
+			assert.True(resp.VerifySignature(testMinerWorker))
+		}
+	})
+}
+
 type clientTestAPI struct {
-	blockHeight *types.BlockHeight
-	channelID   *types.ChannelID
-	msgCid      cid.Cid
-	payer       address.Address
-	target      address.Address
-	perPayment  *types.AttoFIL
-	require     *require.Assertions
+	commitments        map[string]types.Commitments
+	candidates         []*porcelain.MinerCandidate
+	clientConfig       *config.ClientConfig
+	provingPeriodStart *types.BlockHeight
+	blockHeight        *types.BlockHeight
+	channelID          *types.ChannelID
+	msgCid             cid.Cid
+	payer              address.Address
+	target             address.Address
+	perPayment         *types.AttoFIL
+	paymentsCreated    int
+	findMinersCalls    int
+	require            *require.Assertions
 }
 
 func newTestClientAPI(require *require.Assertions) *clientTestAPI {
@@ -143,13 +383,15 @@ func newTestClientAPI(require *require.Assertions) *clientTestAPI {
 	addressGetter := address.NewForTestGetter()
 
 	return &clientTestAPI{
-		blockHeight: types.NewBlockHeight(773),
-		msgCid:      cidGetter(),
-		channelID:   types.NewChannelID(23),
-		payer:       addressGetter(),
-		target:      addressGetter(),
-		perPayment:  types.NewAttoFILFromFIL(10),
-		require:     require,
+		clientConfig:       config.NewDefaultConfig().Client,
+		provingPeriodStart: types.NewBlockHeight(0),
+		blockHeight:        types.NewBlockHeight(773),
+		msgCid:             cidGetter(),
+		channelID:          types.NewChannelID(23),
+		payer:              addressGetter(),
+		target:             addressGetter(),
+		perPayment:         types.NewAttoFILFromFIL(10),
+		require:            require,
 	}
 }
 
@@ -157,7 +399,18 @@ func (ctp *clientTestAPI) ChainBlockHeight(ctx context.Context) (*types.BlockHei
 	return ctp.blockHeight, nil
 }
 
+func (ctp *clientTestAPI) ClientFindMiners(ctx context.Context) ([]*porcelain.MinerCandidate, error) {
+	ctp.findMinersCalls++
+	return ctp.candidates, nil
+}
+
+func (ctp *clientTestAPI) ConfigGet(dottedPath string) (interface{}, error) {
+	ctp.require.Equal("client", dottedPath)
+	return ctp.clientConfig, nil
+}
+
 func (ctp *clientTestAPI) CreatePayments(ctx context.Context, config porcelain.CreatePaymentsParams) (*porcelain.CreatePaymentsReturn, error) {
+	ctp.paymentsCreated++
 	resp := &porcelain.CreatePaymentsReturn{
 		CreatePaymentsParams: config,
 		Channel:              ctp.channelID,
@@ -187,7 +440,11 @@ func (ctp *clientTestAPI) MinerGetAsk(ctx context.Context, minerAddr address.Add
 }
 
 func (ctp *clientTestAPI) MinerGetOwnerAddress(ctx context.Context, minerAddr address.Address) (address.Address, error) {
-	return address.TestAddress, nil
+	return testMinerOwner, nil
+}
+
+func (ctp *clientTestAPI) MinerGetWorkerAddress(ctx context.Context, minerAddr address.Address) (address.Address, error) {
+	return testMinerWorker, nil
 }
 
 func (ctp *clientTestAPI) MinerGetPeerID(ctx context.Context, minerAddr address.Address) (peer.ID, error) {
@@ -197,6 +454,14 @@ func (ctp *clientTestAPI) MinerGetPeerID(ctx context.Context, minerAddr address.
 	return id, nil
 }
 
+func (ctp *clientTestAPI) MinerGetProvingPeriodStart(ctx context.Context, minerAddr address.Address) (*types.BlockHeight, error) {
+	return ctp.provingPeriodStart, nil
+}
+
+func (ctp *clientTestAPI) MinerGetSectorCommitments(ctx context.Context, minerAddr address.Address) (map[string]types.Commitments, error) {
+	return ctp.commitments, nil
+}
+
 func (ctp *clientTestAPI) GetAndMaybeSetDefaultSenderAddress() (address.Address, error) {
 	// always just default address
 	return ctp.payer, nil
@@ -224,6 +489,10 @@ func (tcn *testClientNode) GetFileSize(context.Context, cid.Cid) (uint64, error)
 	return 1000000000, nil
 }
 
+func (tcn *testClientNode) GetPieceCommitment(context.Context, cid.Cid, uint64) (proofs.CommP, error) {
+	return testCommP, nil
+}
+
 func (tcn *testClientNode) MakeProtocolRequest(ctx context.Context, protocol protocol.ID, peer peer.ID, request interface{}, response interface{}) error {
 	dealResponse := response.(*DealResponse)
 	res, err := tcn.responder(request)
@@ -231,5 +500,21 @@ func (tcn *testClientNode) MakeProtocolRequest(ctx context.Context, protocol pro
 		return err
 	}
 	*dealResponse = *res.(*DealResponse)
+	// Responders set a signature only to test bad ones.
+	if dealResponse.Signature == nil {
+		return dealResponse.Sign(testMinerWorker, testMinerSigner)
+	}
 	return nil
 }
+
+func (tcn *testClientNode) OpenStream(context.Context, peer.ID, protocol.ID) (inet.Stream, error) {
+	return nil, errors.New("no streams in test node")
+}
+
+func (tcn *testClientNode) DAGService() ipld.DAGService {
+	return nil
+}
+
+func (tcn *testClientNode) RetrievePiece(context.Context, peer.ID, cid.Cid) (io.ReadCloser, error) {
+	return nil, errors.New("no retrieval in test node")
+}
@@ -0,0 +1,237 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore/query"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// dealIndexDatastorePrefix namespaces the deal indexes in the deals
+// datastore. It must not share a prefix with the namespaces holding deals.
+const dealIndexDatastorePrefix = "dealindex"
+
+// Fields deals are indexed by.
+const (
+	indexByState  = "state"
+	indexByMiner  = "miner"
+	indexByClient = "client"
+	indexByPiece  = "piece"
+)
+
+// DealFilter selects deals to list. Zero valued fields match every deal.
+type DealFilter struct {
+	State    DealState
+	Miner    address.Address
+	Client   address.Address
+	PieceRef cid.Cid
+}
+
+// DealSummary describes a deal as listed by ListDeals.
+type DealSummary struct {
+	ProposalCid cid.Cid
+	State       DealState
+	Message     string
+	Miner       address.Address
+	Client      address.Address
+	PieceRef    cid.Cid
+	Size        *types.BytesAmount
+	TotalPrice  *types.AttoFIL
+	Duration    uint64
+	// SectorID is the sector the piece is in, if known.
+	SectorID *uint64
+	// StateChanged is when the deal last changed state.
+	StateChanged time.Time
+}
+
+// indexFields returns the index fields of the deal with the given proposal
+// and state.
+func indexFields(p *DealProposal, state DealState) map[string]string {
+	fields := map[string]string{
+		indexByState:  strconv.Itoa(int(state)),
+		indexByMiner:  p.MinerAddress.String(),
+		indexByClient: p.Payment.Payer.String(),
+	}
+	if p.PieceRef.Defined() {
+		fields[indexByPiece] = p.PieceRef.String()
+	}
+	return fields
+}
+
+// filterFields returns the index fields f selects on.
+func filterFields(f DealFilter) map[string]string {
+	fields := map[string]string{}
+	if f.State != Unknown {
+		fields[indexByState] = strconv.Itoa(int(f.State))
+	}
+	if !f.Miner.Empty() {
+		fields[indexByMiner] = f.Miner.String()
+	}
+	if !f.Client.Empty() {
+		fields[indexByClient] = f.Client.String()
+	}
+	if f.PieceRef.Defined() {
+		fields[indexByPiece] = f.PieceRef.String()
+	}
+	return fields
+}
+
+// dealIndex maintains secondary indexes of the deals in a deals datastore,
+// one entry per indexed field, so deals can be found without decoding all of
+// them. Entries are keys of the form
+// /dealindex/<namespace>/<field>/<value>/<proposal cid> with empty values.
+type dealIndex struct {
+	ds        repo.Datastore
+	namespace string
+
+	lk sync.Mutex
+	// keys holds the current index keys of each deal, to remove them when
+	// the deal changes.
+	keys map[cid.Cid][]datastore.Key
+}
+
+func newDealIndex(ds repo.Datastore, namespace string) *dealIndex {
+	return &dealIndex{
+		ds:        ds,
+		namespace: namespace,
+		keys:      make(map[cid.Cid][]datastore.Key),
+	}
+}
+
+func (di *dealIndex) fieldKey(field, value string) datastore.Key {
+	return datastore.KeyWithNamespaces([]string{dealIndexDatastorePrefix, di.namespace, field, value})
+}
+
+// update replaces the index entries of the deal with proposal cid c.
+func (di *dealIndex) update(c cid.Cid, fields map[string]string) error {
+	di.lk.Lock()
+	defer di.lk.Unlock()
+
+	newKeys := make(map[datastore.Key]bool)
+	for field, value := range fields {
+		newKeys[di.fieldKey(field, value).ChildString(c.String())] = true
+	}
+
+	for _, k := range di.keys[c] {
+		if newKeys[k] {
+			delete(newKeys, k)
+			continue
+		}
+		if err := di.ds.Delete(k); err != nil {
+			return errors.Wrap(err, "failed to remove deal index entry")
+		}
+	}
+	for k := range newKeys {
+		if err := di.ds.Put(k, []byte{}); err != nil {
+			return errors.Wrap(err, "failed to add deal index entry")
+		}
+	}
+
+	keys := make([]datastore.Key, 0, len(fields))
+	for field, value := range fields {
+		keys = append(keys, di.fieldKey(field, value).ChildString(c.String()))
+	}
+	di.keys[c] = keys
+	return nil
+}
+
+// rebuild drops all index entries and indexes the given deals, so that
+// entries left stale by a crash do not survive a restart.
+func (di *dealIndex) rebuild(deals map[cid.Cid]map[string]string) error {
+	res, err := di.ds.Query(query.Query{
+		Prefix:   datastore.KeyWithNamespaces([]string{dealIndexDatastorePrefix, di.namespace}).String(),
+		KeysOnly: true,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to query deal index")
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return errors.Wrap(err, "failed to read deal index")
+	}
+	for _, e := range entries {
+		if err := di.ds.Delete(datastore.NewKey(e.Key)); err != nil {
+			return errors.Wrap(err, "failed to clear deal index")
+		}
+	}
+
+	di.lk.Lock()
+	di.keys = make(map[cid.Cid][]datastore.Key)
+	di.lk.Unlock()
+
+	for c, fields := range deals {
+		if err := di.update(c, fields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookup returns the proposal cids of the deals whose field has value.
+func (di *dealIndex) lookup(field, value string) (map[cid.Cid]bool, error) {
+	prefix := di.fieldKey(field, value)
+	res, err := di.ds.Query(query.Query{Prefix: prefix.String(), KeysOnly: true})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query deal index")
+	}
+
+	found := make(map[cid.Cid]bool)
+	for e := range res.Next() {
+		if e.Error != nil {
+			return nil, errors.Wrap(e.Error, "failed to read deal index")
+		}
+		k := datastore.NewKey(e.Key)
+		// Prefixes match strings, so skip other values sharing a prefix.
+		if !k.Parent().Equal(prefix) {
+			continue
+		}
+		c, err := cid.Decode(k.BaseNamespace())
+		if err != nil {
+			return nil, fmt.Errorf("invalid deal index entry %s", k)
+		}
+		found[c] = true
+	}
+	return found, nil
+}
+
+// find returns the proposal cids of the deals matching all fields, or nil
+// if fields is empty and every deal matches.
+func (di *dealIndex) find(fields map[string]string) (map[cid.Cid]bool, error) {
+	var matches map[cid.Cid]bool
+	for field, value := range fields {
+		found, err := di.lookup(field, value)
+		if err != nil {
+			return nil, err
+		}
+		if matches == nil {
+			matches = found
+			continue
+		}
+		for c := range matches {
+			if !found[c] {
+				delete(matches, c)
+			}
+		}
+	}
+	if matches == nil && len(fields) > 0 {
+		matches = map[cid.Cid]bool{}
+	}
+	return matches, nil
+}
+
+// sortDealSummaries orders deals from the most recently changed.
+func sortDealSummaries(deals []*DealSummary) {
+	sort.Slice(deals, func(i, j int) bool {
+		return deals[i].StateChanged.After(deals[j].StateChanged)
+	})
+}
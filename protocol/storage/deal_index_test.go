@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestMinerListDeals(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dealsDs := repo.NewInMemoryRepo().DealsDatastore()
+	newMiner := func() *Miner {
+		sm := &Miner{deals: make(map[cid.Cid]*storageDeal), dealsDs: dealsDs}
+		require.NoError(sm.loadDeals())
+		return sm
+	}
+
+	newAddr := address.NewForTestGetter()
+	minerAddr, alice, bob := newAddr(), newAddr(), newAddr()
+	newCid := types.NewCidForTestGetter()
+	piece := newCid()
+
+	sm := newMiner()
+	addDeal := func(client address.Address, pieceRef cid.Cid, state DealState) cid.Cid {
+		c := newCid()
+		sm.deals[c] = &storageDeal{
+			Proposal: &DealProposal{
+				PieceRef:     pieceRef,
+				Size:         types.NewBytesAmount(1000),
+				TotalPrice:   types.NewAttoFILFromFIL(10),
+				Duration:     100,
+				MinerAddress: minerAddr,
+				Payment:      PaymentInfo{Payer: client},
+			},
+			Response: &DealResponse{State: state, ProposalCid: c},
+		}
+		require.NoError(sm.saveDeal(c))
+		return c
+	}
+	aliceAccepted := addDeal(alice, piece, Accepted)
+	aliceStaged := addDeal(alice, newCid(), Staged)
+	bobAccepted := addDeal(bob, piece, Accepted)
+
+	proposalCids := func(deals []*DealSummary) []cid.Cid {
+		var cids []cid.Cid
+		for _, d := range deals {
+			cids = append(cids, d.ProposalCid)
+		}
+		return cids
+	}
+
+	t.Run("filters on each field", func(t *testing.T) {
+		all, err := sm.ListDeals(DealFilter{})
+		require.NoError(err)
+		assert.Len(all, 3)
+
+		accepted, err := sm.ListDeals(DealFilter{State: Accepted})
+		require.NoError(err)
+		assert.Len(accepted, 2)
+		assert.Contains(proposalCids(accepted), aliceAccepted)
+		assert.Contains(proposalCids(accepted), bobAccepted)
+
+		fromAlice, err := sm.ListDeals(DealFilter{Client: alice})
+		require.NoError(err)
+		assert.Len(fromAlice, 2)
+		assert.Contains(proposalCids(fromAlice), aliceAccepted)
+		assert.Contains(proposalCids(fromAlice), aliceStaged)
+
+		ofPiece, err := sm.ListDeals(DealFilter{Client: alice, PieceRef: piece})
+		require.NoError(err)
+		assert.Equal([]cid.Cid{aliceAccepted}, proposalCids(ofPiece))
+
+		withOtherMiner, err := sm.ListDeals(DealFilter{Miner: newAddr()})
+		require.NoError(err)
+		assert.Empty(withOtherMiner)
+	})
+
+	t.Run("follows state changes", func(t *testing.T) {
+		require.NoError(sm.updateDealResponse(bobAccepted, func(resp *DealResponse) {
+			resp.State = Staged
+		}))
+		sm.deals[bobAccepted].SectorID = 9
+
+		staged, err := sm.ListDeals(DealFilter{State: Staged})
+		require.NoError(err)
+		// The most recently changed deal comes first.
+		assert.Equal([]cid.Cid{bobAccepted, aliceStaged}, proposalCids(staged))
+		require.NotNil(staged[0].SectorID)
+		assert.Equal(uint64(9), *staged[0].SectorID)
+		assert.NotZero(staged[0].StateChanged.Unix())
+
+		accepted, err := sm.ListDeals(DealFilter{State: Accepted})
+		require.NoError(err)
+		assert.Equal([]cid.Cid{aliceAccepted}, proposalCids(accepted))
+	})
+
+	t.Run("drops stale entries on restart", func(t *testing.T) {
+		stale := datastore.KeyWithNamespaces([]string{dealIndexDatastorePrefix, minerDatastorePrefix, indexByState, "2", newCid().String()})
+		require.NoError(dealsDs.Put(stale, []byte{}))
+
+		restarted := newMiner()
+		accepted, err := restarted.ListDeals(DealFilter{State: Accepted})
+		require.NoError(err)
+		assert.Equal([]cid.Cid{aliceAccepted}, proposalCids(accepted))
+
+		has, err := dealsDs.Has(stale)
+		require.NoError(err)
+		assert.False(has)
+	})
+}
+
+func TestClientListDeals(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	smc := &Client{
+		deals:   make(map[cid.Cid]*clientDeal),
+		dealsDs: repo.NewInMemoryRepo().DealsDatastore(),
+	}
+
+	newAddr := address.NewForTestGetter()
+	minerA, minerB := newAddr(), newAddr()
+	newCid := types.NewCidForTestGetter()
+
+	addDeal := func(miner address.Address, resp DealResponse) cid.Cid {
+		c := newCid()
+		resp.ProposalCid = c
+		smc.deals[c] = &clientDeal{
+			Miner:    miner,
+			Proposal: &DealProposal{PieceRef: newCid(), MinerAddress: miner, Size: types.NewBytesAmount(1000)},
+			Response: &resp,
+		}
+		require.NoError(smc.saveDeal(c))
+		return c
+	}
+	addDeal(minerA, DealResponse{State: Accepted})
+	posted := addDeal(minerB, DealResponse{State: Posted, ProofInfo: &ProofInfo{SectorID: 5}})
+
+	deals, err := smc.ListDeals(DealFilter{Miner: minerB})
+	require.NoError(err)
+	require.Len(deals, 1)
+	assert.Equal(posted, deals[0].ProposalCid)
+	assert.Equal(Posted, deals[0].State)
+	require.NotNil(deals[0].SectorID)
+	assert.Equal(uint64(5), *deals[0].SectorID)
+
+	deals, err = smc.ListDeals(DealFilter{Miner: minerA, State: Posted})
+	require.NoError(err)
+	assert.Empty(deals)
+}
+
+func TestParseDealState(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, state := range dealStates {
+		parsed, err := ParseDealState(state.String())
+		assert.NoError(err)
+		assert.Equal(state, parsed)
+	}
+
+	for _, name := range []string{"unknown", DealState(len(dealStates) + 1).String(), "bogus"} {
+		_, err := ParseDealState(name)
+		assert.Error(err, name)
+	}
+}
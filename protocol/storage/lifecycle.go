@@ -0,0 +1,345 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	imp "gx/ipfs/QmRDWTzVdbHXdtat7tVJ7YC7kRaW7rTZTEF79yykcLYa49/go-unixfs/importer"
+	ipld "gx/ipfs/QmRL22E4paat7ky7vx9MLpR97JHHbFPrg3ytFQw6qp1y1s/go-ipld-format"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	chunk "gx/ipfs/QmXivYDjgMqNQXbEQVC7TMuZnRADCa71ABQUQxWPZPTLbd/go-ipfs-chunker"
+
+	"github.com/filecoin-project/go-filecoin/actor/builtin/miner"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/config"
+	"github.com/filecoin-project/go-filecoin/porcelain"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+const (
+	// maxManageAttempts is the number of times the client tries to renew or
+	// repair a deal before giving up on it.
+	maxManageAttempts = 5
+
+	// manageRetryBlocks is the number of blocks the client waits before
+	// trying again to renew or repair a deal, doubled after each failure.
+	manageRetryBlocks = 10
+)
+
+// OnNewHeaviestTipSet is a callback called by node, everytime the latest head
+// is updated. It renews deals that are about to end and repairs deals whose
+// miner stopped proving, as set in the client section of the config.
+func (smc *Client) OnNewHeaviestTipSet(ts types.TipSet) {
+	height, err := ts.Height()
+	if err != nil {
+		log.Errorf("failed to get height of new head: %s", err)
+		return
+	}
+
+	// Proposing deals takes several blocks, so skip heads that arrive while
+	// the previous one is still being handled.
+	if !atomic.CompareAndSwapInt32(&smc.managing, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&smc.managing, 0)
+		smc.manageDeals(context.Background(), height)
+	}()
+}
+
+func (smc *Client) getClientConfig() (*config.ClientConfig, error) {
+	cfg, err := smc.api.ConfigGet("client")
+	if err != nil {
+		return nil, err
+	}
+	clientConfig, ok := cfg.(*config.ClientConfig)
+	if !ok {
+		return nil, errors.New("Could not retrieve client from config")
+	}
+	return clientConfig, nil
+}
+
+// manageDeals renews and repairs the client's deals at chain height height.
+func (smc *Client) manageDeals(ctx context.Context, height uint64) {
+	cfg, err := smc.getClientConfig()
+	if err != nil {
+		log.Errorf("failed to get client config: %s", err)
+		return
+	}
+	if cfg.RenewBeforeBlocks == 0 && !cfg.RepairDeals {
+		return
+	}
+
+	// Miners are found at most once per pass, and only if a deal needs a
+	// new one.
+	var candidates []*porcelain.MinerCandidate
+	var findErr error
+	found := false
+	findMiners := func() ([]*porcelain.MinerCandidate, error) {
+		if !found {
+			candidates, findErr = smc.api.ClientFindMiners(ctx)
+			found = true
+		}
+		return candidates, findErr
+	}
+
+	for _, d := range smc.dealsSnapshot() {
+		end := d.endHeight()
+		if end != 0 && height >= end {
+			continue
+		}
+		if d.ManageAttempts >= maxManageAttempts || height < d.NextManageHeight {
+			continue
+		}
+
+		if cfg.RepairDeals && d.ReplacedBy == nil && isSealedState(d.Response.State) {
+			if reason := smc.checkProving(ctx, d, height); reason != "" {
+				smc.repairDeal(ctx, findMiners, d, height, reason)
+				continue
+			}
+		}
+
+		if cfg.RenewBeforeBlocks > 0 && d.RenewedBy == nil && end != 0 && height+cfg.RenewBeforeBlocks >= end && isLiveState(d.Response.State) {
+			smc.renewDeal(ctx, findMiners, d, height, cfg.RenewWithSameMiner)
+		}
+	}
+}
+
+// recordManageFailure records a failed attempt to renew or repair the deal
+// with proposal cid c at height, so that the next attempt is made later, or
+// not at all once there were too many.
+func (smc *Client) recordManageFailure(c cid.Cid, height uint64) {
+	smc.dealsLk.Lock()
+	defer smc.dealsLk.Unlock()
+
+	deal, ok := smc.deals[c]
+	if !ok {
+		return
+	}
+	deal.ManageAttempts++
+	deal.NextManageHeight = height + manageRetryBlocks<<uint(deal.ManageAttempts-1)
+	if deal.ManageAttempts >= maxManageAttempts {
+		log.Errorf("giving up on renewing or repairing deal %s after %d attempts", c, deal.ManageAttempts)
+	}
+	if err := smc.saveDeal(c); err != nil {
+		log.Errorf("failed to record failed attempt on deal %s: %s", c, err)
+	}
+}
+
+// dealsSnapshot returns copies of all of the client's deals.
+func (smc *Client) dealsSnapshot() []*clientDeal {
+	smc.dealsLk.Lock()
+	defer smc.dealsLk.Unlock()
+
+	deals := make([]*clientDeal, 0, len(smc.deals))
+	for _, d := range smc.deals {
+		deal := *d
+		deals = append(deals, &deal)
+	}
+	return deals
+}
+
+// isSealedState is whether a deal in state s has had its sector committed.
+func isSealedState(s DealState) bool {
+	return s == Posted || s == Verified || s == SectorVerified || s == Complete
+}
+
+// isLiveState is whether a deal in state s is, or may still become, stored.
+func isLiveState(s DealState) bool {
+	return s != Unknown && s != Rejected && s != Failed
+}
+
+// checkProving returns why the miner of a sealed deal is no longer proving
+// its sector at height, or the empty string if it still is.
+func (smc *Client) checkProving(ctx context.Context, d *clientDeal, height uint64) string {
+	if d.Response.ProofInfo == nil {
+		return ""
+	}
+	sectorID := d.Response.ProofInfo.SectorID
+
+	commitments, err := smc.api.MinerGetSectorCommitments(ctx, d.Miner)
+	if err != nil {
+		log.Errorf("failed to get sector commitments of miner %s: %s", d.Miner, err)
+		return ""
+	}
+	if _, ok := commitments[strconv.FormatUint(sectorID, 10)]; !ok {
+		return fmt.Sprintf("sector %d is no longer committed", sectorID)
+	}
+
+	start, err := smc.api.MinerGetProvingPeriodStart(ctx, d.Miner)
+	if err != nil {
+		log.Errorf("failed to get proving period start of miner %s: %s", d.Miner, err)
+		return ""
+	}
+	deadline := start.Add(miner.ProvingPeriodBlocks).Add(miner.GracePeriodBlocks)
+	if deadline.LessThan(types.NewBlockHeight(height)) {
+		return fmt.Sprintf("miner stopped proving sector %d after block %s", sectorID, start)
+	}
+	return ""
+}
+
+// renewDeal proposes a deal continuing d once it ends, preferring d's miner
+// if sameMiner is set.
+func (smc *Client) renewDeal(ctx context.Context, findMiners func() ([]*porcelain.MinerCandidate, error), d *clientDeal, height uint64, sameMiner bool) {
+	var prefer *address.Address
+	if sameMiner {
+		prefer = &d.Miner
+	}
+
+	resp, err := smc.placePiece(ctx, findMiners, d.Proposal.PieceRef, d.Proposal.Duration, nil, prefer)
+	if err != nil {
+		log.Errorf("failed to renew deal %s: %s", d.Response.ProposalCid, err)
+		smc.recordManageFailure(d.Response.ProposalCid, height)
+		return
+	}
+
+	smc.dealsLk.Lock()
+	defer smc.dealsLk.Unlock()
+	deal, ok := smc.deals[d.Response.ProposalCid]
+	if !ok {
+		return
+	}
+	deal.RenewedBy = &resp.ProposalCid
+	if err := smc.saveDeal(d.Response.ProposalCid); err != nil {
+		log.Errorf("failed to record renewal of deal %s: %s", d.Response.ProposalCid, err)
+	}
+}
+
+// repairDeal stores the piece of d, whose miner stopped proving it, with a
+// new miner for the rest of the deal, fetching the piece from a remaining
+// replica first. d is then marked failed.
+func (smc *Client) repairDeal(ctx context.Context, findMiners func() ([]*porcelain.MinerCandidate, error), d *clientDeal, height uint64, reason string) {
+	piece := d.Proposal.PieceRef
+	sources := smc.replicasOf(piece, d.Miner)
+
+	exclude := []address.Address{d.Miner}
+	for _, src := range sources {
+		exclude = append(exclude, src.Miner)
+	}
+
+	// The data may still be held locally, so try to place it even if no
+	// replica could be retrieved.
+	if err := smc.fetchPiece(ctx, piece, sources); err != nil {
+		log.Warningf("could not retrieve piece %s to repair deal %s: %s", piece, d.Response.ProposalCid, err)
+	}
+
+	duration := d.Proposal.Duration
+	if end := d.endHeight(); end != 0 {
+		duration = end - height
+	}
+
+	resp, err := smc.placePiece(ctx, findMiners, piece, duration, exclude, nil)
+	if err != nil {
+		log.Errorf("failed to repair deal %s: %s", d.Response.ProposalCid, err)
+		smc.recordManageFailure(d.Response.ProposalCid, height)
+		return
+	}
+
+	smc.dealsLk.Lock()
+	defer smc.dealsLk.Unlock()
+	deal, ok := smc.deals[d.Response.ProposalCid]
+	if !ok {
+		return
+	}
+	failed := *deal.Response
+	failed.State = Failed
+	failed.Message = fmt.Sprintf("%s; piece replaced by deal %s", reason, resp.ProposalCid)
+	deal.Response = &failed
+	deal.StateChanged = time.Now().Unix()
+	deal.ReplacedBy = &resp.ProposalCid
+	if err := smc.saveDeal(d.Response.ProposalCid); err != nil {
+		log.Errorf("failed to record repair of deal %s: %s", d.Response.ProposalCid, err)
+	}
+}
+
+// replicasOf returns the sealed deals storing piece with miners other than
+// except.
+func (smc *Client) replicasOf(piece cid.Cid, except address.Address) []*clientDeal {
+	var replicas []*clientDeal
+	for _, d := range smc.dealsSnapshot() {
+		if d.Miner == except || d.ReplacedBy != nil || !isSealedState(d.Response.State) {
+			continue
+		}
+		if d.Proposal.PieceRef.Equals(piece) {
+			replicas = append(replicas, d)
+		}
+	}
+	return replicas
+}
+
+// fetchPiece retrieves piece from the first of sources that serves it and
+// imports it into the client's DAG.
+func (smc *Client) fetchPiece(ctx context.Context, piece cid.Cid, sources []*clientDeal) error {
+	if len(sources) == 0 {
+		return errors.New("no remaining replicas")
+	}
+
+	var lastErr error
+	for _, src := range sources {
+		nd, err := smc.retrieveFrom(ctx, src.Miner, piece)
+		if err != nil {
+			lastErr = errors.Wrapf(err, "failed to retrieve from miner %s", src.Miner)
+			continue
+		}
+		if !nd.Cid().Equals(piece) {
+			lastErr = fmt.Errorf("miner %s served data with cid %s", src.Miner, nd.Cid())
+			continue
+		}
+		return nil
+	}
+	return lastErr
+}
+
+func (smc *Client) retrieveFrom(ctx context.Context, minerAddr address.Address, piece cid.Cid) (ipld.Node, error) {
+	pid, err := smc.api.MinerGetPeerID(ctx, minerAddr)
+	if err != nil {
+		return nil, err
+	}
+	r, err := smc.node.RetrievePiece(ctx, pid, piece)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close() // nolint: errcheck
+
+	return imp.BuildDagFromReader(smc.node.DAGService(), chunk.DefaultSplitter(r))
+}
+
+// placePiece proposes a deal for piece to the best reachable miner not in
+// exclude, trying prefer first if set.
+func (smc *Client) placePiece(ctx context.Context, findMiners func() ([]*porcelain.MinerCandidate, error), piece cid.Cid, duration uint64, exclude []address.Address, prefer *address.Address) (*DealResponse, error) {
+	found, err := findMiners()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not find miners")
+	}
+
+	// The candidates are shared by the deals placed in a pass.
+	candidates := make([]*porcelain.MinerCandidate, len(found))
+	copy(candidates, found)
+	if prefer != nil {
+		for i, c := range candidates {
+			if c.Miner == *prefer {
+				copy(candidates[1:i+1], candidates[:i])
+				candidates[0] = c
+				break
+			}
+		}
+	}
+
+	lastErr := errors.New("no reachable miners")
+	for _, c := range candidates {
+		if !c.Reachable || containsAddress(exclude, c.Miner) {
+			continue
+		}
+		resp, err := smc.ProposeDeal(ctx, c.Miner, piece, c.AskID, duration, true, TransferPush)
+		if err != nil {
+			lastErr = errors.Wrapf(err, "miner %s", c.Miner)
+			continue
+		}
+		return resp, nil
+	}
+	return nil, lastErr
+}
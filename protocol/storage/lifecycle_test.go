@@ -0,0 +1,247 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/config"
+	"github.com/filecoin-project/go-filecoin/porcelain"
+	"github.com/filecoin-project/go-filecoin/proofs"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/util/convert"
+)
+
+// newLifecycleTestClient returns a client whose proposals all end in state,
+// and the API it uses.
+func newLifecycleTestClient(require *require.Assertions, state DealState) (*Client, *clientTestAPI) {
+	testNode := newTestClientNode(func(request interface{}) (interface{}, error) {
+		p := request.(*SignedDealProposal)
+		pcid, err := convert.ToCid(p.DealProposal)
+		require.NoError(err)
+		return &DealResponse{State: state, ProposalCid: pcid}, nil
+	})
+	testAPI := newTestClientAPI(require)
+
+	client, err := NewClient(testNode, testAPI, repo.NewInMemoryRepo().DealsDs, proofs.NewFakeVerifier(true, nil))
+	require.NoError(err)
+	return client, testAPI
+}
+
+func addLifecycleTestDeal(require *require.Assertions, client *Client, c cid.Cid, d *clientDeal) cid.Cid {
+	d.Response.ProposalCid = c
+	client.deals[c] = d
+	require.NoError(client.saveDeal(c))
+	return c
+}
+
+func TestRenewDeals(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	newAddr := address.NewForTestGetter()
+	minerA, minerB := newAddr(), newAddr()
+
+	client, testAPI := newLifecycleTestClient(require, Accepted)
+	testAPI.clientConfig = &config.ClientConfig{RenewBeforeBlocks: 100, RenewWithSameMiner: true}
+	testAPI.candidates = []*porcelain.MinerCandidate{
+		{Miner: minerB, AskID: 1, Reachable: true},
+		{Miner: minerA, AskID: 2, Reachable: true},
+	}
+
+	newCid := types.NewCidForTestGetter()
+	piece := newCid()
+	dealCid := addLifecycleTestDeal(require, client, newCid(), &clientDeal{
+		Miner:       minerA,
+		Proposal:    &DealProposal{PieceRef: piece, Duration: 1000, MinerAddress: minerA},
+		Response:    &DealResponse{State: Staged},
+		StartHeight: 1000,
+	})
+
+	// The deal ends at 2000, so it is not renewed before 1900.
+	client.manageDeals(ctx, 1899)
+	deal, err := client.getDeal(dealCid)
+	require.NoError(err)
+	assert.Nil(deal.RenewedBy)
+	assert.Len(client.dealsSnapshot(), 1)
+
+	client.manageDeals(ctx, 1900)
+	deal, err = client.getDeal(dealCid)
+	require.NoError(err)
+	require.NotNil(deal.RenewedBy)
+
+	renewal, err := client.getDeal(*deal.RenewedBy)
+	require.NoError(err)
+	assert.Equal(minerA, renewal.Miner)
+	assert.Equal(piece, renewal.Proposal.PieceRef)
+	assert.Equal(uint64(1000), renewal.Proposal.Duration)
+
+	// A renewed deal is not renewed again.
+	client.manageDeals(ctx, 1950)
+	assert.Len(client.dealsSnapshot(), 2)
+}
+
+func TestRenewDealsFindsMinersOncePerPass(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	newAddr := address.NewForTestGetter()
+	minerA, minerB := newAddr(), newAddr()
+
+	client, testAPI := newLifecycleTestClient(require, Accepted)
+	testAPI.clientConfig = &config.ClientConfig{RenewBeforeBlocks: 100, RenewWithSameMiner: true}
+	testAPI.candidates = []*porcelain.MinerCandidate{
+		{Miner: minerA, AskID: 1, Reachable: true},
+		{Miner: minerB, AskID: 2, Reachable: true},
+	}
+
+	newCid := types.NewCidForTestGetter()
+	var dealCids []cid.Cid
+	for _, m := range []address.Address{minerA, minerB} {
+		dealCids = append(dealCids, addLifecycleTestDeal(require, client, newCid(), &clientDeal{
+			Miner:       m,
+			Proposal:    &DealProposal{PieceRef: newCid(), Duration: 1000, MinerAddress: m},
+			Response:    &DealResponse{State: Staged},
+			StartHeight: 1000,
+		}))
+	}
+
+	// No deal needs a miner yet.
+	client.manageDeals(ctx, 1800)
+	assert.Equal(0, testAPI.findMinersCalls)
+
+	client.manageDeals(ctx, 1900)
+	assert.Equal(1, testAPI.findMinersCalls)
+
+	// Each deal still prefers its own miner.
+	for _, c := range dealCids {
+		deal, err := client.getDeal(c)
+		require.NoError(err)
+		require.NotNil(deal.RenewedBy)
+		renewal, err := client.getDeal(*deal.RenewedBy)
+		require.NoError(err)
+		assert.Equal(deal.Miner, renewal.Miner)
+	}
+	assert.Equal(minerA, testAPI.candidates[0].Miner)
+}
+
+func TestRenewDealsBacksOff(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	minerA := address.NewForTestGetter()()
+
+	client, testAPI := newLifecycleTestClient(require, Rejected)
+	testAPI.clientConfig = &config.ClientConfig{RenewBeforeBlocks: 1000}
+	testAPI.candidates = []*porcelain.MinerCandidate{
+		{Miner: minerA, AskID: 1, Reachable: true},
+	}
+
+	newCid := types.NewCidForTestGetter()
+	dealCid := addLifecycleTestDeal(require, client, newCid(), &clientDeal{
+		Miner:       minerA,
+		Proposal:    &DealProposal{PieceRef: newCid(), Duration: 1000, MinerAddress: minerA},
+		Response:    &DealResponse{State: Staged},
+		StartHeight: 1000,
+	})
+
+	client.manageDeals(ctx, 1000)
+	deal, err := client.getDeal(dealCid)
+	require.NoError(err)
+	assert.Nil(deal.RenewedBy)
+	assert.Equal(1, deal.ManageAttempts)
+	assert.Equal(uint64(1000+manageRetryBlocks), deal.NextManageHeight)
+
+	t.Run("waits before trying again", func(t *testing.T) {
+		calls := testAPI.findMinersCalls
+		client.manageDeals(ctx, 1000+manageRetryBlocks-1)
+		assert.Equal(calls, testAPI.findMinersCalls)
+
+		client.manageDeals(ctx, 1000+manageRetryBlocks)
+		assert.Equal(calls+1, testAPI.findMinersCalls)
+
+		deal, err := client.getDeal(dealCid)
+		require.NoError(err)
+		assert.Equal(2, deal.ManageAttempts)
+		assert.Equal(uint64(1000+3*manageRetryBlocks), deal.NextManageHeight)
+	})
+
+	t.Run("gives up after too many attempts", func(t *testing.T) {
+		for h := uint64(1000); h < 2000; h++ {
+			client.manageDeals(ctx, h)
+		}
+		deal, err := client.getDeal(dealCid)
+		require.NoError(err)
+		assert.Equal(maxManageAttempts, deal.ManageAttempts)
+		assert.Nil(deal.RenewedBy)
+
+		// The attempts survive a restart.
+		restarted, err := NewClient(client.node, testAPI, client.dealsDs, proofs.NewFakeVerifier(true, nil))
+		require.NoError(err)
+		deal, err = restarted.getDeal(dealCid)
+		require.NoError(err)
+		assert.Equal(maxManageAttempts, deal.ManageAttempts)
+	})
+}
+
+func TestRepairDeals(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	newAddr := address.NewForTestGetter()
+	minerA, minerB := newAddr(), newAddr()
+
+	client, testAPI := newLifecycleTestClient(require, Accepted)
+	testAPI.clientConfig = &config.ClientConfig{RepairDeals: true}
+	testAPI.candidates = []*porcelain.MinerCandidate{
+		{Miner: minerA, AskID: 1, Reachable: true},
+		{Miner: minerB, AskID: 2, Reachable: true},
+	}
+	testAPI.commitments = map[string]types.Commitments{"3": {}}
+	testAPI.provingPeriodStart = types.NewBlockHeight(100)
+
+	newCid := types.NewCidForTestGetter()
+	dealCid := addLifecycleTestDeal(require, client, newCid(), &clientDeal{
+		Miner:       minerA,
+		Proposal:    &DealProposal{PieceRef: newCid(), Duration: 50000, MinerAddress: minerA},
+		Response:    &DealResponse{State: Posted, ProofInfo: &ProofInfo{SectorID: 3}},
+		StartHeight: 100,
+	})
+
+	t.Run("leaves deals whose miner is proving", func(t *testing.T) {
+		client.manageDeals(ctx, 20200)
+		deal, err := client.getDeal(dealCid)
+		require.NoError(err)
+		assert.Nil(deal.ReplacedBy)
+		assert.Equal(Posted, deal.Response.State)
+	})
+
+	t.Run("replaces deals whose miner missed its proving period", func(t *testing.T) {
+		client.manageDeals(ctx, 20201)
+		deal, err := client.getDeal(dealCid)
+		require.NoError(err)
+		require.NotNil(deal.ReplacedBy)
+		assert.Equal(Failed, deal.Response.State)
+		assert.Contains(deal.Response.Message, "stopped proving sector 3")
+
+		replacement, err := client.getDeal(*deal.ReplacedBy)
+		require.NoError(err)
+		assert.Equal(minerB, replacement.Miner)
+		// The replacement covers the rest of the original deal.
+		assert.Equal(uint64(50100-20201), replacement.Proposal.Duration)
+
+		// Replaced deals keep the client's verdict.
+		resp, err := client.QueryDeal(ctx, dealCid)
+		require.NoError(err)
+		assert.Equal(Failed, resp.State)
+	})
+}
@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/big"
-	"math/rand"
 	"strconv"
 	"sync"
 	"time"
@@ -15,6 +14,7 @@ import (
 	"gx/ipfs/QmRDWTzVdbHXdtat7tVJ7YC7kRaW7rTZTEF79yykcLYa49/go-unixfs"
 	ipld "gx/ipfs/QmRL22E4paat7ky7vx9MLpR97JHHbFPrg3ytFQw6qp1y1s/go-ipld-format"
 	inet "gx/ipfs/QmTGxDz2CjBucFzPNTiWwzQmTWdrBnzqbqrMucDYMsjuPb/go-libp2p-net"
+	"gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
 	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
 	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore/query"
 	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
@@ -41,10 +41,20 @@ var log = logging.Logger("/fil/storage")
 
 const makeDealProtocol = protocol.ID("/fil/storage/mk/1.0.0")
 const queryDealProtocol = protocol.ID("/fil/storage/qry/1.0.0")
+const checkProposalProtocol = protocol.ID("/fil/storage/check/1.0.0")
+
+// announcePieceTimeout bounds how long announcing a sealed piece may take.
+const announcePieceTimeout = time.Minute
+
+// reprovideInterval is how often sealed pieces are announced again, well
+// within the lifetime of DHT provider records.
+const reprovideInterval = 12 * time.Hour
 
 // TODO: replace this with a queries to pick reasonable gas price and limits.
 const submitPostGasPrice = 0
 const submitPostGasLimit = 300
+const commitSectorGasPrice = 0
+const commitSectorGasLimit = 300
 
 const waitForPaymentChannelDuration = 2 * time.Minute
 
@@ -60,22 +70,57 @@ type Miner struct {
 	deals   map[cid.Cid]*storageDeal
 	dealsDs repo.Datastore
 	dealsLk sync.Mutex
+	// reserved holds the proposals being decided on, by proposal cid, whose
+	// bytes count against their client's limit until they are. Guarded by
+	// dealsLk.
+	reserved map[cid.Cid]*DealProposal
+	// index indexes deals in dealsDs for ListDeals. Use getDealIndex.
+	index *dealIndex
 
-	postInProcessLk sync.Mutex
-	postInProcess   *types.BlockHeight
+	// proving schedules the miner's proofs of spacetime.
+	proving *provingScheduler
 
 	dealsAwaitingSeal *dealsAwaitingSealStruct
 
+	// outbox sends the miner's commitSector and submitPoSt messages.
+	outbox *outbox
+
+	// transfers holds a channel per deal waiting for its data, closed when
+	// data arrives.
+	transfers   map[cid.Cid]chan struct{}
+	transfersLk sync.Mutex
+
 	porcelainAPI minerPorcelain
 	node         node
 
+	// ctx is cancelled by Stop, ending the processing of deals.
+	ctx    context.Context
+	cancel context.CancelFunc
+
 	proposalAcceptor func(ctx context.Context, m *Miner, p *DealProposal) (*DealResponse, error)
 	proposalRejector func(ctx context.Context, m *Miner, p *DealProposal, reason string) (*DealResponse, error)
 }
 
+// storageDeal is a deal as persisted in the deals datastore. Its
+// Response.State records how far processing got, so that it can be resumed
+// after a restart: Accepted and Started deals still need their data fetched
+// and staged, and Staged deals are waiting for SectorID to be sealed.
 type storageDeal struct {
 	Proposal *DealProposal
 	Response *DealResponse
+	// SectorID is the sector the deal's piece was added to, once Staged.
+	SectorID uint64
+	// Staging is set before the deal's piece is added to a sector and
+	// cleared in the same save that records SectorID. A deal found Staging
+	// when processing resumes may have its piece in a sector the miner has
+	// no record of, so it is failed rather than added again.
+	Staging bool
+	// Proposer is the peer the deal was proposed by, the only one allowed to
+	// push its data.
+	Proposer peer.ID
+	// StateChanged is when Response.State last changed, in seconds since
+	// the epoch.
+	StateChanged int64
 }
 
 // minerPorcelain is the subset of the porcelain API that storage.Miner needs.
@@ -86,6 +131,10 @@ type minerPorcelain interface {
 	MessageSend(ctx context.Context, from, to address.Address, value *types.AttoFIL, gasPrice types.AttoFIL, gasLimit types.GasUnits, method string, params ...interface{}) (cid.Cid, error)
 	MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error)
 	MessageWait(ctx context.Context, msgCid cid.Cid, cb func(*types.Block, *types.SignedMessage, *types.MessageReceipt) error) error
+	MessagePoolPending() []*types.SignedMessage
+	MessagePoolRemove(cid cid.Cid)
+
+	types.Signer
 }
 
 // node is subset of node on which this protocol depends. These deps
@@ -97,6 +146,14 @@ type node interface {
 	BlockService() bserv.BlockService
 	Host() host.Host
 	SectorBuilder() sectorbuilder.SectorBuilder
+	// FreeStagingBytes returns the most bytes a staged sector can take up.
+	FreeStagingBytes() (uint64, error)
+	// ChainRandomness returns the chain randomness a block on top of ts
+	// samples.
+	ChainRandomness(ctx context.Context, ts types.TipSet) (miner.Randomness, error)
+	// AnnouncePiece advertises that the node can serve the piece with the
+	// given cid to retrieval clients.
+	AnnouncePiece(ctx context.Context, pieceRef cid.Cid) error
 }
 
 // generatePostInput is a struct containing sector id and related commitments
@@ -115,7 +172,12 @@ func init() {
 
 // NewMiner is
 func NewMiner(ctx context.Context, minerAddr, minerOwnerAddr address.Address, nd node, dealsDs repo.Datastore, porcelainAPI minerPorcelain) (*Miner, error) {
+	// Deals outlive the context the miner is created in, so they are
+	// processed until Stop instead.
+	minerCtx, cancel := context.WithCancel(context.Background())
 	sm := &Miner{
+		ctx:              minerCtx,
+		cancel:           cancel,
 		minerAddr:        minerAddr,
 		minerOwnerAddr:   minerOwnerAddr,
 		deals:            make(map[cid.Cid]*storageDeal),
@@ -135,34 +197,120 @@ func NewMiner(ctx context.Context, minerAddr, minerOwnerAddr address.Address, nd
 	if err := sm.loadDeals(); err != nil {
 		return nil, errors.Wrap(err, "failed to load miner deals when creating miner")
 	}
+	sm.resumeDeals()
 
-	nd.Host().SetStreamHandler(makeDealProtocol, sm.handleMakeDeal)
-	nd.Host().SetStreamHandler(queryDealProtocol, sm.handleQueryDeal)
+	proving, err := newProvingScheduler(sm, dealsDs)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load proving progress when creating miner")
+	}
+	sm.proving = proving
+
+	sm.outbox = newOutbox(sm.workerAddress, minerAddr, porcelainAPI, dealsDs, nd.GetBlockTime(), sm.onMessageDone)
+	if err := sm.outbox.load(); err != nil {
+		return nil, errors.Wrap(err, "failed to load outbox when creating miner")
+	}
 
 	return sm, nil
 }
 
-func (sm *Miner) handleMakeDeal(s inet.Stream) {
-	defer s.Close() // nolint: errcheck
+// Stop ends the processing of deals. Deals in progress are resumed when a
+// miner is next created over the same datastore.
+func (sm *Miner) Stop() {
+	sm.cancel()
+}
 
-	var signedProposal SignedDealProposal
-	if err := cbu.NewMsgReader(s).ReadMsg(&signedProposal); err != nil {
-		log.Errorf("received invalid proposal: %s", err)
-		return
-	}
+// Address returns the address of the miner actor sm works for.
+func (sm *Miner) Address() address.Address {
+	return sm.minerAddr
+}
 
+// serveMakeDeal answers signedProposal, read from s by the MinerRouter.
+func (sm *Miner) serveMakeDeal(s inet.Stream, signedProposal *SignedDealProposal) {
 	ctx := context.Background()
-	resp, err := sm.receiveStorageProposal(ctx, &signedProposal)
+	resp, err := sm.receiveStorageProposal(ctx, signedProposal)
 	if err != nil {
 		log.Errorf("failed to process proposal: %s", err)
 		return
 	}
 
-	if err := cbu.NewMsgWriter(s).WriteMsg(resp); err != nil {
+	// Record the proposer before it learns the deal was accepted, since it
+	// then starts pushing the data. Whoever sends the proposal again later
+	// does not take its place.
+	if sm.hasDeal(resp.ProposalCid) {
+		err := sm.updateDeal(resp.ProposalCid, func(d *storageDeal) {
+			if d.Proposer == "" {
+				d.Proposer = s.Conn().RemotePeer()
+			}
+		})
+		if err != nil {
+			log.Errorf("failed to record proposer of deal %s: %s", resp.ProposalCid, err)
+			return
+		}
+	}
+
+	signed, err := sm.signResponse(ctx, resp)
+	if err != nil {
+		log.Errorf("failed to sign proposal response: %s", err)
+		return
+	}
+
+	if err := cbu.NewMsgWriter(s).WriteMsg(signed); err != nil {
 		log.Errorf("failed to write proposal response: %s", err)
 	}
 }
 
+func (sm *Miner) serveCheckProposal(s inet.Stream, signedProposal *SignedDealProposal) {
+	resp, err := sm.checkProposal(context.Background(), signedProposal)
+	if err != nil {
+		log.Errorf("failed to check proposal: %s", err)
+		return
+	}
+
+	if err := cbu.NewMsgWriter(s).WriteMsg(resp); err != nil {
+		log.Errorf("failed to write proposal check response: %s", err)
+	}
+}
+
+// checkProposal tells a client whether the miner would accept a proposal
+// once it carries its payment, so that the client only pays for deals the
+// miner accepts. The payment itself is not checked, and nothing is recorded.
+func (sm *Miner) checkProposal(ctx context.Context, sp *SignedDealProposal) (*DealResponse, error) {
+	p := &sp.DealProposal
+	proposalCid, err := convert.ToCid(p)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get cid of proposal")
+	}
+	resp := &DealResponse{State: Accepted, ProposalCid: proposalCid}
+
+	reject := func(reason string) (*DealResponse, error) {
+		resp.State = Rejected
+		resp.Message = reason
+		return resp, nil
+	}
+
+	bdp, err := p.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	if !types.IsValidSignature(bdp, p.Payment.Payer, sp.Signature) {
+		return reject("invalid deal signature")
+	}
+	if _, err := sm.expectedDealPrice(p); err != nil {
+		return reject(err.Error())
+	}
+
+	release, err := sm.reserveClientBytes(p)
+	if err != nil {
+		return reject(err.Error())
+	}
+	release()
+
+	if err := sm.checkDealPolicy(ctx, p); err != nil {
+		return reject(err.Error())
+	}
+	return resp, nil
+}
+
 // receiveStorageProposal is the entry point for the miner storage protocol
 func (sm *Miner) receiveStorageProposal(ctx context.Context, sp *SignedDealProposal) (*DealResponse, error) {
 	// Validate deal signature
@@ -176,30 +324,52 @@ func (sm *Miner) receiveStorageProposal(ctx context.Context, sp *SignedDealPropo
 		return sm.proposalRejector(ctx, sm, p, fmt.Sprint("invalid deal signature"))
 	}
 
+	// Check the payment first: it is cheap, and the policy may call out to
+	// decision hooks.
 	if err := sm.validateDealPayment(ctx, p); err != nil {
 		return sm.proposalRejector(ctx, sm, p, err.Error())
 	}
 
+	release, err := sm.reserveClientBytes(p)
+	if err != nil {
+		return sm.proposalRejector(ctx, sm, p, err.Error())
+	}
+	defer release()
+
+	if err := sm.checkDealPolicy(ctx, p); err != nil {
+		return sm.proposalRejector(ctx, sm, p, err.Error())
+	}
+
 	// Payment is valid, everything else checks out, let's accept this proposal
 	return sm.proposalAcceptor(ctx, sm, p)
 }
 
-func (sm *Miner) validateDealPayment(ctx context.Context, p *DealProposal) error {
+// expectedDealPrice returns the miner's price for the proposal's size and
+// duration, or an error if the proposal offers less.
+func (sm *Miner) expectedDealPrice(p *DealProposal) (*types.AttoFIL, error) {
 	// compute expected total price for deal (storage price * duration * bytes)
 	price, err := sm.getStoragePrice()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if p.Size == nil {
-		return fmt.Errorf("proposed deal has no size")
+		return nil, fmt.Errorf("proposed deal has no size")
 	}
 
 	durationBigInt := big.NewInt(0).SetUint64(p.Duration)
 	priceBigInt := big.NewInt(0).SetUint64(p.Size.Uint64())
 	expectedPrice := price.MulBigInt(durationBigInt).MulBigInt(priceBigInt)
 	if p.TotalPrice.LessThan(expectedPrice) {
-		return fmt.Errorf("proposed price (%s) is less than expected (%s) given asking price of %s", p.TotalPrice.String(), expectedPrice.String(), price.String())
+		return nil, fmt.Errorf("proposed price (%s) is less than expected (%s) given asking price of %s", p.TotalPrice.String(), expectedPrice.String(), price.String())
+	}
+	return expectedPrice, nil
+}
+
+func (sm *Miner) validateDealPayment(ctx context.Context, p *DealProposal) error {
+	expectedPrice, err := sm.expectedDealPrice(p)
+	if err != nil {
+		return err
 	}
 
 	// get channel
@@ -336,15 +506,19 @@ func acceptProposal(ctx context.Context, sm *Miner, p *DealProposal) (*DealRespo
 	resp := &DealResponse{
 		State:       Accepted,
 		ProposalCid: proposalCid,
-		Signature:   types.Signature("signaturrreee"),
 	}
 
 	sm.dealsLk.Lock()
 	defer sm.dealsLk.Unlock()
 
+	if existing, ok := sm.existingDealResponse(proposalCid); ok {
+		return existing, nil
+	}
+
 	sm.deals[proposalCid] = &storageDeal{
-		Proposal: p,
-		Response: resp,
+		Proposal:     p,
+		Response:     resp,
+		StateChanged: time.Now().Unix(),
 	}
 	if err := sm.saveDeal(proposalCid); err != nil {
 		sm.deals[proposalCid].Response.State = Failed
@@ -368,15 +542,19 @@ func rejectProposal(ctx context.Context, sm *Miner, p *DealProposal, reason stri
 		State:       Rejected,
 		ProposalCid: proposalCid,
 		Message:     reason,
-		Signature:   types.Signature("signaturrreee"),
 	}
 
 	sm.dealsLk.Lock()
 	defer sm.dealsLk.Unlock()
 
+	if existing, ok := sm.existingDealResponse(proposalCid); ok {
+		return existing, nil
+	}
+
 	sm.deals[proposalCid] = &storageDeal{
-		Proposal: p,
-		Response: resp,
+		Proposal:     p,
+		Response:     resp,
+		StateChanged: time.Now().Unix(),
 	}
 	if err := sm.saveDeal(proposalCid); err != nil {
 		return nil, errors.Wrap(err, "failed to save miner deal")
@@ -385,6 +563,18 @@ func rejectProposal(ctx context.Context, sm *Miner, p *DealProposal, reason stri
 	return resp, nil
 }
 
+// existingDealResponse returns a copy of the response of the deal made by the
+// proposal with the given cid, if any. A proposal sent again gets that
+// response rather than resetting the deal. dealsLk must be held.
+func (sm *Miner) existingDealResponse(proposalCid cid.Cid) (*DealResponse, bool) {
+	d, ok := sm.deals[proposalCid]
+	if !ok {
+		return nil, false
+	}
+	resp := *d.Response
+	return &resp, true
+}
+
 func (sm *Miner) getStorageDeal(c cid.Cid) *storageDeal {
 	sm.dealsLk.Lock()
 	defer sm.dealsLk.Unlock()
@@ -392,9 +582,21 @@ func (sm *Miner) getStorageDeal(c cid.Cid) *storageDeal {
 }
 
 func (sm *Miner) updateDealResponse(proposalCid cid.Cid, f func(*DealResponse)) error {
+	return sm.updateDeal(proposalCid, func(d *storageDeal) {
+		f(d.Response)
+	})
+}
+
+// updateDeal applies f to the deal and persists the result.
+func (sm *Miner) updateDeal(proposalCid cid.Cid, f func(*storageDeal)) error {
 	sm.dealsLk.Lock()
 	defer sm.dealsLk.Unlock()
-	f(sm.deals[proposalCid].Response)
+	d := sm.deals[proposalCid]
+	state := d.Response.State
+	f(d)
+	if d.Response.State != state {
+		d.StateChanged = time.Now().Unix()
+	}
 	err := sm.saveDeal(proposalCid)
 	if err != nil {
 		return errors.Wrap(err, "failed to store updated deal response in datastore")
@@ -404,35 +606,104 @@ func (sm *Miner) updateDealResponse(proposalCid cid.Cid, f func(*DealResponse))
 	return nil
 }
 
+// resumeDeals restarts processing of the deals that were in progress when
+// the miner last stopped.
+func (sm *Miner) resumeDeals() {
+	if sm.node.SectorBuilder() == nil {
+		log.Warning("mining disabled, not resuming storage deals")
+		return
+	}
+
+	sm.dealsLk.Lock()
+	defer sm.dealsLk.Unlock()
+	for c, d := range sm.deals {
+		switch d.Response.State {
+		case Accepted, Started, Staged:
+			log.Infof("resuming storage deal %s in state %s", c, d.Response.State)
+			go sm.processStorageDeal(c)
+		}
+	}
+
+	go sm.reprovidePieces()
+}
+
+// reprovidePieces announces the pieces of sealed deals now and then every
+// reprovideInterval, as provider records expire, until the miner stops.
+func (sm *Miner) reprovidePieces() {
+	ticker := time.NewTicker(reprovideInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, pieceRef := range sm.sealedPieces() {
+			if sm.ctx.Err() != nil {
+				return
+			}
+			sm.announcePiece(pieceRef)
+		}
+
+		select {
+		case <-sm.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sealedPieces returns the distinct pieces of the deals in sealed sectors.
+func (sm *Miner) sealedPieces() []cid.Cid {
+	sm.dealsLk.Lock()
+	defer sm.dealsLk.Unlock()
+
+	seen := cid.NewSet()
+	var pieces []cid.Cid
+	for _, d := range sm.deals {
+		if d.Response.State != Posted && d.Response.State != Complete {
+			continue
+		}
+		if seen.Visit(d.Proposal.PieceRef) {
+			pieces = append(pieces, d.Proposal.PieceRef)
+		}
+	}
+	return pieces
+}
+
+// processStorageDeal moves a deal through its states from wherever it is,
+// persisting each step so that processing can resume after a restart.
 func (sm *Miner) processStorageDeal(c cid.Cid) {
 	log.Debugf("Miner.processStorageDeal(%s)", c.String())
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(sm.ctx)
 	defer cancel()
 
 	d := sm.getStorageDeal(c)
-	if d.Response.State != Accepted {
-		// TODO: handle resumption of deal processing across miner restarts
-		log.Error("attempted to process an already started deal")
-		return
-	}
-
-	// 'Receive' the data, this could also be a truck full of hard drives. (TODO: proper abstraction)
-	// TODO: this is not a great way to do this. At least use a session
-	// Also, this needs to be fetched into a staging area for miners to prepare and seal in data
-	log.Debug("Miner.processStorageDeal - FetchGraph")
-	if err := dag.FetchGraph(ctx, d.Proposal.PieceRef, dag.NewDAGService(sm.node.BlockService())); err != nil {
-		log.Errorf("failed to fetch data: %s", err)
-		err := sm.updateDealResponse(c, func(resp *DealResponse) {
-			resp.Message = "Transfer failed"
-			resp.State = Failed
-			// TODO: signature?
-		})
-		if err != nil {
-			log.Errorf("could not update to deal to 'Failed' state: %s", err)
+	switch d.Response.State {
+	case Accepted, Started:
+		if d.Staging {
+			// The miner stopped while adding the piece to a sector. The
+			// sector builder may or may not have added it, and adding it
+			// again could put it in a second sector.
+			log.Errorf("staging of deal %s was interrupted", c)
+			err := sm.updateDealResponse(c, func(resp *DealResponse) {
+				resp.State = Failed
+				resp.Message = "Staging was interrupted by a miner restart"
+			})
+			if err != nil {
+				log.Errorf("could not update deal %s to 'Failed': %s", c, err)
+			}
+			return
 		}
-		return
+		// A Started deal was interrupted while its data was being received,
+		// which is safe to repeat: a resumed transfer skips blocks we
+		// already have.
+		sm.stageDeal(ctx, c, d.Proposal)
+	case Staged:
+		sm.awaitSeal(d.SectorID, c)
+	default:
+		log.Errorf("attempted to process deal %s in state %s", c, d.Response.State)
 	}
+}
 
+// stageDeal waits for the deal's data and adds it to a sector.
+func (sm *Miner) stageDeal(ctx context.Context, c cid.Cid, proposal *DealProposal) {
 	fail := func(message, logerr string) {
 		log.Errorf(logerr)
 		err := sm.updateDealResponse(c, func(resp *DealResponse) {
@@ -444,9 +715,33 @@ func (sm *Miner) processStorageDeal(c cid.Cid) {
 		}
 	}
 
+	err := sm.updateDealResponse(c, func(resp *DealResponse) {
+		resp.State = Started
+	})
+	if err != nil {
+		log.Errorf("could not update to 'Started': %s", err)
+	}
+
+	// The data is pushed by the client or, for offline deals, imported by
+	// the miner from a truck full of hard drives.
+	log.Debug("Miner.processStorageDeal - waitForDealData")
+	if err := sm.waitForDealData(ctx, c, proposal); err != nil {
+		if ctx.Err() != nil {
+			// The miner stopped; the deal is resumed when it next starts.
+			return
+		}
+		fail("Transfer failed", fmt.Sprintf("failed to receive data: %s", err))
+		return
+	}
+
 	pi := &sectorbuilder.PieceInfo{
-		Ref:  d.Proposal.PieceRef,
-		Size: d.Proposal.Size.Uint64(),
+		Ref:  proposal.PieceRef,
+		Size: proposal.Size.Uint64(),
+	}
+
+	if err := sm.updateDeal(c, func(d *storageDeal) { d.Staging = true }); err != nil {
+		fail("Could not persist deal due to internal error", fmt.Sprintf("failed to mark deal as staging: %s", err))
+		return
 	}
 
 	// There is a race here that requires us to use dealsAwaitingSeal below. If the
@@ -460,12 +755,24 @@ func (sm *Miner) processStorageDeal(c cid.Cid) {
 	// the call is inelegant.
 	sectorID, err := sm.node.SectorBuilder().AddPiece(ctx, pi)
 	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
 		fail("failed to submit seal proof", fmt.Sprintf("failed to add piece: %s", err))
 		return
 	}
 
-	err = sm.updateDealResponse(c, func(resp *DealResponse) {
-		resp.State = Staged
+	sm.recordStaged(c, sectorID)
+}
+
+// recordStaged moves the deal to Staged, its piece being in the given sector,
+// recording the sector in the same save that clears Staging.
+func (sm *Miner) recordStaged(c cid.Cid, sectorID uint64) {
+	err := sm.updateDeal(c, func(d *storageDeal) {
+		d.Response.State = Staged
+		d.Response.Message = ""
+		d.SectorID = sectorID
+		d.Staging = false
 	})
 	if err != nil {
 		log.Errorf("could update to 'Staged': %s", err)
@@ -473,6 +780,12 @@ func (sm *Miner) processStorageDeal(c cid.Cid) {
 
 	// Careful: this might update state to success or failure so it should go after
 	// updating state to Staged.
+	sm.awaitSeal(sectorID, c)
+}
+
+// awaitSeal records that the deal's piece is in the given sector, so the deal
+// is updated when the sector is sealed.
+func (sm *Miner) awaitSeal(sectorID uint64, c cid.Cid) {
 	sm.dealsAwaitingSeal.add(sectorID, c)
 	if err := sm.saveDealsAwaitingSeal(); err != nil {
 		log.Errorf("could not save deal awaiting seal: %s", err)
@@ -548,12 +861,14 @@ func (dealsAwaitingSeal *dealsAwaitingSealStruct) add(sectorID uint64, dealCid c
 		// Same as above.
 		delete(dealsAwaitingSeal.FailedSectors, sectorID)
 	} else {
-		deals, ok := dealsAwaitingSeal.SectorsToDeals[sectorID]
-		if ok {
-			dealsAwaitingSeal.SectorsToDeals[sectorID] = append(deals, dealCid)
-		} else {
-			dealsAwaitingSeal.SectorsToDeals[sectorID] = []cid.Cid{dealCid}
+		deals := dealsAwaitingSeal.SectorsToDeals[sectorID]
+		for _, c := range deals {
+			if c.Equals(dealCid) {
+				// Already waiting, e.g. a deal resumed after a restart.
+				return
+			}
 		}
+		dealsAwaitingSeal.SectorsToDeals[sectorID] = append(deals, dealCid)
 	}
 }
 
@@ -581,6 +896,54 @@ func (dealsAwaitingSeal *dealsAwaitingSealStruct) fail(sectorID uint64, message
 	delete(dealsAwaitingSeal.SectorsToDeals, sectorID)
 }
 
+// CommitSector commits a sealed sector in the chain, retrying until the
+// commitment is included. OnCommitmentAddedToChain is called with the
+// outcome.
+func (sm *Miner) CommitSector(sector *sectorbuilder.SealedSectorMetadata) error {
+	m, err := newOutboxMessage(
+		commitSectorMessageID(sector.SectorID),
+		types.NewGasPrice(commitSectorGasPrice),
+		types.NewGasUnits(commitSectorGasLimit),
+		"commitSector",
+		sector.SectorID,
+		sector.CommD[:],
+		sector.CommR[:],
+		sector.CommRStar[:],
+		sector.Proof[:],
+	)
+	if err != nil {
+		return err
+	}
+	m.Sector = sector
+	return sm.outbox.send(m)
+}
+
+// commitSectorMessageID returns the outbox id of the message committing the
+// sector with the given id.
+func commitSectorMessageID(sectorID uint64) string {
+	return fmt.Sprintf("commitSector-%d", sectorID)
+}
+
+// onMessageDone is called by the outbox once a message it sent was included
+// in the chain, or it gave up on it.
+func (sm *Miner) onMessageDone(m *outboxMessage, receipt *types.MessageReceipt, err error) {
+	switch m.Method {
+	case "commitSector":
+		if err != nil {
+			err = errors.Wrap(err, "failed to commit sector")
+		}
+		sm.OnCommitmentAddedToChain(m.Sector, err)
+	case "submitPoSt":
+		if err != nil {
+			log.Errorf("failed to submit PoSt %s: %s", m.ID, err)
+			err = errors.Wrap(err, "failed to submit PoSt")
+		} else {
+			log.Debug("submitted PoSt")
+		}
+		sm.proving.onPoStDone(m.PeriodStart, err)
+	}
+}
+
 // OnCommitmentAddedToChain is a callback, called when a sector seal message was posted to the chain.
 func (sm *Miner) OnCommitmentAddedToChain(sector *sectorbuilder.SealedSectorMetadata, err error) {
 	sectorID := sector.SectorID
@@ -600,17 +963,66 @@ func (sm *Miner) OnCommitmentAddedToChain(sector *sectorbuilder.SealedSectorMeta
 }
 
 func (sm *Miner) onCommitSuccess(dealCid cid.Cid, sector *sectorbuilder.SealedSectorMetadata) {
+	info := &ProofInfo{
+		SectorID: sector.SectorID,
+		CommR:    sector.CommR[:],
+		CommD:    sector.CommD[:],
+	}
+
+	// Without a piece inclusion proof the client cannot verify the deal, but
+	// it is still sealed, so go on if one cannot be made.
+	if deal := sm.getStorageDeal(dealCid); deal != nil {
+		pip, err := sm.node.SectorBuilder().GeneratePieceInclusionProof(deal.Proposal.PieceRef)
+		if err == proofs.ErrPieceInclusionProofsUnsupported {
+			log.Debugf("not proving piece of deal %s: %s", dealCid, err)
+		} else if err != nil {
+			log.Warningf("failed to prove piece of deal %s: %s", dealCid, err)
+		} else {
+			info.CommP = pip.CommP[:]
+			info.PieceInclusionProof = pip.Proof
+		}
+	}
+
 	err := sm.updateDealResponse(dealCid, func(resp *DealResponse) {
 		resp.State = Posted
-		resp.ProofInfo = &ProofInfo{
-			SectorID: sector.SectorID,
-			CommR:    sector.CommR[:],
-			CommD:    sector.CommD[:],
-		}
+		resp.ProofInfo = info
 	})
 	if err != nil {
 		log.Errorf("commit succeeded but could not update to deal 'Posted' state: %s", err)
+		return
+	}
+
+	if deal := sm.getStorageDeal(dealCid); deal != nil {
+		sm.announcePiece(deal.Proposal.PieceRef)
+	}
+}
+
+// announcePiece advertises to retrieval clients that the miner holds the
+// piece with the given cid in a sealed sector.
+func (sm *Miner) announcePiece(pieceRef cid.Cid) {
+	ctx, cancel := context.WithTimeout(context.Background(), announcePieceTimeout)
+	defer cancel()
+
+	if err := sm.node.AnnouncePiece(ctx, pieceRef); err != nil {
+		log.Warningf("failed to announce piece %s: %s", pieceRef, err)
+	}
+}
+
+// SealedPieceSize returns the size of the piece with the given cid, and
+// whether the miner holds it in a sealed sector.
+func (sm *Miner) SealedPieceSize(pieceRef cid.Cid) (uint64, bool) {
+	deals, err := sm.ListDeals(DealFilter{PieceRef: pieceRef})
+	if err != nil {
+		log.Errorf("failed to list deals of piece %s: %s", pieceRef, err)
+		return 0, false
+	}
+
+	for _, d := range deals {
+		if d.State == Posted || d.State == Complete {
+			return d.Size.Uint64(), true
+		}
 	}
+	return 0, false
 }
 
 func (sm *Miner) onCommitFail(dealCid cid.Cid, message string) {
@@ -624,37 +1036,27 @@ func (sm *Miner) onCommitFail(dealCid cid.Cid, message string) {
 // OnNewHeaviestTipSet is a callback called by node, everytime the the latest head is updated.
 // It is used to check if we are in a new proving period and need to trigger PoSt submission.
 func (sm *Miner) OnNewHeaviestTipSet(ts types.TipSet) {
-	ctx := context.Background()
+	sm.proving.onNewHead(context.Background(), ts)
+}
 
-	rets, sig, err := sm.porcelainAPI.MessageQuery(
-		ctx,
-		address.Address{},
-		sm.minerAddr,
-		"getSectorCommitments",
-	)
-	if err != nil {
-		log.Errorf("failed to call query method getSectorCommitments: %s", err)
-		return
-	}
+// ProvingInfo describes the miner's current proving period and the progress
+// of its PoSt, as of the last head.
+func (sm *Miner) ProvingInfo() *ProvingInfo {
+	return sm.proving.provingInfo()
+}
 
-	commitmentsVal, err := abi.Deserialize(rets[0], sig.Return[0])
+// getPoStInputs returns the sectors the miner's PoSt proves.
+func (sm *Miner) getPoStInputs(ctx context.Context) ([]generatePostInput, error) {
+	commitments, err := sm.getSectorCommitments(ctx)
 	if err != nil {
-		log.Errorf("failed to convert returned ABI value: %s", err)
-		return
-	}
-
-	commitments, ok := commitmentsVal.Val.(map[string]types.Commitments)
-	if !ok {
-		log.Errorf("failed to convert returned ABI value to miner.Commitments")
-		return
+		return nil, errors.Wrap(err, "failed to get sector commitments")
 	}
 
 	var inputs []generatePostInput
 	for k, v := range commitments {
 		n, err := strconv.ParseUint(k, 10, 64)
 		if err != nil {
-			log.Errorf("failed to parse commitment sector id to uint64: %s", err)
-			return
+			return nil, errors.Wrap(err, "failed to parse commitment sector id to uint64")
 		}
 
 		inputs = append(inputs, generatePostInput{
@@ -664,46 +1066,62 @@ func (sm *Miner) OnNewHeaviestTipSet(ts types.TipSet) {
 			sectorID:  n,
 		})
 	}
+	return inputs, nil
+}
 
-	if len(inputs) == 0 {
-		// no sector sealed, nothing to do
-		return
+// getPoStChallenge returns the challenge of the proving period starting at
+// start, as seen by a block on top of ts, where a PoSt sent now lands at the
+// earliest.
+func (sm *Miner) getPoStChallenge(ctx context.Context, ts types.TipSet, start *types.BlockHeight) (proofs.PoStChallengeSeed, error) {
+	height, err := ts.Height()
+	if err != nil {
+		return proofs.PoStChallengeSeed{}, err
 	}
-
-	provingPeriodStart, err := sm.getProvingPeriodStart()
+	rnd, err := sm.node.ChainRandomness(ctx, ts)
 	if err != nil {
-		log.Errorf("failed to get provingPeriodStart: %s", err)
-		return
+		return proofs.PoStChallengeSeed{}, errors.Wrap(err, "failed to get chain randomness")
 	}
+	return miner.ProvingPeriodChallenge(rnd, start, types.NewBlockHeight(height+1))
+}
 
-	sm.postInProcessLk.Lock()
-	defer sm.postInProcessLk.Unlock()
-
-	if sm.postInProcess != nil && sm.postInProcess.Equal(provingPeriodStart) {
-		// post is already being generated for this period, nothing to do
-		return
+// getPoStLeadBlocks returns how many blocks before the end of a proving
+// period PoSt generation starts.
+func (sm *Miner) getPoStLeadBlocks() (uint64, error) {
+	lead, err := sm.porcelainAPI.ConfigGet("mining.postLeadBlocks")
+	if err != nil {
+		return 0, err
 	}
+	blocks, ok := lead.(uint64)
+	if !ok {
+		return 0, errors.New("Could not retrieve postLeadBlocks from config")
+	}
+	return blocks, nil
+}
 
-	height, err := ts.Height()
+// getSectorCommitments returns the commitments of the miner's sectors in
+// the chain, keyed by sector id.
+func (sm *Miner) getSectorCommitments(ctx context.Context) (map[string]types.Commitments, error) {
+	rets, sig, err := sm.porcelainAPI.MessageQuery(
+		ctx,
+		address.Address{},
+		sm.minerAddr,
+		"getSectorCommitments",
+	)
 	if err != nil {
-		log.Errorf("failed to get block height: %s", err)
-		return
+		return nil, errors.Wrap(err, "failed to call query method getSectorCommitments")
 	}
 
-	h := types.NewBlockHeight(height)
-	provingPeriodEnd := provingPeriodStart.Add(miner.ProvingPeriodBlocks)
+	commitmentsVal, err := abi.Deserialize(rets[0], sig.Return[0])
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert returned ABI value")
+	}
 
-	if h.GreaterEqual(provingPeriodStart) {
-		if h.LessThan(provingPeriodEnd) {
-			// we are in a new proving period, lets get this post going
-			sm.postInProcess = provingPeriodStart
-			go sm.submitPoSt(provingPeriodStart, provingPeriodEnd, inputs)
-		} else {
-			// we are too late
-			// TODO: figure out faults and payments here
-			log.Errorf("too late start=%s  end=%s current=%s", provingPeriodStart, provingPeriodEnd, h)
-		}
+	commitments, ok := commitmentsVal.Val.(map[string]types.Commitments)
+	if !ok {
+		return nil, errors.New("failed to convert returned ABI value to miner.Commitments")
 	}
+
+	return commitments, nil
 }
 
 func (sm *Miner) getProvingPeriodStart() (*types.BlockHeight, error) {
@@ -720,6 +1138,17 @@ func (sm *Miner) getProvingPeriodStart() (*types.BlockHeight, error) {
 	return types.NewBlockHeightFromBytes(res[0]), nil
 }
 
+// workerAddress returns the address of the miner's worker, which sends its
+// sector commitments and PoSts.
+func (sm *Miner) workerAddress(ctx context.Context) (address.Address, error) {
+	res, _, err := sm.porcelainAPI.MessageQuery(ctx, address.Address{}, sm.minerAddr, "getWorker")
+	if err != nil {
+		return address.Address{}, errors.Wrap(err, "failed to get miner worker")
+	}
+
+	return address.NewFromBytes(res[0])
+}
+
 // generatePoSt creates the required PoSt, given a list of sector ids and
 // matching seeds. It returns the Snark Proof for the PoSt, and a list of
 // sectors that faulted, if there were any faults.
@@ -736,13 +1165,9 @@ func (sm *Miner) generatePoSt(commRs []proofs.CommR, challenge proofs.PoStChalle
 	return res.Proof, res.Faults, nil
 }
 
-func (sm *Miner) submitPoSt(start, end *types.BlockHeight, inputs []generatePostInput) {
-	// TODO: real seed generation
-	seed := proofs.PoStChallengeSeed{}
-	if _, err := rand.Read(seed[:]); err != nil {
-		panic(err)
-	}
-
+// submitPoSt generates the PoSt of the proving period from start to end and
+// hands it to the outbox, which reports whether it landed in the chain.
+func (sm *Miner) submitPoSt(start, end *types.BlockHeight, seed proofs.PoStChallengeSeed, inputs []generatePostInput) error {
 	commRs := make([]proofs.CommR, len(inputs))
 	for i, input := range inputs {
 		commRs[i] = input.commR
@@ -750,8 +1175,7 @@ func (sm *Miner) submitPoSt(start, end *types.BlockHeight, inputs []generatePost
 
 	proof, faults, err := sm.generatePoSt(commRs, seed)
 	if err != nil {
-		log.Errorf("failed to generate PoSts: %s", err)
-		return
+		return err
 	}
 	if len(faults) != 0 {
 		log.Warningf("some faults when generating PoSt: %v", faults)
@@ -760,37 +1184,92 @@ func (sm *Miner) submitPoSt(start, end *types.BlockHeight, inputs []generatePost
 
 	height, err := sm.node.BlockHeight()
 	if err != nil {
-		log.Errorf("failed to submit PoSt, as the current block height can not be determined: %s", err)
-		// TODO: what should happen in this case?
-		return
+		return errors.Wrap(err, "failed to get the current block height")
 	}
-	if height.LessThan(start) {
-		// TODO: what to do here? not sure this can happen, maybe through reordering?
-		log.Errorf("PoSt generation time took negative block time: %s < %s", height, start)
-		return
-	}
-
 	if height.GreaterEqual(end) {
 		// TODO: we are too late, figure out faults and decide if we want to still submit
-		log.Errorf("PoSt generation was too slow height=%s end=%s", height, end)
-		return
+		return errors.Errorf("PoSt generation was too slow height=%s end=%s", height, end)
 	}
 
-	// TODO: figure out a more sensible timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
-	defer cancel()
-
 	// TODO: algorithmically determine appropriate values for these
 	gasPrice := types.NewGasPrice(submitPostGasPrice)
 	gasLimit := types.NewGasUnits(submitPostGasLimit)
 
-	_, err = sm.porcelainAPI.MessageSend(ctx, sm.minerOwnerAddr, sm.minerAddr, types.ZeroAttoFIL, gasPrice, gasLimit, "submitPoSt", proof[:])
+	m, err := newOutboxMessage(fmt.Sprintf("submitPoSt-%s", start), gasPrice, gasLimit, "submitPoSt", proof[:])
 	if err != nil {
-		log.Errorf("failed to submit PoSt: %s", err)
-		return
+		return errors.Wrap(err, "failed to create PoSt message")
+	}
+	m.PeriodStart = start
+	return sm.outbox.send(m)
+}
+
+// SectorStatus describes a sector of the miner, as seen by its sector
+// builder and the chain.
+type SectorStatus struct {
+	*sectorbuilder.SectorInfo
+
+	// MaxUserBytes is how many piece bytes fit in a sector.
+	MaxUserBytes uint64
+
+	// Committed is whether the sector's commitment is in the chain, and
+	// Committing whether it is being sent there.
+	Committed  bool
+	Committing bool
+}
+
+// ListSectors describes the sectors of the miner's sector builder, ordered by
+// sector id.
+func (sm *Miner) ListSectors(ctx context.Context) ([]*SectorStatus, error) {
+	infos, err := sm.node.SectorBuilder().ListSectors()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list sectors")
+	}
+	return sm.sectorStatuses(ctx, infos)
+}
+
+// SectorStatus describes the sector of the miner with the given id.
+func (sm *Miner) SectorStatus(ctx context.Context, sectorID uint64) (*SectorStatus, error) {
+	info, err := sm.node.SectorBuilder().SectorStatus(sectorID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get status of sector %d", sectorID)
+	}
+
+	statuses, err := sm.sectorStatuses(ctx, []*sectorbuilder.SectorInfo{info})
+	if err != nil {
+		return nil, err
+	}
+	return statuses[0], nil
+}
+
+// sectorStatuses adds the fill level and commit status of each of infos.
+func (sm *Miner) sectorStatuses(ctx context.Context, infos []*sectorbuilder.SectorInfo) ([]*SectorStatus, error) {
+	maxBytes, err := sm.node.SectorBuilder().GetMaxUserBytesPerStagedSector()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get sector size")
+	}
+
+	commitments, err := sm.getSectorCommitments(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]*SectorStatus, len(infos))
+	for i, info := range infos {
+		_, committed := commitments[strconv.FormatUint(info.SectorID, 10)]
+		statuses[i] = &SectorStatus{
+			SectorInfo:   info,
+			MaxUserBytes: maxBytes,
+			Committed:    committed,
+			Committing:   !committed && sm.outbox.isPending(commitSectorMessageID(info.SectorID)),
+		}
 	}
+	return statuses, nil
+}
 
-	log.Debug("submitted PoSt")
+// ProvePiece proves that the piece with the given cid lies inside the sealed
+// sector the miner stored it in.
+func (sm *Miner) ProvePiece(ctx context.Context, pieceCid cid.Cid) (*sectorbuilder.PieceInclusionProof, error) {
+	return sm.node.SectorBuilder().GeneratePieceInclusionProof(pieceCid)
 }
 
 // Query responds to a query for the proposal referenced by the given cid
@@ -808,17 +1287,39 @@ func (sm *Miner) Query(ctx context.Context, c cid.Cid) *DealResponse {
 	return d.Response
 }
 
-func (sm *Miner) handleQueryDeal(s inet.Stream) {
-	defer s.Close() // nolint: errcheck
+// hasDeal returns whether a deal was proposed to sm with the proposal with
+// the given cid.
+func (sm *Miner) hasDeal(c cid.Cid) bool {
+	sm.dealsLk.Lock()
+	defer sm.dealsLk.Unlock()
+	_, ok := sm.deals[c]
+	return ok
+}
 
-	var q queryRequest
-	if err := cbu.NewMsgReader(s).ReadMsg(&q); err != nil {
-		log.Errorf("received invalid query: %s", err)
-		return
+// signResponse returns a copy of resp signed by the miner's worker, leaving
+// the deal's own response untouched. The worker key is the one the node
+// uses to send the miner's messages, so it is always at hand.
+func (sm *Miner) signResponse(ctx context.Context, resp *DealResponse) (*DealResponse, error) {
+	worker, err := sm.workerAddress(ctx)
+	if err != nil {
+		return nil, err
 	}
 
+	signed := *resp
+	if err := signed.Sign(worker, sm.porcelainAPI); err != nil {
+		return nil, err
+	}
+	return &signed, nil
+}
+
+// serveQueryDeal answers q, read from s by the MinerRouter.
+func (sm *Miner) serveQueryDeal(s inet.Stream, q *queryRequest) {
 	ctx := context.Background()
-	resp := sm.Query(ctx, q.Cid)
+	resp, err := sm.signResponse(ctx, sm.Query(ctx, q.Cid))
+	if err != nil {
+		log.Errorf("failed to sign query response: %s", err)
+		return
+	}
 
 	if err := cbu.NewMsgWriter(s).WriteMsg(resp); err != nil {
 		log.Errorf("failed to write query response: %s", err)
@@ -841,28 +1342,38 @@ func getFileSize(ctx context.Context, c cid.Cid, dserv ipld.DAGService) (uint64,
 }
 
 func (sm *Miner) loadDeals() error {
+	prefix := datastore.NewKey(minerDatastorePrefix)
 	res, err := sm.dealsDs.Query(query.Query{
-		Prefix: "/" + minerDatastorePrefix,
+		Prefix: prefix.String(),
 	})
 	if err != nil {
 		return errors.Wrap(err, "failed to query deals from datastore")
 	}
 
 	sm.deals = make(map[cid.Cid]*storageDeal)
+	indexed := make(map[cid.Cid]map[string]string)
 
 	for entry := range res.Next() {
+		// Prefixes match strings, so skip keys of other namespaces sharing
+		// the prefix.
+		if !datastore.NewKey(entry.Key).Parent().Equal(prefix) {
+			continue
+		}
+
 		var deal storageDeal
 		if err := cbor.DecodeInto(entry.Value, &deal); err != nil {
 			return errors.Wrap(err, "failed to unmarshal deals from datastore")
 		}
 		sm.deals[deal.Response.ProposalCid] = &deal
+		indexed[deal.Response.ProposalCid] = indexFields(deal.Proposal, deal.Response.State)
 	}
 
-	return nil
+	return sm.getDealIndex().rebuild(indexed)
 }
 
 func (sm *Miner) saveDeal(proposalCid cid.Cid) error {
-	marshalledDeal, err := cbor.DumpObject(sm.deals[proposalCid])
+	deal := sm.deals[proposalCid]
+	marshalledDeal, err := cbor.DumpObject(deal)
 	if err != nil {
 		return errors.Wrap(err, "Could not marshal storageDeal")
 	}
@@ -871,5 +1382,64 @@ func (sm *Miner) saveDeal(proposalCid cid.Cid) error {
 	if err != nil {
 		return errors.Wrap(err, "could not save client storage deal")
 	}
-	return nil
+	return sm.getDealIndex().update(proposalCid, indexFields(deal.Proposal, deal.Response.State))
+}
+
+// getDealIndex returns the index of the miner's deals. Callers must hold
+// dealsLk, or otherwise have the miner to themselves.
+func (sm *Miner) getDealIndex() *dealIndex {
+	if sm.index == nil {
+		sm.index = newDealIndex(sm.dealsDs, minerDatastorePrefix)
+	}
+	return sm.index
+}
+
+// ListDeals returns the miner's deals matching filter, most recently changed
+// first.
+func (sm *Miner) ListDeals(filter DealFilter) ([]*DealSummary, error) {
+	sm.dealsLk.Lock()
+	defer sm.dealsLk.Unlock()
+
+	matches, err := sm.getDealIndex().find(filterFields(filter))
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the deals the index matched are visited, unless every deal does.
+	if matches == nil {
+		matches = make(map[cid.Cid]bool, len(sm.deals))
+		for c := range sm.deals {
+			matches[c] = true
+		}
+	}
+
+	var deals []*DealSummary
+	for c := range matches {
+		d, ok := sm.deals[c]
+		if !ok {
+			continue
+		}
+		summary := &DealSummary{
+			ProposalCid:  c,
+			State:        d.Response.State,
+			Message:      d.Response.Message,
+			Miner:        d.Proposal.MinerAddress,
+			Client:       d.Proposal.Payment.Payer,
+			PieceRef:     d.Proposal.PieceRef,
+			Size:         d.Proposal.Size,
+			TotalPrice:   d.Proposal.TotalPrice,
+			Duration:     d.Proposal.Duration,
+			StateChanged: time.Unix(d.StateChanged, 0),
+		}
+		if d.Response.ProofInfo != nil {
+			sectorID := d.Response.ProofInfo.SectorID
+			summary.SectorID = &sectorID
+		} else if d.Response.State == Staged {
+			sectorID := d.SectorID
+			summary.SectorID = &sectorID
+		}
+		deals = append(deals, summary)
+	}
+	sortDealSummaries(deals)
+	return deals, nil
 }
@@ -2,18 +2,32 @@ package storage
 
 import (
 	"context"
+	"sync"
 	"testing"
+	"time"
 
+	dag "gx/ipfs/QmNRAuGmvnVw8urHkUZQirhu42VTiZjVWASa2aTznEMmpP/go-merkledag"
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
-
+	"gx/ipfs/QmRu7tiRnFk9mMPpVECQTBQJqXtmG132jJxA1w9A7TtpBz/go-ipfs-blockstore"
+	"gx/ipfs/QmSz8kAe2JCKp2dWSG8gHSWnwSmne8YfRXTeK5HBmc9L7t/go-ipfs-exchange-offline"
+	ds "gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore/namespace"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	bserv "gx/ipfs/QmZsGVGCqMCNzHLNMB6q4F6yyvomqf1VxwhJwSfgo1NGaF/go-blockservice"
+	"gx/ipfs/Qmd52WKRSwrBK5gUaJKawryZQ5by6UbNB8KVW2Zy6JtbyW/go-libp2p-host"
+
+	"github.com/filecoin-project/go-filecoin/abi"
 	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/miner"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/exec"
 	"github.com/filecoin-project/go-filecoin/plumbing/cfg"
+	"github.com/filecoin-project/go-filecoin/proofs"
 	"github.com/filecoin-project/go-filecoin/proofs/sectorbuilder"
 	"github.com/filecoin-project/go-filecoin/repo"
 	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/util/convert"
 	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
 	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
 )
@@ -73,6 +87,26 @@ func TestReceiveStorageProposal(t *testing.T) {
 		assert.Equal("proposed price (2500) is less than expected (5000) given asking price of 0.0005", res.Message)
 	})
 
+	t.Run("Checks proposals before they carry a payment", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		porcelainAPI, miner, proposal := defaultMinerTestSetup(require, VoucherInterval, defaultAmountInc)
+		porcelainAPI.noChannels = true
+
+		res, err := miner.checkProposal(context.Background(), proposal)
+		require.NoError(err)
+		assert.Equal(Accepted, res.State)
+
+		porcelainAPI.config.Set("mining.storagePrice", `".0005"`)
+		res, err = miner.checkProposal(context.Background(), proposal)
+		require.NoError(err)
+		assert.Equal(Rejected, res.State)
+		assert.Contains(res.Message, "is less than expected")
+
+		assert.Empty(miner.deals)
+	})
+
 	t.Run("Rejects proposals with invalid payment channel", func(t *testing.T) {
 		assert := assert.New(t)
 		require := require.New(t)
@@ -217,6 +251,84 @@ func TestReceiveStorageProposal(t *testing.T) {
 	})
 }
 
+func TestProposalSentAgain(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	porcelainAPI := newMinerTestPorcelain(require)
+	p := &testSignedDealProposal(porcelainAPI, nil, porcelainAPI.targetAddress).DealProposal
+	proposalCid, err := convert.ToCid(p)
+	require.NoError(err)
+
+	sm := &Miner{
+		deals:   make(map[cid.Cid]*storageDeal),
+		dealsDs: repo.NewInMemoryRepo().DealsDatastore(),
+		node:    &resumeTestNode{sectorBuilder: &resumeTestSectorBuilder{}},
+	}
+	sm.deals[proposalCid] = &storageDeal{
+		Proposal: p,
+		Response: &DealResponse{State: Staged, ProposalCid: proposalCid},
+		SectorID: 3,
+	}
+
+	// Neither accepting nor rejecting the proposal again resets its deal.
+	resp, err := acceptProposal(ctx, sm, p)
+	require.NoError(err)
+	assert.Equal(Staged, resp.State)
+
+	resp, err = rejectProposal(ctx, sm, p, "client is over its limit")
+	require.NoError(err)
+	assert.Equal(Staged, resp.State)
+	assert.Empty(resp.Message)
+
+	d := sm.getStorageDeal(proposalCid)
+	assert.Equal(Staged, d.Response.State)
+	assert.Equal(uint64(3), d.SectorID)
+}
+
+func TestSignResponse(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	keys := types.NewMockSigner(types.MustGenerateKeyInfo(1, types.GenerateKeyInfoSeed()))
+	porcelainAPI := &workerSignerPorcelain{
+		minerTestPorcelain: newMinerTestPorcelain(require),
+		keys:               keys,
+	}
+	miner := &Miner{
+		minerAddr:      address.NewForTestGetter()(),
+		minerOwnerAddr: porcelainAPI.targetAddress,
+		porcelainAPI:   porcelainAPI,
+	}
+
+	resp := &DealResponse{State: Accepted}
+	signed, err := miner.signResponse(context.Background(), resp)
+	require.NoError(err)
+
+	assert.True(signed.VerifySignature(keys.Addresses[0]))
+	assert.False(signed.VerifySignature(miner.minerOwnerAddr))
+	assert.Nil(resp.Signature)
+}
+
+// workerSignerPorcelain is a minerTestPorcelain whose miner has the only key
+// in keys as its worker, and which signs with that key.
+type workerSignerPorcelain struct {
+	*minerTestPorcelain
+	keys types.MockSigner
+}
+
+func (wsp *workerSignerPorcelain) MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error) {
+	if method == "getWorker" {
+		return [][]byte{wsp.keys.Addresses[0].Bytes()}, &exec.FunctionSignature{Return: []abi.Type{abi.Address}}, nil
+	}
+	return wsp.minerTestPorcelain.MessageQuery(ctx, optFrom, to, method, params...)
+}
+
+func (wsp *workerSignerPorcelain) SignBytes(data []byte, addr address.Address) (types.Signature, error) {
+	return wsp.keys.SignBytes(data, addr)
+}
+
 func TestDealsAwaitingSeal(t *testing.T) {
 	newCid := types.NewCidForTestGetter()
 	cid0 := newCid()
@@ -345,6 +457,311 @@ func TestDealsAwaitingSeal(t *testing.T) {
 	})
 }
 
+func TestLoadDealsOfMinersSharingADatastore(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// A node keeps its default miner's deals at the root of its deals
+	// datastore and those of its other miners in namespaces of it, whose
+	// keys may share the prefix of the default miner's deals.
+	root := repo.NewInMemoryRepo().DealsDatastore()
+	other := namespace.Wrap(root, ds.NewKey("miners").ChildString(address.NewForTestGetter()().String()))
+
+	newMiner := func(dealsDs repo.Datastore) *Miner {
+		sm := &Miner{deals: make(map[cid.Cid]*storageDeal), dealsDs: dealsDs}
+		require.NoError(sm.loadDeals())
+		return sm
+	}
+
+	newCid := types.NewCidForTestGetter()
+	saveDeal := func(sm *Miner) cid.Cid {
+		c := newCid()
+		sm.deals[c] = &storageDeal{
+			Proposal: &DealProposal{PieceRef: newCid(), Size: types.NewBytesAmount(1)},
+			Response: &DealResponse{State: Accepted, ProposalCid: c},
+		}
+		require.NoError(sm.saveDeal(c))
+		return c
+	}
+	defaultDeal := saveDeal(newMiner(root))
+	otherDeal := saveDeal(newMiner(other))
+
+	// After the node restarts, each miner loads only its own deals.
+	defaultMiner, otherMiner := newMiner(root), newMiner(other)
+	assert.Len(defaultMiner.deals, 1)
+	assert.Contains(defaultMiner.deals, defaultDeal)
+	assert.Len(otherMiner.deals, 1)
+	assert.Contains(otherMiner.deals, otherDeal)
+
+	summaries, err := defaultMiner.ListDeals(DealFilter{})
+	require.NoError(err)
+	require.Len(summaries, 1)
+	assert.Equal(defaultDeal, summaries[0].ProposalCid)
+}
+
+func TestResumeDeals(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	bstore := blockstore.NewBlockstore(ds.NewMapDatastore())
+	bs := bserv.New(bstore, offline.Exchange(bstore))
+	data := dag.NewRawNode([]byte("some deal data"))
+	require.NoError(bs.AddBlock(data))
+
+	nd := &resumeTestNode{
+		blockService:  bs,
+		sectorBuilder: &resumeTestSectorBuilder{sectorID: 42},
+	}
+	dealsDs := repo.NewInMemoryRepo().DealsDatastore()
+
+	newMiner := func() *Miner {
+		ctx, cancel := context.WithCancel(context.Background())
+		sm := &Miner{
+			deals:   make(map[cid.Cid]*storageDeal),
+			dealsDs: dealsDs,
+			node:    nd,
+			ctx:     ctx,
+			cancel:  cancel,
+		}
+		require.NoError(sm.loadDealsAwaitingSeal())
+		sm.dealsAwaitingSeal.onSuccess = sm.onCommitSuccess
+		sm.dealsAwaitingSeal.onFail = sm.onCommitFail
+		require.NoError(sm.loadDeals())
+		return sm
+	}
+
+	// Persist deals in each state a miner may stop in, as if it crashed.
+	before := newMiner()
+	newCid := types.NewCidForTestGetter()
+	addDeal := func(state DealState, sectorID uint64) cid.Cid {
+		c := newCid()
+		before.deals[c] = &storageDeal{
+			Proposal: &DealProposal{PieceRef: data.Cid(), Size: types.NewBytesAmount(14)},
+			Response: &DealResponse{State: state, ProposalCid: c},
+			SectorID: sectorID,
+		}
+		require.NoError(before.saveDeal(c))
+		return c
+	}
+	accepted := addDeal(Accepted, 0)
+	started := addDeal(Started, 0)
+	staged := addDeal(Staged, 7)
+	posted := addDeal(Posted, 3)
+	staging := addDeal(Started, 0)
+	before.deals[staging].Staging = true
+	require.NoError(before.saveDeal(staging))
+
+	sm := newMiner()
+	defer sm.Stop()
+	sm.resumeDeals()
+
+	waitForState := func(c cid.Cid, want DealState) *storageDeal {
+		for i := 0; i < 100; i++ {
+			sm.dealsLk.Lock()
+			d := *sm.deals[c]
+			sm.dealsLk.Unlock()
+			if d.Response.State == want {
+				return &d
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("deal %s never reached state %s", c, want)
+		return nil
+	}
+
+	// Deals not yet staged are fetched and staged again.
+	for _, c := range []cid.Cid{accepted, started} {
+		d := waitForState(c, Staged)
+		assert.Equal(uint64(42), d.SectorID)
+		assert.False(d.Staging)
+	}
+
+	// A deal the miner stopped adding to a sector may already have its
+	// piece in one, so it fails instead of being staged twice.
+	assert.Contains(waitForState(staging, Failed).Response.Message, "Staging was interrupted")
+	assert.Equal(2, nd.sectorBuilder.addedPieces())
+
+	// Staged deals wait for their sector again, and complete when it seals.
+	sm.dealsAwaitingSeal.l.Lock()
+	assert.Equal([]cid.Cid{staged}, sm.dealsAwaitingSeal.SectorsToDeals[7])
+	sm.dealsAwaitingSeal.l.Unlock()
+
+	sm.OnCommitmentAddedToChain(&sectorbuilder.SealedSectorMetadata{SectorID: 7}, nil)
+	proofInfo := waitForState(staged, Posted).Response.ProofInfo
+	assert.Equal(uint64(7), proofInfo.SectorID)
+	assert.Equal([]byte{2}, proofInfo.PieceInclusionProof)
+	require.Len(proofInfo.CommP, 32)
+	assert.Equal(byte(1), proofInfo.CommP[0])
+
+	// Finished deals are left alone, but their pieces are announced again
+	// when reproviding starts.
+	assert.Equal(Posted, sm.getStorageDeal(posted).Response.State)
+	assert.Nil(sm.getStorageDeal(posted).Response.ProofInfo)
+
+	// Both the resumed posted deal and the newly sealed one are announced.
+	for i := 0; i < 100 && nd.announcedPieces() < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(nd.announcedPieces() >= 2)
+
+	size, ok := sm.SealedPieceSize(data.Cid())
+	assert.True(ok)
+	assert.Equal(uint64(14), size)
+
+	_, ok = sm.SealedPieceSize(newCid())
+	assert.False(ok)
+}
+
+func TestSealedPieces(t *testing.T) {
+	assert := assert.New(t)
+
+	newCid := types.NewCidForTestGetter()
+	sealed, unsealed := newCid(), newCid()
+
+	sm := &Miner{deals: make(map[cid.Cid]*storageDeal)}
+	for _, d := range []struct {
+		piece cid.Cid
+		state DealState
+	}{{sealed, Posted}, {sealed, Complete}, {unsealed, Staged}, {unsealed, Failed}} {
+		sm.deals[newCid()] = &storageDeal{
+			Proposal: &DealProposal{PieceRef: d.piece},
+			Response: &DealResponse{State: d.state},
+		}
+	}
+
+	assert.Equal([]cid.Cid{sealed}, sm.sealedPieces())
+}
+
+func TestListSectors(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	newCid := types.NewCidForTestGetter()
+	sb := &sectorsTestSectorBuilder{sectors: []*sectorbuilder.SectorInfo{
+		{SectorID: 1, State: sectorbuilder.SectorSealed, Pieces: []*sectorbuilder.PieceInfo{{Ref: newCid(), Size: 10}}},
+		{SectorID: 2, State: sectorbuilder.SectorSealed, Pieces: []*sectorbuilder.PieceInfo{{Ref: newCid(), Size: 20}}},
+		{SectorID: 3, State: sectorbuilder.SectorStaged},
+	}}
+
+	porcelainAPI := newMinerTestPorcelain(require)
+	porcelainAPI.commitments = map[string]types.Commitments{"1": {}}
+
+	sm := newTestMiner(porcelainAPI)
+	sm.node = &resumeTestNode{sectorBuilder: &resumeTestSectorBuilder{SectorBuilder: sb}}
+	sm.outbox = newOutbox(sm.workerAddress, address.Address{}, porcelainAPI, repo.NewInMemoryRepo().DealsDatastore(), time.Second, nil)
+	// Sector 2's commitment is still being sent.
+	sm.outbox.pending[commitSectorMessageID(2)] = &pendingOutboxMessage{}
+
+	sectors, err := sm.ListSectors(ctx)
+	require.NoError(err)
+	require.Len(sectors, 3)
+
+	assert.True(sectors[0].Committed)
+	assert.False(sectors[1].Committed)
+	assert.True(sectors[1].Committing)
+	assert.False(sectors[2].Committed)
+	assert.False(sectors[2].Committing)
+	for _, s := range sectors {
+		assert.Equal(uint64(100), s.MaxUserBytes)
+	}
+	assert.Equal(uint64(20), sectors[1].UserBytes())
+
+	status, err := sm.SectorStatus(ctx, 1)
+	require.NoError(err)
+	assert.Equal(uint64(1), status.SectorID)
+	assert.True(status.Committed)
+
+	_, err = sm.SectorStatus(ctx, 4)
+	assert.Equal(sectorbuilder.ErrSectorNotFound, errors.Cause(err))
+}
+
+// sectorsTestSectorBuilder describes a fixed list of sectors.
+type sectorsTestSectorBuilder struct {
+	sectorbuilder.SectorBuilder
+
+	sectors []*sectorbuilder.SectorInfo
+}
+
+func (sb *sectorsTestSectorBuilder) ListSectors() ([]*sectorbuilder.SectorInfo, error) {
+	return sb.sectors, nil
+}
+
+func (sb *sectorsTestSectorBuilder) SectorStatus(sectorID uint64) (*sectorbuilder.SectorInfo, error) {
+	for _, s := range sb.sectors {
+		if s.SectorID == sectorID {
+			return s, nil
+		}
+	}
+	return nil, sectorbuilder.ErrSectorNotFound
+}
+
+func (sb *sectorsTestSectorBuilder) GetMaxUserBytesPerStagedSector() (uint64, error) {
+	return 100, nil
+}
+
+type resumeTestNode struct {
+	blockService  bserv.BlockService
+	sectorBuilder *resumeTestSectorBuilder
+	freeStaging   uint64
+
+	announcedLk sync.Mutex
+	announced   []cid.Cid
+}
+
+func (n *resumeTestNode) BlockHeight() (*types.BlockHeight, error) {
+	return types.NewBlockHeight(0), nil
+}
+func (n *resumeTestNode) GetBlockTime() time.Duration                { return time.Second }
+func (n *resumeTestNode) BlockService() bserv.BlockService           { return n.blockService }
+func (n *resumeTestNode) Host() host.Host                            { return nil }
+func (n *resumeTestNode) SectorBuilder() sectorbuilder.SectorBuilder { return n.sectorBuilder }
+func (n *resumeTestNode) FreeStagingBytes() (uint64, error)          { return n.freeStaging, nil }
+
+func (n *resumeTestNode) ChainRandomness(ctx context.Context, ts types.TipSet) (miner.Randomness, error) {
+	return nil, errors.New("no chain")
+}
+
+func (n *resumeTestNode) AnnouncePiece(ctx context.Context, pieceRef cid.Cid) error {
+	n.announcedLk.Lock()
+	defer n.announcedLk.Unlock()
+	n.announced = append(n.announced, pieceRef)
+	return nil
+}
+
+func (n *resumeTestNode) announcedPieces() int {
+	n.announcedLk.Lock()
+	defer n.announcedLk.Unlock()
+	return len(n.announced)
+}
+
+// resumeTestSectorBuilder stages every piece into the same sector.
+type resumeTestSectorBuilder struct {
+	sectorbuilder.SectorBuilder
+
+	sectorID uint64
+
+	lk     sync.Mutex
+	pieces []*sectorbuilder.PieceInfo
+}
+
+func (sb *resumeTestSectorBuilder) AddPiece(ctx context.Context, pi *sectorbuilder.PieceInfo) (uint64, error) {
+	sb.lk.Lock()
+	defer sb.lk.Unlock()
+	sb.pieces = append(sb.pieces, pi)
+	return sb.sectorID, nil
+}
+
+func (sb *resumeTestSectorBuilder) GeneratePieceInclusionProof(pieceCid cid.Cid) (*sectorbuilder.PieceInclusionProof, error) {
+	return &sectorbuilder.PieceInclusionProof{SectorID: sb.sectorID, CommP: proofs.CommP{1}, Proof: []byte{2}}, nil
+}
+
+func (sb *resumeTestSectorBuilder) addedPieces() int {
+	sb.lk.Lock()
+	defer sb.lk.Unlock()
+	return len(sb.pieces)
+}
+
 type minerTestPorcelain struct {
 	config        *cfg.Config
 	payerAddress  address.Address
@@ -356,6 +773,7 @@ type minerTestPorcelain struct {
 	blockHeight   *types.BlockHeight
 	channelEol    *types.BlockHeight
 	paymentStart  *types.BlockHeight
+	commitments   map[string]types.Commitments
 
 	require *require.Assertions
 }
@@ -395,6 +813,13 @@ func (mtp *minerTestPorcelain) MessageSend(ctx context.Context, from, to address
 }
 
 func (mtp *minerTestPorcelain) MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error) {
+	if method == "getSectorCommitments" {
+		commitments := &abi.Value{Type: abi.CommitmentsMap, Val: mtp.commitments}
+		commitmentsBytes, err := commitments.Serialize()
+		mtp.require.NoError(err)
+		return [][]byte{commitmentsBytes}, &exec.FunctionSignature{Return: []abi.Type{abi.CommitmentsMap}}, nil
+	}
+
 	channels := map[string]*paymentbroker.PaymentChannel{}
 
 	if !mtp.noChannels {
@@ -424,6 +849,14 @@ func (mtp *minerTestPorcelain) MessageWait(ctx context.Context, msgCid cid.Cid,
 	return nil
 }
 
+func (mtp *minerTestPorcelain) MessagePoolPending() []*types.SignedMessage { return nil }
+
+func (mtp *minerTestPorcelain) MessagePoolRemove(cid cid.Cid) {}
+
+func (mtp *minerTestPorcelain) SignBytes(data []byte, addr address.Address) (types.Signature, error) {
+	return testSignature, nil
+}
+
 func newTestMiner(api *minerTestPorcelain) *Miner {
 	return &Miner{
 		porcelainAPI:   api,
@@ -0,0 +1,398 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"sync"
+	"time"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore/query"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/abi"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/proofs/sectorbuilder"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// outboxDatastorePrefix namespaces the miner's outbound messages in the
+// deals datastore.
+const outboxDatastorePrefix = "outbox"
+
+// outboxMaxAttempts is how many times a message is sent before the outbox
+// gives up on it.
+const outboxMaxAttempts = 5
+
+// outboxWaitBlocks is how many block times a sent message may take to be
+// included in the chain before it is sent again with a higher gas price.
+const outboxWaitBlocks = 20
+
+// outboxRetryDelay is how long the outbox waits before sending a message
+// again after failing to send it.
+const outboxRetryDelay = 10 * time.Second
+
+// errOutboxWaitTimeout is returned while waiting for a sent message that was
+// not included in the chain in time.
+var errOutboxWaitTimeout = errors.New("message was not included in the chain in time")
+
+// errOutboxEvicted is returned while waiting for a sent message whose last
+// copy was evicted from the message pool to free its nonce.
+var errOutboxEvicted = errors.New("message was evicted from the message pool")
+
+// outboxMinGasPriceIncrement is the least a replacement copy of a message
+// raises the gas price by.
+var outboxMinGasPriceIncrement = types.NewAttoFIL(big.NewInt(10))
+
+// outboxPorcelain is the subset of the porcelain API that the outbox needs.
+type outboxPorcelain interface {
+	MessageSend(ctx context.Context, from, to address.Address, value *types.AttoFIL, gasPrice types.AttoFIL, gasLimit types.GasUnits, method string, params ...interface{}) (cid.Cid, error)
+	MessageWait(ctx context.Context, msgCid cid.Cid, cb func(*types.Block, *types.SignedMessage, *types.MessageReceipt) error) error
+	MessagePoolPending() []*types.SignedMessage
+	MessagePoolRemove(cid cid.Cid)
+}
+
+// outboxMessage is a message from the miner's worker to the miner that the
+// outbox sends until it is included in the chain. It is persisted so that
+// sending resumes after a restart.
+type outboxMessage struct {
+	// ID identifies the message, e.g. by the sector it commits, so that the
+	// same message is never queued twice.
+	ID         string
+	Method     string
+	Params     []byte
+	ParamTypes []abi.Type
+	GasPrice   *types.AttoFIL
+	GasLimit   types.GasUnits
+
+	// Sector is the sector a commitSector message commits.
+	Sector *sectorbuilder.SealedSectorMetadata `json:",omitempty"`
+	// PeriodStart is the start of the proving period a submitPoSt message
+	// proves.
+	PeriodStart *types.BlockHeight `json:",omitempty"`
+
+	// Attempts is how many times the message was sent, and Sent the cids of
+	// the copies sent, each with a higher gas price than the last.
+	Attempts int
+	Sent     []cid.Cid
+}
+
+// outbox sends the messages a miner depends on, such as its sector
+// commitments and proofs of spacetime. It sends each until it lands in the
+// chain. When a copy is not included in time, every pending message of its
+// sender is evicted from the message pool, so that a nonce gap cannot keep
+// them out of the chain, and the copy is sent again at the sender's nonce on
+// chain with a higher gas price. The evicted messages that follow it are sent
+// again right away. Once a copy is included, or the outbox gives up, done is
+// called with the outcome. Each copy is sent from the address sender returns
+// when it is sent, so that messages follow changes of the sender.
+//
+// The sender is expected to send nothing but outbox messages: other messages
+// of the sender are dropped when the outbox evicts them.
+type outbox struct {
+	sender func(ctx context.Context) (address.Address, error)
+	to     address.Address
+	api    outboxPorcelain
+	ds     repo.Datastore
+
+	waitTimeout time.Duration
+	retryDelay  time.Duration
+
+	done func(m *outboxMessage, receipt *types.MessageReceipt, err error)
+
+	lk      sync.Mutex
+	pending map[string]*pendingOutboxMessage
+}
+
+// pendingOutboxMessage is a message being sent, and the channel that wakes
+// its sending when its last copy is evicted from the message pool.
+type pendingOutboxMessage struct {
+	message *outboxMessage
+	evicted chan struct{}
+}
+
+func newOutbox(sender func(context.Context) (address.Address, error), to address.Address, api outboxPorcelain, ds repo.Datastore, blockTime time.Duration, done func(*outboxMessage, *types.MessageReceipt, error)) *outbox {
+	return &outbox{
+		sender:      sender,
+		to:          to,
+		api:         api,
+		ds:          ds,
+		waitTimeout: outboxWaitBlocks * blockTime,
+		retryDelay:  outboxRetryDelay,
+		done:        done,
+		pending:     make(map[string]*pendingOutboxMessage),
+	}
+}
+
+// newOutboxMessage returns a message with the given id calling method with
+// params.
+func newOutboxMessage(id string, gasPrice types.AttoFIL, gasLimit types.GasUnits, method string, params ...interface{}) (*outboxMessage, error) {
+	vals, err := abi.ToValues(params)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid params")
+	}
+	encoded, err := abi.EncodeValues(vals)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode params")
+	}
+
+	m := &outboxMessage{
+		ID:       id,
+		Method:   method,
+		Params:   encoded,
+		GasPrice: &gasPrice,
+		GasLimit: gasLimit,
+	}
+	for _, v := range vals {
+		m.ParamTypes = append(m.ParamTypes, v.Type)
+	}
+	return m, nil
+}
+
+// send persists m and starts sending it. Messages whose id is already in the
+// outbox are ignored.
+func (ob *outbox) send(m *outboxMessage) error {
+	ob.lk.Lock()
+	defer ob.lk.Unlock()
+
+	if _, ok := ob.pending[m.ID]; ok {
+		return nil
+	}
+	if err := ob.save(m); err != nil {
+		return err
+	}
+
+	go ob.process(ob.addPending(m))
+	return nil
+}
+
+// addPending records that m is being sent. Callers must hold lk.
+func (ob *outbox) addPending(m *outboxMessage) *pendingOutboxMessage {
+	p := &pendingOutboxMessage{message: m, evicted: make(chan struct{}, 1)}
+	ob.pending[m.ID] = p
+	return p
+}
+
+// isPending returns whether the message with the given id is being sent.
+func (ob *outbox) isPending(id string) bool {
+	ob.lk.Lock()
+	defer ob.lk.Unlock()
+	_, ok := ob.pending[id]
+	return ok
+}
+
+// load resumes sending the messages persisted when the miner last stopped.
+func (ob *outbox) load() error {
+	res, err := ob.ds.Query(query.Query{Prefix: "/" + outboxDatastorePrefix})
+	if err != nil {
+		return errors.Wrap(err, "failed to query outbox from datastore")
+	}
+
+	var messages []*outboxMessage
+	for entry := range res.Next() {
+		var m outboxMessage
+		if err := json.Unmarshal(entry.Value, &m); err != nil {
+			return errors.Wrap(err, "failed to unmarshal outbox message from datastore")
+		}
+		messages = append(messages, &m)
+	}
+
+	ob.lk.Lock()
+	defer ob.lk.Unlock()
+	for _, m := range messages {
+		if _, ok := ob.pending[m.ID]; ok {
+			continue
+		}
+		log.Infof("resuming %s message %s after %d attempts", m.Method, m.ID, m.Attempts)
+		go ob.process(ob.addPending(m))
+	}
+	return nil
+}
+
+// process sends p's message until a copy of it is included in the chain or
+// it has been sent outboxMaxAttempts times. Copies sent again because they
+// were evicted for another message do not count as attempts.
+func (ob *outbox) process(p *pendingOutboxMessage) {
+	m := p.message
+	evicted := false
+	for {
+		if len(m.Sent) > 0 && !evicted {
+			receipt, err := ob.waitAny(m.Sent, p.evicted)
+			if err == nil {
+				ob.finish(m, receipt, nil)
+				return
+			}
+			evicted = err == errOutboxEvicted
+			log.Warningf("%s message %s: %s", m.Method, m.ID, err)
+		}
+
+		if !evicted && m.Attempts >= outboxMaxAttempts {
+			ob.finish(m, nil, errors.Errorf("gave up after sending %d times", m.Attempts))
+			return
+		}
+
+		if err := ob.sendOnce(m, !evicted); err != nil {
+			log.Warningf("failed to send %s message %s: %s", m.Method, m.ID, err)
+			time.Sleep(ob.retryDelay)
+			continue
+		}
+		evicted = false
+	}
+}
+
+// sendOnce sends a copy of m. If replace is set and a copy was sent before,
+// the pending messages of the sender are evicted first and the copy pays a
+// higher gas price.
+func (ob *outbox) sendOnce(m *outboxMessage, replace bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), ob.waitTimeout)
+	defer cancel()
+	from, err := ob.sender(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to get message sender")
+	}
+
+	if replace {
+		if len(m.Sent) > 0 {
+			ob.evictPending(m, from)
+			m.GasPrice = bumpGasPrice(m.GasPrice)
+		}
+		m.Attempts++
+	}
+
+	vals, err := abi.DecodeValues(m.Params, m.ParamTypes)
+	if err != nil {
+		return errors.Wrap(err, "failed to decode params")
+	}
+
+	c, err := ob.api.MessageSend(ctx, from, ob.to, types.ZeroAttoFIL, *m.GasPrice, m.GasLimit, m.Method, abi.FromValues(vals)...)
+
+	ob.lk.Lock()
+	defer ob.lk.Unlock()
+	if err == nil {
+		m.Sent = append(m.Sent, c)
+	}
+	if saveErr := ob.save(m); saveErr != nil {
+		log.Errorf("failed to persist %s message %s: %s", m.Method, m.ID, saveErr)
+	}
+	return err
+}
+
+// evictPending removes every pending message from the given sender from the
+// message pool, so that the next message it sends takes the sender's nonce
+// on chain, which any gap in the pool's nonces starts at. The other outbox
+// messages whose last copy is evicted are woken to send it again.
+func (ob *outbox) evictPending(m *outboxMessage, from address.Address) {
+	evicted := cid.NewSet()
+	for _, msg := range ob.api.MessagePoolPending() {
+		if msg.From != from {
+			continue
+		}
+		c, err := msg.Cid()
+		if err != nil {
+			log.Errorf("failed to get cid of pending message: %s", err)
+			continue
+		}
+		ob.api.MessagePoolRemove(c)
+		evicted.Add(c)
+	}
+
+	ob.lk.Lock()
+	defer ob.lk.Unlock()
+	owned := 0
+	for id, p := range ob.pending {
+		sent := p.message.Sent
+		if len(sent) == 0 || !evicted.Has(sent[len(sent)-1]) {
+			continue
+		}
+		owned++
+		if id == m.ID {
+			continue
+		}
+		select {
+		case p.evicted <- struct{}{}:
+		default:
+		}
+	}
+	if dropped := evicted.Len() - owned; dropped > 0 {
+		log.Warningf("dropped %d pending messages from %s that the outbox did not send", dropped, from)
+	}
+}
+
+// waitAny returns the receipt of the first of the sent copies of a message
+// to be included in the chain, errOutboxWaitTimeout if none is in time, or
+// errOutboxEvicted if a value arrives on evicted first.
+func (ob *outbox) waitAny(sent []cid.Cid, evicted <-chan struct{}) (*types.MessageReceipt, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ob.waitTimeout)
+	defer cancel()
+
+	found := make(chan *types.MessageReceipt, len(sent))
+	for _, c := range sent {
+		go func(c cid.Cid) {
+			err := ob.api.MessageWait(ctx, c, func(_ *types.Block, _ *types.SignedMessage, receipt *types.MessageReceipt) error {
+				found <- receipt
+				return nil
+			})
+			if err != nil && ctx.Err() == nil {
+				log.Warningf("failed to wait for message %s: %s", c, err)
+			}
+		}(c)
+	}
+
+	select {
+	case receipt := <-found:
+		if receipt == nil {
+			return nil, errors.New("message was included without a receipt")
+		}
+		return receipt, nil
+	case <-evicted:
+		return nil, errOutboxEvicted
+	case <-ctx.Done():
+		return nil, errOutboxWaitTimeout
+	}
+}
+
+// finish removes m from the outbox and reports its outcome.
+func (ob *outbox) finish(m *outboxMessage, receipt *types.MessageReceipt, err error) {
+	if err == nil && receipt.ExitCode != 0 {
+		err = errors.Errorf("message failed with exit code %d", receipt.ExitCode)
+	}
+
+	ob.lk.Lock()
+	delete(ob.pending, m.ID)
+	if dsErr := ob.ds.Delete(outboxKey(m.ID)); dsErr != nil {
+		log.Errorf("failed to remove %s message %s from outbox: %s", m.Method, m.ID, dsErr)
+	}
+	ob.lk.Unlock()
+
+	ob.done(m, receipt, err)
+}
+
+// save persists m. Callers must hold lk.
+func (ob *outbox) save(m *outboxMessage) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal outbox message")
+	}
+	if err := ob.ds.Put(outboxKey(m.ID), data); err != nil {
+		return errors.Wrap(err, "could not save outbox message")
+	}
+	return nil
+}
+
+func outboxKey(id string) datastore.Key {
+	return datastore.KeyWithNamespaces([]string{outboxDatastorePrefix, id})
+}
+
+// bumpGasPrice returns the gas price of a copy of a message replacing one
+// sent with gas price p: a quarter more, and at least
+// outboxMinGasPriceIncrement more.
+func bumpGasPrice(p *types.AttoFIL) *types.AttoFIL {
+	increment := p.DivCeil(types.NewAttoFIL(big.NewInt(4)))
+	if increment.LessThan(outboxMinGasPriceIncrement) {
+		increment = outboxMinGasPriceIncrement
+	}
+	return p.Add(increment)
+}
@@ -0,0 +1,351 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// outboxTestPorcelain fails the sends listed in failSends, and includes the
+// sends listed in includeSends in the chain with exitCode. The outbox sends
+// from each of senders in turn, then from the last one. Sent messages stay in
+// pool until they are removed.
+type outboxTestPorcelain struct {
+	failSends    map[int]bool
+	includeSends map[int]bool
+	exitCode     uint8
+
+	newCid func() cid.Cid
+
+	lk        sync.Mutex
+	senders   []address.Address
+	froms     []address.Address
+	sends     int
+	gasPrices []string
+	params    [][]interface{}
+	included  map[cid.Cid]bool
+	pool      map[cid.Cid]*types.SignedMessage
+	removed   []cid.Cid
+}
+
+func newOutboxTestPorcelain() *outboxTestPorcelain {
+	return &outboxTestPorcelain{
+		failSends:    map[int]bool{},
+		includeSends: map[int]bool{},
+		newCid:       types.NewCidForTestGetter(),
+		included:     map[cid.Cid]bool{},
+		pool:         map[cid.Cid]*types.SignedMessage{},
+	}
+}
+
+func (otp *outboxTestPorcelain) MessageSend(ctx context.Context, from, to address.Address, value *types.AttoFIL, gasPrice types.AttoFIL, gasLimit types.GasUnits, method string, params ...interface{}) (cid.Cid, error) {
+	otp.lk.Lock()
+	defer otp.lk.Unlock()
+
+	otp.sends++
+	otp.froms = append(otp.froms, from)
+	otp.gasPrices = append(otp.gasPrices, gasPrice.String())
+	otp.params = append(otp.params, params)
+	if otp.failSends[otp.sends] {
+		return cid.Undef, errors.New("nonce collision")
+	}
+
+	c := otp.addToPool(from, uint64(otp.sends))
+	if otp.includeSends[otp.sends] {
+		otp.included[c] = true
+	}
+	return c, nil
+}
+
+// addToPool adds a message from the given sender to the pool. Callers must
+// hold lk.
+func (otp *outboxTestPorcelain) addToPool(from address.Address, nonce uint64) cid.Cid {
+	msg := &types.SignedMessage{MeteredMessage: types.MeteredMessage{Message: *types.NewMessage(from, address.Address{}, nonce, types.ZeroAttoFIL, "", nil)}}
+	c, err := msg.Cid()
+	if err != nil {
+		panic(err)
+	}
+	otp.pool[c] = msg
+	return c
+}
+
+func (otp *outboxTestPorcelain) MessageWait(ctx context.Context, msgCid cid.Cid, cb func(*types.Block, *types.SignedMessage, *types.MessageReceipt) error) error {
+	otp.lk.Lock()
+	included := otp.included[msgCid]
+	otp.lk.Unlock()
+
+	if !included {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return cb(nil, nil, &types.MessageReceipt{ExitCode: otp.exitCode})
+}
+
+func (otp *outboxTestPorcelain) sender(ctx context.Context) (address.Address, error) {
+	otp.lk.Lock()
+	defer otp.lk.Unlock()
+
+	if len(otp.senders) == 0 {
+		return address.Address{}, nil
+	}
+	from := otp.senders[0]
+	if len(otp.senders) > 1 {
+		otp.senders = otp.senders[1:]
+	}
+	return from, nil
+}
+
+func (otp *outboxTestPorcelain) MessagePoolPending() []*types.SignedMessage {
+	otp.lk.Lock()
+	defer otp.lk.Unlock()
+
+	var pending []*types.SignedMessage
+	for _, msg := range otp.pool {
+		pending = append(pending, msg)
+	}
+	return pending
+}
+
+func (otp *outboxTestPorcelain) MessagePoolRemove(c cid.Cid) {
+	otp.lk.Lock()
+	defer otp.lk.Unlock()
+	delete(otp.pool, c)
+	otp.removed = append(otp.removed, c)
+}
+
+type outboxTestResult struct {
+	message *outboxMessage
+	receipt *types.MessageReceipt
+	err     error
+}
+
+func newTestOutbox(otp *outboxTestPorcelain, dealsDs repo.Datastore) (*outbox, chan outboxTestResult) {
+	results := make(chan outboxTestResult, 1)
+	ob := newOutbox(otp.sender, address.NewForTestGetter()(), otp, dealsDs, time.Millisecond, func(m *outboxMessage, receipt *types.MessageReceipt, err error) {
+		results <- outboxTestResult{m, receipt, err}
+	})
+	ob.waitTimeout = 50 * time.Millisecond
+	ob.retryDelay = time.Millisecond
+	return ob, results
+}
+
+func waitForOutboxResult(t *testing.T, results chan outboxTestResult) outboxTestResult {
+	select {
+	case res := <-results:
+		return res
+	case <-time.After(5 * time.Second):
+		t.Fatal("outbox never finished sending")
+		return outboxTestResult{}
+	}
+}
+
+func TestOutbox(t *testing.T) {
+	t.Run("retries with a new nonce and a higher gas price until included", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		otp := newOutboxTestPorcelain()
+		otp.failSends[1] = true
+		otp.includeSends[3] = true
+		dealsDs := repo.NewInMemoryRepo().DealsDatastore()
+		ob, results := newTestOutbox(otp, dealsDs)
+
+		m, err := newOutboxMessage("commitSector-3", types.NewGasPrice(0), types.NewGasUnits(300), "commitSector", uint64(3), []byte{1, 2})
+		require.NoError(err)
+		require.NoError(ob.send(m))
+		// Queuing the same message again does nothing.
+		require.NoError(ob.send(m))
+
+		res := waitForOutboxResult(t, results)
+		require.NoError(res.err)
+		assert.Equal(uint8(0), res.receipt.ExitCode)
+		assert.Equal("commitSector-3", res.message.ID)
+
+		otp.lk.Lock()
+		defer otp.lk.Unlock()
+		// The first send failed and the second was never included, so it was
+		// dropped from the pool and replaced.
+		assert.Equal(3, otp.sends)
+		bumped := types.NewGasPrice(10)
+		assert.Equal([]string{"0", "0", bumped.String()}, otp.gasPrices)
+		assert.Len(otp.removed, 1)
+		assert.Equal([]interface{}{uint64(3), []byte{1, 2}}, otp.params[2])
+
+		has, err := dealsDs.Has(outboxKey("commitSector-3"))
+		require.NoError(err)
+		assert.False(has)
+	})
+
+	t.Run("evicts the pending messages of the sender and resends those it sent", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		addrGetter := address.NewForTestGetter()
+		worker, other := addrGetter(), addrGetter()
+
+		otp := newOutboxTestPorcelain()
+		otp.senders = []address.Address{worker}
+		ob, _ := newTestOutbox(otp, repo.NewInMemoryRepo().DealsDatastore())
+
+		stuck, err := newOutboxMessage("commitSector-3", types.NewGasPrice(0), types.NewGasUnits(300), "commitSector", uint64(3))
+		require.NoError(err)
+		dependent, err := newOutboxMessage("commitSector-4", types.NewGasPrice(0), types.NewGasUnits(300), "commitSector", uint64(4))
+		require.NoError(err)
+
+		otp.lk.Lock()
+		stuck.Sent = []cid.Cid{otp.addToPool(worker, 5)}
+		dependent.Sent = []cid.Cid{otp.addToPool(worker, 6)}
+		otp.addToPool(worker, 7)
+		otherMsg := otp.addToPool(other, 5)
+		otp.lk.Unlock()
+		stuck.Attempts, dependent.Attempts = 1, 1
+
+		ob.lk.Lock()
+		pendingStuck := ob.addPending(stuck)
+		pendingDependent := ob.addPending(dependent)
+		ob.lk.Unlock()
+
+		require.NoError(ob.sendOnce(stuck, true))
+
+		otp.lk.Lock()
+		// Only the new copy and the message of the other sender are left.
+		assert.Len(otp.removed, 3)
+		assert.Len(otp.pool, 2)
+		assert.Contains(otp.pool, otherMsg)
+		assert.Contains(otp.pool, stuck.Sent[1])
+		otp.lk.Unlock()
+
+		assert.Equal(testGasPriceString(10), stuck.GasPrice.String())
+		assert.Equal(2, stuck.Attempts)
+
+		// The evicted dependent is woken to send again, but the stuck
+		// message itself is not.
+		assert.Len(pendingDependent.evicted, 1)
+		assert.Len(pendingStuck.evicted, 0)
+
+		// Sending an evicted message again neither bumps its gas price nor
+		// counts as an attempt.
+		require.NoError(ob.sendOnce(dependent, false))
+		assert.Equal(testGasPriceString(0), dependent.GasPrice.String())
+		assert.Equal(1, dependent.Attempts)
+		assert.Len(dependent.Sent, 2)
+	})
+
+	t.Run("sends each copy from the current sender", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		addrGetter := address.NewForTestGetter()
+		oldWorker, newWorker := addrGetter(), addrGetter()
+
+		otp := newOutboxTestPorcelain()
+		otp.senders = []address.Address{oldWorker, newWorker}
+		otp.failSends[1] = true
+		otp.includeSends[2] = true
+		ob, results := newTestOutbox(otp, repo.NewInMemoryRepo().DealsDatastore())
+
+		m, err := newOutboxMessage("submitPoSt-10", types.NewGasPrice(0), types.NewGasUnits(300), "submitPoSt", []byte{1})
+		require.NoError(err)
+		require.NoError(ob.send(m))
+
+		res := waitForOutboxResult(t, results)
+		require.NoError(res.err)
+
+		otp.lk.Lock()
+		defer otp.lk.Unlock()
+		assert.Equal([]address.Address{oldWorker, newWorker}, otp.froms)
+	})
+
+	t.Run("reports failed messages", func(t *testing.T) {
+		require := require.New(t)
+
+		otp := newOutboxTestPorcelain()
+		otp.includeSends[1] = true
+		otp.exitCode = 1
+		ob, results := newTestOutbox(otp, repo.NewInMemoryRepo().DealsDatastore())
+
+		m, err := newOutboxMessage("submitPoSt-10", types.NewGasPrice(0), types.NewGasUnits(300), "submitPoSt", []byte{1})
+		require.NoError(err)
+		require.NoError(ob.send(m))
+
+		res := waitForOutboxResult(t, results)
+		require.Error(res.err)
+		require.Contains(res.err.Error(), "exit code 1")
+	})
+
+	t.Run("gives up after too many attempts", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		otp := newOutboxTestPorcelain()
+		ob, results := newTestOutbox(otp, repo.NewInMemoryRepo().DealsDatastore())
+
+		m, err := newOutboxMessage("submitPoSt-10", types.NewGasPrice(0), types.NewGasUnits(300), "submitPoSt", []byte{1})
+		require.NoError(err)
+		require.NoError(ob.send(m))
+
+		res := waitForOutboxResult(t, results)
+		require.Error(res.err)
+		assert.Nil(res.receipt)
+
+		otp.lk.Lock()
+		defer otp.lk.Unlock()
+		assert.Equal(outboxMaxAttempts, otp.sends)
+	})
+
+	t.Run("resumes waiting for messages sent before a restart", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		otp := newOutboxTestPorcelain()
+		dealsDs := repo.NewInMemoryRepo().DealsDatastore()
+
+		sent := otp.newCid()
+		otp.included[sent] = true
+
+		m, err := newOutboxMessage("commitSector-3", types.NewGasPrice(0), types.NewGasUnits(300), "commitSector", uint64(3))
+		require.NoError(err)
+		m.Attempts = 1
+		m.Sent = []cid.Cid{sent}
+
+		before, _ := newTestOutbox(otp, dealsDs)
+		require.NoError(before.save(m))
+
+		ob, results := newTestOutbox(otp, dealsDs)
+		require.NoError(ob.load())
+
+		res := waitForOutboxResult(t, results)
+		require.NoError(res.err)
+		assert.Equal(1, res.message.Attempts)
+
+		otp.lk.Lock()
+		defer otp.lk.Unlock()
+		assert.Equal(0, otp.sends)
+	})
+}
+
+func TestBumpGasPrice(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, tc := range []struct {
+		price, bumped int64
+	}{{0, 10}, {10, 20}, {100, 125}, {101, 127}} {
+		price := types.NewGasPrice(tc.price)
+		assert.Equal(testGasPriceString(tc.bumped), bumpGasPrice(&price).String(), "gas price %d", tc.price)
+	}
+}
+
+func testGasPriceString(price int64) string {
+	p := types.NewGasPrice(price)
+	return p.String()
+}
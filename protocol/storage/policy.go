@@ -0,0 +1,236 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/config"
+	"github.com/filecoin-project/go-filecoin/util/convert"
+)
+
+// decisionHookTimeout is how long the miner waits for a decision hook before
+// rejecting the proposal.
+const decisionHookTimeout = 30 * time.Second
+
+// hookDecision is the JSON answer of a decision hook called over HTTP.
+type hookDecision struct {
+	Accept bool   `json:"accept"`
+	Reason string `json:"reason"`
+}
+
+func (sm *Miner) getDealPolicy() (*config.DealPolicyConfig, error) {
+	policy, err := sm.porcelainAPI.ConfigGet("mining.dealPolicy")
+	if err != nil {
+		return nil, err
+	}
+	policyConfig, ok := policy.(*config.DealPolicyConfig)
+	if !ok {
+		return nil, errors.New("Could not retrieve dealPolicy from config")
+	}
+	return policyConfig, nil
+}
+
+// checkDealPolicy returns an error, suitable as the message of a rejection,
+// if the proposal breaks a rule of the miner's deal policy. The limit on the
+// bytes per client is checked by reserveClientBytes.
+func (sm *Miner) checkDealPolicy(ctx context.Context, p *DealProposal) error {
+	policy, err := sm.getDealPolicy()
+	if err != nil {
+		return err
+	}
+
+	if p.Size == nil {
+		return fmt.Errorf("proposed deal has no size")
+	}
+	size := p.Size.Uint64()
+
+	if size < policy.MinPieceSize {
+		return fmt.Errorf("piece size (%d bytes) is less than the minimum of %d bytes", size, policy.MinPieceSize)
+	}
+	if policy.MaxPieceSize > 0 && size > policy.MaxPieceSize {
+		return fmt.Errorf("piece size (%d bytes) is more than the maximum of %d bytes", size, policy.MaxPieceSize)
+	}
+
+	if p.Duration < policy.MinDuration {
+		return fmt.Errorf("duration (%d blocks) is less than the minimum of %d blocks", p.Duration, policy.MinDuration)
+	}
+	if policy.MaxDuration > 0 && p.Duration > policy.MaxDuration {
+		return fmt.Errorf("duration (%d blocks) is more than the maximum of %d blocks", p.Duration, policy.MaxDuration)
+	}
+
+	client := p.Payment.Payer
+	if containsAddress(policy.DeniedClients, client) {
+		return fmt.Errorf("client %s is not accepted by this miner", client)
+	}
+	if len(policy.AllowedClients) > 0 && !containsAddress(policy.AllowedClients, client) {
+		return fmt.Errorf("client %s is not accepted by this miner", client)
+	}
+
+	if policy.MinFreeStagingBytes > 0 {
+		free, err := sm.node.FreeStagingBytes()
+		if err != nil {
+			return errors.Wrap(err, "could not determine free staging space")
+		}
+		if free < size+policy.MinFreeStagingBytes {
+			return fmt.Errorf("not enough free staging space for a piece of %d bytes", size)
+		}
+	}
+
+	if policy.DecisionHook != "" {
+		if err := runDecisionHook(ctx, policy.DecisionHook, p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reserveClientBytes counts the bytes of the proposal against the limit of
+// bytes per client of the miner's deal policy until release is called, or
+// returns an error if they would exceed it. Checking and reserving under the
+// same lock keeps concurrent proposals from together exceeding the limit.
+func (sm *Miner) reserveClientBytes(p *DealProposal) (release func(), err error) {
+	policy, err := sm.getDealPolicy()
+	if err != nil {
+		return nil, err
+	}
+	if policy.MaxBytesPerClient == 0 || p.Size == nil {
+		return func() {}, nil
+	}
+
+	proposalCid, err := convert.ToCid(p)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get cid of proposal")
+	}
+
+	sm.dealsLk.Lock()
+	defer sm.dealsLk.Unlock()
+
+	client := p.Payment.Payer
+	if total := sm.clientDealBytes(client) + p.Size.Uint64(); total > policy.MaxBytesPerClient {
+		return nil, fmt.Errorf("deal would bring client %s to %d bytes stored, more than the limit of %d bytes per client", client, total, policy.MaxBytesPerClient)
+	}
+
+	if sm.reserved == nil {
+		sm.reserved = make(map[cid.Cid]*DealProposal)
+	}
+	sm.reserved[proposalCid] = p
+	return func() {
+		sm.dealsLk.Lock()
+		defer sm.dealsLk.Unlock()
+		delete(sm.reserved, proposalCid)
+	}, nil
+}
+
+// clientDealBytes returns the bytes in the miner's deals with client that
+// were not rejected and have not failed, and in its proposals being decided
+// on. sm.dealsLk must be held.
+func (sm *Miner) clientDealBytes(client address.Address) uint64 {
+	var total uint64
+	for _, d := range sm.deals {
+		if d.Proposal.Payment.Payer != client || d.Proposal.Size == nil {
+			continue
+		}
+		if d.Response.State == Rejected || d.Response.State == Failed {
+			continue
+		}
+		total += d.Proposal.Size.Uint64()
+	}
+	for c, p := range sm.reserved {
+		// A proposal is counted once, even once it became a deal.
+		if _, ok := sm.deals[c]; ok || p.Payment.Payer != client {
+			continue
+		}
+		total += p.Size.Uint64()
+	}
+	return total
+}
+
+func containsAddress(addrs []address.Address, addr address.Address) bool {
+	for _, a := range addrs {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// runDecisionHook asks the hook whether to accept the proposal. A hook that
+// cannot be reached or fails rejects the proposal.
+func runDecisionHook(ctx context.Context, hook string, p *DealProposal) error {
+	proposal, err := json.Marshal(p)
+	if err != nil {
+		return errors.Wrap(err, "could not encode proposal for decision hook")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, decisionHookTimeout)
+	defer cancel()
+
+	if strings.HasPrefix(hook, "http://") || strings.HasPrefix(hook, "https://") {
+		return postDecisionHook(ctx, hook, proposal)
+	}
+	return execDecisionHook(ctx, hook, proposal)
+}
+
+// postDecisionHook posts the proposal to url, which answers with a
+// hookDecision.
+func postDecisionHook(ctx context.Context, url string, proposal []byte) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(proposal))
+	if err != nil {
+		return errors.Wrap(err, "decision hook failed")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, "decision hook failed")
+	}
+	defer res.Body.Close() // nolint: errcheck
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("decision hook failed: %s", res.Status)
+	}
+
+	var decision hookDecision
+	if err := json.NewDecoder(res.Body).Decode(&decision); err != nil {
+		return errors.Wrap(err, "decision hook failed")
+	}
+	if !decision.Accept {
+		return hookRejection(decision.Reason)
+	}
+	return nil
+}
+
+// execDecisionHook runs the executable at path with the proposal on stdin.
+// It accepts the proposal by exiting with status 0. Otherwise what it writes
+// to stdout is the reason for the rejection.
+func execDecisionHook(ctx context.Context, path string, proposal []byte) error {
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Stdin = bytes.NewReader(proposal)
+
+	out, err := cmd.Output()
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*exec.ExitError); ok && ctx.Err() == nil {
+		return hookRejection(strings.TrimSpace(string(out)))
+	}
+	return errors.Wrap(err, "decision hook failed")
+}
+
+func hookRejection(reason string) error {
+	if reason == "" {
+		return errors.New("rejected by decision hook")
+	}
+	return fmt.Errorf("rejected by decision hook: %s", reason)
+}
@@ -0,0 +1,244 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestDealPolicy(t *testing.T) {
+	// The test proposal is for 1000 bytes over 10000 blocks.
+	rejections := []struct {
+		name    string
+		key     string
+		value   string
+		message string
+	}{
+		{"piece too small", "minPieceSize", "1001", "piece size (1000 bytes) is less than the minimum of 1001 bytes"},
+		{"piece too large", "maxPieceSize", "999", "piece size (1000 bytes) is more than the maximum of 999 bytes"},
+		{"duration too short", "minDuration", "10001", "duration (10000 blocks) is less than the minimum of 10001 blocks"},
+		{"duration too long", "maxDuration", "9999", "duration (10000 blocks) is more than the maximum of 9999 blocks"},
+		{"client not allowed", "allowedClients", fmt.Sprintf(`["%s"]`, address.TestAddress), "is not accepted by this miner"},
+	}
+
+	for _, test := range rejections {
+		t.Run(fmt.Sprintf("Rejects proposals with %s", test.name), func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			porcelainAPI, miner, proposal := defaultMinerTestSetup(require, VoucherInterval, defaultAmountInc)
+			require.NoError(porcelainAPI.config.Set("mining.dealPolicy."+test.key, test.value))
+
+			res, err := miner.receiveStorageProposal(context.Background(), proposal)
+			require.NoError(err)
+
+			assert.Equal(Rejected, res.State)
+			assert.Contains(res.Message, test.message)
+		})
+	}
+
+	t.Run("Accepts proposals within all limits", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		porcelainAPI, miner, proposal := defaultMinerTestSetup(require, VoucherInterval, defaultAmountInc)
+		require.NoError(porcelainAPI.config.Set("mining.dealPolicy", fmt.Sprintf(`{
+			"minPieceSize": 1000,
+			"maxPieceSize": 1000,
+			"minDuration": 10000,
+			"maxDuration": 10000,
+			"allowedClients": ["%s"],
+			"maxBytesPerClient": 1000
+		}`, porcelainAPI.payerAddress)))
+
+		res, err := miner.receiveStorageProposal(context.Background(), proposal)
+		require.NoError(err)
+
+		assert.Equal(Accepted, res.State)
+	})
+
+	t.Run("Rejects proposals from denied clients", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		porcelainAPI, miner, proposal := defaultMinerTestSetup(require, VoucherInterval, defaultAmountInc)
+		require.NoError(porcelainAPI.config.Set("mining.dealPolicy.deniedClients", fmt.Sprintf(`["%s"]`, porcelainAPI.payerAddress)))
+
+		res, err := miner.receiveStorageProposal(context.Background(), proposal)
+		require.NoError(err)
+
+		assert.Equal(Rejected, res.State)
+		assert.Equal(fmt.Sprintf("client %s is not accepted by this miner", porcelainAPI.payerAddress), res.Message)
+	})
+
+	t.Run("Rejects proposals over the per client limit", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		porcelainAPI, miner, proposal := defaultMinerTestSetup(require, VoucherInterval, defaultAmountInc)
+		require.NoError(porcelainAPI.config.Set("mining.dealPolicy.maxBytesPerClient", "1500"))
+
+		newCid := types.NewCidForTestGetter()
+		miner.deals = map[cid.Cid]*storageDeal{}
+		addDeal := func(state DealState) {
+			p := proposal.DealProposal
+			miner.deals[newCid()] = &storageDeal{Proposal: &p, Response: &DealResponse{State: state}}
+		}
+
+		// Failed deals do not count against the limit.
+		addDeal(Failed)
+		res, err := miner.receiveStorageProposal(context.Background(), proposal)
+		require.NoError(err)
+		assert.Equal(Accepted, res.State)
+
+		addDeal(Staged)
+		res, err = miner.receiveStorageProposal(context.Background(), proposal)
+		require.NoError(err)
+		assert.Equal(Rejected, res.State)
+		assert.Contains(res.Message, "to 2000 bytes stored, more than the limit of 1500 bytes per client")
+	})
+
+	t.Run("Counts proposals being decided on against the per client limit", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		porcelainAPI, miner, proposal := defaultMinerTestSetup(require, VoucherInterval, defaultAmountInc)
+		require.NoError(porcelainAPI.config.Set("mining.dealPolicy.maxBytesPerClient", "1500"))
+
+		release, err := miner.reserveClientBytes(&proposal.DealProposal)
+		require.NoError(err)
+
+		_, err = miner.reserveClientBytes(&proposal.DealProposal)
+		require.Error(err)
+		assert.Contains(err.Error(), "to 2000 bytes stored")
+
+		release()
+		release, err = miner.reserveClientBytes(&proposal.DealProposal)
+		require.NoError(err)
+		release()
+	})
+
+	t.Run("Rejects proposals without enough free staging space", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		porcelainAPI, miner, proposal := defaultMinerTestSetup(require, VoucherInterval, defaultAmountInc)
+		miner.node = &resumeTestNode{freeStaging: 1 << 40}
+		require.NoError(porcelainAPI.config.Set("mining.dealPolicy.minFreeStagingBytes", "1"))
+
+		res, err := miner.receiveStorageProposal(context.Background(), proposal)
+		require.NoError(err)
+		assert.Equal(Accepted, res.State)
+
+		require.NoError(porcelainAPI.config.Set("mining.dealPolicy.minFreeStagingBytes", fmt.Sprintf("%d", uint64(1)<<62)))
+
+		res, err = miner.receiveStorageProposal(context.Background(), proposal)
+		require.NoError(err)
+		assert.Equal(Rejected, res.State)
+		assert.Equal("not enough free staging space for a piece of 1000 bytes", res.Message)
+	})
+
+	t.Run("Consults an executable decision hook", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		dir, err := ioutil.TempDir("", "hook")
+		require.NoError(err)
+		defer os.RemoveAll(dir) // nolint: errcheck
+
+		writeHook := func(name, script string) string {
+			path := filepath.Join(dir, name)
+			require.NoError(ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script), 0700))
+			return path
+		}
+		accept := writeHook("accept", "grep -q PieceRef && exit 0\nexit 1\n")
+		reject := writeHook("reject", "echo 'too busy'\nexit 1\n")
+
+		porcelainAPI, miner, proposal := defaultMinerTestSetup(require, VoucherInterval, defaultAmountInc)
+
+		require.NoError(porcelainAPI.config.Set("mining.dealPolicy.decisionHook", accept))
+		res, err := miner.receiveStorageProposal(context.Background(), proposal)
+		require.NoError(err)
+		assert.Equal(Accepted, res.State)
+
+		require.NoError(porcelainAPI.config.Set("mining.dealPolicy.decisionHook", reject))
+		res, err = miner.receiveStorageProposal(context.Background(), proposal)
+		require.NoError(err)
+		assert.Equal(Rejected, res.State)
+		assert.Equal("rejected by decision hook: too busy", res.Message)
+
+		require.NoError(porcelainAPI.config.Set("mining.dealPolicy.decisionHook", filepath.Join(dir, "missing")))
+		res, err = miner.receiveStorageProposal(context.Background(), proposal)
+		require.NoError(err)
+		assert.Equal(Rejected, res.State)
+		assert.Contains(res.Message, "decision hook failed")
+	})
+
+	t.Run("Does not consult decision hooks about proposals with invalid payments", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		dir, err := ioutil.TempDir("", "hook")
+		require.NoError(err)
+		defer os.RemoveAll(dir) // nolint: errcheck
+
+		called := filepath.Join(dir, "called")
+		hook := filepath.Join(dir, "hook")
+		require.NoError(ioutil.WriteFile(hook, []byte("#!/bin/sh\ntouch "+called+"\n"), 0700))
+
+		porcelainAPI, miner, proposal := defaultMinerTestSetup(require, VoucherInterval, defaultAmountInc)
+		require.NoError(porcelainAPI.config.Set("mining.dealPolicy.decisionHook", hook))
+		porcelainAPI.noChannels = true
+
+		res, err := miner.receiveStorageProposal(context.Background(), proposal)
+		require.NoError(err)
+		assert.Equal(Rejected, res.State)
+		assert.Contains(res.Message, "could not find payment channel")
+
+		_, err = os.Stat(called)
+		assert.True(os.IsNotExist(err))
+	})
+
+	t.Run("Consults an HTTP decision hook", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		var accept bool
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var p map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&p); err != nil || p["Size"] == nil {
+				http.Error(w, "bad proposal", http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(hookDecision{Accept: accept, Reason: "no space for you"}) // nolint: errcheck
+		}))
+		defer server.Close()
+
+		porcelainAPI, miner, proposal := defaultMinerTestSetup(require, VoucherInterval, defaultAmountInc)
+		require.NoError(porcelainAPI.config.Set("mining.dealPolicy.decisionHook", server.URL))
+
+		accept = true
+		res, err := miner.receiveStorageProposal(context.Background(), proposal)
+		require.NoError(err)
+		assert.Equal(Accepted, res.State)
+
+		accept = false
+		res, err = miner.receiveStorageProposal(context.Background(), proposal)
+		require.NoError(err)
+		assert.Equal(Rejected, res.State)
+		assert.Equal("rejected by decision hook: no space for you", res.Message)
+	})
+}
@@ -0,0 +1,380 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/actor/builtin/miner"
+	"github.com/filecoin-project/go-filecoin/metrics"
+	"github.com/filecoin-project/go-filecoin/proofs"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// provingDatastoreKey is where a miner's proving progress is persisted in its
+// deals datastore.
+var provingDatastoreKey = datastore.NewKey("proving")
+
+var (
+	postsProven = metrics.NewCounter("filecoin_proving_posts_proven_total", "Number of PoSts included in the chain.")
+	postsFailed = metrics.NewCounter("filecoin_proving_posts_failed_total", "Number of PoSts that failed to be generated or included in the chain.")
+	postsLate   = metrics.NewCounter("filecoin_proving_posts_late_total", "Number of proving periods that ended without a PoSt.")
+)
+
+func init() {
+	metrics.DefaultRegistry.MustRegister(postsProven, postsFailed, postsLate)
+}
+
+// ProvingState is how far the PoSt of a proving period got.
+type ProvingState string
+
+const (
+	// ProvingIdle means the miner has no committed sectors to prove.
+	ProvingIdle = ProvingState("idle")
+	// ProvingWaiting means PoSt generation waits for its lead time or for
+	// the period's challenge to be in the chain.
+	ProvingWaiting = ProvingState("waiting")
+	// ProvingGenerating means the PoSt is being generated.
+	ProvingGenerating = ProvingState("generating")
+	// ProvingSubmitting means the PoSt was sent and waits to be included in
+	// the chain.
+	ProvingSubmitting = ProvingState("submitting")
+	// ProvingProven means the PoSt was included in the chain.
+	ProvingProven = ProvingState("proven")
+	// ProvingFailed means the last attempt at the PoSt failed. It is tried
+	// again at the next head while the period lasts.
+	ProvingFailed = ProvingState("failed")
+	// ProvingLate means the period ended without a PoSt.
+	ProvingLate = ProvingState("late")
+)
+
+// ProvingAlert warns that the PoSt of a proving period is in trouble.
+type ProvingAlert string
+
+const (
+	// ProvingAlertNone means the PoSt is on track.
+	ProvingAlertNone = ProvingAlert("")
+	// ProvingAlertAtRisk means less than half of the lead time is left
+	// before the end of the period and the PoSt was not sent yet.
+	ProvingAlertAtRisk = ProvingAlert("at-risk")
+	// ProvingAlertFailed means the last attempt at the PoSt failed.
+	ProvingAlertFailed = ProvingAlert("failed")
+	// ProvingAlertLate means the period ended without a PoSt.
+	ProvingAlertLate = ProvingAlert("late")
+)
+
+// ProvingInfo describes the proving period of a miner and the progress of its
+// PoSt.
+type ProvingInfo struct {
+	// Height is the height of the head the info was computed at.
+	Height *types.BlockHeight
+
+	// PeriodStart and PeriodEnd bound the current proving period, and a
+	// late PoSt may still be accepted at a penalty until GraceEnd.
+	PeriodStart *types.BlockHeight
+	PeriodEnd   *types.BlockHeight
+	GraceEnd    *types.BlockHeight
+
+	// LeadBlocks is the configured lead time, and GenerationStart the
+	// height PoSt generation starts at.
+	LeadBlocks      uint64
+	GenerationStart *types.BlockHeight
+
+	// Sectors is how many committed sectors the PoSt proves.
+	Sectors int
+
+	State     ProvingState
+	Attempts  int
+	LastError string
+	Alert     ProvingAlert
+}
+
+// provingRecord is the progress of the PoSt of a proving period, persisted
+// so that a restarted miner knows what it was doing.
+type provingRecord struct {
+	PeriodStart *types.BlockHeight
+	State       ProvingState
+	Attempts    int
+	LastError   string
+	// Started is when the last attempt started, in seconds since the epoch.
+	Started int64
+}
+
+// prover is what a provingScheduler needs of a storage miner.
+type prover interface {
+	getProvingPeriodStart() (*types.BlockHeight, error)
+	getPoStInputs(ctx context.Context) ([]generatePostInput, error)
+	getPoStChallenge(ctx context.Context, ts types.TipSet, start *types.BlockHeight) (proofs.PoStChallengeSeed, error)
+	getPoStLeadBlocks() (uint64, error)
+	submitPoSt(start, end *types.BlockHeight, seed proofs.PoStChallengeSeed, inputs []generatePostInput) error
+}
+
+// provingScheduler tracks the proving periods of a miner. It starts
+// generating the PoSt of a period its lead time before the period ends, tries
+// again when an attempt fails, and raises an alert when the PoSt is at risk,
+// failed or late.
+type provingScheduler struct {
+	p  prover
+	ds repo.Datastore
+
+	// lk protects record and info.
+	lk     sync.Mutex
+	record provingRecord
+	info   ProvingInfo
+}
+
+// newProvingScheduler returns a provingScheduler for p, resuming the
+// progress persisted in ds.
+func newProvingScheduler(p prover, ds repo.Datastore) (*provingScheduler, error) {
+	s := &provingScheduler{
+		p:      p,
+		ds:     ds,
+		record: provingRecord{State: ProvingIdle},
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	s.info.State = s.record.State
+	s.info.PeriodStart = s.record.PeriodStart
+	return s, nil
+}
+
+// onNewHead checks whether the PoSt of the current proving period is due,
+// and starts generating it if so.
+func (s *provingScheduler) onNewHead(ctx context.Context, ts types.TipSet) {
+	height, err := ts.Height()
+	if err != nil {
+		log.Errorf("failed to get block height: %s", err)
+		return
+	}
+	h := types.NewBlockHeight(height)
+
+	inputs, err := s.p.getPoStInputs(ctx)
+	if err != nil {
+		log.Errorf("failed to get PoSt inputs: %s", err)
+		return
+	}
+
+	if len(inputs) == 0 {
+		// no sector sealed, nothing to do
+		s.lk.Lock()
+		defer s.lk.Unlock()
+		s.info = ProvingInfo{Height: h, State: ProvingIdle}
+		return
+	}
+
+	start, err := s.p.getProvingPeriodStart()
+	if err != nil {
+		log.Errorf("failed to get provingPeriodStart: %s", err)
+		return
+	}
+	lead, err := s.p.getPoStLeadBlocks()
+	if err != nil {
+		log.Errorf("failed to get PoSt lead time: %s", err)
+		return
+	}
+	end := start.Add(miner.ProvingPeriodBlocks)
+	generationStart := provingGenerationStart(start, end, lead)
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	defer s.updateInfo(h, start, end, lead, generationStart, len(inputs))
+
+	if s.record.PeriodStart == nil || !s.record.PeriodStart.Equal(start) {
+		// The chain accepted the last PoSt, or this is the first period.
+		s.record = provingRecord{PeriodStart: start, State: ProvingWaiting}
+		s.save()
+	}
+
+	switch s.record.State {
+	case ProvingGenerating, ProvingProven, ProvingLate:
+		return
+	}
+
+	if h.GreaterEqual(end) {
+		// TODO: figure out faults and payments here
+		log.Errorf("proving period %s-%s ended at %s without a PoSt", start, end, h)
+		postsLate.Inc()
+		s.record.State = ProvingLate
+		s.save()
+		return
+	}
+	if s.record.State == ProvingSubmitting || h.LessThan(generationStart) {
+		return
+	}
+
+	seed, err := s.p.getPoStChallenge(ctx, ts, start)
+	if err != nil {
+		log.Debugf("waiting for PoSt challenge: %s", err)
+		return
+	}
+
+	s.record.State = ProvingGenerating
+	s.record.Attempts++
+	s.record.Started = time.Now().Unix()
+	s.save()
+	go s.prove(start, end, seed, inputs)
+}
+
+// prove generates and submits the PoSt of the period from start to end.
+func (s *provingScheduler) prove(start, end *types.BlockHeight, seed proofs.PoStChallengeSeed, inputs []generatePostInput) {
+	err := s.p.submitPoSt(start, end, seed, inputs)
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if !s.record.PeriodStart.Equal(start) {
+		return
+	}
+	if err != nil {
+		s.fail(err)
+		return
+	}
+	s.record.State = ProvingSubmitting
+	s.save()
+	s.info.State = s.record.State
+}
+
+// onPoStDone is called once the PoSt of the period starting at start was
+// included in the chain, or failed to be.
+func (s *provingScheduler) onPoStDone(start *types.BlockHeight, err error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if start == nil || s.record.PeriodStart == nil || !s.record.PeriodStart.Equal(start) {
+		return
+	}
+	if err != nil {
+		s.fail(err)
+		return
+	}
+	postsProven.Inc()
+	s.record.State = ProvingProven
+	s.record.LastError = ""
+	s.save()
+	s.info.State = s.record.State
+	s.info.LastError = ""
+	s.info.Alert = ProvingAlertNone
+}
+
+// fail records a failed attempt at the PoSt. Callers must hold lk.
+func (s *provingScheduler) fail(err error) {
+	log.Errorf("PoSt of proving period starting at %s failed after %d attempts: %s", s.record.PeriodStart, s.record.Attempts, err)
+	postsFailed.Inc()
+	s.record.State = ProvingFailed
+	s.record.LastError = err.Error()
+	s.save()
+	s.info.State = s.record.State
+	s.info.LastError = s.record.LastError
+	s.info.Alert = ProvingAlertFailed
+}
+
+// updateInfo refreshes info at height h and logs new alerts. Callers must
+// hold lk.
+func (s *provingScheduler) updateInfo(h, start, end *types.BlockHeight, lead uint64, generationStart *types.BlockHeight, sectors int) {
+	alert := provingAlert(s.record.State, h, end, generationStart)
+	if alert != s.info.Alert {
+		switch alert {
+		case ProvingAlertAtRisk:
+			log.Warningf("PoSt of proving period %s-%s is at risk at %s: it is %s", start, end, h, s.record.State)
+		case ProvingAlertFailed, ProvingAlertLate:
+			log.Errorf("PoSt of proving period %s-%s is %s at %s", start, end, alert, h)
+		}
+	}
+
+	s.info = ProvingInfo{
+		Height:          h,
+		PeriodStart:     start,
+		PeriodEnd:       end,
+		GraceEnd:        end.Add(miner.GracePeriodBlocks),
+		LeadBlocks:      lead,
+		GenerationStart: generationStart,
+		Sectors:         sectors,
+		State:           s.record.State,
+		Attempts:        s.record.Attempts,
+		LastError:       s.record.LastError,
+		Alert:           alert,
+	}
+}
+
+// provingInfo returns a copy of the info computed at the last head.
+func (s *provingScheduler) provingInfo() *ProvingInfo {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	info := s.info
+	return &info
+}
+
+// load resumes the progress persisted when the miner last stopped.
+func (s *provingScheduler) load() error {
+	data, err := s.ds.Get(provingDatastoreKey)
+	if err == datastore.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to get proving progress from datastore")
+	}
+	if err := json.Unmarshal(data.([]byte), &s.record); err != nil {
+		return errors.Wrap(err, "failed to unmarshal proving progress from datastore")
+	}
+
+	// A PoSt that was being generated is generated again. One that was
+	// submitted is resumed by the outbox.
+	if s.record.State == ProvingGenerating {
+		log.Infof("resuming PoSt of proving period starting at %s after %d attempts", s.record.PeriodStart, s.record.Attempts)
+		s.record.State = ProvingWaiting
+	}
+	return nil
+}
+
+// save persists the record. Callers must hold lk.
+func (s *provingScheduler) save() {
+	data, err := json.Marshal(s.record)
+	if err != nil {
+		log.Errorf("could not marshal proving progress: %s", err)
+		return
+	}
+	if err := s.ds.Put(provingDatastoreKey, data); err != nil {
+		log.Errorf("could not save proving progress: %s", err)
+	}
+}
+
+// provingGenerationStart returns the height PoSt generation starts at in the
+// period from start to end, lead blocks before its end. A lead of zero, or
+// one at least as long as the period, starts it with the period.
+func provingGenerationStart(start, end *types.BlockHeight, lead uint64) *types.BlockHeight {
+	leadBlocks := types.NewBlockHeight(lead)
+	if lead == 0 || leadBlocks.GreaterEqual(end.Sub(start)) {
+		return start
+	}
+	return end.Sub(leadBlocks)
+}
+
+// provingAlert returns the alert for a PoSt in state at height h of a period
+// ending at end, whose generation started at generationStart.
+func provingAlert(state ProvingState, h, end, generationStart *types.BlockHeight) ProvingAlert {
+	switch state {
+	case ProvingIdle, ProvingProven:
+		return ProvingAlertNone
+	case ProvingLate:
+		return ProvingAlertLate
+	case ProvingFailed:
+		return ProvingAlertFailed
+	}
+	if h.GreaterEqual(end) {
+		return ProvingAlertLate
+	}
+	if state == ProvingSubmitting {
+		return ProvingAlertNone
+	}
+
+	// Less than half of the lead time is left.
+	halfLead := types.NewBlockHeight(end.Sub(generationStart).AsBigInt().Uint64() / 2)
+	if h.GreaterEqual(end.Sub(halfLead)) {
+		return ProvingAlertAtRisk
+	}
+	return ProvingAlertNone
+}
@@ -0,0 +1,272 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/proofs"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// provingTestProver proves sectors for a period starting at start, with a
+// challenge only available from challengeHeight on. Its PoSts fail with
+// submitErr.
+type provingTestProver struct {
+	lk              sync.Mutex
+	start           *types.BlockHeight
+	sectors         int
+	lead            uint64
+	challengeHeight uint64
+	submitErr       error
+	submitted       chan *types.BlockHeight
+}
+
+func newProvingTestProver() *provingTestProver {
+	return &provingTestProver{
+		start:     types.NewBlockHeight(100),
+		sectors:   2,
+		lead:      1000,
+		submitted: make(chan *types.BlockHeight, 10),
+	}
+}
+
+func (p *provingTestProver) getProvingPeriodStart() (*types.BlockHeight, error) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	return p.start, nil
+}
+
+func (p *provingTestProver) getPoStInputs(ctx context.Context) ([]generatePostInput, error) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	inputs := make([]generatePostInput, p.sectors)
+	for i := range inputs {
+		inputs[i].sectorID = uint64(i)
+	}
+	return inputs, nil
+}
+
+func (p *provingTestProver) getPoStChallenge(ctx context.Context, ts types.TipSet, start *types.BlockHeight) (proofs.PoStChallengeSeed, error) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	h, err := ts.Height()
+	if err != nil {
+		return proofs.PoStChallengeSeed{}, err
+	}
+	if h < p.challengeHeight {
+		return proofs.PoStChallengeSeed{}, errors.New("challenge not in the chain yet")
+	}
+	return proofs.PoStChallengeSeed{1}, nil
+}
+
+func (p *provingTestProver) getPoStLeadBlocks() (uint64, error) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	return p.lead, nil
+}
+
+func (p *provingTestProver) submitPoSt(start, end *types.BlockHeight, seed proofs.PoStChallengeSeed, inputs []generatePostInput) error {
+	p.lk.Lock()
+	err := p.submitErr
+	p.lk.Unlock()
+	p.submitted <- start
+	return err
+}
+
+func provingTestHead(t *testing.T, h uint64) types.TipSet {
+	return types.RequireNewTipSet(require.New(t), &types.Block{Height: types.Uint64(h)})
+}
+
+func waitForProvingState(t *testing.T, s *provingScheduler, state ProvingState) *ProvingInfo {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		info := s.provingInfo()
+		if info.State == state {
+			return info
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for proving state %s, state is %s", state, info.State)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestProvingScheduler(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("starts generation its lead time before the period ends", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		p := newProvingTestProver()
+		s, err := newProvingScheduler(p, repo.NewInMemoryRepo().DealsDatastore())
+		require.NoError(err)
+
+		s.onNewHead(ctx, provingTestHead(t, 200))
+		info := s.provingInfo()
+		assert.Equal(ProvingWaiting, info.State)
+		assert.Equal(types.NewBlockHeight(20100), info.PeriodEnd)
+		assert.Equal(types.NewBlockHeight(20200), info.GraceEnd)
+		assert.Equal(types.NewBlockHeight(19100), info.GenerationStart)
+		assert.Equal(2, info.Sectors)
+		assert.Equal(ProvingAlertNone, info.Alert)
+		assert.Len(p.submitted, 0)
+
+		s.onNewHead(ctx, provingTestHead(t, 19100))
+		assert.Equal(types.NewBlockHeight(100), <-p.submitted)
+		info = waitForProvingState(t, s, ProvingSubmitting)
+		assert.Equal(1, info.Attempts)
+
+		// Further heads leave the submitted PoSt alone.
+		s.onNewHead(ctx, provingTestHead(t, 19101))
+		assert.Len(p.submitted, 0)
+
+		s.onPoStDone(types.NewBlockHeight(100), nil)
+		assert.Equal(ProvingProven, s.provingInfo().State)
+
+		// The chain moves the period on once the PoSt lands.
+		p.lk.Lock()
+		p.start = types.NewBlockHeight(20100)
+		p.lk.Unlock()
+		s.onNewHead(ctx, provingTestHead(t, 19102))
+		info = s.provingInfo()
+		assert.Equal(ProvingWaiting, info.State)
+		assert.Equal(0, info.Attempts)
+	})
+
+	t.Run("waits for the challenge to be in the chain", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		p := newProvingTestProver()
+		p.lead = 0
+		p.challengeHeight = 150
+		s, err := newProvingScheduler(p, repo.NewInMemoryRepo().DealsDatastore())
+		require.NoError(err)
+
+		s.onNewHead(ctx, provingTestHead(t, 120))
+		assert.Equal(types.NewBlockHeight(100), s.provingInfo().GenerationStart)
+		assert.Equal(ProvingWaiting, s.provingInfo().State)
+		assert.Len(p.submitted, 0)
+
+		s.onNewHead(ctx, provingTestHead(t, 150))
+		assert.Equal(types.NewBlockHeight(100), <-p.submitted)
+		waitForProvingState(t, s, ProvingSubmitting)
+	})
+
+	t.Run("tries failed PoSts again", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		p := newProvingTestProver()
+		p.submitErr = errors.New("boom")
+		s, err := newProvingScheduler(p, repo.NewInMemoryRepo().DealsDatastore())
+		require.NoError(err)
+
+		s.onNewHead(ctx, provingTestHead(t, 19100))
+		<-p.submitted
+		info := waitForProvingState(t, s, ProvingFailed)
+		assert.Equal("boom", info.LastError)
+		assert.Equal(ProvingAlertFailed, info.Alert)
+
+		p.lk.Lock()
+		p.submitErr = nil
+		p.lk.Unlock()
+		s.onNewHead(ctx, provingTestHead(t, 19101))
+		<-p.submitted
+		info = waitForProvingState(t, s, ProvingSubmitting)
+		assert.Equal(2, info.Attempts)
+
+		// The PoSt may still fail to land in the chain.
+		s.onPoStDone(types.NewBlockHeight(100), errors.New("exit code 1"))
+		info = s.provingInfo()
+		assert.Equal(ProvingFailed, info.State)
+		assert.Equal("exit code 1", info.LastError)
+	})
+
+	t.Run("raises alerts as the deadline nears and passes", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		p := newProvingTestProver()
+		p.challengeHeight = 30000
+		s, err := newProvingScheduler(p, repo.NewInMemoryRepo().DealsDatastore())
+		require.NoError(err)
+
+		s.onNewHead(ctx, provingTestHead(t, 19599))
+		assert.Equal(ProvingAlertNone, s.provingInfo().Alert)
+
+		s.onNewHead(ctx, provingTestHead(t, 19600))
+		assert.Equal(ProvingAlertAtRisk, s.provingInfo().Alert)
+
+		s.onNewHead(ctx, provingTestHead(t, 20100))
+		info := s.provingInfo()
+		assert.Equal(ProvingLate, info.State)
+		assert.Equal(ProvingAlertLate, info.Alert)
+
+		// A late period is not proven anymore.
+		p.lk.Lock()
+		p.challengeHeight = 0
+		p.lk.Unlock()
+		s.onNewHead(ctx, provingTestHead(t, 20101))
+		assert.Len(p.submitted, 0)
+		assert.Equal(ProvingLate, s.provingInfo().State)
+	})
+
+	t.Run("resumes its progress after a restart", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		dealsDs := repo.NewInMemoryRepo().DealsDatastore()
+		p := newProvingTestProver()
+		before, err := newProvingScheduler(p, dealsDs)
+		require.NoError(err)
+
+		before.onNewHead(ctx, provingTestHead(t, 19100))
+		<-p.submitted
+		waitForProvingState(t, before, ProvingSubmitting)
+
+		s, err := newProvingScheduler(p, dealsDs)
+		require.NoError(err)
+		assert.Equal(ProvingSubmitting, s.provingInfo().State)
+
+		// The outbox reports the PoSt it resumed.
+		s.onPoStDone(types.NewBlockHeight(100), nil)
+		assert.Equal(ProvingProven, s.provingInfo().State)
+
+		// A PoSt that was being generated is generated again.
+		s.lk.Lock()
+		s.record.State = ProvingGenerating
+		s.save()
+		s.lk.Unlock()
+
+		s, err = newProvingScheduler(p, dealsDs)
+		require.NoError(err)
+		assert.Equal(ProvingWaiting, s.provingInfo().State)
+
+		s.onNewHead(ctx, provingTestHead(t, 19200))
+		<-p.submitted
+		info := waitForProvingState(t, s, ProvingSubmitting)
+		assert.Equal(2, info.Attempts)
+	})
+
+	t.Run("is idle without sectors", func(t *testing.T) {
+		require := require.New(t)
+
+		p := newProvingTestProver()
+		p.sectors = 0
+		s, err := newProvingScheduler(p, repo.NewInMemoryRepo().DealsDatastore())
+		require.NoError(err)
+
+		s.onNewHead(ctx, provingTestHead(t, 19100))
+		require.Equal(ProvingIdle, s.provingInfo().State)
+		require.Len(p.submitted, 0)
+	})
+}
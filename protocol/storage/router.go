@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"sync"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	inet "gx/ipfs/QmTGxDz2CjBucFzPNTiWwzQmTWdrBnzqbqrMucDYMsjuPb/go-libp2p-net"
+	"gx/ipfs/Qmd52WKRSwrBK5gUaJKawryZQ5by6UbNB8KVW2Zy6JtbyW/go-libp2p-host"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	cbu "github.com/filecoin-project/go-filecoin/cborutil"
+)
+
+// MinerRouter serves the storage protocols of a node for all of its storage
+// miners, handing each request to the miner it is for. Proposals, and checks
+// of them, are routed by the miner they are made to, queries and transfers by the miner the deal
+// was proposed to.
+type MinerRouter struct {
+	lk sync.RWMutex
+	// miners are the routed miners, in the order they were added. The first
+	// answers queries for deals no miner knows.
+	miners []*Miner
+}
+
+// NewMinerRouter returns a MinerRouter serving the storage protocols on h.
+func NewMinerRouter(h host.Host) *MinerRouter {
+	r := &MinerRouter{}
+	h.SetStreamHandler(makeDealProtocol, r.handleMakeDeal)
+	h.SetStreamHandler(queryDealProtocol, r.handleQueryDeal)
+	h.SetStreamHandler(checkProposalProtocol, r.handleCheckProposal)
+	h.SetStreamHandler(transferProtocol, r.handleTransfer)
+	return r
+}
+
+// Add routes the requests for the miner of sm to sm, in place of the storage
+// miner previously added for it.
+func (r *MinerRouter) Add(sm *Miner) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	for i, m := range r.miners {
+		if m.Address() == sm.Address() {
+			r.miners[i] = sm
+			return
+		}
+	}
+	r.miners = append(r.miners, sm)
+}
+
+// Miner returns the storage miner of the miner with the given address.
+func (r *MinerRouter) Miner(addr address.Address) (*Miner, bool) {
+	r.lk.RLock()
+	defer r.lk.RUnlock()
+
+	for _, m := range r.miners {
+		if m.Address() == addr {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+// MinerForDeal returns the storage miner the proposal with the given cid was
+// made to.
+func (r *MinerRouter) MinerForDeal(proposalCid cid.Cid) (*Miner, bool) {
+	r.lk.RLock()
+	defer r.lk.RUnlock()
+
+	for _, m := range r.miners {
+		if m.hasDeal(proposalCid) {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+// minerForQuery returns the storage miner that answers a query for the
+// proposal with the given cid.
+func (r *MinerRouter) minerForQuery(proposalCid cid.Cid) (*Miner, bool) {
+	if sm, ok := r.MinerForDeal(proposalCid); ok {
+		return sm, true
+	}
+
+	r.lk.RLock()
+	defer r.lk.RUnlock()
+	if len(r.miners) == 0 {
+		return nil, false
+	}
+	return r.miners[0], true
+}
+
+func (r *MinerRouter) handleMakeDeal(s inet.Stream) {
+	defer s.Close() // nolint: errcheck
+
+	var signedProposal SignedDealProposal
+	if err := cbu.NewMsgReader(s).ReadMsg(&signedProposal); err != nil {
+		log.Errorf("received invalid proposal: %s", err)
+		return
+	}
+
+	sm, ok := r.Miner(signedProposal.MinerAddress)
+	if !ok {
+		log.Errorf("received proposal for miner %s, which this node does not run", signedProposal.MinerAddress)
+		return
+	}
+	sm.serveMakeDeal(s, &signedProposal)
+}
+
+func (r *MinerRouter) handleCheckProposal(s inet.Stream) {
+	defer s.Close() // nolint: errcheck
+
+	var signedProposal SignedDealProposal
+	if err := cbu.NewMsgReader(s).ReadMsg(&signedProposal); err != nil {
+		log.Errorf("received invalid proposal to check: %s", err)
+		return
+	}
+
+	sm, ok := r.Miner(signedProposal.MinerAddress)
+	if !ok {
+		log.Errorf("received proposal to check for miner %s, which this node does not run", signedProposal.MinerAddress)
+		return
+	}
+	sm.serveCheckProposal(s, &signedProposal)
+}
+
+func (r *MinerRouter) handleQueryDeal(s inet.Stream) {
+	defer s.Close() // nolint: errcheck
+
+	var q queryRequest
+	if err := cbu.NewMsgReader(s).ReadMsg(&q); err != nil {
+		log.Errorf("received invalid query: %s", err)
+		return
+	}
+
+	sm, ok := r.minerForQuery(q.Cid)
+	if !ok {
+		log.Errorf("received query for deal %s while not mining", q.Cid)
+		return
+	}
+	sm.serveQueryDeal(s, &q)
+}
+
+func (r *MinerRouter) handleTransfer(s inet.Stream) {
+	defer s.Close() // nolint: errcheck
+
+	reader := cbu.NewMsgReaderSize(s, maxTransferMessageSize)
+	w := cbu.NewMsgWriter(s)
+
+	var req transferRequest
+	if err := reader.ReadMsg(&req); err != nil {
+		log.Errorf("received invalid transfer request: %s", err)
+		return
+	}
+
+	sm, ok := r.MinerForDeal(req.ProposalCid)
+	if !ok {
+		if err := w.WriteMsg(&transferResponse{Message: "no such deal: " + req.ProposalCid.String()}); err != nil {
+			log.Errorf("failed to write transfer response: %s", err)
+		}
+		return
+	}
+	sm.serveTransfer(s.Conn().RemotePeer(), reader, w, &req)
+}
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestMinerRouter(t *testing.T) {
+	assert := assert.New(t)
+
+	addrGetter := address.NewForTestGetter()
+	newCid := types.NewCidForTestGetter()
+
+	proposal := newCid()
+	first := &Miner{minerAddr: addrGetter(), deals: map[cid.Cid]*storageDeal{}}
+	second := &Miner{minerAddr: addrGetter(), deals: map[cid.Cid]*storageDeal{proposal: {}}}
+
+	r := &MinerRouter{}
+	_, ok := r.minerForQuery(proposal)
+	assert.False(ok)
+
+	r.Add(first)
+	r.Add(second)
+
+	sm, ok := r.Miner(second.Address())
+	assert.True(ok)
+	assert.True(sm == second)
+	_, ok = r.Miner(addrGetter())
+	assert.False(ok)
+
+	sm, ok = r.MinerForDeal(proposal)
+	assert.True(ok)
+	assert.True(sm == second)
+	_, ok = r.MinerForDeal(newCid())
+	assert.False(ok)
+
+	// Queries for unknown deals are answered by the first miner.
+	sm, ok = r.minerForQuery(newCid())
+	assert.True(ok)
+	assert.True(sm == first)
+
+	// Adding a miner again replaces its storage miner.
+	restarted := &Miner{minerAddr: first.Address(), deals: map[cid.Cid]*storageDeal{}}
+	r.Add(restarted)
+	assert.Len(r.miners, 2)
+	sm, _ = r.Miner(first.Address())
+	assert.True(sm == restarted)
+}
@@ -30,6 +30,16 @@ const (
 
 	// Staged means that the data in the deal has been staged into a sector
 	Staged
+
+	// Verified means the client has checked that the deal's data is sealed
+	// in a sector whose commitments are on chain. Only clients set it.
+	Verified
+
+	// SectorVerified means the client has checked that the sector the miner
+	// reports the deal's data in is committed on chain, but could not check
+	// that the data lies inside it, as its verifier cannot check piece
+	// inclusion proofs. Only clients set it.
+	SectorVerified
 )
 
 func (s DealState) String() string {
@@ -50,7 +60,24 @@ func (s DealState) String() string {
 		return "complete"
 	case Staged:
 		return "staged"
+	case Verified:
+		return "verified"
+	case SectorVerified:
+		return "sector-verified"
 	default:
 		return fmt.Sprintf("<unrecognized %d>", s)
 	}
 }
+
+// dealStates are the states a deal can be in, and be listed by.
+var dealStates = []DealState{Rejected, Accepted, Started, Failed, Posted, Complete, Staged, Verified, SectorVerified}
+
+// ParseDealState returns the deal state named s, as printed by String.
+func ParseDealState(s string) (DealState, error) {
+	for _, state := range dealStates {
+		if state.String() == s {
+			return state, nil
+		}
+	}
+	return Unknown, fmt.Errorf("unknown deal state %q", s)
+}
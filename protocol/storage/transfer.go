@@ -0,0 +1,575 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	dag "gx/ipfs/QmNRAuGmvnVw8urHkUZQirhu42VTiZjVWASa2aTznEMmpP/go-merkledag"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	ipld "gx/ipfs/QmRL22E4paat7ky7vx9MLpR97JHHbFPrg3ytFQw6qp1y1s/go-ipld-format"
+	"gx/ipfs/QmRu7tiRnFk9mMPpVECQTBQJqXtmG132jJxA1w9A7TtpBz/go-ipfs-blockstore"
+	"gx/ipfs/QmSz8kAe2JCKp2dWSG8gHSWnwSmne8YfRXTeK5HBmc9L7t/go-ipfs-exchange-offline"
+	"gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
+	car "gx/ipfs/QmUGpiTCKct5s1F7jaAnY9KJmoo7Qm1R2uhSjq5iHDSUMn/go-car"
+	ds "gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore/namespace"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore/query"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+	"gx/ipfs/QmZNkThpqfVXs9GNbexPrfBbXSLNYeKrE7jwFM2oqHbyqN/go-libp2p-protocol"
+	bserv "gx/ipfs/QmZsGVGCqMCNzHLNMB6q4F6yyvomqf1VxwhJwSfgo1NGaF/go-blockservice"
+
+	cbu "github.com/filecoin-project/go-filecoin/cborutil"
+)
+
+const transferProtocol = protocol.ID("/fil/storage/xfer/1.0.0")
+
+// importScratchDatastorePrefix prefixes the keys under which the CAR file of
+// an offline deal is loaded while it is imported.
+const importScratchDatastorePrefix = "dealimport"
+
+// TransferMode is how the data of a deal gets to the miner.
+type TransferMode string
+
+const (
+	// TransferFetch, the default, means the miner fetches the data from the
+	// network over bitswap.
+	TransferFetch = TransferMode("")
+
+	// TransferPush means the client pushes the data to the miner over the
+	// transfer protocol once the deal is accepted.
+	TransferPush = TransferMode("push")
+
+	// TransferOffline means the data is delivered out of band, e.g. on a hard
+	// drive, and imported by the miner with `client import-deal-data`.
+	TransferOffline = TransferMode("offline")
+)
+
+const (
+	// maxTransferMessageSize bounds the size of a pushed block and its
+	// framing. It is well above the size of blocks made by the importer.
+	maxTransferMessageSize = 2 << 20
+
+	// transferProgressInterval is the number of blocks between progress
+	// reports.
+	transferProgressInterval = 64
+
+	// transferAttempts is the number of times a client tries to push a
+	// deal's data before giving up.
+	transferAttempts = 5
+
+	// transferRetryDelay is multiplied by the attempt number to get the delay
+	// before the client retries a failed push.
+	transferRetryDelay = 10 * time.Second
+
+	// transferDataTimeout is how long a miner waits for the data of a pushed
+	// or fetched deal. Offline deals wait indefinitely.
+	transferDataTimeout = time.Hour
+)
+
+// transferRequest opens a push of the data of the deal with the given
+// proposal cid.
+type transferRequest struct {
+	ProposalCid cid.Cid
+}
+
+// transferResponse is the miner's answer to a transferRequest, and is sent
+// again once all blocks are received.
+type transferResponse struct {
+	Accepted bool
+	Message  string
+	// Offset is the number of blocks, in walkDAG order, that the miner
+	// already has. The client resumes sending after them.
+	Offset uint64
+}
+
+// transferBlock is a block of the DAG being pushed. A transferBlock with Done
+// set ends the transfer.
+type transferBlock struct {
+	Done bool
+	Cid  *cid.Cid
+	Data []byte
+}
+
+// transferRefusedError is returned when a miner refuses a push. Such pushes
+// are not retried.
+type transferRefusedError struct {
+	message string
+}
+
+func (e *transferRefusedError) Error() string {
+	return fmt.Sprintf("miner refused transfer: %s", e.message)
+}
+
+// walkDAG calls visit for each node of the DAG rooted at root once, depth
+// first in link order. Both ends of a push walk the DAG the same way, so a
+// restarted push can skip the blocks the miner already has.
+func walkDAG(ctx context.Context, getter ipld.NodeGetter, root cid.Cid, visit func(ipld.Node) error) error {
+	seen := cid.NewSet()
+
+	var walk func(c cid.Cid) error
+	walk = func(c cid.Cid) error {
+		if !seen.Visit(c) {
+			return nil
+		}
+		nd, err := getter.Get(ctx, c)
+		if err != nil {
+			return err
+		}
+		if err := visit(nd); err != nil {
+			return err
+		}
+		for _, l := range nd.Links() {
+			if err := walk(l.Cid); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(root)
+}
+
+// localDAG returns a DAG service reading only from the miner's blockstore.
+func (sm *Miner) localDAG() ipld.DAGService {
+	bs := sm.node.BlockService().Blockstore()
+	return dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+}
+
+// countLocalBlocks returns the number of blocks of the DAG rooted at root that
+// the miner has, counting in walkDAG order up to the first missing one, and
+// whether it has them all.
+func (sm *Miner) countLocalBlocks(ctx context.Context, root cid.Cid) (uint64, bool) {
+	var n uint64
+	err := walkDAG(ctx, sm.localDAG(), root, func(ipld.Node) error {
+		n++
+		return nil
+	})
+	return n, err == nil
+}
+
+// missingBlocks returns the cids of the blocks of the DAG rooted at root that
+// the miner is missing, but which are linked from a block it has or are the
+// root. These are the blocks it accepts next in a push.
+func (sm *Miner) missingBlocks(ctx context.Context, root cid.Cid) (*cid.Set, error) {
+	missing := cid.NewSet()
+	seen := cid.NewSet()
+	getter := sm.localDAG()
+
+	var walk func(c cid.Cid) error
+	walk = func(c cid.Cid) error {
+		if !seen.Visit(c) {
+			return nil
+		}
+		nd, err := getter.Get(ctx, c)
+		if err == ipld.ErrNotFound {
+			missing.Add(c)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, l := range nd.Links() {
+			if err := walk(l.Cid); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return missing, walk(root)
+}
+
+// dealAwaitingData returns the proposal of the deal with the given cid if it
+// is still waiting for its data.
+func (sm *Miner) dealAwaitingData(c cid.Cid) (*DealProposal, error) {
+	sm.dealsLk.Lock()
+	defer sm.dealsLk.Unlock()
+
+	d, ok := sm.deals[c]
+	if !ok {
+		return nil, fmt.Errorf("no such deal: %s", c)
+	}
+	switch d.Response.State {
+	case Accepted, Started:
+		return d.Proposal, nil
+	default:
+		return nil, fmt.Errorf("deal %s is %s, not awaiting data", c, d.Response.State)
+	}
+}
+
+// dealDataArrived returns a channel that is closed the next time data for the
+// deal is pushed or imported.
+func (sm *Miner) dealDataArrived(c cid.Cid) <-chan struct{} {
+	sm.transfersLk.Lock()
+	defer sm.transfersLk.Unlock()
+
+	if sm.transfers == nil {
+		sm.transfers = make(map[cid.Cid]chan struct{})
+	}
+	ch, ok := sm.transfers[c]
+	if !ok {
+		ch = make(chan struct{})
+		sm.transfers[c] = ch
+	}
+	return ch
+}
+
+func (sm *Miner) notifyDealDataArrived(c cid.Cid) {
+	sm.transfersLk.Lock()
+	defer sm.transfersLk.Unlock()
+
+	if ch, ok := sm.transfers[c]; ok {
+		close(ch)
+		delete(sm.transfers, c)
+	}
+}
+
+// waitForDealData waits until the miner has the deal's whole DAG.
+func (sm *Miner) waitForDealData(ctx context.Context, c cid.Cid, proposal *DealProposal) error {
+	if proposal.TransferMode != TransferOffline {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, transferDataTimeout)
+		defer cancel()
+	}
+
+	if proposal.TransferMode == TransferFetch {
+		// TODO: this is not a great way to do this. At least use a session.
+		return dag.FetchGraph(ctx, proposal.PieceRef, dag.NewDAGService(sm.node.BlockService()))
+	}
+
+	for {
+		// Get the channel before checking, so data arriving in between is not
+		// missed.
+		arrived := sm.dealDataArrived(c)
+		if _, complete := sm.countLocalBlocks(ctx, proposal.PieceRef); complete {
+			sm.notifyDealDataArrived(c)
+			return nil
+		}
+
+		select {
+		case <-arrived:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// reportTransferProgress records the number of the piece's blocks received
+// in the deal's response, for clients querying the deal.
+func (sm *Miner) reportTransferProgress(c cid.Cid, blockCount uint64) {
+	err := sm.updateDealResponse(c, func(resp *DealResponse) {
+		resp.Message = fmt.Sprintf("received %d of the piece's blocks", blockCount)
+	})
+	if err != nil {
+		log.Errorf("could not record transfer progress: %s", err)
+	}
+}
+
+// serveTransfer receives the data of a deal pushed by its client from peer
+// from, over the stream the MinerRouter read req from with r. Only the blocks
+// of the deal's piece are accepted, and only from the peer that proposed it.
+func (sm *Miner) serveTransfer(from peer.ID, r *cbu.MsgReader, w *cbu.MsgWriter, req *transferRequest) {
+	ctx := context.Background()
+	c := req.ProposalCid
+
+	refuse := func(message string) {
+		if err := w.WriteMsg(&transferResponse{Message: message}); err != nil {
+			log.Errorf("failed to write transfer response: %s", err)
+		}
+	}
+
+	proposal, err := sm.dealAwaitingData(c)
+	if err != nil {
+		refuse(err.Error())
+		return
+	}
+	if proposer := sm.getStorageDeal(c).Proposer; proposer != from {
+		log.Warningf("peer %s tried to push data for deal %s proposed by %s", from, c, proposer)
+		refuse("transfer must come from the deal's proposer")
+		return
+	}
+
+	wanted, err := sm.missingBlocks(ctx, proposal.PieceRef)
+	if err != nil {
+		log.Errorf("failed to read local blocks of deal %s: %s", c, err)
+		refuse("internal error")
+		return
+	}
+
+	offset, _ := sm.countLocalBlocks(ctx, proposal.PieceRef)
+	if err := w.WriteMsg(&transferResponse{Accepted: true, Offset: offset}); err != nil {
+		log.Errorf("failed to write transfer response: %s", err)
+		return
+	}
+
+	bs := sm.node.BlockService()
+	var received uint64
+	for {
+		var msg transferBlock
+		if err := r.ReadMsg(&msg); err != nil {
+			log.Errorf("transfer of deal %s interrupted after %d blocks: %s", c, received, err)
+			sm.reportTransferProgress(c, offset+received)
+			return
+		}
+		if msg.Done {
+			break
+		}
+		if msg.Cid == nil {
+			log.Errorf("received block without cid for deal %s", c)
+			return
+		}
+
+		if !wanted.Has(*msg.Cid) {
+			if has, err := bs.Blockstore().Has(*msg.Cid); err == nil && has {
+				// Already received, e.g. by a push that got further than
+				// the offset the client resumed from.
+				continue
+			}
+			log.Errorf("received block %s that is not part of the piece of deal %s", msg.Cid, c)
+			return
+		}
+
+		blk, err := verifiedBlock(*msg.Cid, msg.Data)
+		if err != nil {
+			log.Errorf("received invalid block for deal %s: %s", c, err)
+			return
+		}
+		nd, err := ipld.Decode(blk)
+		if err != nil {
+			log.Errorf("received undecodable block for deal %s: %s", c, err)
+			return
+		}
+		if err := bs.AddBlock(nd); err != nil {
+			log.Errorf("failed to store block for deal %s: %s", c, err)
+			return
+		}
+
+		// The block's links are part of the piece too.
+		wanted.Remove(nd.Cid())
+		for _, l := range nd.Links() {
+			if has, err := bs.Blockstore().Has(l.Cid); err != nil || !has {
+				wanted.Add(l.Cid)
+			}
+		}
+
+		received++
+		if received%transferProgressInterval == 0 {
+			sm.reportTransferProgress(c, offset+received)
+		}
+	}
+
+	total, complete := sm.countLocalBlocks(ctx, proposal.PieceRef)
+	resp := &transferResponse{Accepted: complete, Offset: total}
+	if complete {
+		sm.reportTransferProgress(c, total)
+		sm.notifyDealDataArrived(c)
+	} else {
+		resp.Message = fmt.Sprintf("transfer incomplete, have %d blocks", total)
+	}
+	if err := w.WriteMsg(resp); err != nil {
+		log.Errorf("failed to write transfer response: %s", err)
+	}
+}
+
+// verifiedBlock returns the block with the given data, checking that it
+// hashes to c.
+func verifiedBlock(c cid.Cid, data []byte) (blocks.Block, error) {
+	sum, err := c.Prefix().Sum(data)
+	if err != nil {
+		return nil, err
+	}
+	if !sum.Equals(c) {
+		return nil, fmt.Errorf("data does not match cid %s", c)
+	}
+	return blocks.NewBlockWithCid(data, c)
+}
+
+// ImportDealData imports the data of an offline deal from a CAR file, which
+// must hold the whole DAG of the proposal's PieceRef and nothing else at its
+// root. Processing of the deal then continues as if the data had been pushed.
+func (sm *Miner) ImportDealData(ctx context.Context, proposalCid cid.Cid, r io.Reader) error {
+	proposal, err := sm.dealAwaitingData(proposalCid)
+	if err != nil {
+		return err
+	}
+
+	// Offline deals hold pieces too large to push, so the file is loaded into
+	// a scratch space in the deals datastore rather than in memory. Blocks
+	// are only copied to the node's blockstore once the file's root is the
+	// deal's piece.
+	scratchDs := namespace.Wrap(sm.dealsDs, ds.NewKey(importScratchDatastorePrefix).ChildString(proposalCid.String()))
+	if err := clearDatastore(scratchDs); err != nil {
+		return errors.Wrap(err, "failed to clear import scratch space")
+	}
+	defer func() {
+		if err := clearDatastore(scratchDs); err != nil {
+			log.Warningf("failed to clear import scratch space of deal %s: %s", proposalCid, err)
+		}
+	}()
+
+	scratch := blockstore.NewBlockstore(scratchDs)
+	header, err := car.LoadCar(scratch, r)
+	if err != nil {
+		return errors.Wrap(err, "failed to read CAR file")
+	}
+	if len(header.Roots) != 1 || !header.Roots[0].Equals(proposal.PieceRef) {
+		return fmt.Errorf("CAR file roots %v do not match the deal's piece %s", header.Roots, proposal.PieceRef)
+	}
+
+	// A file missing blocks of the piece leaves the blocks before the first
+	// missing one in the blockstore; importing the whole piece later reuses
+	// them.
+	bs := sm.node.BlockService()
+	var blocksImported uint64
+	var storeErr error
+	scratchDAG := dag.NewDAGService(bserv.New(scratch, offline.Exchange(scratch)))
+	err = walkDAG(ctx, scratchDAG, proposal.PieceRef, func(nd ipld.Node) error {
+		if storeErr = bs.AddBlock(nd); storeErr != nil {
+			return storeErr
+		}
+		blocksImported++
+		return nil
+	})
+	if storeErr != nil {
+		return errors.Wrap(storeErr, "failed to store deal data")
+	}
+	if err != nil {
+		return errors.Wrap(err, "CAR file does not hold the deal's whole piece")
+	}
+
+	sm.reportTransferProgress(proposalCid, blocksImported)
+	sm.notifyDealDataArrived(proposalCid)
+	return nil
+}
+
+// clearDatastore deletes every entry of d.
+func clearDatastore(d ds.Datastore) error {
+	res, err := d.Query(query.Query{KeysOnly: true})
+	if err != nil {
+		return err
+	}
+	defer res.Close() // nolint: errcheck
+
+	for entry := range res.Next() {
+		if entry.Error != nil {
+			return entry.Error
+		}
+		if err := d.Delete(ds.NewKey(entry.Key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pushDealData pushes the data of a deal to its miner, retrying failed
+// attempts. Each attempt resumes after the blocks the miner already has.
+func (smc *Client) pushDealData(proposalCid cid.Cid) {
+	ctx := context.Background()
+
+	for attempt := 1; ; attempt++ {
+		err := smc.sendDealData(ctx, proposalCid)
+		if err == nil {
+			break
+		}
+		if _, refused := err.(*transferRefusedError); refused || attempt == transferAttempts {
+			log.Errorf("failed to push data for deal %s: %s", proposalCid, err)
+			return
+		}
+		log.Warningf("failed to push data for deal %s, retrying: %s", proposalCid, err)
+		time.Sleep(time.Duration(attempt) * transferRetryDelay)
+	}
+
+	smc.dealsLk.Lock()
+	defer smc.dealsLk.Unlock()
+	smc.deals[proposalCid].TransferComplete = true
+	if err := smc.saveDeal(proposalCid); err != nil {
+		log.Errorf("failed to record completed transfer of deal %s: %s", proposalCid, err)
+	}
+}
+
+func (smc *Client) sendDealData(ctx context.Context, proposalCid cid.Cid) error {
+	smc.dealsLk.Lock()
+	d, ok := smc.deals[proposalCid]
+	smc.dealsLk.Unlock()
+	if !ok {
+		return fmt.Errorf("no such proposal by cid: %s", proposalCid)
+	}
+
+	pid, err := smc.api.MinerGetPeerID(ctx, d.Miner)
+	if err != nil {
+		return err
+	}
+
+	s, err := smc.node.OpenStream(ctx, pid, transferProtocol)
+	if err != nil {
+		return err
+	}
+	defer s.Close() // nolint: errcheck
+
+	w := cbu.NewMsgWriter(s)
+	r := cbu.NewMsgReader(s)
+
+	if err := w.WriteMsg(&transferRequest{ProposalCid: proposalCid}); err != nil {
+		return errors.Wrap(err, "failed to write transfer request")
+	}
+	var resp transferResponse
+	if err := r.ReadMsg(&resp); err != nil {
+		return errors.Wrap(err, "failed to read transfer response")
+	}
+	if !resp.Accepted {
+		return &transferRefusedError{message: resp.Message}
+	}
+
+	var index, sent, sentBytes uint64
+	err = walkDAG(ctx, smc.node.DAGService(), d.Proposal.PieceRef, func(nd ipld.Node) error {
+		index++
+		if index <= resp.Offset {
+			return nil
+		}
+
+		c := nd.Cid()
+		if err := w.WriteMsg(&transferBlock{Cid: &c, Data: nd.RawData()}); err != nil {
+			return errors.Wrap(err, "failed to write block")
+		}
+
+		sent++
+		sentBytes += uint64(len(nd.RawData()))
+		if sent%transferProgressInterval == 0 {
+			log.Infof("deal %s: sent %d of the piece's blocks (%d bytes)", proposalCid, resp.Offset+sent, sentBytes)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := w.WriteMsg(&transferBlock{Done: true}); err != nil {
+		return errors.Wrap(err, "failed to end transfer")
+	}
+	if err := r.ReadMsg(&resp); err != nil {
+		return errors.Wrap(err, "failed to read transfer result")
+	}
+	if !resp.Accepted {
+		return errors.New(resp.Message)
+	}
+
+	log.Infof("deal %s: transfer complete, sent %d blocks (%d bytes)", proposalCid, sent, sentBytes)
+	return nil
+}
+
+// resumeTransfers restarts pushes interrupted when the client last stopped.
+func (smc *Client) resumeTransfers() {
+	smc.dealsLk.Lock()
+	defer smc.dealsLk.Unlock()
+
+	for c, d := range smc.deals {
+		if d.Proposal.TransferMode != TransferPush || d.TransferComplete {
+			continue
+		}
+		if d.Response.State != Accepted && d.Response.State != Started {
+			continue
+		}
+		go smc.pushDealData(c)
+	}
+}
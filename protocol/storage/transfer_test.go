@@ -0,0 +1,349 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	dag "gx/ipfs/QmNRAuGmvnVw8urHkUZQirhu42VTiZjVWASa2aTznEMmpP/go-merkledag"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	imp "gx/ipfs/QmRDWTzVdbHXdtat7tVJ7YC7kRaW7rTZTEF79yykcLYa49/go-unixfs/importer"
+	ipld "gx/ipfs/QmRL22E4paat7ky7vx9MLpR97JHHbFPrg3ytFQw6qp1y1s/go-ipld-format"
+	"gx/ipfs/QmRu7tiRnFk9mMPpVECQTBQJqXtmG132jJxA1w9A7TtpBz/go-ipfs-blockstore"
+	"gx/ipfs/QmSz8kAe2JCKp2dWSG8gHSWnwSmne8YfRXTeK5HBmc9L7t/go-ipfs-exchange-offline"
+	"gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
+	car "gx/ipfs/QmUGpiTCKct5s1F7jaAnY9KJmoo7Qm1R2uhSjq5iHDSUMn/go-car"
+	ds "gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore/query"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+	chunk "gx/ipfs/QmXivYDjgMqNQXbEQVC7TMuZnRADCa71ABQUQxWPZPTLbd/go-ipfs-chunker"
+	bserv "gx/ipfs/QmZsGVGCqMCNzHLNMB6q4F6yyvomqf1VxwhJwSfgo1NGaF/go-blockservice"
+	mocknet "gx/ipfs/QmcNGX5RaxPPCYwa6yGXM1EcUbrreTTinixLcYGmMwf1sx/go-libp2p/p2p/net/mock"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestPushDealData(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	clientDAG, root := newTransferTestDAG(require)
+	sm, bstore := newTransferTestMiner(require)
+	smc := newTransferTestClient(ctx, require, sm, clientDAG)
+
+	proposalCid := addTransferTestDeal(require, sm, smc, root, TransferPush)
+
+	arrived := make(chan error, 1)
+	go func() {
+		arrived <- sm.waitForDealData(ctx, proposalCid, sm.getStorageDeal(proposalCid).Proposal)
+	}()
+
+	require.NoError(smc.sendDealData(ctx, proposalCid))
+
+	select {
+	case err := <-arrived:
+		assert.NoError(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("miner never saw the pushed data")
+	}
+
+	total, complete := sm.countLocalBlocks(ctx, root)
+	assert.True(complete)
+	assert.Equal(int(total), bstore.putCount())
+	assert.Contains(sm.getStorageDeal(proposalCid).Response.Message, "received")
+}
+
+func TestPushDealDataResumes(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	clientDAG, root := newTransferTestDAG(require)
+	sm, bstore := newTransferTestMiner(require)
+	smc := newTransferTestClient(ctx, require, sm, clientDAG)
+
+	proposalCid := addTransferTestDeal(require, sm, smc, root, TransferPush)
+
+	// Give the miner the first blocks, as if an earlier push was interrupted.
+	var walked []ipld.Node
+	require.NoError(walkDAG(ctx, clientDAG, root, func(nd ipld.Node) error {
+		walked = append(walked, nd)
+		return nil
+	}))
+	had := len(walked) / 2
+	for _, nd := range walked[:had] {
+		require.NoError(sm.node.BlockService().AddBlock(nd))
+	}
+	bstore.resetPuts()
+
+	offset, complete := sm.countLocalBlocks(ctx, root)
+	assert.Equal(uint64(had), offset)
+	assert.False(complete)
+
+	require.NoError(smc.sendDealData(ctx, proposalCid))
+
+	_, complete = sm.countLocalBlocks(ctx, root)
+	assert.True(complete)
+	assert.Equal(len(walked)-had, bstore.putCount())
+}
+
+func TestPushDealDataRefused(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	clientDAG, root := newTransferTestDAG(require)
+	sm, _ := newTransferTestMiner(require)
+	smc := newTransferTestClient(ctx, require, sm, clientDAG)
+
+	proposalCid := addTransferTestDeal(require, sm, smc, root, TransferPush)
+	require.NoError(sm.updateDealResponse(proposalCid, func(resp *DealResponse) {
+		resp.State = Failed
+	}))
+
+	err := smc.sendDealData(ctx, proposalCid)
+	require.Error(err)
+	_, refused := err.(*transferRefusedError)
+	assert.True(refused)
+}
+
+func TestPushDealDataFromOtherPeer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	clientDAG, root := newTransferTestDAG(require)
+	sm, bstore := newTransferTestMiner(require)
+	smc := newTransferTestClient(ctx, require, sm, clientDAG)
+
+	proposalCid := addTransferTestDeal(require, sm, smc, root, TransferPush)
+	require.NoError(sm.updateDeal(proposalCid, func(d *storageDeal) {
+		d.Proposer = peer.ID("someone else")
+	}))
+
+	err := smc.sendDealData(ctx, proposalCid)
+	require.Error(err)
+	assert.Contains(err.Error(), "proposer")
+	assert.Equal(0, bstore.putCount())
+}
+
+func TestPushDealDataOutsidePiece(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	clientDAG, root := newTransferTestDAG(require)
+	sm, bstore := newTransferTestMiner(require)
+	smc := newTransferTestClient(ctx, require, sm, clientDAG)
+
+	// The client pushes another DAG than the deal's piece.
+	other := dag.NewRawNode([]byte("not the piece"))
+	require.NoError(clientDAG.Add(ctx, other))
+	proposalCid := addTransferTestDeal(require, sm, smc, root, TransferPush)
+	smc.deals[proposalCid].Proposal = &DealProposal{PieceRef: other.Cid(), TransferMode: TransferPush}
+
+	assert.Error(smc.sendDealData(ctx, proposalCid))
+	assert.Equal(0, bstore.putCount())
+}
+
+func TestFetchDealData(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	// The miner's exchange fetches from the client's blockstore.
+	clientBstore := blockstore.NewBlockstore(ds.NewMapDatastore())
+	data := dag.NewRawNode([]byte("fetched over the network"))
+	require.NoError(clientBstore.Put(data))
+
+	minerBstore := blockstore.NewBlockstore(ds.NewMapDatastore())
+	sm, _ := newTransferTestMiner(require)
+	sm.node = &resumeTestNode{blockService: bserv.New(minerBstore, offline.Exchange(clientBstore))}
+
+	proposal := &DealProposal{PieceRef: data.Cid(), TransferMode: TransferFetch}
+	require.NoError(sm.waitForDealData(ctx, types.SomeCid(), proposal))
+
+	has, err := minerBstore.Has(data.Cid())
+	require.NoError(err)
+	assert.True(has)
+}
+
+func TestImportDealData(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	clientDAG, root := newTransferTestDAG(require)
+	sm, bstore := newTransferTestMiner(require)
+	smc := newTransferTestClient(ctx, require, sm, clientDAG)
+
+	proposalCid := addTransferTestDeal(require, sm, smc, root, TransferOffline)
+
+	t.Run("rejects a CAR file of other data", func(t *testing.T) {
+		other := dag.NewRawNode([]byte("not the piece"))
+		require.NoError(clientDAG.Add(ctx, other))
+
+		var buf bytes.Buffer
+		require.NoError(car.WriteCar(ctx, clientDAG, []cid.Cid{other.Cid()}, &buf))
+
+		err := sm.ImportDealData(ctx, proposalCid, &buf)
+		assert.Error(err)
+		assert.Contains(err.Error(), "do not match")
+		assert.Equal(0, bstore.putCount())
+		assert.Equal(0, countImportScratchKeys(require, sm))
+	})
+
+	t.Run("imports a CAR file of the piece", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(car.WriteCar(ctx, clientDAG, []cid.Cid{root}, &buf))
+
+		arrived := sm.dealDataArrived(proposalCid)
+		require.NoError(sm.ImportDealData(ctx, proposalCid, &buf))
+
+		select {
+		case <-arrived:
+		default:
+			t.Fatal("import did not notify waiting deals")
+		}
+		_, complete := sm.countLocalBlocks(ctx, root)
+		assert.True(complete)
+
+		// The file was loaded into the deals datastore, which is left
+		// without it.
+		assert.Equal(0, countImportScratchKeys(require, sm))
+	})
+
+	t.Run("rejects deals not awaiting data", func(t *testing.T) {
+		err := sm.ImportDealData(ctx, dag.NewRawNode([]byte("no such deal")).Cid(), &bytes.Buffer{})
+		assert.Error(err)
+	})
+}
+
+// countImportScratchKeys returns the number of keys ImportDealData left in
+// the miner's deals datastore.
+func countImportScratchKeys(require *require.Assertions, sm *Miner) int {
+	res, err := sm.dealsDs.Query(query.Query{Prefix: "/" + importScratchDatastorePrefix, KeysOnly: true})
+	require.NoError(err)
+	entries, err := res.Rest()
+	require.NoError(err)
+	return len(entries)
+}
+
+// newTransferTestDAG returns a DAG service holding a piece of a few dozen
+// blocks, and the piece's root.
+func newTransferTestDAG(require *require.Assertions) (ipld.DAGService, cid.Cid) {
+	bstore := blockstore.NewBlockstore(ds.NewMapDatastore())
+	dserv := dag.NewDAGService(bserv.New(bstore, offline.Exchange(bstore)))
+
+	data := make([]byte, 10000)
+	rand.New(rand.NewSource(7)).Read(data) // nolint: errcheck
+	nd, err := imp.BuildDagFromReader(dserv, chunk.NewSizeSplitter(bytes.NewReader(data), 256))
+	require.NoError(err)
+
+	return dserv, nd.Cid()
+}
+
+func newTransferTestMiner(require *require.Assertions) (*Miner, *countingBlockstore) {
+	bstore := &countingBlockstore{Blockstore: blockstore.NewBlockstore(ds.NewMapDatastore())}
+	sm := &Miner{
+		deals:   make(map[cid.Cid]*storageDeal),
+		dealsDs: repo.NewInMemoryRepo().DealsDatastore(),
+		node:    &resumeTestNode{blockService: bserv.New(bstore, offline.Exchange(bstore))},
+	}
+	return sm, bstore
+}
+
+// newTransferTestClient returns a client connected to a host routing the
+// storage protocols to sm.
+func newTransferTestClient(ctx context.Context, require *require.Assertions, sm *Miner, dserv ipld.DAGService) *Client {
+	mn, err := mocknet.WithNPeers(ctx, 2)
+	require.NoError(err)
+	require.NoError(mn.LinkAll())
+	require.NoError(mn.ConnectAllButSelf())
+
+	clientHost, minerHost := mn.Hosts()[0], mn.Hosts()[1]
+	NewMinerRouter(minerHost).Add(sm)
+
+	return &Client{
+		deals:   make(map[cid.Cid]*clientDeal),
+		dealsDs: repo.NewInMemoryRepo().DealsDatastore(),
+		node:    NewClientNodeImpl(dserv, clientHost, time.Second),
+		api:     &transferTestAPI{minerPeer: minerHost.ID()},
+	}
+}
+
+// addTransferTestDeal records an accepted deal for the piece at root with
+// both the miner and the client.
+func addTransferTestDeal(require *require.Assertions, sm *Miner, smc *Client, root cid.Cid, mode TransferMode) cid.Cid {
+	proposal := &DealProposal{PieceRef: root, TransferMode: mode}
+	proposalCid := types.SomeCid()
+
+	sm.deals[proposalCid] = &storageDeal{
+		Proposal: proposal,
+		Response: &DealResponse{State: Accepted, ProposalCid: proposalCid},
+		Proposer: smc.node.(*ClientNodeImpl).host.ID(),
+	}
+	require.NoError(sm.saveDeal(proposalCid))
+
+	smc.deals[proposalCid] = &clientDeal{
+		Miner:    address.TestAddress,
+		Proposal: proposal,
+		Response: &DealResponse{State: Accepted, ProposalCid: proposalCid},
+	}
+	require.NoError(smc.saveDeal(proposalCid))
+
+	return proposalCid
+}
+
+// transferTestAPI resolves every miner to the same peer.
+type transferTestAPI struct {
+	clientPorcelainAPI
+
+	minerPeer peer.ID
+}
+
+func (api *transferTestAPI) MinerGetPeerID(context.Context, address.Address) (peer.ID, error) {
+	return api.minerPeer, nil
+}
+
+// countingBlockstore counts the blocks put into it.
+type countingBlockstore struct {
+	blockstore.Blockstore
+
+	lk   sync.Mutex
+	puts int
+}
+
+func (bs *countingBlockstore) Put(blk blocks.Block) error {
+	bs.lk.Lock()
+	bs.puts++
+	bs.lk.Unlock()
+	return bs.Blockstore.Put(blk)
+}
+
+func (bs *countingBlockstore) PutMany(blks []blocks.Block) error {
+	bs.lk.Lock()
+	bs.puts += len(blks)
+	bs.lk.Unlock()
+	return bs.Blockstore.PutMany(blks)
+}
+
+func (bs *countingBlockstore) putCount() int {
+	bs.lk.Lock()
+	defer bs.lk.Unlock()
+	return bs.puts
+}
+
+func (bs *countingBlockstore) resetPuts() {
+	bs.lk.Lock()
+	defer bs.lk.Unlock()
+	bs.puts = 0
+}
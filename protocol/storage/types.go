@@ -16,6 +16,9 @@ func init() {
 	cbor.RegisterCborType(DealResponse{})
 	cbor.RegisterCborType(ProofInfo{})
 	cbor.RegisterCborType(queryRequest{})
+	cbor.RegisterCborType(transferRequest{})
+	cbor.RegisterCborType(transferResponse{})
+	cbor.RegisterCborType(transferBlock{})
 }
 
 // PaymentInfo contains all the payment related information for a storage deal.
@@ -61,6 +64,9 @@ type DealProposal struct {
 	// will use to pay the miner. It should be verifiable by the
 	// miner using on-chain information.
 	Payment PaymentInfo
+
+	// TransferMode is how the data will get to the miner.
+	TransferMode TransferMode
 }
 
 // Unmarshal a DealProposal from bytes.
@@ -112,16 +118,55 @@ type DealResponse struct {
 	// the miner has sealed the data into a sector.
 	ProofInfo *ProofInfo
 
-	// Signature is a signature from the miner over the response
+	// Signature is the signature of the miner's worker over the rest of the
+	// response.
 	Signature types.Signature
 }
 
+// unsignedBytes returns the bytes of the response that are signed.
+func (dr *DealResponse) unsignedBytes() ([]byte, error) {
+	unsigned := *dr
+	unsigned.Signature = nil
+	return cbor.DumpObject(unsigned)
+}
+
+// Sign sets the response's signature to one made with address `addr`, which
+// should be the worker of the responding miner.
+func (dr *DealResponse) Sign(addr address.Address, signer types.Signer) error {
+	data, err := dr.unsignedBytes()
+	if err != nil {
+		return err
+	}
+
+	sig, err := signer.SignBytes(data, addr)
+	if err != nil {
+		return err
+	}
+	dr.Signature = sig
+	return nil
+}
+
+// VerifySignature returns whether the response is signed by address `addr`.
+func (dr *DealResponse) VerifySignature(addr address.Address) bool {
+	data, err := dr.unsignedBytes()
+	if err != nil {
+		return false
+	}
+	return types.IsValidSignature(data, addr, dr.Signature)
+}
+
 // ProofInfo contains the details about a seal proof, that the client needs to know to verify that his deal was posted on chain.
 // TODO: finalize parameters
 type ProofInfo struct {
 	SectorID uint64
 	CommR    []byte
 	CommD    []byte
+
+	// CommP is the commitment of the deal's piece, and PieceInclusionProof
+	// proves that it lies inside CommD. They are empty if the miner's
+	// sector builder cannot generate piece inclusion proofs.
+	CommP               []byte
+	PieceInclusionProof []byte
 }
 
 type queryRequest struct {
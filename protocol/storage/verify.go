@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/proofs"
+)
+
+// verifyDeal checks that a deal the miner reports posted is really sealed:
+// the sector in resp.ProofInfo must be committed on chain by the deal's miner
+// with the reported commitments, the miner's piece commitment must be the one
+// the client computed when proposing the deal, and the miner's piece
+// inclusion proof must show the piece lies inside the sector's CommD. It
+// returns the state the deal is in once checked.
+//
+// A verifier that cannot check piece inclusion proofs, such as the Rust one
+// until rust-fil-proofs exposes them, only lets the sector be checked, and
+// the deal is SectorVerified rather than Verified.
+func (smc *Client) verifyDeal(ctx context.Context, deal *clientDeal, resp *DealResponse) (DealState, error) {
+	info := resp.ProofInfo
+	if info == nil {
+		return Posted, errors.New("miner sent no proof info")
+	}
+
+	commitments, err := smc.api.MinerGetSectorCommitments(ctx, deal.Miner)
+	if err != nil {
+		return Posted, errors.Wrap(err, "failed to get sector commitments")
+	}
+
+	onChain, ok := commitments[strconv.FormatUint(info.SectorID, 10)]
+	if !ok {
+		return Posted, fmt.Errorf("sector %d is not committed on chain", info.SectorID)
+	}
+	if !bytes.Equal(onChain.CommR[:], info.CommR) {
+		return Posted, fmt.Errorf("CommR of sector %d does not match the one on chain", info.SectorID)
+	}
+	if !bytes.Equal(onChain.CommD[:], info.CommD) {
+		return Posted, fmt.Errorf("CommD of sector %d does not match the one on chain", info.SectorID)
+	}
+
+	req := proofs.VerifyPieceInclusionProofRequest{
+		CommD:     onChain.CommD,
+		PieceSize: deal.Proposal.Size.Uint64(),
+		Proof:     info.PieceInclusionProof,
+	}
+	copy(req.CommP[:], info.CommP)
+
+	res, err := smc.verifier.VerifyPieceInclusionProof(req)
+	if err == proofs.ErrPieceInclusionProofsUnsupported {
+		return SectorVerified, nil
+	}
+	if err != nil {
+		return Posted, errors.Wrap(err, "failed to verify piece inclusion proof")
+	}
+
+	if len(deal.CommP) == 0 {
+		return Posted, errors.New("the piece commitment of the deal is unknown")
+	}
+	if !bytes.Equal(deal.CommP, info.CommP) {
+		return Posted, errors.New("piece commitment does not match the one computed for the deal")
+	}
+	if len(info.PieceInclusionProof) == 0 {
+		return Posted, errors.New("miner sent no piece inclusion proof")
+	}
+	if !res.IsValid {
+		return Posted, errors.New("invalid piece inclusion proof")
+	}
+
+	return Verified, nil
+}
@@ -36,6 +36,9 @@ const (
 	snapshotFilenamePrefix = "snapshot"
 )
 
+// APITokenFile is the filename containing the filecoin node's admin api token.
+const APITokenFile = "token"
+
 // NoRepoError is returned when trying to open a repo where one does not exist
 type NoRepoError struct {
 	Path string
@@ -259,6 +262,10 @@ func (r *FSRepo) Close() error {
 		return errors.Wrap(err, "error removing API file")
 	}
 
+	if err := r.removeFile(filepath.Join(r.path, APITokenFile)); err != nil {
+		return errors.Wrap(err, "error removing API token file")
+	}
+
 	return r.lockfile.Close()
 }
 
@@ -480,3 +487,27 @@ func APIAddrFromFile(apiFilePath string) (string, error) {
 func (r *FSRepo) APIAddr() (string, error) {
 	return APIAddrFromFile(filepath.Join(filepath.Clean(r.path), APIFile))
 }
+
+// SetAPIToken writes the admin token of the running API to a file readable
+// only by the current user.
+func (r *FSRepo) SetAPIToken(token string) error {
+	if err := ioutil.WriteFile(filepath.Join(r.path, APITokenFile), []byte(token), 0600); err != nil {
+		return errors.Wrap(err, "failed to write API token file")
+	}
+	return nil
+}
+
+// APITokenFromFile reads the token from the API token file at the given path.
+func APITokenFromFile(tokenFilePath string) (string, error) {
+	contents, err := ioutil.ReadFile(tokenFilePath)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read API token file")
+	}
+
+	return string(contents), nil
+}
+
+// APIToken reads the FSRepo's API token file and returns the admin token.
+func (r *FSRepo) APIToken() (string, error) {
+	return APITokenFromFile(filepath.Join(filepath.Clean(r.path), APITokenFile))
+}
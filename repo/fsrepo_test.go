@@ -30,7 +30,8 @@ const (
 			"GET",
 			"POST",
 			"PUT"
-		]
+		],
+		"authRequired": true
 	},
 	"bootstrap": {
 		"addresses": [],
@@ -48,7 +49,34 @@ const (
 		"minerAddress": "",
 		"blockSignerAddress": "",
 		"autoSealIntervalSeconds": 120,
-		"storagePrice": "0"
+		"storagePrice": "0",
+		"dealPolicy": {
+			"minPieceSize": 0,
+			"maxPieceSize": 0,
+			"minDuration": 0,
+			"maxDuration": 0,
+			"allowedClients": [],
+			"deniedClients": [],
+			"maxBytesPerClient": 0,
+			"minFreeStagingBytes": 0,
+			"decisionHook": ""
+		},
+		"sealPolicy": {
+			"fillPercent": 0,
+			"maxWaitSeconds": 0,
+			"maxConcurrentSeals": 0
+		},
+		"sealWorkers": {
+			"listenAddress": ""
+		},
+		"storagePaths": [],
+		"postLeadBlocks": 1000,
+		"miners": []
+	},
+	"client": {
+		"renewBeforeBlocks": 0,
+		"renewWithSameMiner": true,
+		"repairDeals": false
 	},
 	"wallet": {
 		"defaultAddress": ""
@@ -58,6 +86,14 @@ const (
 		"beatPeriod": "3s",
 		"reconnectPeriod": "10s",
 		"nickname": ""
+	},
+	"metrics": {
+		"prometheusEnabled": false,
+		"prometheusEndpoint": "/metrics"
+	},
+	"proofs": {
+		"insecure": false,
+		"insecureSealDelaySeconds": 0
 	}
 }`
 )
@@ -342,6 +378,42 @@ func TestRepoAPIFile(t *testing.T) {
 	})
 }
 
+func TestRepoAPITokenFile(t *testing.T) {
+	t.Parallel()
+	t.Run("APIToken returns the value written to the token file", func(t *testing.T) {
+		t.Parallel()
+		assert := assert.New(t)
+		require := require.New(t)
+
+		withFSRepo(t, func(r *FSRepo) {
+			require.NoError(r.SetAPIToken("sometoken"))
+
+			token, err := r.APIToken()
+			assert.NoError(err)
+			assert.Equal("sometoken", token)
+
+			info, err := os.Stat(filepath.Join(r.path, APITokenFile))
+			require.NoError(err)
+			assert.Equal(os.FileMode(0600), info.Mode().Perm())
+		})
+	})
+
+	t.Run("Close deletes API token file", func(t *testing.T) {
+		t.Parallel()
+		assert := assert.New(t)
+		require := require.New(t)
+
+		withFSRepo(t, func(r *FSRepo) {
+			require.NoError(r.SetAPIToken("sometoken"))
+
+			r.Close()
+
+			_, err := os.Stat(filepath.Join(r.path, APITokenFile))
+			assert.Error(err)
+		})
+	})
+}
+
 func withFSRepo(t *testing.T, f func(*FSRepo)) {
 	require := require.New(t)
 
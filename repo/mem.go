@@ -25,6 +25,7 @@ type MemRepo struct {
 	DealsDs    Datastore
 	version    uint
 	apiAddress string
+	apiToken   string
 	stagingDir string
 	sealedDir  string
 }
@@ -144,3 +145,14 @@ func (mr *MemRepo) SetAPIAddr(addr string) error {
 func (mr *MemRepo) APIAddr() (string, error) {
 	return mr.apiAddress, nil
 }
+
+// SetAPIToken writes the admin token of the running API to memory.
+func (mr *MemRepo) SetAPIToken(token string) error {
+	mr.apiToken = token
+	return nil
+}
+
+// APIToken reads the admin token of the running API from memory.
+func (mr *MemRepo) APIToken() (string, error) {
+	return mr.apiToken, nil
+}
@@ -0,0 +1,443 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+)
+
+// subscriptionBuffer is the number of notifications buffered for each
+// client subscription before it is dropped for falling behind.
+const subscriptionBuffer = 256
+
+// unsubscribeTimeout bounds how long Unsubscribe waits for the server.
+const unsubscribeTimeout = 10 * time.Second
+
+var (
+	// ErrClientClosed is returned by calls on a closed client.
+	ErrClientClosed = errors.New("rpc client closed")
+	// ErrNotificationsNotSupported is returned when subscribing on a client
+	// that does not use a websocket.
+	ErrNotificationsNotSupported = errors.New("subscriptions require a websocket connection")
+	// ErrSubscriptionQueueOverflow is reported by a subscription whose
+	// receiver did not keep up with its notifications.
+	ErrSubscriptionQueueOverflow = errors.New("subscription queue overflow")
+)
+
+// Client is a JSON-RPC client. A client made with NewHTTPClient sends each
+// call as an HTTP POST request; a client made with Dial makes calls over a
+// single websocket, and also supports subscriptions.
+type Client struct {
+	url   string
+	token string
+
+	httpClient *http.Client
+
+	ws *wsConn
+
+	lk      sync.Mutex
+	nextID  uint64
+	pending map[string]*pendingCall
+	subs    map[string]*ClientSubscription
+	closed  bool
+	err     error
+	done    chan struct{}
+}
+
+type pendingCall struct {
+	resp chan *message
+	// sub is set for subscribe calls, and is registered as soon as the
+	// response arrives so no notification for it can be missed.
+	sub *ClientSubscription
+}
+
+// NewHTTPClient returns a client that POSTs calls to the http:// url addr,
+// authenticating with token if it is not empty.
+func NewHTTPClient(addr, token string) *Client {
+	return &Client{
+		url:        addr,
+		token:      token,
+		httpClient: &http.Client{},
+		done:       make(chan struct{}),
+	}
+}
+
+// Dial opens a websocket to the ws:// url addr, authenticating with token if
+// it is not empty.
+func Dial(ctx context.Context, addr, token string) (*Client, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid url")
+	}
+
+	ws, err := dialWebsocket(ctx, u, authHeader(token))
+	if err != nil {
+		return nil, err
+	}
+	return newWebsocketClient(addr, token, ws), nil
+}
+
+// DialConn is like Dial, but opens the websocket over conn instead of a new
+// TCP connection, so that servers can be reached over other transports such
+// as unix sockets. addr only provides the host and path of the handshake.
+func DialConn(ctx context.Context, conn net.Conn, addr, token string) (*Client, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		conn.Close() // nolint: errcheck
+		return nil, errors.Wrap(err, "invalid url")
+	}
+
+	ws, err := handshakeWebsocket(ctx, conn, u, authHeader(token))
+	if err != nil {
+		return nil, err
+	}
+	return newWebsocketClient(addr, token, ws), nil
+}
+
+func authHeader(token string) http.Header {
+	header := http.Header{}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	return header
+}
+
+func newWebsocketClient(addr, token string, ws *wsConn) *Client {
+	c := &Client{
+		url:     addr,
+		token:   token,
+		ws:      ws,
+		pending: make(map[string]*pendingCall),
+		subs:    make(map[string]*ClientSubscription),
+		done:    make(chan struct{}),
+	}
+	go c.readLoop()
+	return c
+}
+
+// Call calls method with the given params and decodes its result into
+// result, which may be nil if the result is not needed.
+func (c *Client) Call(ctx context.Context, method string, result interface{}, params ...interface{}) error {
+	msg, err := c.roundTrip(ctx, method, params, nil)
+	if err != nil {
+		return err
+	}
+	if result == nil || len(msg.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(msg.Result, result)
+}
+
+// Subscribe calls the subscription method with the given params. Each
+// notification is decoded into a new value of ch's element type and sent on
+// ch, which must be a writable channel. ch is closed when the subscription
+// ends.
+func (c *Client) Subscribe(ctx context.Context, method string, ch interface{}, params ...interface{}) (*ClientSubscription, error) {
+	chv := reflect.ValueOf(ch)
+	if chv.Kind() != reflect.Chan || chv.Type().ChanDir()&reflect.SendDir == 0 {
+		panic(fmt.Sprintf("rpc: Subscribe needs a writable channel, got %T", ch))
+	}
+	if c.ws == nil {
+		return nil, ErrNotificationsNotSupported
+	}
+
+	sub := &ClientSubscription{
+		client: c,
+		ch:     chv,
+		queue:  make(chan json.RawMessage, subscriptionBuffer),
+		quit:   make(chan struct{}),
+		err:    make(chan error, 1),
+	}
+	if _, err := c.roundTrip(ctx, method, params, sub); err != nil {
+		return nil, err
+	}
+	// The id is set by the read loop when the response arrives.
+	if sub.id == "" {
+		return nil, errors.New("invalid subscription id")
+	}
+	return sub, nil
+}
+
+// Close closes the client's connection, ending all subscriptions.
+func (c *Client) Close() error {
+	if c.ws == nil {
+		return nil
+	}
+	c.lk.Lock()
+	c.closed = true
+	c.lk.Unlock()
+	return c.ws.Close()
+}
+
+func (c *Client) roundTrip(ctx context.Context, method string, params []interface{}, sub *ClientSubscription) (*message, error) {
+	if params == nil {
+		params = []interface{}{}
+	}
+	rawParams, err := json.Marshal(params)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode params")
+	}
+
+	c.lk.Lock()
+	c.nextID++
+	id := strconv.FormatUint(c.nextID, 10)
+	c.lk.Unlock()
+
+	req, err := json.Marshal(&request{
+		JSONRPC: Version,
+		ID:      json.RawMessage(id),
+		Method:  method,
+		Params:  rawParams,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var msg *message
+	if c.ws == nil {
+		msg, err = c.postHTTP(ctx, req)
+	} else {
+		msg, err = c.sendWebsocket(ctx, id, req, sub)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if msg.Error != nil {
+		return nil, msg.Error
+	}
+	return msg, nil
+}
+
+func (c *Client) postHTTP(ctx context.Context, body []byte) (*message, error) {
+	req, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxMessageSize))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &HTTPError{StatusCode: resp.StatusCode, Body: string(bytes.TrimSpace(data))}
+	}
+
+	var msg message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, errors.Wrap(err, "invalid response")
+	}
+	return &msg, nil
+}
+
+func (c *Client) sendWebsocket(ctx context.Context, id string, req []byte, sub *ClientSubscription) (*message, error) {
+	call := &pendingCall{resp: make(chan *message, 1), sub: sub}
+
+	c.lk.Lock()
+	if c.closed {
+		c.lk.Unlock()
+		return nil, ErrClientClosed
+	}
+	c.pending[id] = call
+	c.lk.Unlock()
+
+	defer func() {
+		c.lk.Lock()
+		delete(c.pending, id)
+		c.lk.Unlock()
+	}()
+
+	if err := c.ws.WriteMessage(req); err != nil {
+		return nil, err
+	}
+
+	select {
+	case msg := <-call.resp:
+		return msg, nil
+	case <-c.done:
+		return nil, c.closeErr()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *Client) closeErr() error {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	return c.err
+}
+
+// readLoop dispatches responses and notifications received over the
+// websocket until it is closed.
+func (c *Client) readLoop() {
+	var err error
+	defer func() {
+		c.lk.Lock()
+		if c.closed {
+			// Closed by us, so the read error is expected.
+			err = nil
+		}
+		c.closed = true
+		c.err = ErrClientClosed
+		subs := c.subs
+		c.subs = make(map[string]*ClientSubscription)
+		c.lk.Unlock()
+
+		close(c.done)
+		for _, sub := range subs {
+			sub.end(err)
+		}
+	}()
+
+	for {
+		var data []byte
+		data, err = c.ws.ReadMessage()
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+
+		var msg message
+		if jerr := json.Unmarshal(data, &msg); jerr != nil {
+			log.Warningf("ignoring invalid message from server: %s", jerr)
+			continue
+		}
+
+		if msg.Method == SubscriptionMethod {
+			c.lk.Lock()
+			sub := c.subs[msg.Params.Subscription]
+			c.lk.Unlock()
+			if sub != nil {
+				sub.deliver(msg.Params.Result)
+			}
+			continue
+		}
+
+		c.lk.Lock()
+		call := c.pending[string(msg.ID)]
+		if call != nil && call.sub != nil && msg.Error == nil {
+			var id string
+			if json.Unmarshal(msg.Result, &id) == nil {
+				call.sub.id = id
+				c.subs[id] = call.sub
+				go call.sub.run()
+			}
+		}
+		c.lk.Unlock()
+
+		if call != nil {
+			call.resp <- &msg
+		}
+	}
+}
+
+// ClientSubscription is a subscription made with Client.Subscribe.
+type ClientSubscription struct {
+	client *Client
+	id     string
+
+	ch    reflect.Value
+	queue chan json.RawMessage
+
+	quitOnce sync.Once
+	quit     chan struct{}
+	err      chan error
+}
+
+// Err returns a channel which receives the error that ended the
+// subscription, if any, and is then closed. It is closed without a value
+// when the subscription is ended by Unsubscribe or by closing the client.
+func (s *ClientSubscription) Err() <-chan error {
+	return s.err
+}
+
+// Unsubscribe ends the subscription.
+func (s *ClientSubscription) Unsubscribe() {
+	s.client.lk.Lock()
+	_, ok := s.client.subs[s.id]
+	delete(s.client.subs, s.id)
+	s.client.lk.Unlock()
+
+	if ok {
+		ctx, cancel := context.WithTimeout(context.Background(), unsubscribeTimeout)
+		defer cancel()
+		s.client.Call(ctx, UnsubscribeMethod, nil, s.id) // nolint: errcheck
+	}
+	s.end(nil)
+}
+
+// deliver queues a notification for delivery, ending the subscription if
+// its queue is full.
+func (s *ClientSubscription) deliver(result json.RawMessage) {
+	select {
+	case s.queue <- result:
+	case <-s.quit:
+	default:
+		s.client.lk.Lock()
+		delete(s.client.subs, s.id)
+		s.client.lk.Unlock()
+		s.end(ErrSubscriptionQueueOverflow)
+	}
+}
+
+// run decodes queued notifications and sends them on the subscriber's
+// channel until the subscription ends.
+func (s *ClientSubscription) run() {
+	defer s.ch.Close()
+
+	elemType := s.ch.Type().Elem()
+	for {
+		select {
+		case <-s.quit:
+			return
+		case raw := <-s.queue:
+			v := reflect.New(elemType)
+			if err := json.Unmarshal(raw, v.Interface()); err != nil {
+				log.Warningf("dropping undecodable notification for subscription %s: %s", s.id, err)
+				continue
+			}
+
+			chosen, _, _ := reflect.Select([]reflect.SelectCase{
+				{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(s.quit)},
+				{Dir: reflect.SelectSend, Chan: s.ch, Send: v.Elem()},
+			})
+			if chosen == 0 {
+				return
+			}
+		}
+	}
+}
+
+func (s *ClientSubscription) end(err error) {
+	s.quitOnce.Do(func() {
+		if err != nil {
+			s.err <- err
+		}
+		close(s.err)
+		close(s.quit)
+	})
+}
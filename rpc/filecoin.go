@@ -0,0 +1,242 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/auth"
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/core"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// FilecoinNamespace is the namespace the node's API is registered under.
+const FilecoinNamespace = "Filecoin"
+
+// filecoinPermissions maps each method of FilecoinAPI to the permission a
+// token must grant to call it. Methods not listed require admin.
+var filecoinPermissions = map[string]auth.Permission{
+	"ActorGet":           auth.PermRead,
+	"BlockGet":           auth.PermRead,
+	"ChainHead":          auth.PermRead,
+	"ChainNotify":        auth.PermRead,
+	"ChainSyncStatus":    auth.PermRead,
+	"MessagePoolNotify":  auth.PermRead,
+	"MessagePoolPending": auth.PermRead,
+	"MessageNotify":      auth.PermRead,
+	"MessageWait":        auth.PermRead,
+	"NetworkGetPeerID":   auth.PermRead,
+	"WalletAddresses":    auth.PermRead,
+	"WalletBalance":      auth.PermRead,
+	"MessageSend":        auth.PermSign,
+	"WalletNewAddress":   auth.PermWrite,
+}
+
+// RequiredPermission returns the permission needed to call the named method,
+// e.g. "Filecoin.ChainHead". Unsubscribing is always allowed as only the
+// caller's own subscriptions can be cancelled.
+func RequiredPermission(method string) auth.Permission {
+	if method == UnsubscribeMethod {
+		return auth.PermRead
+	}
+	if len(method) > len(FilecoinNamespace)+1 && method[:len(FilecoinNamespace)+1] == FilecoinNamespace+"." {
+		if perm, ok := filecoinPermissions[method[len(FilecoinNamespace)+1:]]; ok {
+			return perm
+		}
+	}
+	return auth.PermAdmin
+}
+
+// TokenAuthorizer returns an Authorizer admitting calls whose token, taken
+// from the request as by auth.TokenFromRequest, grants the permission the
+// method requires.
+func TokenAuthorizer(a *auth.Authenticator) Authorizer {
+	return func(r *http.Request, method string) error {
+		perm, err := a.Verify(auth.TokenFromRequest(r))
+		if err != nil {
+			return err
+		}
+		if required := RequiredPermission(method); !perm.Includes(required) {
+			return fmt.Errorf("%s permission required to call %s", required, method)
+		}
+		return nil
+	}
+}
+
+// filecoinPlumbing is the subset of the porcelain API FilecoinAPI uses.
+type filecoinPlumbing interface {
+	ActorGet(ctx context.Context, addr address.Address) (*actor.Actor, error)
+	BlockGet(ctx context.Context, id cid.Cid) (*types.Block, error)
+	ChainHead(ctx context.Context) types.TipSet
+	ChainNotify(ctx context.Context) <-chan types.TipSet
+	ChainSyncStatus() chain.SyncStatus
+	ConfigGet(dottedPath string) (interface{}, error)
+	ConfigSet(dottedPath string, paramJSON string) error
+	MessagePoolNotify(ctx context.Context) <-chan core.MessagePoolUpdate
+	MessagePoolPending() []*types.SignedMessage
+	MessageSendWithDefaultAddress(ctx context.Context, from, to address.Address, value *types.AttoFIL, gasPrice types.AttoFIL, gasLimit types.GasUnits, method string, params ...interface{}) (cid.Cid, error)
+	MessageWait(ctx context.Context, msgCid cid.Cid, cb func(*types.Block, *types.SignedMessage, *types.MessageReceipt) error) error
+	NetworkGetPeerID() peer.ID
+	WalletAddresses() []address.Address
+	WalletBalance(ctx context.Context, address address.Address) (*types.AttoFIL, error)
+	WalletNewAddress() (address.Address, error)
+}
+
+// MessageSendParams are the parameters of FilecoinAPI.MessageSend.
+type MessageSendParams struct {
+	// From is the address to send from. If empty, the node's default
+	// address is used.
+	From     address.Address
+	To       address.Address
+	Value    *types.AttoFIL
+	GasPrice types.AttoFIL
+	GasLimit types.GasUnits
+	// Method is the actor method to invoke, empty for a plain transfer.
+	// Methods taking parameters cannot yet be called over RPC.
+	Method string
+}
+
+// MessageConfirmation describes a message that has been included in a block.
+type MessageConfirmation struct {
+	Block   *types.Block
+	Message *types.SignedMessage
+	Receipt *types.MessageReceipt
+}
+
+// FilecoinAPI exposes the node's plumbing and porcelain over JSON-RPC with
+// JSON friendly types.
+type FilecoinAPI struct {
+	api filecoinPlumbing
+}
+
+// NewFilecoinAPI returns a FilecoinAPI serving calls from api, typically
+// the node's porcelain.API.
+func NewFilecoinAPI(api filecoinPlumbing) *FilecoinAPI {
+	return &FilecoinAPI{api: api}
+}
+
+// ActorGet returns the actor at addr in the latest state.
+func (f *FilecoinAPI) ActorGet(ctx context.Context, addr address.Address) (*actor.Actor, error) {
+	return f.api.ActorGet(ctx, addr)
+}
+
+// BlockGet returns the block with the given cid.
+func (f *FilecoinAPI) BlockGet(ctx context.Context, c cid.Cid) (*types.Block, error) {
+	return f.api.BlockGet(ctx, c)
+}
+
+// ChainHead returns the blocks of the head tipset.
+func (f *FilecoinAPI) ChainHead(ctx context.Context) ([]*types.Block, error) {
+	return f.api.ChainHead(ctx).ToSlice(), nil
+}
+
+// ChainNotify subscribes to new heads, sending the blocks of each.
+func (f *FilecoinAPI) ChainNotify(ctx context.Context) (<-chan []*types.Block, error) {
+	heads := f.api.ChainNotify(ctx)
+	out := make(chan []*types.Block)
+	go func() {
+		defer close(out)
+		for ts := range heads {
+			select {
+			case out <- ts.ToSlice():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// ChainSyncStatus returns the progress of the chain syncer.
+func (f *FilecoinAPI) ChainSyncStatus(ctx context.Context) (chain.SyncStatus, error) {
+	return f.api.ChainSyncStatus(), nil
+}
+
+// ConfigGet returns the config value at the given dotted path.
+func (f *FilecoinAPI) ConfigGet(ctx context.Context, dottedPath string) (interface{}, error) {
+	return f.api.ConfigGet(dottedPath)
+}
+
+// ConfigSet sets the config value at the given dotted path to the given
+// JSON value.
+func (f *FilecoinAPI) ConfigSet(ctx context.Context, dottedPath string, paramJSON string) error {
+	return f.api.ConfigSet(dottedPath, paramJSON)
+}
+
+// MessagePoolNotify subscribes to messages entering and leaving the pool.
+func (f *FilecoinAPI) MessagePoolNotify(ctx context.Context) (<-chan core.MessagePoolUpdate, error) {
+	return f.api.MessagePoolNotify(ctx), nil
+}
+
+// MessagePoolPending returns the messages waiting in the pool.
+func (f *FilecoinAPI) MessagePoolPending(ctx context.Context) ([]*types.SignedMessage, error) {
+	return f.api.MessagePoolPending(), nil
+}
+
+// MessageSend signs a message and adds it to the pool, returning its cid.
+func (f *FilecoinAPI) MessageSend(ctx context.Context, p MessageSendParams) (cid.Cid, error) {
+	value := p.Value
+	if value == nil {
+		value = types.ZeroAttoFIL
+	}
+	return f.api.MessageSendWithDefaultAddress(ctx, p.From, p.To, value, p.GasPrice, p.GasLimit, p.Method)
+}
+
+// MessageWait waits for the message with the given cid to be included in a
+// block.
+func (f *FilecoinAPI) MessageWait(ctx context.Context, c cid.Cid) (*MessageConfirmation, error) {
+	var conf *MessageConfirmation
+	err := f.api.MessageWait(ctx, c, func(blk *types.Block, msg *types.SignedMessage, receipt *types.MessageReceipt) error {
+		conf = &MessageConfirmation{Block: blk, Message: msg, Receipt: receipt}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// MessageNotify subscribes to the inclusion of the message with the given
+// cid in a block. A single notification is sent once it is, after which the
+// subscription ends.
+func (f *FilecoinAPI) MessageNotify(ctx context.Context, c cid.Cid) (<-chan *MessageConfirmation, error) {
+	out := make(chan *MessageConfirmation, 1)
+	go func() {
+		defer close(out)
+		conf, err := f.MessageWait(ctx, c)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Warningf("failed waiting for message %s: %s", c, err)
+			}
+			return
+		}
+		out <- conf
+	}()
+	return out, nil
+}
+
+// NetworkGetPeerID returns the node's peer id.
+func (f *FilecoinAPI) NetworkGetPeerID(ctx context.Context) (string, error) {
+	return f.api.NetworkGetPeerID().Pretty(), nil
+}
+
+// WalletAddresses returns the addresses in the node's wallet.
+func (f *FilecoinAPI) WalletAddresses(ctx context.Context) ([]address.Address, error) {
+	return f.api.WalletAddresses(), nil
+}
+
+// WalletBalance returns the balance of addr.
+func (f *FilecoinAPI) WalletBalance(ctx context.Context, addr address.Address) (*types.AttoFIL, error) {
+	return f.api.WalletBalance(ctx, addr)
+}
+
+// WalletNewAddress creates a new address in the node's wallet.
+func (f *FilecoinAPI) WalletNewAddress(ctx context.Context) (address.Address, error) {
+	return f.api.WalletNewAddress()
+}
@@ -0,0 +1,162 @@
+package rpc
+
+import (
+	"context"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/core"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// FilecoinClient is a typed client for a node's FilecoinAPI. Subscriptions
+// are only available if the underlying client was made with Dial.
+type FilecoinClient struct {
+	c *Client
+}
+
+// NewFilecoinClient returns a typed client making calls with c.
+func NewFilecoinClient(c *Client) *FilecoinClient {
+	return &FilecoinClient{c: c}
+}
+
+func (f *FilecoinClient) call(ctx context.Context, method string, result interface{}, params ...interface{}) error {
+	return f.c.Call(ctx, FilecoinNamespace+"."+method, result, params...)
+}
+
+func (f *FilecoinClient) subscribe(ctx context.Context, method string, ch interface{}, params ...interface{}) (*ClientSubscription, error) {
+	return f.c.Subscribe(ctx, FilecoinNamespace+"."+method, ch, params...)
+}
+
+// ActorGet returns the actor at addr in the latest state.
+func (f *FilecoinClient) ActorGet(ctx context.Context, addr address.Address) (*actor.Actor, error) {
+	var a actor.Actor
+	if err := f.call(ctx, "ActorGet", &a, addr); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// BlockGet returns the block with the given cid.
+func (f *FilecoinClient) BlockGet(ctx context.Context, c cid.Cid) (*types.Block, error) {
+	var blk types.Block
+	if err := f.call(ctx, "BlockGet", &blk, c); err != nil {
+		return nil, err
+	}
+	return &blk, nil
+}
+
+// ChainHead returns the blocks of the head tipset.
+func (f *FilecoinClient) ChainHead(ctx context.Context) ([]*types.Block, error) {
+	var blks []*types.Block
+	err := f.call(ctx, "ChainHead", &blks)
+	return blks, err
+}
+
+// ChainNotify subscribes to new heads. The blocks of each are sent on the
+// returned channel until the subscription ends.
+func (f *FilecoinClient) ChainNotify(ctx context.Context) (<-chan []*types.Block, *ClientSubscription, error) {
+	ch := make(chan []*types.Block)
+	sub, err := f.subscribe(ctx, "ChainNotify", ch)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ch, sub, nil
+}
+
+// ChainSyncStatus returns the progress of the node's chain syncer.
+func (f *FilecoinClient) ChainSyncStatus(ctx context.Context) (chain.SyncStatus, error) {
+	var status chain.SyncStatus
+	err := f.call(ctx, "ChainSyncStatus", &status)
+	return status, err
+}
+
+// ConfigGet returns the config value at the given dotted path, decoded into
+// out.
+func (f *FilecoinClient) ConfigGet(ctx context.Context, dottedPath string, out interface{}) error {
+	return f.call(ctx, "ConfigGet", out, dottedPath)
+}
+
+// ConfigSet sets the config value at the given dotted path to the given
+// JSON value.
+func (f *FilecoinClient) ConfigSet(ctx context.Context, dottedPath string, paramJSON string) error {
+	return f.call(ctx, "ConfigSet", nil, dottedPath, paramJSON)
+}
+
+// MessagePoolNotify subscribes to messages entering and leaving the pool.
+func (f *FilecoinClient) MessagePoolNotify(ctx context.Context) (<-chan core.MessagePoolUpdate, *ClientSubscription, error) {
+	ch := make(chan core.MessagePoolUpdate)
+	sub, err := f.subscribe(ctx, "MessagePoolNotify", ch)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ch, sub, nil
+}
+
+// MessagePoolPending returns the messages waiting in the node's pool.
+func (f *FilecoinClient) MessagePoolPending(ctx context.Context) ([]*types.SignedMessage, error) {
+	var msgs []*types.SignedMessage
+	err := f.call(ctx, "MessagePoolPending", &msgs)
+	return msgs, err
+}
+
+// MessageSend has the node sign and send a message, returning its cid.
+func (f *FilecoinClient) MessageSend(ctx context.Context, p MessageSendParams) (cid.Cid, error) {
+	var c cid.Cid
+	err := f.call(ctx, "MessageSend", &c, p)
+	return c, err
+}
+
+// MessageWait waits for the message with the given cid to be included in a
+// block.
+func (f *FilecoinClient) MessageWait(ctx context.Context, c cid.Cid) (*MessageConfirmation, error) {
+	var conf MessageConfirmation
+	if err := f.call(ctx, "MessageWait", &conf, c); err != nil {
+		return nil, err
+	}
+	return &conf, nil
+}
+
+// MessageNotify subscribes to the inclusion of the message with the given
+// cid in a block. The returned channel receives a single confirmation.
+func (f *FilecoinClient) MessageNotify(ctx context.Context, c cid.Cid) (<-chan *MessageConfirmation, *ClientSubscription, error) {
+	ch := make(chan *MessageConfirmation)
+	sub, err := f.subscribe(ctx, "MessageNotify", ch, c)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ch, sub, nil
+}
+
+// NetworkGetPeerID returns the node's peer id.
+func (f *FilecoinClient) NetworkGetPeerID(ctx context.Context) (string, error) {
+	var id string
+	err := f.call(ctx, "NetworkGetPeerID", &id)
+	return id, err
+}
+
+// WalletAddresses returns the addresses in the node's wallet.
+func (f *FilecoinClient) WalletAddresses(ctx context.Context) ([]address.Address, error) {
+	var addrs []address.Address
+	err := f.call(ctx, "WalletAddresses", &addrs)
+	return addrs, err
+}
+
+// WalletBalance returns the balance of addr.
+func (f *FilecoinClient) WalletBalance(ctx context.Context, addr address.Address) (*types.AttoFIL, error) {
+	var balance types.AttoFIL
+	if err := f.call(ctx, "WalletBalance", &balance, addr); err != nil {
+		return nil, err
+	}
+	return &balance, nil
+}
+
+// WalletNewAddress creates a new address in the node's wallet.
+func (f *FilecoinClient) WalletNewAddress(ctx context.Context) (address.Address, error) {
+	var addr address.Address
+	err := f.call(ctx, "WalletNewAddress", &addr)
+	return addr, err
+}
@@ -0,0 +1,43 @@
+package rpc
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+
+	"github.com/filecoin-project/go-filecoin/auth"
+)
+
+func TestRequiredPermission(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(auth.PermRead, RequiredPermission("Filecoin.ChainHead"))
+	assert.Equal(auth.PermSign, RequiredPermission("Filecoin.MessageSend"))
+	assert.Equal(auth.PermAdmin, RequiredPermission("Filecoin.ConfigSet"))
+	assert.Equal(auth.PermAdmin, RequiredPermission("Other.ChainHead"))
+	assert.Equal(auth.PermAdmin, RequiredPermission("ChainHead"))
+	assert.Equal(auth.PermRead, RequiredPermission(UnsubscribeMethod))
+}
+
+func TestTokenAuthorizer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	a := auth.NewAuthenticator([]byte("secret"), datastore.NewMapDatastore())
+	authorize := TokenAuthorizer(a)
+
+	readToken, err := a.CreateToken(auth.PermRead, 0)
+	require.NoError(err)
+
+	req := httptest.NewRequest("POST", "/rpc/v0", nil)
+	assert.Equal(auth.ErrMissingToken, authorize(req, "Filecoin.ChainHead"))
+
+	req.Header.Set("Authorization", "Bearer "+readToken)
+	assert.NoError(authorize(req, "Filecoin.ChainHead"))
+	err = authorize(req, "Filecoin.MessageSend")
+	require.Error(err)
+	assert.Contains(err.Error(), "sign permission required")
+}
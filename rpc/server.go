@@ -0,0 +1,547 @@
+// Package rpc implements a JSON-RPC 2.0 server and client. Calls may be made
+// over plain HTTP POST requests or over a websocket, which additionally
+// supports subscriptions: methods that stream notifications to the caller
+// until they unsubscribe or disconnect.
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sync"
+	"unicode"
+
+	logging "gx/ipfs/QmbkT7eMTyXfpeyB3ZMxxcxg7XH8t6uXp49jqzz4HB7BGF/go-log"
+)
+
+var log = logging.Logger("rpc")
+
+const (
+	// SubscriptionMethod is the method of the notifications the server sends
+	// for subscriptions.
+	SubscriptionMethod = "rpc.subscription"
+	// UnsubscribeMethod cancels a subscription. It takes the subscription id
+	// as its only parameter.
+	UnsubscribeMethod = "rpc.unsubscribe"
+)
+
+// maxRequestSize bounds the size of the body of an HTTP request.
+const maxRequestSize = 32 << 20
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// Authorizer decides whether the HTTP request r, which carried a websocket
+// connection or POST body, may call the named method. It returns a non-nil
+// error to refuse the call.
+type Authorizer func(r *http.Request, method string) error
+
+// method is a registered method of a service.
+type method struct {
+	fn reflect.Value
+
+	// hasCtx is true if the method takes a context as its first argument.
+	hasCtx   bool
+	argTypes []reflect.Type
+
+	// hasResult is true if the method returns a value before its error.
+	hasResult bool
+	// isSubscription is true if that value is a receive channel whose
+	// elements are sent as notifications.
+	isSubscription bool
+}
+
+// Server dispatches JSON-RPC requests to the exported methods of registered
+// services. It implements http.Handler.
+type Server struct {
+	methodsLk sync.RWMutex
+	methods   map[string]*method
+
+	authorize Authorizer
+
+	// allowedOrigins are the origins of the web pages allowed to make
+	// requests. Requests without an Origin header, i.e. not made by a
+	// browser, are always allowed.
+	allowedOrigins []string
+}
+
+// NewServer returns a server with no services registered.
+func NewServer() *Server {
+	return &Server{
+		methods: make(map[string]*method),
+	}
+}
+
+// SetAuthorizer installs an authorizer consulted before every call.
+func (s *Server) SetAuthorizer(a Authorizer) {
+	s.authorize = a
+}
+
+// SetAllowedOrigins sets the origins of the web pages allowed to make
+// requests, "*" allowing any. By default requests made from web pages are
+// refused.
+func (s *Server) SetAllowedOrigins(origins ...string) {
+	s.allowedOrigins = origins
+}
+
+// originAllowed returns true iff r was not made by a web page, or was made by
+// one the server allows requests from.
+func (s *Server) originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, o := range s.allowedOrigins {
+		if o == "*" || o == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// Register makes the exported methods of rcvr available as
+// "<namespace>.<Method>". A method is exported if it returns either a single
+// error or a result and an error, optionally takes a context as its first
+// argument, and each argument and result can be encoded as JSON. Methods whose result is a receive-only channel are subscriptions:
+// they are only available over websockets, and each value received from the
+// channel is sent to the caller as a notification. Subscription methods
+// should close their channel once the context they are given is done.
+func (s *Server) Register(namespace string, rcvr interface{}) error {
+	if namespace == "" {
+		return fmt.Errorf("rpc: no namespace given for %T", rcvr)
+	}
+
+	v := reflect.ValueOf(rcvr)
+	t := v.Type()
+
+	found := make(map[string]*method)
+	for i := 0; i < t.NumMethod(); i++ {
+		m := t.Method(i)
+		if m.PkgPath != "" {
+			continue
+		}
+		if rm := newMethod(v.Method(i)); rm != nil {
+			found[namespace+"."+m.Name] = rm
+		}
+	}
+	if len(found) == 0 {
+		return fmt.Errorf("rpc: %T has no suitable methods", rcvr)
+	}
+
+	s.methodsLk.Lock()
+	defer s.methodsLk.Unlock()
+	for name, m := range found {
+		s.methods[name] = m
+	}
+	return nil
+}
+
+func newMethod(fn reflect.Value) *method {
+	ft := fn.Type()
+
+	m := &method{fn: fn}
+	first := 0
+	if ft.NumIn() > 0 && ft.In(0) == contextType {
+		m.hasCtx = true
+		first = 1
+	}
+	for i := first; i < ft.NumIn(); i++ {
+		m.argTypes = append(m.argTypes, ft.In(i))
+	}
+
+	switch ft.NumOut() {
+	case 1:
+		if ft.Out(0) != errorType {
+			return nil
+		}
+	case 2:
+		if ft.Out(1) != errorType {
+			return nil
+		}
+		m.hasResult = true
+		out := ft.Out(0)
+		m.isSubscription = out.Kind() == reflect.Chan && out.ChanDir()&reflect.RecvDir != 0
+	default:
+		return nil
+	}
+
+	return m
+}
+
+func (s *Server) lookup(name string) *method {
+	s.methodsLk.RLock()
+	defer s.methodsLk.RUnlock()
+	return s.methods[name]
+}
+
+// ServeHTTP handles JSON-RPC requests POSTed to the server, and websocket
+// connections over which any number of requests may be made.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Browsers do not apply the same origin policy to websockets, nor to
+	// POSTs they consider simple, so the origin is checked here.
+	if !s.originAllowed(r) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	if isWebsocketUpgrade(r) {
+		s.serveWebsocket(w, r)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "JSON-RPC requests must be POSTed or made over a websocket", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxRequestSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	out := s.handleMessage(r.Context(), r, body, nil)
+	if out == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out) // nolint: errcheck
+}
+
+// handleMessage handles a single request or batch of requests and returns
+// the encoded response, or nil if there is nothing to respond with. msg is
+// nil for HTTP requests.
+func (s *Server) handleMessage(ctx context.Context, r *http.Request, data []byte, msg *wsMessage) []byte {
+	data = bytes.TrimLeftFunc(data, unicode.IsSpace)
+
+	if len(data) > 0 && data[0] == '[' {
+		var reqs []json.RawMessage
+		if err := json.Unmarshal(data, &reqs); err != nil {
+			return mustMarshal(errorResponse(nil, &Error{Code: CodeParseError, Message: err.Error()}))
+		}
+		if len(reqs) == 0 {
+			return mustMarshal(errorResponse(nil, &Error{Code: CodeInvalidRequest, Message: "empty batch"}))
+		}
+
+		var resps []*response
+		for _, raw := range reqs {
+			if resp := s.handleRequest(ctx, r, raw, msg); resp != nil {
+				resps = append(resps, resp)
+			}
+		}
+		if len(resps) == 0 {
+			return nil
+		}
+		return mustMarshal(resps)
+	}
+
+	resp := s.handleRequest(ctx, r, data, msg)
+	if resp == nil {
+		return nil
+	}
+	return mustMarshal(resp)
+}
+
+// handleRequest handles a single request, returning nil for notifications.
+func (s *Server) handleRequest(ctx context.Context, r *http.Request, data json.RawMessage, msg *wsMessage) *response {
+	var req request
+	if err := json.Unmarshal(data, &req); err != nil {
+		return errorResponse(nil, &Error{Code: CodeParseError, Message: err.Error()})
+	}
+	if req.JSONRPC != Version || req.Method == "" {
+		return errorResponse(req.ID, &Error{Code: CodeInvalidRequest, Message: "invalid JSON-RPC 2.0 request"})
+	}
+
+	result, rpcErr := s.call(ctx, r, &req, msg)
+	if req.isNotification() {
+		return nil
+	}
+	if rpcErr != nil {
+		return errorResponse(req.ID, rpcErr)
+	}
+	return &response{JSONRPC: Version, ID: req.ID, Result: result}
+}
+
+func (s *Server) call(ctx context.Context, r *http.Request, req *request, msg *wsMessage) (json.RawMessage, *Error) {
+	if req.Method == UnsubscribeMethod {
+		if msg == nil {
+			return nil, &Error{Code: CodeInvalidRequest, Message: "subscriptions require a websocket connection"}
+		}
+		var args []string
+		if err := json.Unmarshal(req.Params, &args); err != nil || len(args) != 1 {
+			return nil, &Error{Code: CodeInvalidParams, Message: "expected a single subscription id"}
+		}
+		if !msg.conn.unsubscribe(args[0]) {
+			return nil, &Error{Code: CodeInvalidParams, Message: fmt.Sprintf("no subscription %s", args[0])}
+		}
+		return json.RawMessage("true"), nil
+	}
+
+	m := s.lookup(req.Method)
+	if m == nil {
+		return nil, &Error{Code: CodeMethodNotFound, Message: fmt.Sprintf("method %s not found", req.Method)}
+	}
+	if m.isSubscription && msg == nil {
+		return nil, &Error{Code: CodeInvalidRequest, Message: "subscriptions require a websocket connection"}
+	}
+
+	if s.authorize != nil {
+		if err := s.authorize(r, req.Method); err != nil {
+			return nil, &Error{Code: CodeUnauthorized, Message: err.Error()}
+		}
+	}
+
+	args, err := m.parseArgs(req.Params)
+	if err != nil {
+		return nil, &Error{Code: CodeInvalidParams, Message: err.Error()}
+	}
+
+	if m.isSubscription {
+		// Subscriptions outlive the request, so they are bound to the
+		// connection instead.
+		subCtx, cancel := context.WithCancel(msg.conn.ctx)
+		out, err := m.invoke(subCtx, args)
+		if err != nil {
+			cancel()
+			return nil, &Error{Code: CodeServerError, Message: err.Error()}
+		}
+		id := msg.conn.subscribe(cancel)
+		// Notifications are held back until the response carrying the id
+		// has been written, so clients never see a notification for a
+		// subscription they do not yet know about.
+		msg.afterWrite = append(msg.afterWrite, func() {
+			go msg.conn.forward(id, out)
+		})
+		return mustMarshal(id), nil
+	}
+
+	out, err := m.invoke(ctx, args)
+	if err != nil {
+		return nil, &Error{Code: CodeServerError, Message: err.Error()}
+	}
+	if !m.hasResult {
+		return json.RawMessage("null"), nil
+	}
+	res, err := json.Marshal(out.Interface())
+	if err != nil {
+		return nil, &Error{Code: CodeInternalError, Message: fmt.Sprintf("failed to encode result: %s", err)}
+	}
+	return res, nil
+}
+
+// parseArgs decodes positional params into values of the method's argument
+// types. Trailing arguments may be omitted, in which case they take their
+// zero value.
+func (m *method) parseArgs(params json.RawMessage) ([]reflect.Value, error) {
+	var raw []json.RawMessage
+	if len(bytes.TrimSpace(params)) > 0 && string(params) != "null" {
+		if err := json.Unmarshal(params, &raw); err != nil {
+			return nil, fmt.Errorf("params must be an array: %s", err)
+		}
+	}
+	if len(raw) > len(m.argTypes) {
+		return nil, fmt.Errorf("too many params, want at most %d", len(m.argTypes))
+	}
+
+	args := make([]reflect.Value, len(m.argTypes))
+	for i, t := range m.argTypes {
+		v := reflect.New(t)
+		if i < len(raw) {
+			if err := json.Unmarshal(raw[i], v.Interface()); err != nil {
+				return nil, fmt.Errorf("invalid param %d: %s", i, err)
+			}
+		}
+		args[i] = v.Elem()
+	}
+	return args, nil
+}
+
+// invoke calls the method, returning its result (if any) and error.
+func (m *method) invoke(ctx context.Context, args []reflect.Value) (out reflect.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("rpc method panicked: %v", r)
+			err = fmt.Errorf("method panicked: %v", r)
+		}
+	}()
+
+	in := args
+	if m.hasCtx {
+		in = append([]reflect.Value{reflect.ValueOf(ctx)}, args...)
+	}
+	res := m.fn.Call(in)
+
+	if errv := res[len(res)-1]; !errv.IsNil() {
+		return reflect.Value{}, errv.Interface().(error)
+	}
+	if m.hasResult {
+		return res[0], nil
+	}
+	return reflect.Value{}, nil
+}
+
+// connIDKey is the context key of the id of the websocket connection a call
+// was made over.
+type connIDKey struct{}
+
+// ConnID returns the id of the websocket connection over which the call
+// whose ctx is given was made. Calls made over HTTP POST requests have none.
+// Methods can use it to tie state to the connection of the caller, which,
+// unlike anything the caller sends, the caller cannot choose.
+func ConnID(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(connIDKey{}).(string)
+	return id, ok
+}
+
+type serverConn struct {
+	ws     *wsConn
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	subsLk sync.Mutex
+	subs   map[string]context.CancelFunc
+}
+
+func (s *Server) serveWebsocket(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgradeWebsocket(w, r)
+	if err != nil {
+		log.Warningf("websocket upgrade failed: %s", err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), connIDKey{}, newID()))
+	conn := &serverConn{
+		ws:     ws,
+		ctx:    ctx,
+		cancel: cancel,
+		subs:   make(map[string]context.CancelFunc),
+	}
+	defer conn.close()
+
+	for {
+		data, err := ws.ReadMessage()
+		if err != nil {
+			if err != io.EOF {
+				log.Debugf("websocket read failed: %s", err)
+			}
+			return
+		}
+
+		// Handle requests concurrently so that slow calls, e.g. waiting
+		// for a message, do not hold up others on the same connection.
+		go func() {
+			msg := &wsMessage{conn: conn}
+			if out := s.handleMessage(ctx, r, data, msg); out != nil {
+				if err := ws.WriteMessage(out); err != nil {
+					log.Debugf("websocket write failed: %s", err)
+					conn.close()
+					return
+				}
+			}
+			for _, f := range msg.afterWrite {
+				f()
+			}
+		}()
+	}
+}
+
+// wsMessage is a message received over a websocket connection.
+type wsMessage struct {
+	conn *serverConn
+
+	// afterWrite is run once the response to the message has been written.
+	afterWrite []func()
+}
+
+// subscribe records a new subscription, cancelled with cancel, and returns
+// its id.
+func (c *serverConn) subscribe(cancel context.CancelFunc) string {
+	id := newID()
+
+	c.subsLk.Lock()
+	c.subs[id] = cancel
+	c.subsLk.Unlock()
+
+	return id
+}
+
+// forward sends each value received from ch, a channel returned by a
+// subscription method, as a notification for the subscription id until the
+// channel is closed. A connection a notification cannot be written to within
+// the write timeout is closed, ending all its subscriptions, so a stalled
+// client cannot hold up the publishers its subscriptions read from.
+func (c *serverConn) forward(id string, ch reflect.Value) {
+	defer c.unsubscribe(id)
+
+	for {
+		v, ok := ch.Recv()
+		if !ok {
+			return
+		}
+		n := &notification{
+			JSONRPC: Version,
+			Method:  SubscriptionMethod,
+			Params: subscriptionResult{
+				Subscription: id,
+				Result:       v.Interface(),
+			},
+		}
+		data, err := json.Marshal(n)
+		if err != nil {
+			log.Errorf("failed to encode notification for subscription %s: %s", id, err)
+			continue
+		}
+		if err := c.ws.WriteMessage(data); err != nil {
+			log.Debugf("closing websocket after failing to write notification: %s", err)
+			c.close()
+			return
+		}
+	}
+}
+
+// unsubscribe cancels the subscription with the given id, returning false if
+// there is no such subscription.
+func (c *serverConn) unsubscribe(id string) bool {
+	c.subsLk.Lock()
+	cancel, ok := c.subs[id]
+	delete(c.subs, id)
+	c.subsLk.Unlock()
+
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+func (c *serverConn) close() {
+	c.cancel()
+	c.ws.Close() // nolint: errcheck
+}
+
+// newID returns a random id for a connection or subscription.
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return "0x" + hex.EncodeToString(b)
+}
+
+func mustMarshal(v interface{}) []byte {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
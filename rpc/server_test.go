@@ -0,0 +1,386 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+)
+
+type testService struct {
+	ticks chan int
+}
+
+type addArgs struct {
+	A, B int
+}
+
+func (s *testService) Add(ctx context.Context, args addArgs) (int, error) {
+	return args.A + args.B, nil
+}
+
+func (s *testService) Echo(msg string) (string, error) {
+	return msg, nil
+}
+
+func (s *testService) Fail(ctx context.Context) error {
+	return errors.New("failed on purpose")
+}
+
+// ConnID returns the id of the caller's connection, or "" if it has none.
+func (s *testService) ConnID(ctx context.Context) (string, error) {
+	id, _ := ConnID(ctx)
+	return id, nil
+}
+
+// Count is a subscription sending 0..n-1 then ending.
+func (s *testService) Count(ctx context.Context, n int) (<-chan int, error) {
+	out := make(chan int)
+	go func() {
+		defer close(out)
+		for i := 0; i < n; i++ {
+			select {
+			case out <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// Ticks is a subscription forwarding values sent on s.ticks.
+func (s *testService) Ticks(ctx context.Context) (<-chan int, error) {
+	out := make(chan int)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case i := <-s.ticks:
+				select {
+				case out <- i:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// NotAMethod is not exported over RPC as it does not return an error.
+func (s *testService) NotAMethod() int {
+	return 0
+}
+
+func newTestServer(t *testing.T) (*httptest.Server, *testService) {
+	svc := &testService{ticks: make(chan int)}
+	s := NewServer()
+	require.NoError(t, s.Register("test", svc))
+	return httptest.NewServer(s), svc
+}
+
+func wsURL(ts *httptest.Server) string {
+	return "ws" + strings.TrimPrefix(ts.URL, "http")
+}
+
+func postRaw(t *testing.T, url, body string) string {
+	res, err := http.Post(url, "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	defer res.Body.Close() // nolint: errcheck
+	out, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+	return string(bytes.TrimSpace(out))
+}
+
+func TestServerHTTP(t *testing.T) {
+	t.Parallel()
+
+	ts, _ := newTestServer(t)
+	defer ts.Close()
+
+	t.Run("calls methods with typed params", func(t *testing.T) {
+		assert := assert.New(t)
+		c := NewHTTPClient(ts.URL, "")
+
+		var sum int
+		assert.NoError(c.Call(context.Background(), "test.Add", &sum, addArgs{A: 2, B: 3}))
+		assert.Equal(5, sum)
+
+		var echoed string
+		assert.NoError(c.Call(context.Background(), "test.Echo", &echoed, "hello"))
+		assert.Equal("hello", echoed)
+	})
+
+	t.Run("reports errors", func(t *testing.T) {
+		assert := assert.New(t)
+		c := NewHTTPClient(ts.URL, "")
+
+		err := c.Call(context.Background(), "test.Fail", nil)
+		require.Error(t, err)
+		assert.Equal(CodeServerError, err.(*Error).Code)
+		assert.Contains(err.Error(), "failed on purpose")
+
+		err = c.Call(context.Background(), "test.NotAMethod", nil)
+		require.Error(t, err)
+		assert.Equal(CodeMethodNotFound, err.(*Error).Code)
+
+		err = c.Call(context.Background(), "test.Echo", nil, 1)
+		require.Error(t, err)
+		assert.Equal(CodeInvalidParams, err.(*Error).Code)
+
+		err = c.Call(context.Background(), "test.Count", nil, 1)
+		require.Error(t, err)
+		assert.Contains(err.Error(), "websocket")
+
+		_, err = c.Subscribe(context.Background(), "test.Count", make(chan int), 1)
+		assert.Equal(ErrNotificationsNotSupported, err)
+	})
+
+	t.Run("handles batches and notifications", func(t *testing.T) {
+		assert := assert.New(t)
+
+		out := postRaw(t, ts.URL, `[
+			{"jsonrpc":"2.0","id":1,"method":"test.Echo","params":["a"]},
+			{"jsonrpc":"2.0","method":"test.Echo","params":["b"]},
+			{"jsonrpc":"2.0","id":"two","method":"test.Nope"}
+		]`)
+		var resps []message
+		require.NoError(t, json.Unmarshal([]byte(out), &resps))
+		require.Len(t, resps, 2)
+		assert.Equal(`1`, string(resps[0].ID))
+		assert.Equal(`"a"`, string(resps[0].Result))
+		assert.Equal(`"two"`, string(resps[1].ID))
+		assert.Equal(CodeMethodNotFound, resps[1].Error.Code)
+	})
+
+	t.Run("rejects malformed requests", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Contains(postRaw(t, ts.URL, `{`), fmt.Sprintf(`"code":%d`, CodeParseError))
+		assert.Contains(postRaw(t, ts.URL, `{"jsonrpc":"1.0","id":1,"method":"test.Echo"}`), fmt.Sprintf(`"code":%d`, CodeInvalidRequest))
+
+		res, err := http.Get(ts.URL)
+		require.NoError(t, err)
+		assert.Equal(http.StatusMethodNotAllowed, res.StatusCode)
+	})
+}
+
+func TestServerWebsocket(t *testing.T) {
+	t.Parallel()
+
+	t.Run("calls methods", func(t *testing.T) {
+		assert := assert.New(t)
+		ts, _ := newTestServer(t)
+		defer ts.Close()
+
+		c, err := Dial(context.Background(), wsURL(ts), "")
+		require.NoError(t, err)
+		defer c.Close() // nolint: errcheck
+
+		var sum int
+		assert.NoError(c.Call(context.Background(), "test.Add", &sum, addArgs{A: 40, B: 2}))
+		assert.Equal(42, sum)
+
+		// Large messages span several frames worth of length encodings.
+		big := strings.Repeat("x", 70000)
+		var echoed string
+		assert.NoError(c.Call(context.Background(), "test.Echo", &echoed, big))
+		assert.Equal(big, echoed)
+	})
+
+	t.Run("calls over a connection share its id", func(t *testing.T) {
+		assert := assert.New(t)
+		ts, _ := newTestServer(t)
+		defer ts.Close()
+
+		c1, err := Dial(context.Background(), wsURL(ts), "")
+		require.NoError(t, err)
+		defer c1.Close() // nolint: errcheck
+		c2, err := Dial(context.Background(), wsURL(ts), "")
+		require.NoError(t, err)
+		defer c2.Close() // nolint: errcheck
+
+		var first, second, other string
+		assert.NoError(c1.Call(context.Background(), "test.ConnID", &first))
+		assert.NoError(c1.Call(context.Background(), "test.ConnID", &second))
+		assert.NoError(c2.Call(context.Background(), "test.ConnID", &other))
+		assert.NotEmpty(first)
+		assert.Equal(first, second)
+		assert.NotEqual(first, other)
+
+		var none string
+		assert.NoError(NewHTTPClient(ts.URL, "").Call(context.Background(), "test.ConnID", &none))
+		assert.Empty(none)
+	})
+
+	t.Run("subscriptions deliver notifications until they end", func(t *testing.T) {
+		assert := assert.New(t)
+		ts, _ := newTestServer(t)
+		defer ts.Close()
+
+		c, err := Dial(context.Background(), wsURL(ts), "")
+		require.NoError(t, err)
+		defer c.Close() // nolint: errcheck
+
+		ch := make(chan int)
+		_, err = c.Subscribe(context.Background(), "test.Count", ch, 3)
+		require.NoError(t, err)
+
+		var got []int
+		for i := range ch {
+			got = append(got, i)
+			if len(got) == 3 {
+				break
+			}
+		}
+		assert.Equal([]int{0, 1, 2}, got)
+	})
+
+	t.Run("unsubscribing stops notifications", func(t *testing.T) {
+		assert := assert.New(t)
+		ts, svc := newTestServer(t)
+		defer ts.Close()
+
+		c, err := Dial(context.Background(), wsURL(ts), "")
+		require.NoError(t, err)
+		defer c.Close() // nolint: errcheck
+
+		ch := make(chan int)
+		sub, err := c.Subscribe(context.Background(), "test.Ticks", ch)
+		require.NoError(t, err)
+
+		svc.ticks <- 7
+		assert.Equal(7, <-ch)
+
+		sub.Unsubscribe()
+		_, ok := <-ch
+		assert.False(ok)
+		assert.NoError(<-sub.Err())
+
+		// The server's subscription is gone, so nothing reads the ticks.
+		select {
+		case svc.ticks <- 8:
+			t.Fatal("tick consumed after unsubscribing")
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+
+	t.Run("closing the client ends subscriptions", func(t *testing.T) {
+		assert := assert.New(t)
+		ts, _ := newTestServer(t)
+		defer ts.Close()
+
+		c, err := Dial(context.Background(), wsURL(ts), "")
+		require.NoError(t, err)
+
+		ch := make(chan int)
+		sub, err := c.Subscribe(context.Background(), "test.Ticks", ch)
+		require.NoError(t, err)
+
+		require.NoError(t, c.Close())
+		_, ok := <-ch
+		assert.False(ok)
+		assert.NoError(<-sub.Err())
+
+		assert.Equal(ErrClientClosed, c.Call(context.Background(), "test.Echo", nil, "x"))
+	})
+}
+
+func TestServerOrigins(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	s := NewServer()
+	require.NoError(t, s.Register("test", &testService{}))
+	s.SetAllowedOrigins("http://localhost:8080")
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	post := func(origin string) int {
+		req, err := http.NewRequest(http.MethodPost, ts.URL, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"test.Echo","params":["a"]}`))
+		require.NoError(t, err)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		res.Body.Close() // nolint: errcheck
+		return res.StatusCode
+	}
+	assert.Equal(http.StatusOK, post(""))
+	assert.Equal(http.StatusOK, post("http://localhost:8080"))
+	assert.Equal(http.StatusForbidden, post("http://evil.example"))
+
+	u, err := url.Parse(wsURL(ts))
+	require.NoError(t, err)
+	_, err = dialWebsocket(context.Background(), u, http.Header{"Origin": []string{"http://evil.example"}})
+	require.Error(t, err)
+	assert.Equal(http.StatusForbidden, err.(*HTTPError).StatusCode)
+
+	ws, err := dialWebsocket(context.Background(), u, http.Header{"Origin": []string{"http://localhost:8080"}})
+	require.NoError(t, err)
+	ws.Close() // nolint: errcheck
+}
+
+func TestServerAuthorizer(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	s := NewServer()
+	require.NoError(t, s.Register("test", &testService{}))
+	s.SetAuthorizer(func(r *http.Request, method string) error {
+		if method == "test.Echo" || r.Header.Get("Authorization") == "Bearer admin" {
+			return nil
+		}
+		return errors.New("not allowed")
+	})
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	var out string
+	assert.NoError(NewHTTPClient(ts.URL, "").Call(context.Background(), "test.Echo", &out, "hi"))
+
+	err := NewHTTPClient(ts.URL, "").Call(context.Background(), "test.Fail", nil)
+	require.Error(t, err)
+	assert.Equal(CodeUnauthorized, err.(*Error).Code)
+
+	err = NewHTTPClient(ts.URL, "admin").Call(context.Background(), "test.Fail", nil)
+	require.Error(t, err)
+	assert.Equal(CodeServerError, err.(*Error).Code)
+
+	c, err := Dial(context.Background(), wsURL(ts), "")
+	require.NoError(t, err)
+	defer c.Close() // nolint: errcheck
+	_, err = c.Subscribe(context.Background(), "test.Ticks", make(chan int))
+	require.Error(t, err)
+	assert.Equal(CodeUnauthorized, err.(*Error).Code)
+}
+
+func TestRegister(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	s := NewServer()
+	assert.Error(s.Register("", &testService{}))
+	assert.Error(s.Register("none", struct{}{}))
+	assert.NoError(s.Register("test", &testService{}))
+
+	assert.NotNil(s.lookup("test.Add"))
+	assert.True(s.lookup("test.Count").isSubscription)
+	assert.False(s.lookup("test.Add").isSubscription)
+	assert.Nil(s.lookup("test.NotAMethod"))
+}
@@ -0,0 +1,363 @@
+package rpc
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1" // nolint: gosec
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+)
+
+// This file implements the subset of the websocket protocol (RFC 6455) the
+// JSON-RPC server and client need: the opening handshake, text messages,
+// fragmentation, ping/pong and the closing handshake. Extensions and
+// subprotocols are not supported.
+
+// wsGUID is appended to the client's key to compute the accept header.
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxMessageSize bounds the size of a single (possibly fragmented) message.
+const maxMessageSize = 32 << 20
+
+// writeTimeout bounds the time a single frame may take to write. A peer that
+// does not read its connection fast enough has it closed.
+const writeTimeout = 10 * time.Second
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// errMessageTooLarge is returned when a peer sends a message larger than
+// maxMessageSize.
+var errMessageTooLarge = errors.New("websocket message too large")
+
+// wsConn is a websocket connection. Reads must happen from a single
+// goroutine; writes may happen concurrently.
+type wsConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+
+	// isClient is true on the dialing side of the connection, which must
+	// mask the frames it sends.
+	isClient bool
+
+	wlk    sync.Mutex
+	closed bool
+}
+
+// isWebsocketUpgrade returns true iff r asks to upgrade to a websocket.
+func isWebsocketUpgrade(r *http.Request) bool {
+	return headerContains(r.Header, "Connection", "upgrade") && headerContains(r.Header, "Upgrade", "websocket")
+}
+
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func acceptKey(key string) string {
+	h := sha1.New()               // nolint: gosec
+	h.Write([]byte(key + wsGUID)) // nolint: errcheck
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// upgradeWebsocket performs the server side of the opening handshake.
+func upgradeWebsocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "websocket upgrade requires GET", http.StatusMethodNotAllowed)
+		return nil, errors.New("bad method")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusBadRequest)
+		return nil, errors.New("unsupported websocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("missing websocket key")
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket upgrade not supported", http.StatusInternalServerError)
+		return nil, errors.New("response writer cannot be hijacked")
+	}
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to hijack connection")
+	}
+
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n"
+	if _, err := brw.WriteString(resp); err != nil {
+		conn.Close() // nolint: errcheck
+		return nil, err
+	}
+	if err := brw.Flush(); err != nil {
+		conn.Close() // nolint: errcheck
+		return nil, err
+	}
+
+	return &wsConn{conn: conn, br: brw.Reader}, nil
+}
+
+// dialWebsocket performs the client side of the opening handshake against
+// the ws:// url u, sending the given extra headers.
+func dialWebsocket(ctx context.Context, u *url.URL, header http.Header) (*wsConn, error) {
+	if u.Scheme != "ws" {
+		return nil, fmt.Errorf("unsupported websocket scheme %q", u.Scheme)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(host, "80")
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to dial websocket")
+	}
+
+	return handshakeWebsocket(ctx, conn, u, header)
+}
+
+// handshakeWebsocket performs the client side of the opening handshake over
+// conn, which it closes if the handshake fails.
+func handshakeWebsocket(ctx context.Context, conn net.Conn, u *url.URL, header http.Header) (*wsConn, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		conn.Close() // nolint: errcheck
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        u,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Host:       u.Host,
+	}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req = req.WithContext(ctx)
+
+	if err := req.Write(conn); err != nil {
+		conn.Close() // nolint: errcheck
+		return nil, errors.Wrap(err, "failed to send websocket handshake")
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close() // nolint: errcheck
+		return nil, errors.Wrap(err, "failed to read websocket handshake")
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close() // nolint: errcheck
+		conn.Close()      // nolint: errcheck
+		return nil, &HTTPError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		conn.Close() // nolint: errcheck
+		return nil, errors.New("invalid Sec-WebSocket-Accept in websocket handshake")
+	}
+
+	return &wsConn{conn: conn, br: br, isClient: true}, nil
+}
+
+// ReadMessage returns the payload of the next text or binary message,
+// answering pings and reassembling fragments along the way. It returns
+// io.EOF once the peer has closed the connection.
+func (c *wsConn) ReadMessage() ([]byte, error) {
+	var msg []byte
+	inMessage := false
+
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch op {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+		case opPong:
+		case opClose:
+			c.writeFrame(opClose, payload) // nolint: errcheck
+			c.Close()                      // nolint: errcheck
+			return nil, io.EOF
+		case opText, opBinary, opContinuation:
+			if (op == opContinuation) != inMessage {
+				return nil, errors.New("unexpected websocket fragment")
+			}
+			inMessage = true
+			if len(msg)+len(payload) > maxMessageSize {
+				return nil, errMessageTooLarge
+			}
+			msg = append(msg, payload...)
+			if fin {
+				return msg, nil
+			}
+		default:
+			return nil, fmt.Errorf("unknown websocket opcode %d", op)
+		}
+	}
+}
+
+func (c *wsConn) readFrame() (fin bool, op byte, payload []byte, err error) {
+	var hdr [2]byte
+	if _, err = io.ReadFull(c.br, hdr[:]); err != nil {
+		return
+	}
+	fin = hdr[0]&0x80 != 0
+	op = hdr[0] & 0x0f
+	masked := hdr[1]&0x80 != 0
+
+	// Clients must mask every frame they send and servers must not.
+	if masked == c.isClient {
+		err = errors.New("websocket frame has incorrect masking")
+		return
+	}
+
+	length := uint64(hdr[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > maxMessageSize {
+		err = errMessageTooLarge
+		return
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err = io.ReadFull(c.br, mask[:]); err != nil {
+			return
+		}
+	}
+
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.br, payload); err != nil {
+		return
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return
+}
+
+// WriteMessage sends data as a single text message.
+func (c *wsConn) WriteMessage(data []byte) error {
+	return c.writeFrame(opText, data)
+}
+
+func (c *wsConn) writeFrame(op byte, payload []byte) error {
+	c.wlk.Lock()
+	defer c.wlk.Unlock()
+
+	if c.closed {
+		return io.ErrClosedPipe
+	}
+
+	hdr := make([]byte, 0, 14)
+	hdr = append(hdr, 0x80|op)
+
+	var maskBit byte
+	if c.isClient {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n < 126:
+		hdr = append(hdr, maskBit|byte(n))
+	case n <= 0xffff:
+		hdr = append(hdr, maskBit|126, 0, 0)
+		binary.BigEndian.PutUint16(hdr[len(hdr)-2:], uint16(n))
+	default:
+		hdr = append(hdr, maskBit|127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(hdr[len(hdr)-8:], uint64(n))
+	}
+
+	if c.isClient {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return err
+		}
+		hdr = append(hdr, mask[:]...)
+		masked := make([]byte, len(payload))
+		for i := range payload {
+			masked[i] = payload[i] ^ mask[i%4]
+		}
+		payload = masked
+	}
+
+	if err := c.conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return err
+	}
+	if _, err := c.conn.Write(append(hdr, payload...)); err != nil {
+		// The frame may have been partly written, so nothing more can be
+		// sent on the connection.
+		c.closed = true
+		c.conn.Close() // nolint: errcheck
+		return err
+	}
+	if op == opClose {
+		c.closed = true
+	}
+	return nil
+}
+
+// Close starts the closing handshake if it has not already happened and
+// closes the underlying connection.
+func (c *wsConn) Close() error {
+	c.writeFrame(opClose, nil) // nolint: errcheck
+	return c.conn.Close()
+}
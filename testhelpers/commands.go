@@ -25,6 +25,7 @@ import (
 
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/config"
+	"github.com/filecoin-project/go-filecoin/repo"
 	"github.com/filecoin-project/go-filecoin/types"
 
 	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
@@ -630,6 +631,11 @@ func (td *TestDaemon) GetDefaultAddress() string {
 	return strings.Split(addrs.ReadStdout(), "\n")[0]
 }
 
+// APIToken returns the admin api token written to the repo by this daemon.
+func (td *TestDaemon) APIToken() (string, error) {
+	return repo.APITokenFromFile(filepath.Join(td.repoDir, repo.APITokenFile))
+}
+
 // GetMinerAddress returns the miner address for this daemon.
 func (td *TestDaemon) GetMinerAddress() address.Address {
 	return td.Config().Mining.MinerAddress
@@ -646,8 +652,18 @@ func tryAPICheck(td *TestDaemon) error {
 		return err
 	}
 
+	token, err := td.APIToken()
+	if err != nil {
+		return err
+	}
+
 	url := fmt.Sprintf("http://%s/api/id", host)
-	resp, err := http.Get(url)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return err
 	}
@@ -153,7 +153,19 @@ func ApplyTestMessage(st state.Tree, store vm.StorageMap, msg *types.Message, bh
 	}
 
 	ta := newTestApplier()
-	return newMessageApplier(smsg, ta, st, store, bh, address.Address{})
+	return newMessageApplier(smsg, ta, st, store, bh, address.Address{}, nil)
+}
+
+// ApplyTestMessageWithAncestors is like ApplyTestMessage, with ancestors
+// providing the chain randomness of the message's block, newest first.
+func ApplyTestMessageWithAncestors(st state.Tree, store vm.StorageMap, msg *types.Message, bh *types.BlockHeight, ancestors []types.TipSet) (*consensus.ApplicationResult, error) {
+	smsg, err := types.NewSignedMessage(*msg, testSigner{}, types.NewGasPrice(0), types.NewGasUnits(300))
+	if err != nil {
+		panic(err)
+	}
+
+	ta := newTestApplier()
+	return newMessageApplier(smsg, ta, st, store, bh, address.Address{}, ancestors)
 }
 
 // ApplyTestMessageWithGas uses the TestBlockRewarder but the default SignedMessageValidator
@@ -165,12 +177,12 @@ func ApplyTestMessageWithGas(st state.Tree, store vm.StorageMap, msg *types.Mess
 		panic(err)
 	}
 	applier := consensus.NewConfiguredProcessor(consensus.NewDefaultMessageValidator(), consensus.NewDefaultBlockRewarder())
-	return newMessageApplier(smsg, applier, st, store, bh, minerAddr)
+	return newMessageApplier(smsg, applier, st, store, bh, minerAddr, nil)
 }
 
 func newMessageApplier(smsg *types.SignedMessage, processor *consensus.DefaultProcessor, st state.Tree, storageMap vm.StorageMap,
-	bh *types.BlockHeight, minerAddr address.Address) (*consensus.ApplicationResult, error) {
-	amr, err := processor.ApplyMessagesAndPayRewards(context.Background(), st, storageMap, []*types.SignedMessage{smsg}, minerAddr, bh, nil)
+	bh *types.BlockHeight, minerAddr address.Address, ancestors []types.TipSet) (*consensus.ApplicationResult, error) {
+	amr, err := processor.ApplyMessagesAndPayRewards(context.Background(), st, storageMap, []*types.SignedMessage{smsg}, minerAddr, bh, ancestors)
 
 	if len(amr.Results) > 0 {
 		return amr.Results[0], err
@@ -188,6 +200,16 @@ func CreateAndApplyTestMessage(t *testing.T, st state.Tree, vms vm.StorageMap, t
 	return ApplyTestMessage(st, vms, msg, types.NewBlockHeight(bh))
 }
 
+// CreateAndApplyTestMessageWithAncestors wraps the given parameters in a
+// message and calls ApplyTestMessageWithAncestors
+func CreateAndApplyTestMessageWithAncestors(t *testing.T, st state.Tree, vms vm.StorageMap, to address.Address, val, bh uint64, ancestors []types.TipSet, method string, params ...interface{}) (*consensus.ApplicationResult, error) {
+	t.Helper()
+
+	pdata := actor.MustConvertParams(params...)
+	msg := types.NewMessage(address.TestAddress, to, 0, types.NewAttoFILFromFIL(val), method, pdata)
+	return ApplyTestMessageWithAncestors(st, vms, msg, types.NewBlockHeight(bh), ancestors)
+}
+
 func newTestApplier() *consensus.DefaultProcessor {
 	return consensus.NewConfiguredProcessor(&TestSignedMessageValidator{}, &TestBlockRewarder{})
 }